@@ -21,30 +21,100 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/check"
+	"github.com/bhojpur/web/pkg/client/httplib"
 )
 
+var checkCmdOpts struct {
+	Endpoint string
+	Format   string
+	Output   string
+	Insecure bool
+}
+
 // checkCmd represents the check command
 var checkCmd = &cobra.Command{
-	Use:   "check",
+	Use:   "check <suite.yaml|suite.json>",
 	Short: "To check a target server, application or service instance",
+	Long: `Runs a suite of HTTP checks against a server, application or service instance.
+Every check sends a request and asserts on the status code, headers, JSONPath or
+XPath values of the body and the latency. The command exits non-zero if any check
+fails, so it can gate deployments.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("check called")
+		suite, err := check.LoadSuite(args[0])
+		if err != nil {
+			log.WithError(err).Fatal("cannot load check suite")
+		}
+		if checkCmdOpts.Endpoint != "" {
+			suite.Endpoint = checkCmdOpts.Endpoint
+		}
+		var opts []httplib.ClientOption
+		if checkCmdOpts.Insecure {
+			opts = append(opts, httplib.WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}))
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt)
+			<-sigs
+			cancel()
+		}()
+
+		report, err := suite.Run(ctx, opts...)
+		if report == nil {
+			log.WithError(err).Fatal("cannot run check suite")
+		}
+		if err != nil {
+			log.WithError(err).Warn("checks interrupted, reporting partial results")
+		}
+
+		var out io.Writer = os.Stdout
+		if checkCmdOpts.Output != "" {
+			f, err := os.Create(checkCmdOpts.Output)
+			if err != nil {
+				log.WithError(err).Fatal("cannot create report file")
+			}
+			defer f.Close()
+			out = f
+		}
+		switch checkCmdOpts.Format {
+		case "text":
+			err = report.WriteText(out)
+		case "json":
+			err = report.WriteJSON(out)
+		case "junit":
+			err = report.WriteJUnit(out)
+		default:
+			log.Fatalf("unknown report format: %s", checkCmdOpts.Format)
+		}
+		if err != nil {
+			log.WithError(err).Fatal("cannot write report")
+		}
+		if !report.Passed() {
+			fmt.Fprintf(os.Stderr, "%d of %d checks failed\n", report.Failed(), len(report.Results))
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(checkCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// checkCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// checkCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	checkCmd.Flags().StringVarP(&checkCmdOpts.Endpoint, "endpoint", "e", "", "endpoint to check instead of the one of the suite")
+	checkCmd.Flags().StringVarP(&checkCmdOpts.Format, "format", "f", "text", "report format: text, json or junit")
+	checkCmd.Flags().StringVarP(&checkCmdOpts.Output, "output", "o", "", "write the report to this file instead of stdout")
+	checkCmd.Flags().BoolVar(&checkCmdOpts.Insecure, "insecure", false, "do not validate TLS/SSL certificates")
 }
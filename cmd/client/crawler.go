@@ -21,30 +21,131 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/client/httplib"
+	logfilter "github.com/bhojpur/web/pkg/client/httplib/filter/log"
+	"github.com/bhojpur/web/pkg/crawler"
 )
 
+var crawlerCmdOpts struct {
+	Depth        int
+	AllowedHosts []string
+	NoExternal   bool
+	IgnoreRobots bool
+	Slow         time.Duration
+	Concurrency  int
+	Timeout      time.Duration
+	UserAgent    string
+	Insecure     bool
+	Format       string
+	Output       string
+	FailOn       []string
+	LogRequests  bool
+}
+
 // crawlerCmd represents the crawler command
 var crawlerCmd = &cobra.Command{
-	Use:   "crawler",
+	Use:   "crawler <url>",
 	Short: "To crawl over specified server, application or service instance",
+	Long: `Crawls a site from the given URL and checks every link and asset it references.
+Broken links, redirect chains, slow pages and mixed content are reported as JSON
+or JUnit XML. The command exits non-zero if issues of the --fail-on kinds are found.`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("crawl called")
+		opts := []crawler.Option{
+			crawler.WithMaxDepth(crawlerCmdOpts.Depth),
+			crawler.WithAllowedHosts(crawlerCmdOpts.AllowedHosts...),
+			crawler.WithExternal(!crawlerCmdOpts.NoExternal),
+			crawler.WithRobots(!crawlerCmdOpts.IgnoreRobots),
+			crawler.WithSlowThreshold(crawlerCmdOpts.Slow),
+			crawler.WithConcurrency(crawlerCmdOpts.Concurrency),
+			crawler.WithTimeout(crawlerCmdOpts.Timeout),
+		}
+		if crawlerCmdOpts.UserAgent != "" {
+			opts = append(opts, crawler.WithUserAgent(crawlerCmdOpts.UserAgent))
+		}
+		if crawlerCmdOpts.Insecure {
+			opts = append(opts, crawler.WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}))
+		}
+		if crawlerCmdOpts.LogRequests {
+			opts = append(opts, crawler.WithFilterChains(logfilter.NewFilterChainBuilder().FilterChain))
+		}
+		c, err := crawler.NewCrawler(args[0], opts...)
+		if err != nil {
+			log.WithError(err).Fatal("cannot create crawler")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, os.Interrupt)
+			<-sigs
+			cancel()
+		}()
+
+		report, err := c.Run(ctx)
+		if err != nil {
+			log.WithError(err).Warn("crawl interrupted, reporting partial results")
+		}
+
+		var out io.Writer = os.Stdout
+		if crawlerCmdOpts.Output != "" {
+			f, err := os.Create(crawlerCmdOpts.Output)
+			if err != nil {
+				log.WithError(err).Fatal("cannot create report file")
+			}
+			defer f.Close()
+			out = f
+		}
+		switch crawlerCmdOpts.Format {
+		case "json":
+			err = report.WriteJSON(out)
+		case "junit":
+			err = report.WriteJUnit(out)
+		default:
+			log.Fatalf("unknown report format: %s", crawlerCmdOpts.Format)
+		}
+		if err != nil {
+			log.WithError(err).Fatal("cannot write report")
+		}
+
+		var failOn []crawler.IssueKind
+		for _, k := range crawlerCmdOpts.FailOn {
+			failOn = append(failOn, crawler.IssueKind(strings.TrimSpace(k)))
+		}
+		if n := report.Count(failOn...); len(failOn) > 0 && n > 0 {
+			fmt.Fprintf(os.Stderr, "%d pages checked, %d issues\n", len(report.Pages), n)
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(crawlerCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// crawlerCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// crawlerCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	crawlerCmd.Flags().IntVar(&crawlerCmdOpts.Depth, "depth", 3, "maximum number of links away from the start page to crawl")
+	crawlerCmd.Flags().StringSliceVar(&crawlerCmdOpts.AllowedHosts, "allow-host", nil, "additional host whose pages are crawled (can be used multiple times)")
+	crawlerCmd.Flags().BoolVar(&crawlerCmdOpts.NoExternal, "no-external", false, "do not check references to other hosts")
+	crawlerCmd.Flags().BoolVar(&crawlerCmdOpts.IgnoreRobots, "ignore-robots", false, "do not honor robots.txt")
+	crawlerCmd.Flags().DurationVar(&crawlerCmdOpts.Slow, "slow", 2*time.Second, "report pages taking longer than this")
+	crawlerCmd.Flags().IntVar(&crawlerCmdOpts.Concurrency, "concurrency", 4, "number of parallel requests")
+	crawlerCmd.Flags().DurationVar(&crawlerCmdOpts.Timeout, "timeout", 30*time.Second, "connect and read/write timeout of every request")
+	crawlerCmd.Flags().StringVar(&crawlerCmdOpts.UserAgent, "user-agent", httplib.GetDefaultSetting().UserAgent, "user agent of the requests, also used for robots.txt")
+	crawlerCmd.Flags().BoolVar(&crawlerCmdOpts.Insecure, "insecure", false, "do not validate TLS/SSL certificates")
+	crawlerCmd.Flags().StringVarP(&crawlerCmdOpts.Format, "format", "f", "json", "report format: json or junit")
+	crawlerCmd.Flags().StringVarP(&crawlerCmdOpts.Output, "output", "o", "", "write the report to this file instead of stdout")
+	crawlerCmd.Flags().StringSliceVar(&crawlerCmdOpts.FailOn, "fail-on", []string{string(crawler.BrokenLink), string(crawler.MixedContent)}, "issue kinds that make the command fail (broken_link, redirect_chain, slow_page, mixed_content)")
+	crawlerCmd.Flags().BoolVar(&crawlerCmdOpts.LogRequests, "log-requests", false, "log every request and response")
 }
@@ -21,16 +21,22 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
 	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/perftest"
 )
 
 var perftestCmdOpts struct {
@@ -40,186 +46,237 @@ var perftestCmdOpts struct {
 	Headers     []string
 	NoGzip      bool
 	SecureTLS   bool
+	Mode        string
+	Rate        float64
+	Stages      []string
+	Duration    time.Duration
+	Method      string
+	Body        string
+	Vars        []string
+	MaxInFlight int
+	Timeout     time.Duration
+	Label       string
+	Format      string
+	Output      string
 }
 
 // perftestCmd represents the perftest command
 var perftestCmd = &cobra.Command{
-	Use:   "perftest",
+	Use:   "perftest <url>",
 	Short: "Execute performance tests over servers, applications or services",
+	Long: `Generates load against the given URL and reports latency percentiles and a
+breakdown by status code.
+
+In concurrency mode (closed model) a number of connections send requests back to
+back. In rate mode (open model) requests are started at --rate per second whether
+or not earlier ones returned, and latency is measured from the time a request was
+due. Both modes ramp linearly through --stage duration:target steps.
+
+The URL, --header values and --body are Go templates evaluated for every request,
+with {{.Seq}}, {{.Vars.name}} (set with --var name=value), {{rand 1 100}},
+{{pick "a" "b"}}, {{uuid}}, {{now}} and {{env "NAME"}}.
+
+Results are written as text, JSON or CSV. CSV output is appended to the -o file
+so that runs of different releases can be compared.`,
+	Example: `  webctl perftest --num-requests 1000 --concurrent 10 http://localhost:8080/
+  webctl perftest --mode rate --rate 50 --stage 30s:200 --stage 1m:200 \
+    --method POST --body '{"id": "{{uuid}}"}' http://localhost:8080/posts
+  webctl perftest --duration 1m --concurrent 20 --label v1.2.0 -f csv -o runs.csv \
+    'http://localhost:8080/posts/{{rand 1 100}}'`,
+	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		testing(args)
+		testing(cmd, args[0])
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(perftestCmd)
 
-	var numRequests int
-	webNumRequests := os.Getenv("WEB_NUM_REQUESTS")
-	if webNumRequests == "" {
-		numRequests = 1
-	}
-	var concurrent int
-	webConcurrent := os.Getenv("WEB_CONCURRENT")
-	if webConcurrent == "" {
-		concurrent = 1
-	}
-	var keepAlive bool
-	webKeepAlive := os.Getenv("WEB_KEEP_ALIVE")
-	if webKeepAlive == "" {
-		keepAlive = false
-	}
+	numRequests := envInt("WEB_NUM_REQUESTS", 0)
+	concurrent := envInt("WEB_CONCURRENT", 1)
+	keepAlive := envBool("WEB_KEEP_ALIVE", false)
 	var headers []string
-	webHeaders := os.Getenv("WEB_HEADERS")
-	if webHeaders == "" {
-		headers = nil
-	}
-	var noGzip bool
-	webNoGzip := os.Getenv("WEB_NO_GZIP")
-	if webNoGzip == "" {
-		noGzip = false
-	}
-	var secureTLS bool
-	webSecureTLS := os.Getenv("WEB_SECURE_TLS")
-	if webSecureTLS == "" {
-		secureTLS = false
-	}
-	perftestCmd.PersistentFlags().IntVar(&perftestCmdOpts.NumRequests, "num-requests", numRequests, "Number of requests to make")
-	perftestCmd.PersistentFlags().IntVar(&perftestCmdOpts.Concurrent, "concurrent", concurrent, "Number of concurrent connections to make")
-	perftestCmd.PersistentFlags().BoolVar(&perftestCmdOpts.KeepAlive, "keep-alive", keepAlive, "Use keep alive connection")
-	perftestCmd.PersistentFlags().StringArrayVar(&perftestCmdOpts.Headers, "header", headers, "Header to include in request (can be used multiple times)")
-	perftestCmd.PersistentFlags().BoolVar(&perftestCmdOpts.KeepAlive, "no-gzip", noGzip, "Disable gzip accept encoding")
-	perftestCmd.PersistentFlags().BoolVar(&perftestCmdOpts.KeepAlive, "secure-tls", secureTLS, "Validate TLS/SSL certificates")
-}
+	if webHeaders := os.Getenv("WEB_HEADERS"); webHeaders != "" {
+		headers = strings.Split(webHeaders, "\n")
+	}
+	noGzip := envBool("WEB_NO_GZIP", false)
+	secureTLS := envBool("WEB_SECURE_TLS", false)
 
-type result struct {
-	duration   time.Duration
-	statusCode int
-	bytesRead  int
-	err        error
+	flags := perftestCmd.PersistentFlags()
+	flags.IntVar(&perftestCmdOpts.NumRequests, "num-requests", numRequests, "Number of requests to make, 0 for no limit (defaults to WEB_NUM_REQUESTS env var)")
+	flags.IntVar(&perftestCmdOpts.Concurrent, "concurrent", concurrent, "Number of concurrent connections to make in concurrency mode (defaults to WEB_CONCURRENT env var)")
+	flags.BoolVar(&perftestCmdOpts.KeepAlive, "keep-alive", keepAlive, "Use keep alive connection (defaults to WEB_KEEP_ALIVE env var)")
+	flags.StringArrayVar(&perftestCmdOpts.Headers, "header", headers, "Header to include in request (can be used multiple times, defaults to newline separated WEB_HEADERS env var)")
+	flags.BoolVar(&perftestCmdOpts.NoGzip, "no-gzip", noGzip, "Disable gzip accept encoding (defaults to WEB_NO_GZIP env var)")
+	flags.BoolVar(&perftestCmdOpts.SecureTLS, "secure-tls", secureTLS, "Validate TLS/SSL certificates (defaults to WEB_SECURE_TLS env var)")
+	flags.StringVar(&perftestCmdOpts.Mode, "mode", "", "Load model: concurrency or rate (defaults to rate if --rate is set)")
+	flags.Float64Var(&perftestCmdOpts.Rate, "rate", 0, "Requests per second to start in rate mode")
+	flags.StringArrayVar(&perftestCmdOpts.Stages, "stage", nil, "Ramp linearly to a target over a duration, as duration:target (can be used multiple times)")
+	flags.DurationVar(&perftestCmdOpts.Duration, "duration", 0, "Length of the test (defaults to the sum of the stages)")
+	flags.StringVar(&perftestCmdOpts.Method, "method", http.MethodGet, "HTTP method of the requests")
+	flags.StringVar(&perftestCmdOpts.Body, "body", "", "Request body template, or @file to read it from a file")
+	flags.StringArrayVar(&perftestCmdOpts.Vars, "var", nil, "Template variable as name=value (can be used multiple times)")
+	flags.IntVar(&perftestCmdOpts.MaxInFlight, "max-in-flight", 0, "Maximum outstanding requests in rate mode, requests over it are dropped")
+	flags.DurationVar(&perftestCmdOpts.Timeout, "timeout", 30*time.Second, "Timeout of a single request")
+	flags.StringVar(&perftestCmdOpts.Label, "label", "", "Name of the run in exported results, e.g. the release under test")
+	flags.StringVarP(&perftestCmdOpts.Format, "format", "f", "text", "Result format: text, json or csv")
+	flags.StringVarP(&perftestCmdOpts.Output, "output", "o", "", "Write the result to a file instead of stdout, csv results are appended")
 }
 
-type Summary struct {
-	numRequests          int
-	totalRequestDuration time.Duration
-	avgRequestDuration   time.Duration
-	duration             time.Duration
-	numSuccesses         int
-	numFailures          int
-	numUnavailables      int
-	requestsPerSecond    float64
-	totalBytesRead       int
+func envInt(name string, def int) int {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		log.WithError(err).Warnf("ignoring invalid %s", name)
+		return def
+	}
+	return i
 }
 
-var requestChan chan *http.Request
-var resultChan chan *result
-var summaryChan chan *Summary
-var client *http.Client
+func envBool(name string, def bool) bool {
+	v := os.Getenv(name)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.WithError(err).Warnf("ignoring invalid %s", name)
+		return def
+	}
+	return b
+}
 
-func doRequests() {
-	for request := range requestChan {
-		startTime := time.Now()
-		response, err := client.Do(request)
+func perftestConfig(cmd *cobra.Command, target string) (*perftest.Config, error) {
+	opts := perftestCmdOpts
+	cfg := &perftest.Config{
+		Mode:        opts.Mode,
+		Duration:    opts.Duration,
+		MaxRequests: int64(opts.NumRequests),
+		MaxInFlight: opts.MaxInFlight,
+		Label:       opts.Label,
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = perftest.ModeConcurrency
+		if cmd.Flags().Changed("rate") {
+			cfg.Mode = perftest.ModeRate
+		}
+	}
+	cfg.Start = float64(opts.Concurrent)
+	if cfg.Mode == perftest.ModeRate {
+		cfg.Start = opts.Rate
+	}
+	for _, s := range opts.Stages {
+		stage, err := perftest.ParseStage(s)
 		if err != nil {
-			resultChan <- &result{err: err}
-			continue
+			return nil, err
+		}
+		cfg.Stages = append(cfg.Stages, stage)
+	}
+	if cfg.Duration == 0 && cfg.MaxRequests == 0 && len(cfg.Stages) == 0 {
+		// like before, a single request unless told otherwise
+		cfg.MaxRequests = 1
+	}
 
+	vars := make(map[string]string)
+	for _, v := range opts.Vars {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid variable %q, expected name=value", v)
 		}
-		bytesRead, err := io.Copy(ioutil.Discard, response.Body)
+		vars[parts[0]] = parts[1]
+	}
+	body := opts.Body
+	if strings.HasPrefix(body, "@") {
+		data, err := ioutil.ReadFile(body[1:])
 		if err != nil {
-			resultChan <- &result{err: err}
-			continue
+			return nil, err
 		}
+		body = string(data)
+	}
+	tpl, err := perftest.NewTemplate(opts.Method, target, opts.Headers, body, vars, !opts.NoGzip)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Template = tpl
 
-		resultChan <- &result{duration: time.Since(startTime), statusCode: response.StatusCode, bytesRead: int(bytesRead)}
+	conns := opts.Concurrent
+	if opts.MaxInFlight > conns {
+		conns = opts.MaxInFlight
 	}
+	cfg.Client = &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			DisableKeepAlives:   !opts.KeepAlive,
+			MaxIdleConnsPerHost: conns,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: !opts.SecureTLS},
+			DisableCompression:  true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return cfg, nil
 }
 
-func generateRequests(target string, headers []string, numRequests int) {
-	request, err := http.NewRequest("GET", target, nil)
+func testing(cmd *cobra.Command, target string) {
+	switch perftestCmdOpts.Format {
+	case "text", "json", "csv":
+	default:
+		log.Fatalf("unknown result format: %s", perftestCmdOpts.Format)
+	}
+	cfg, err := perftestConfig(cmd, target)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Unable to create HTTP request - %v\n", err)
-		os.Exit(1)
+		log.WithError(err).Fatal("invalid test")
 	}
 
-	if !perftestCmdOpts.NoGzip {
-		request.Header.Add("Accept-Encoding", "gzip")
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		<-sigs
+		cancel()
+	}()
 
-	for _, h := range headers {
-		parts := strings.SplitN(h, ":", 2)
-		if len(parts) != 2 {
-			fmt.Fprintf(os.Stderr, "Invalid header - %s\n", h)
-			os.Exit(1)
-		}
-		request.Header.Add(parts[0], parts[1])
+	fmt.Fprintf(os.Stderr, "generating web load for %s in %s mode\n", target, cfg.Mode)
+	res, err := perftest.Run(ctx, cfg)
+	if err != nil {
+		log.WithError(err).Fatal("cannot run test")
 	}
-
-	for i := 0; i < numRequests; i++ {
-		requestChan <- request
+	if ctx.Err() != nil {
+		log.Warn("test interrupted, reporting partial results")
 	}
-	close(requestChan)
-}
 
-func summarizeResults(numRequests int, startTime time.Time) {
-	summary := new(Summary)
-
-	for i := 0; i < numRequests; i++ {
-		result := <-resultChan
-		summary.numRequests++
-		if result.err != nil {
-			summary.numUnavailables++
-		} else if result.statusCode >= 400 {
-			summary.numFailures++
-		} else {
-			summary.numSuccesses++
-			summary.totalRequestDuration += result.duration
-			summary.totalBytesRead += result.bytesRead
+	var out io.Writer = os.Stdout
+	header := true
+	if perftestCmdOpts.Output != "" {
+		flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if perftestCmdOpts.Format == "csv" {
+			flag = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+			if fi, err := os.Stat(perftestCmdOpts.Output); err == nil && fi.Size() > 0 {
+				header = false
+			}
+		}
+		f, err := os.OpenFile(perftestCmdOpts.Output, flag, 0644)
+		if err != nil {
+			log.WithError(err).Fatal("cannot create result file")
 		}
+		defer f.Close()
+		out = f
 	}
-
-	summary.duration = time.Since(startTime)
-	if 0 < summary.numSuccesses {
-		summary.avgRequestDuration = time.Duration(int64(summary.totalRequestDuration) / int64(summary.numSuccesses))
+	switch perftestCmdOpts.Format {
+	case "json":
+		err = res.WriteJSON(out)
+	case "csv":
+		err = res.WriteCSV(out, header)
+	default:
+		err = res.WriteText(out)
+	}
+	if err != nil {
+		log.WithError(err).Fatal("cannot write result")
 	}
-	summary.requestsPerSecond = float64(summary.numSuccesses) / summary.duration.Seconds()
-	summaryChan <- summary
-}
-
-func testing(args []string) {
-	if len(args) != 1 {
-		fmt.Fprintln(os.Stderr, "Requires one target URL")
-		return
-	}
-	target := args[0]
-	fmt.Println("generating web load for", target)
-	requestChan = make(chan *http.Request)
-	resultChan = make(chan *result)
-	summaryChan = make(chan *Summary)
-	transport := &http.Transport{
-		DisableKeepAlives:   !perftestCmdOpts.KeepAlive,
-		MaxIdleConnsPerHost: perftestCmdOpts.Concurrent,
-		TLSClientConfig:     &tls.Config{InsecureSkipVerify: !perftestCmdOpts.SecureTLS},
-		DisableCompression:  true,
-	}
-	client = &http.Client{Transport: transport}
-
-	startTime := time.Now()
-
-	for i := 0; i < perftestCmdOpts.Concurrent; i++ {
-		go doRequests()
-	}
-	go generateRequests(target, perftestCmdOpts.Headers, perftestCmdOpts.NumRequests)
-	go summarizeResults(perftestCmdOpts.NumRequests, startTime)
-
-	summary := <-summaryChan
-
-	fmt.Printf("# Requests: %v\n", summary.numRequests)
-	fmt.Printf("# Successes: %v\n", summary.numSuccesses)
-	fmt.Printf("# Failures: %v\n", summary.numFailures)
-	fmt.Printf("# Unavailable: %v\n", summary.numUnavailables)
-	fmt.Printf("Duration: %v\n", summary.duration)
-	fmt.Printf("Average Request Duration: %v\n", summary.avgRequestDuration)
-	fmt.Printf("Requests Per Second: %f\n", summary.requestsPerSecond)
-	fmt.Printf("Bytes Received (excluding headers): %d\n", summary.totalBytesRead)
 }
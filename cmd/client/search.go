@@ -21,30 +21,242 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/crawler"
+	"github.com/bhojpur/web/pkg/search"
 )
 
+var searchCmdOpts struct {
+	Index string
+}
+
+var searchIndexCmdOpts struct {
+	BaseURL      string
+	Reset        bool
+	JSON         string
+	Depth        int
+	AllowedHosts []string
+	IgnoreRobots bool
+	Concurrency  int
+	Insecure     bool
+}
+
+var searchQueryCmdOpts struct {
+	Limit  int
+	Format string
+}
+
 // searchCmd represents the search command
 var searchCmd = &cobra.Command{
 	Use:   "search",
-	Short: "To find data from traget server, application or service instance",
+	Short: "To find data from target server, application or service instance",
+	Long: `Builds a full-text index of a site on disk and answers ranked queries with snippets.
+The index is built by crawling a site or by reading a directory of HTML and Markdown
+files, such as a pre-rendered Bhojpur Web application. It can be exported as a static
+JSON file for a frontend to search on the client side.`,
+	Example: `  webctl search index https://docs.bhojpur.net
+  webctl search index --base-url https://docs.bhojpur.net ./web
+  webctl search query reverse proxy
+  webctl search export -o web/search.json`,
+}
+
+var searchIndexCmd = &cobra.Command{
+	Use:   "index <url|dir>",
+	Short: "Add a crawled site or a directory of documents to the index",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		idx := search.NewIndex()
+		if !searchIndexCmdOpts.Reset {
+			if loaded, err := search.Load(searchCmdOpts.Index); err == nil {
+				idx = loaded
+			} else if !os.IsNotExist(err) {
+				log.WithError(err).Fatal("cannot load index, use --reset to start over")
+			}
+		}
+
+		var n int
+		if fi, err := os.Stat(args[0]); err == nil && fi.IsDir() {
+			n, err = idx.AddDir(args[0], searchIndexCmdOpts.BaseURL)
+			if err != nil {
+				log.WithError(err).Fatal("cannot index directory")
+			}
+		} else {
+			n = crawlIndex(idx, args[0])
+		}
+
+		if err := idx.Save(searchCmdOpts.Index); err != nil {
+			log.WithError(err).Fatal("cannot save index")
+		}
+		if searchIndexCmdOpts.JSON != "" {
+			exportIndex(idx, searchIndexCmdOpts.JSON)
+		}
+		fmt.Printf("indexed %d documents, %d in %s\n", n, idx.Len(), searchCmdOpts.Index)
+	},
+}
+
+// crawlIndex adds the pages of the site at url to idx
+func crawlIndex(idx *search.Index, url string) int {
+	var (
+		lock sync.Mutex
+		n    int
+	)
+	opts := []crawler.Option{
+		crawler.WithMaxDepth(searchIndexCmdOpts.Depth),
+		crawler.WithAllowedHosts(searchIndexCmdOpts.AllowedHosts...),
+		crawler.WithExternal(false),
+		crawler.WithRobots(!searchIndexCmdOpts.IgnoreRobots),
+		crawler.WithConcurrency(searchIndexCmdOpts.Concurrency),
+		crawler.WithSlowThreshold(0),
+		crawler.WithPageHandler(func(page *crawler.Page, body []byte) {
+			lock.Lock()
+			defer lock.Unlock()
+			if idx.AddHTML(page.URL, body) {
+				n++
+			}
+		}),
+	}
+	if searchIndexCmdOpts.Insecure {
+		opts = append(opts, crawler.WithTLSClientConfig(&tls.Config{InsecureSkipVerify: true}))
+	}
+	c, err := crawler.NewCrawler(url, opts...)
+	if err != nil {
+		log.WithError(err).Fatal("cannot create crawler")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, os.Interrupt)
+		<-sigs
+		cancel()
+	}()
+
+	report, err := c.Run(ctx)
+	if err != nil {
+		log.WithError(err).Warn("crawl interrupted, saving the pages indexed so far")
+	}
+	if broken := report.Count(crawler.BrokenLink); broken > 0 {
+		log.Warnf("%d broken links, run webctl crawler for details", broken)
+	}
+	return n
+}
+
+var searchQueryCmd = &cobra.Command{
+	Use:   "query <terms>...",
+	Short: "Search the index",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		idx, err := search.Load(searchCmdOpts.Index)
+		if err != nil {
+			log.WithError(err).Fatal("cannot load index")
+		}
+		hits := idx.Search(strings.Join(args, " "), searchQueryCmdOpts.Limit)
+
+		switch searchQueryCmdOpts.Format {
+		case "json":
+			if hits == nil {
+				hits = []*search.Hit{}
+			}
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(hits); err != nil {
+				log.WithError(err).Fatal("cannot write results")
+			}
+		case "text":
+			if len(hits) == 0 {
+				fmt.Println("no results")
+				return
+			}
+			bold := isTerminal(os.Stdout)
+			for i, hit := range hits {
+				fmt.Printf("%d. %s\n   %s\n   %s\n\n", i+1, hit.Title, hit.URL, highlight(hit, bold))
+			}
+		default:
+			log.Fatalf("unknown result format: %s", searchQueryCmdOpts.Format)
+		}
+	},
+}
+
+// highlight marks the matched terms of the snippet of hit
+func highlight(hit *search.Hit, bold bool) string {
+	if !bold {
+		return hit.Snippet
+	}
+	var b strings.Builder
+	last := 0
+	for _, h := range hit.Highlights {
+		b.WriteString(hit.Snippet[last:h[0]])
+		b.WriteString("\x1b[1m" + hit.Snippet[h[0]:h[1]] + "\x1b[0m")
+		last = h[1]
+	}
+	b.WriteString(hit.Snippet[last:])
+	return b.String()
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+var searchExportOutput string
+
+var searchExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Write the index as a static JSON file for client-side search",
+	Args:  cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("search called")
+		idx, err := search.Load(searchCmdOpts.Index)
+		if err != nil {
+			log.WithError(err).Fatal("cannot load index")
+		}
+		exportIndex(idx, searchExportOutput)
 	},
 }
 
+func exportIndex(idx *search.Index, filename string) {
+	f, err := os.Create(filename)
+	if err != nil {
+		log.WithError(err).Fatal("cannot create JSON index")
+	}
+	defer f.Close()
+	if err := idx.WriteJSON(f); err != nil {
+		log.WithError(err).Fatal("cannot write JSON index")
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(searchCmd)
+	searchCmd.AddCommand(searchIndexCmd, searchQueryCmd, searchExportCmd)
+
+	index := os.Getenv("WEB_SEARCH_INDEX")
+	if index == "" {
+		index = "web-search.idx"
+	}
+	searchCmd.PersistentFlags().StringVarP(&searchCmdOpts.Index, "index", "i", index, "index file (defaults to WEB_SEARCH_INDEX env var)")
 
-	// Here you will define your flags and configuration settings.
+	searchIndexCmd.Flags().StringVar(&searchIndexCmdOpts.BaseURL, "base-url", "", "URL prefix of the documents of a directory")
+	searchIndexCmd.Flags().BoolVar(&searchIndexCmdOpts.Reset, "reset", false, "start a new index instead of adding to the existing one")
+	searchIndexCmd.Flags().StringVar(&searchIndexCmdOpts.JSON, "json", "", "also write the index as a static JSON file")
+	searchIndexCmd.Flags().IntVar(&searchIndexCmdOpts.Depth, "depth", 5, "maximum number of links away from the start page to crawl")
+	searchIndexCmd.Flags().StringSliceVar(&searchIndexCmdOpts.AllowedHosts, "allow-host", nil, "additional host whose pages are indexed (can be used multiple times)")
+	searchIndexCmd.Flags().BoolVar(&searchIndexCmdOpts.IgnoreRobots, "ignore-robots", false, "crawl pages disallowed by robots.txt")
+	searchIndexCmd.Flags().IntVar(&searchIndexCmdOpts.Concurrency, "concurrency", 4, "number of parallel requests")
+	searchIndexCmd.Flags().BoolVar(&searchIndexCmdOpts.Insecure, "insecure", false, "skip TLS certificate verification")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// searchCmd.PersistentFlags().String("foo", "", "A help for foo")
+	searchQueryCmd.Flags().IntVarP(&searchQueryCmdOpts.Limit, "limit", "n", 10, "maximum number of results")
+	searchQueryCmd.Flags().StringVarP(&searchQueryCmdOpts.Format, "format", "f", "text", "result format: text or json")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// searchCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	searchExportCmd.Flags().StringVarP(&searchExportOutput, "output", "o", "search.json", "JSON index file")
 }
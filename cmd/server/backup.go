@@ -21,30 +21,233 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/backup"
+	"github.com/bhojpur/web/pkg/client/orm"
+	"github.com/bhojpur/web/pkg/task"
 )
 
+var backupCmdOpts struct {
+	Repository string
+	Name       string
+	Databases  []string
+	Dirs       []string
+	Retention  backup.Retention
+}
+
 // backupCmd represents the backup command
 var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Manage server, application and/or data backup",
+	Long: `Snapshots the databases, the conf directory, static, upload and file cache
+directories of an application into versioned, compressed and checksummed archives
+kept in a repository directory.
+
+Databases are given as alias=driver:datasource, directories as name=path. Sqlite
+databases are copied natively, other databases are dumped table by table.`,
+	Example: `  websvr backup create --name blog --db default=sqlite3:data/blog.db \
+    --dir conf=conf --dir upload=static/upload --keep-last 3 --keep-daily 7
+  websvr backup create --name blog --db default=sqlite3:data/blog.db --schedule "0 0 3 * * *"
+  websvr backup list
+  websvr backup restore --name blog --db default=sqlite3:data/blog.db latest`,
+}
+
+var backupCreateCmdOpts struct {
+	Schedule string
+}
+
+var backupCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a backup and apply the retention policy",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		b := &backup.Backup{
+			Name:       backupCmdOpts.Name,
+			Repository: backupRepository(),
+			Sources:    backupSources(),
+			Retention:  backupCmdOpts.Retention,
+		}
+		if backupCreateCmdOpts.Schedule == "" {
+			snap, err := b.Run(context.Background())
+			if err != nil {
+				log.WithError(err).Fatal("backup failed")
+			}
+			fmt.Println(snap.ID)
+			return
+		}
+
+		task.AddTask(b.Name, b.Task(backupCreateCmdOpts.Schedule))
+		task.StartTask()
+		log.WithField("schedule", backupCreateCmdOpts.Schedule).Info("backups scheduled")
+		sigs := make(chan os.Signal, 1)
+		signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+		<-sigs
+		task.StopTask()
+	},
+}
+
+var backupRestoreCmdOpts struct {
+	Only []string
+}
+
+var backupRestoreCmd = &cobra.Command{
+	Use:   "restore <id|latest>",
+	Short: "Verify a backup and restore it",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("web server backup called")
+		repo := backupRepository()
+		snap, err := repo.Get(backupCmdOpts.Name, args[0])
+		if err != nil {
+			log.WithError(err).Fatal("cannot find backup")
+		}
+		sources := backupSources()
+		if len(backupRestoreCmdOpts.Only) > 0 {
+			only := make(map[string]bool)
+			for _, name := range backupRestoreCmdOpts.Only {
+				only[name] = true
+			}
+			var selected []backup.Source
+			for _, s := range sources {
+				if only[s.Name()] {
+					selected = append(selected, s)
+				}
+			}
+			sources = selected
+		}
+		if len(sources) == 0 {
+			log.Fatal("nothing to restore")
+		}
+		if err := repo.Restore(context.Background(), snap, sources...); err != nil {
+			log.WithError(err).Fatal("restore failed")
+		}
+		for _, s := range sources {
+			log.WithField("backup", snap.ID).Infof("%s restored", s.Name())
+		}
 	},
 }
 
+var backupListCmdOpts struct {
+	Verify bool
+}
+
+var backupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the backups of the repository",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		repo := backupRepository()
+		name := ""
+		if cmd.Flags().Changed("name") {
+			name = backupCmdOpts.Name
+		}
+		snaps, err := repo.List(name)
+		if err != nil {
+			log.WithError(err).Fatal("cannot list backups")
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+		header := "ID\tCREATED\tSIZE\tFILES\tSOURCES"
+		if backupListCmdOpts.Verify {
+			header += "\tVERIFIED"
+		}
+		fmt.Fprintln(tw, header)
+		for _, s := range snaps {
+			line := fmt.Sprintf("%s\t%s\t%d\t%d\t%s", s.ID, s.Created.Local().Format(time.RFC3339),
+				s.Size, len(s.Files), strings.Join(s.Sources, ","))
+			if backupListCmdOpts.Verify {
+				if err := repo.Verify(s); err != nil {
+					line += "\t" + err.Error()
+				} else {
+					line += "\tok"
+				}
+			}
+			fmt.Fprintln(tw, line)
+		}
+	},
+}
+
+var backupPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove the backups the retention policy does not keep",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		pruned, err := backupRepository().Prune(backupCmdOpts.Name, backupCmdOpts.Retention)
+		if err != nil {
+			log.WithError(err).Fatal("prune failed")
+		}
+		for _, s := range pruned {
+			fmt.Println(s.ID)
+		}
+	},
+}
+
+func backupRepository() *backup.Repository {
+	repo, err := backup.NewRepository(backupCmdOpts.Repository)
+	if err != nil {
+		log.WithError(err).Fatal("cannot open backup repository")
+	}
+	return repo
+}
+
+// backupSources registers the databases and returns the sources of the flags
+func backupSources() []backup.Source {
+	var sources []backup.Source
+	for _, db := range backupCmdOpts.Databases {
+		parts := strings.SplitN(db, "=", 2)
+		var driver []string
+		if len(parts) == 2 {
+			driver = strings.SplitN(parts[1], ":", 2)
+		}
+		if len(driver) != 2 {
+			log.Fatalf("invalid database %q, expected alias=driver:datasource", db)
+		}
+		if err := orm.RegisterDataBase(parts[0], driver[0], driver[1]); err != nil {
+			log.WithError(err).Fatalf("cannot open database %s", parts[0])
+		}
+		sources = append(sources, backup.Database(parts[0]))
+	}
+	for _, dir := range backupCmdOpts.Dirs {
+		parts := strings.SplitN(dir, "=", 2)
+		if len(parts) != 2 {
+			log.Fatalf("invalid directory %q, expected name=path", dir)
+		}
+		sources = append(sources, backup.Dir(parts[0], parts[1]))
+	}
+	return sources
+}
+
 func init() {
 	rootCmd.AddCommand(backupCmd)
+	backupCmd.AddCommand(backupCreateCmd, backupRestoreCmd, backupListCmd, backupPruneCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// backupCmd.PersistentFlags().String("foo", "", "A help for foo")
+	repo := os.Getenv("WEB_BACKUP_REPOSITORY")
+	if repo == "" {
+		repo = "backups"
+	}
+	flags := backupCmd.PersistentFlags()
+	flags.StringVar(&backupCmdOpts.Repository, "repository", repo, "directory of the backups (defaults to WEB_BACKUP_REPOSITORY env var)")
+	flags.StringVar(&backupCmdOpts.Name, "name", "app", "name of the backups, e.g. the application name")
+	flags.StringArrayVar(&backupCmdOpts.Databases, "db", nil, "database to back up as alias=driver:datasource (can be used multiple times)")
+	flags.StringArrayVar(&backupCmdOpts.Dirs, "dir", []string{"conf=conf"}, "directory to back up as name=path (can be used multiple times)")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// backupCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	for _, c := range []*cobra.Command{backupCreateCmd, backupPruneCmd} {
+		c.Flags().IntVar(&backupCmdOpts.Retention.KeepLast, "keep-last", 0, "keep the last n backups")
+		c.Flags().IntVar(&backupCmdOpts.Retention.KeepDaily, "keep-daily", 0, "keep the last backup of the last n days")
+		c.Flags().IntVar(&backupCmdOpts.Retention.KeepWeekly, "keep-weekly", 0, "keep the last backup of the last n weeks")
+		c.Flags().IntVar(&backupCmdOpts.Retention.KeepMonthly, "keep-monthly", 0, "keep the last backup of the last n months")
+	}
+	backupCreateCmd.Flags().StringVar(&backupCreateCmdOpts.Schedule, "schedule", "", "run backups on a cron spec with seconds, e.g. \"0 0 3 * * *\", until interrupted")
+	backupRestoreCmd.Flags().StringSliceVar(&backupRestoreCmdOpts.Only, "only", nil, "restore only these sources, e.g. db-default,conf")
+	backupListCmd.Flags().BoolVar(&backupListCmdOpts.Verify, "verify", false, "verify the checksums of every backup")
 }
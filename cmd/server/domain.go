@@ -21,30 +21,288 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
+	"crypto/x509"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/bhojpur/web/pkg/domain"
 )
 
+var domainCmdOpts struct {
+	Registry string
+}
+
 // domainCmd represents the domain command
 var domainCmd = &cobra.Command{
 	Use:   "domain",
 	Short: "Manage hosted Domain of your web applications or services",
+	Long: `Maps domains to applications and manages their TLS certificates. Domains get
+certificates issued and renewed by an ACME certificate authority, Let's Encrypt by
+default, unless a custom certificate is uploaded; wildcard domains need one.
+
+A server running with the registry, websvr domain serve or an application with
+AutoTLS and DomainRegistry set, picks up the changes without a restart.`,
+	Example: `  websvr domain add shop.example.com --app http://127.0.0.1:8080
+  websvr domain cert '*.example.com' --cert example.crt --key example.key
+  websvr domain add '*.example.com' --app http://127.0.0.1:8081
+  websvr domain list
+  websvr domain serve --email admin@example.com`,
+}
+
+var domainAddCmdOpts struct {
+	App string
+}
+
+var domainAddCmd = &cobra.Command{
+	Use:   "add <domain>",
+	Short: "Add a domain, or move it to another app",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		d, err := domainRegistry().Add(args[0], domainAddCmdOpts.App)
+		if err != nil {
+			log.WithError(err).Fatal("cannot add domain")
+		}
+		log.WithFields(log.Fields{"app": d.App, "certificate": d.Certificate}).Infof("%s added", d.Name)
+	},
+}
+
+var domainRemoveCmd = &cobra.Command{
+	Use:     "remove <domain>",
+	Aliases: []string{"rm"},
+	Short:   "Remove a domain and its custom certificate",
+	Args:    cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := domainRegistry().Remove(args[0]); err != nil {
+			log.WithError(err).Fatal("cannot remove domain")
+		}
+		log.Infof("%s removed", domain.Normalize(args[0]))
+	},
+}
+
+var domainListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the domains with their apps and certificates",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		reg := domainRegistry()
+		domains, err := reg.List()
+		if err != nil {
+			log.WithError(err).Fatal("cannot list domains")
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintln(tw, "DOMAIN\tAPP\tCERTIFICATE\tISSUER\tEXPIRES")
+		for _, d := range domains {
+			issuer, expires := "-", "pending"
+			if info, err := domain.Status(reg, "", d.Name); err != nil {
+				expires = err.Error()
+			} else if !info.NotAfter.IsZero() {
+				issuer = info.Issuer
+				expires = info.NotAfter.Local().Format(time.RFC3339)
+				if time.Until(info.NotAfter) < 0 {
+					expires += " (expired)"
+				}
+			}
+			app := d.App
+			if app == "" {
+				app = "-"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", d.Name, app, d.Certificate, issuer, expires)
+		}
+	},
+}
+
+var domainCertCmdOpts struct {
+	Cert  string
+	Key   string
+	Clear bool
+}
+
+var domainCertCmd = &cobra.Command{
+	Use:   "cert <domain>",
+	Short: "Upload a custom certificate for a domain, or go back to ACME",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("domain hosting called")
+		reg := domainRegistry()
+		if domainCertCmdOpts.Clear {
+			if err := reg.ClearCertificate(args[0]); err != nil {
+				log.WithError(err).Fatal("cannot remove certificate")
+			}
+			log.Infof("%s now uses an ACME certificate", domain.Normalize(args[0]))
+			return
+		}
+		if domainCertCmdOpts.Cert == "" || domainCertCmdOpts.Key == "" {
+			log.Fatal("--cert and --key are required")
+		}
+		certPEM, err := ioutil.ReadFile(domainCertCmdOpts.Cert)
+		if err != nil {
+			log.WithError(err).Fatal("cannot read certificate")
+		}
+		keyPEM, err := ioutil.ReadFile(domainCertCmdOpts.Key)
+		if err != nil {
+			log.WithError(err).Fatal("cannot read key")
+		}
+		if err := reg.SetCertificate(args[0], certPEM, keyPEM); err != nil {
+			log.WithError(err).Fatal("cannot set certificate")
+		}
+		log.Infof("%s now uses the custom certificate", domain.Normalize(args[0]))
 	},
 }
 
+var domainServeCmdOpts struct {
+	HTTPAddr      string
+	HTTPSAddr     string
+	Email         string
+	ACMEDirectory string
+	ACMECA        string
+	RenewBefore   time.Duration
+	Watch         time.Duration
+}
+
+var domainServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Serve the domains over HTTPS, proxying requests to their apps",
+	Long: `Terminates TLS for the domains of the registry and proxies their requests to
+their apps, given as URLs. The HTTP listener answers ACME http-01 challenges and
+redirects the other requests to HTTPS. Domains and certificates changed in the
+registry are served without a restart.`,
+	Example: `  websvr domain serve --email admin@example.com
+  websvr domain serve --https :5001 --http :5002 \
+    --acme-directory https://localhost:14000/dir --acme-ca pebble.minica.pem`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := []domain.Option{
+			domain.WithEmail(domainServeCmdOpts.Email),
+			domain.WithRenewBefore(domainServeCmdOpts.RenewBefore),
+		}
+		if domainServeCmdOpts.ACMEDirectory != "" {
+			opts = append(opts, domain.WithDirectoryURL(domainServeCmdOpts.ACMEDirectory))
+		}
+		if domainServeCmdOpts.ACMECA != "" {
+			data, err := ioutil.ReadFile(domainServeCmdOpts.ACMECA)
+			if err != nil {
+				log.WithError(err).Fatal("cannot read ACME CA")
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(data) {
+				log.Fatalf("no certificate in %s", domainServeCmdOpts.ACMECA)
+			}
+			opts = append(opts, domain.WithRootCAs(pool))
+		}
+		m, err := domain.NewManager(domainRegistry(), opts...)
+		if err != nil {
+			log.WithError(err).Fatal("cannot load domains")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go m.Watch(ctx, domainServeCmdOpts.Watch)
+
+		httpsServer := &http.Server{
+			Addr:      domainServeCmdOpts.HTTPSAddr,
+			Handler:   m.Handler(newAppProxies().handler),
+			TLSConfig: m.TLSConfig(),
+		}
+		httpServer := &http.Server{Addr: domainServeCmdOpts.HTTPAddr, Handler: m.HTTPHandler(nil)}
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			<-sigs
+			log.Info("shutting down")
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			httpServer.Shutdown(ctx)
+			httpsServer.Shutdown(ctx)
+		}()
+		if domainServeCmdOpts.HTTPAddr != "" {
+			go func() {
+				if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					log.WithError(err).Fatal("HTTP server failed")
+				}
+			}()
+		}
+		log.WithFields(log.Fields{"https": httpsServer.Addr, "http": httpServer.Addr}).Info("serving domains")
+		if err := httpsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Fatal("HTTPS server failed")
+		}
+	},
+}
+
+// appProxies are the reverse proxies to the apps of the domains
+type appProxies struct {
+	mu      sync.Mutex
+	proxies map[string]http.Handler
+}
+
+func newAppProxies() *appProxies {
+	return &appProxies{proxies: make(map[string]http.Handler)}
+}
+
+func (p *appProxies) handler(app string) http.Handler {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if h, ok := p.proxies[app]; ok {
+		return h
+	}
+	target, err := url.Parse(app)
+	if err != nil || target.Host == "" || !strings.HasPrefix(target.Scheme, "http") {
+		log.WithField("app", app).Warn("app is not a URL, its domains are not served")
+		p.proxies[app] = nil
+		return nil
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Header.Set("X-Forwarded-Proto", "https")
+	}
+	p.proxies[app] = proxy
+	return proxy
+}
+
+func domainRegistry() *domain.Registry {
+	reg, err := domain.OpenRegistry(domainCmdOpts.Registry)
+	if err != nil {
+		log.WithError(err).Fatal("cannot open domain registry")
+	}
+	return reg
+}
+
 func init() {
 	rootCmd.AddCommand(domainCmd)
+	domainCmd.AddCommand(domainAddCmd, domainRemoveCmd, domainListCmd, domainCertCmd, domainServeCmd)
 
-	// Here you will define your flags and configuration settings.
+	registry := os.Getenv("WEB_DOMAIN_REGISTRY")
+	if registry == "" {
+		registry = "conf/domains"
+	}
+	domainCmd.PersistentFlags().StringVar(&domainCmdOpts.Registry, "registry", registry, "directory of the domain registry (defaults to WEB_DOMAIN_REGISTRY env var)")
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// domainCmd.PersistentFlags().String("foo", "", "A help for foo")
+	domainAddCmd.Flags().StringVar(&domainAddCmdOpts.App, "app", "", "app serving the domain, e.g. the URL of its server")
+	domainCertCmd.Flags().StringVar(&domainCertCmdOpts.Cert, "cert", "", "PEM file of the certificate chain")
+	domainCertCmd.Flags().StringVar(&domainCertCmdOpts.Key, "key", "", "PEM file of the private key")
+	domainCertCmd.Flags().BoolVar(&domainCertCmdOpts.Clear, "clear", false, "remove the custom certificate and use ACME again")
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// domainCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	flags := domainServeCmd.Flags()
+	flags.StringVar(&domainServeCmdOpts.HTTPSAddr, "https", ":443", "address of the HTTPS listener")
+	flags.StringVar(&domainServeCmdOpts.HTTPAddr, "http", ":80", "address of the HTTP listener for http-01 challenges and redirects, empty to disable")
+	flags.StringVar(&domainServeCmdOpts.Email, "email", "", "contact email of the ACME account")
+	flags.StringVar(&domainServeCmdOpts.ACMEDirectory, "acme-directory", os.Getenv("WEB_ACME_DIRECTORY"), "ACME directory URL, Let's Encrypt by default (defaults to WEB_ACME_DIRECTORY env var)")
+	flags.StringVar(&domainServeCmdOpts.ACMECA, "acme-ca", "", "PEM file of the CA of the ACME server, for test servers such as pebble")
+	flags.DurationVar(&domainServeCmdOpts.RenewBefore, "renew-before", 30*24*time.Hour, "renew ACME certificates this long before they expire")
+	flags.DurationVar(&domainServeCmdOpts.Watch, "watch", domain.DefaultWatchInterval, "how often the registry is checked for changes")
 }
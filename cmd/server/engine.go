@@ -21,30 +21,218 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+
+	v1 "github.com/bhojpur/web/pkg/api/v1"
+	"github.com/bhojpur/web/pkg/supervisor"
 )
 
+var engineCmdOpts struct {
+	Host string
+}
+
 // engineCmd represents the engine command
 var engineCmd = &cobra.Command{
 	Use:   "engine",
 	Short: "Manage a Server Engine that hosts distributed web applications",
+}
+
+// RegisterEngineApps is called by engine serve before the supervisor
+// starts. Programs embedding the websvr commands set it to register their
+// applications with supervisor.RegisterApp, so that the app: engine specs
+// resolve; process: specs work without it.
+var RegisterEngineApps func()
+
+var engineServeCmdOpts struct {
+	Addr string
+}
+
+// engineServeCmd represents the engine serve command
+var engineServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Runs the engine supervisor serving the WebService gRPC API",
+	Run: func(cmd *cobra.Command, args []string) {
+		lis, err := net.Listen("tcp", engineServeCmdOpts.Addr)
+		if err != nil {
+			log.WithError(err).Fatal("cannot listen")
+		}
+		if RegisterEngineApps != nil {
+			RegisterEngineApps()
+		}
+		if apps := supervisor.Apps(); len(apps) > 0 {
+			log.WithField("apps", strings.Join(apps, ",")).Info("in-process apps registered")
+		} else {
+			log.Info("no in-process apps registered, only process: engines can be started")
+		}
+		sup := supervisor.NewSupervisor()
+		srv := grpc.NewServer()
+		v1.RegisterWebServiceServer(srv, sup)
+
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			<-sigs
+			log.Info("stopping all engines")
+			sup.Shutdown()
+			srv.GracefulStop()
+		}()
+
+		log.WithField("addr", engineServeCmdOpts.Addr).Info("engine supervisor is serving")
+		if err := srv.Serve(lis); err != nil {
+			log.WithError(err).Fatal("engine supervisor failed")
+		}
+	},
+}
+
+var engineStartCmdOpts struct {
+	Suffix string
+	Owner  string
+}
+
+// engineStartCmd represents the engine start command
+var engineStartCmd = &cobra.Command{
+	Use:   "start <engine.yaml>",
+	Short: "Starts a new engine from an engine spec",
+	Args:  cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("server engine called")
+		spec, err := ioutil.ReadFile(args[0])
+		if err != nil {
+			log.WithError(err).Fatal("cannot read engine spec")
+		}
+		client, conn := dialEngine()
+		defer conn.Close()
+
+		resp, err := client.StartEngine(context.Background(), &v1.StartEngineRequest{
+			Metadata: &v1.EngineMetadata{
+				Owner:   engineStartCmdOpts.Owner,
+				Trigger: v1.EngineTrigger_TRIGGER_MANUAL,
+			},
+			EngineYaml: spec,
+			NameSuffix: engineStartCmdOpts.Suffix,
+		})
+		if err != nil {
+			log.WithError(err).Fatal("cannot start engine")
+		}
+		fmt.Println(resp.Status.Name)
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(engineCmd)
+// engineListCmd represents the engine list command
+var engineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists all engines of the supervisor",
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := dialEngine()
+		defer conn.Close()
 
-	// Here you will define your flags and configuration settings.
+		resp, err := client.ListEngines(context.Background(), &v1.ListEnginesRequest{})
+		if err != nil {
+			log.WithError(err).Fatal("cannot list engines")
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tPHASE\tSUCCESS\tCREATED\tDETAILS")
+		for _, st := range resp.Result {
+			fmt.Fprintf(tw, "%s\t%s\t%v\t%s\t%s\n",
+				st.Name, st.Phase, st.Conditions.GetSuccess(),
+				st.Metadata.GetCreated().AsTime().Local().Format(time.RFC3339), st.Details)
+		}
+		tw.Flush()
+	},
+}
+
+var engineStopCmdOpts struct {
+	Timeout time.Duration
+}
+
+// engineStopCmd represents the engine stop command
+var engineStopCmd = &cobra.Command{
+	Use:   "stop <name>",
+	Short: "Stops a running engine",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := dialEngine()
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(cmd.Context(), engineStopCmdOpts.Timeout)
+		defer cancel()
+		if _, err := client.StopEngine(ctx, &v1.StopEngineRequest{Name: args[0]}); err != nil {
+			log.WithError(err).Fatal("cannot stop engine")
+		}
+	},
+}
+
+var engineLogsCmdOpts struct {
+	Follow bool
+}
+
+// engineLogsCmd represents the engine logs command
+var engineLogsCmd = &cobra.Command{
+	Use:   "logs <name>",
+	Short: "Prints the log output of an engine",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		client, conn := dialEngine()
+		defer conn.Close()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream, err := client.Listen(ctx, &v1.ListenRequest{Name: args[0], Logs: v1.ListenRequestLogs_LOGS_RAW})
+		if err != nil {
+			log.WithError(err).Fatal("cannot listen to engine")
+		}
+		// without --follow only the lines logged so far are printed
+		var idle *time.Timer
+		if !engineLogsCmdOpts.Follow {
+			idle = time.AfterFunc(500*time.Millisecond, cancel)
+		}
+		for {
+			msg, err := stream.Recv()
+			if err == io.EOF || ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				log.WithError(err).Fatal("cannot receive logs")
+			}
+			if idle != nil {
+				idle.Reset(500 * time.Millisecond)
+			}
+			if slice := msg.GetSlice(); slice != nil {
+				fmt.Println(slice.Payload)
+			}
+		}
+	},
+}
+
+func dialEngine() (v1.WebServiceClient, *grpc.ClientConn) {
+	conn, err := grpc.Dial(engineCmdOpts.Host, grpc.WithInsecure())
+	if err != nil {
+		log.WithError(err).Fatal("cannot connect to engine supervisor")
+	}
+	return v1.NewWebServiceClient(conn), conn
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// engineCmd.PersistentFlags().String("foo", "", "A help for foo")
+func init() {
+	rootCmd.AddCommand(engineCmd)
+	engineCmd.AddCommand(engineServeCmd, engineStartCmd, engineListCmd, engineStopCmd, engineLogsCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// engineCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	engineCmd.PersistentFlags().StringVar(&engineCmdOpts.Host, "host", "localhost:7777", "address of the engine supervisor")
+	engineServeCmd.Flags().StringVar(&engineServeCmdOpts.Addr, "addr", ":7777", "address the supervisor listens on")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Suffix, "suffix", "", "name suffix of the engine (default: a sequence number)")
+	engineStartCmd.Flags().StringVar(&engineStartCmdOpts.Owner, "owner", os.Getenv("USER"), "owner of the engine")
+	engineStopCmd.Flags().DurationVar(&engineStopCmdOpts.Timeout, "timeout", 30*time.Second, "how long to wait for the engine to stop")
+	engineLogsCmd.Flags().BoolVarP(&engineLogsCmdOpts.Follow, "follow", "f", false, "keep streaming until the engine is done")
 }
@@ -21,30 +21,62 @@ package cmd
 // THE SOFTWARE.
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	_ "github.com/bhojpur/web/pkg/core/config/json"
+	_ "github.com/bhojpur/web/pkg/core/config/xml"
+	_ "github.com/bhojpur/web/pkg/core/config/yaml"
+	"github.com/bhojpur/web/pkg/proxy"
 )
 
+var proxyCmdOpts struct {
+	Config          string
+	ShutdownTimeout time.Duration
+}
+
 // proxyCmd represents the proxy command
 var proxyCmd = &cobra.Command{
 	Use:   "proxy",
 	Short: "Reverse Proxy server as a gateway to protect applications",
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("reverse proxy called")
+		cfg, err := proxy.LoadConfig(proxyCmdOpts.Config)
+		if err != nil {
+			log.WithError(err).Fatal("cannot load proxy configuration")
+		}
+		gw, err := proxy.NewGateway(cfg)
+		if err != nil {
+			log.WithError(err).Fatal("cannot create proxy gateway")
+		}
+
+		go func() {
+			sigs := make(chan os.Signal, 1)
+			signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+			<-sigs
+			log.Info("shutting down reverse proxy")
+			ctx, cancel := context.WithTimeout(context.Background(), proxyCmdOpts.ShutdownTimeout)
+			defer cancel()
+			if err := gw.Shutdown(ctx); err != nil {
+				log.WithError(err).Warn("reverse proxy did not shut down cleanly")
+			}
+		}()
+
+		log.WithField("routes", len(cfg.Routes)).Info("starting reverse proxy")
+		if err := gw.ListenAndServe(); err != nil {
+			log.WithError(err).Fatal("reverse proxy failed")
+		}
 	},
 }
 
 func init() {
 	rootCmd.AddCommand(proxyCmd)
 
-	// Here you will define your flags and configuration settings.
-
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// proxyCmd.PersistentFlags().String("foo", "", "A help for foo")
-
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// proxyCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	proxyCmd.Flags().StringVarP(&proxyCmdOpts.Config, "config", "c", "conf/proxy.json", "route table of the gateway (json, yaml or xml)")
+	proxyCmd.Flags().DurationVar(&proxyCmdOpts.ShutdownTimeout, "shutdown-timeout", 30*time.Second, "time to wait for in-flight requests on shutdown")
 }
@@ -1,3 +1,6 @@
+//go:build !windows
+// +build !windows
+
 package cmd
 
 // Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
@@ -21,30 +24,241 @@ package cmd
 // THE SOFTWARE.
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
+type restartOptions struct {
+	PIDFile         string
+	PID             int
+	Admin           string
+	HealthURL       string
+	Timeout         time.Duration
+	ShutdownTimeout time.Duration
+	Interval        time.Duration
+}
+
+var restartCmdOpts restartOptions
+
 // restartCmd represents the restart command
 var restartCmd = &cobra.Command{
 	Use:   "restart",
 	Short: "To restart a distributed server, application or service instance",
+	Long: `Restarts a server running in graceful mode without dropping connections.
+
+The running server is found with its PID file or its admin endpoint. It starts a
+new process of the program, usually a newly deployed binary, which inherits its
+listeners, and stops accepting connections. Once the new process reports healthy
+through /healthcheck, the old one is terminated after its requests complete.
+If the new process is not healthy within the timeout, it is terminated and the
+old process accepts connections again.`,
+	Example: `  websvr restart --pid-file websvr.pid
+  websvr restart --admin http://127.0.0.1:8088 --timeout 30s`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println("restart called")
+		opts := restartCmdOpts
+		if opts.HealthURL == "" {
+			opts.HealthURL = strings.TrimSuffix(opts.Admin, "/") + "/healthcheck?json=true"
+		}
+		oldPID, err := runningPID(opts.PID, opts.PIDFile, opts.Admin)
+		if err != nil {
+			log.WithError(err).Fatal("cannot find the running server")
+		}
+		if !processAlive(oldPID) {
+			log.Fatalf("no process %d", oldPID)
+		}
+		logger := log.WithField("pid", oldPID)
+
+		if err := syscall.Kill(oldPID, syscall.SIGUSR2); err != nil {
+			logger.WithError(err).Fatal("cannot signal the running server")
+		}
+		logger.Info("handing off to a new process")
+
+		newPID, err := waitReady(oldPID, opts)
+		if err != nil {
+			logger.WithError(err).Error("new process is not ready, rolling back")
+			if err := syscall.Kill(oldPID, syscall.SIGUSR1); err != nil {
+				logger.WithError(err).Fatal("cannot roll back")
+			}
+			if _, err := waitPID(func(pid int) bool { return pid == oldPID }, opts); err != nil {
+				logger.WithError(err).Warn("cannot tell whether the old process serves again")
+			}
+			logger.Fatal("restart failed, the old process serves again")
+		}
+
+		logger = logger.WithField("new_pid", newPID)
+		logger.Info("new process is healthy, stopping the old one")
+		if err := syscall.Kill(oldPID, syscall.SIGTERM); err != nil {
+			logger.WithError(err).Fatal("cannot stop the old process")
+		}
+		deadline := time.Now().Add(opts.ShutdownTimeout)
+		for processAlive(oldPID) {
+			if time.Now().After(deadline) {
+				logger.Fatal("old process is still running")
+			}
+			time.Sleep(opts.Interval)
+		}
+		logger.Info("restarted")
 	},
 }
 
-func init() {
-	rootCmd.AddCommand(restartCmd)
+// runningPID finds the process of the running server
+func runningPID(pid int, pidFile, admin string) (int, error) {
+	if pid > 0 {
+		return pid, nil
+	}
+	if pidFile != "" {
+		return readPIDFile(pidFile)
+	}
+	return adminPID(admin)
+}
+
+func readPIDFile(name string) (int, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid PID file %s: %v", name, err)
+	}
+	return pid, nil
+}
 
-	// Here you will define your flags and configuration settings.
+// restartClient opens a connection per request, since an old connection
+// may be served by the old process
+var restartClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: &http.Transport{DisableKeepAlives: true},
+}
+
+// adminPID asks the admin endpoint which process serves it
+func adminPID(admin string) (int, error) {
+	resp, err := restartClient.Get(strings.TrimSuffix(admin, "/") + "/process")
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	var process struct {
+		PID int `json:"pid"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&process); err != nil || process.PID == 0 {
+		return 0, fmt.Errorf("%s/process is not an admin endpoint", admin)
+	}
+	return process.PID, nil
+}
+
+// waitPID waits until the PID file or the admin endpoint shows a process
+// matching fn, and returns it
+func waitPID(fn func(pid int) bool, opts restartOptions) (int, error) {
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		var pid int
+		var err error
+		if opts.PIDFile != "" {
+			pid, err = readPIDFile(opts.PIDFile)
+		} else {
+			pid, err = adminPID(opts.Admin)
+		}
+		if err == nil && fn(pid) {
+			return pid, nil
+		}
+		if time.Now().After(deadline) {
+			if err == nil {
+				err = fmt.Errorf("process %d still serving", pid)
+			}
+			return 0, fmt.Errorf("timeout: %v", err)
+		}
+		time.Sleep(opts.Interval)
+	}
+}
+
+// waitReady waits until a new process serves and reports healthy, and
+// returns it. Since the old process does not accept connections anymore,
+// the requests are served by the new process.
+func waitReady(oldPID int, opts restartOptions) (int, error) {
+	start := time.Now()
+	newPID, err := waitPID(func(pid int) bool { return pid != oldPID }, opts)
+	if err != nil {
+		return 0, err
+	}
+	log.WithField("new_pid", newPID).Info("new process started, checking its health")
+	deadline := start.Add(opts.Timeout)
+	for {
+		err = checkHealth(opts.HealthURL)
+		if err == nil {
+			return newPID, nil
+		}
+		if !processAlive(newPID) {
+			return 0, fmt.Errorf("new process %d exited", newPID)
+		}
+		if time.Now().After(deadline) {
+			return 0, fmt.Errorf("timeout: %v", err)
+		}
+		time.Sleep(opts.Interval)
+	}
+}
 
-	// Cobra supports Persistent Flags which will work for this command
-	// and all subcommands, e.g.:
-	// restartCmd.PersistentFlags().String("foo", "", "A help for foo")
+// checkHealth reports an error if the health endpoint does not answer with
+// a success status, or reports a failed check in its JSON response
+func checkHealth(url string) error {
+	resp, err := restartClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("health check status %s", resp.Status)
+	}
+	var checks []map[string]interface{}
+	if json.Unmarshal(bytes.TrimSpace(body), &checks) != nil {
+		return nil
+	}
+	// the admin module lists the checks with their results, "error" for a
+	// failed check
+	for _, check := range checks {
+		for _, v := range check {
+			if v == "error" {
+				return fmt.Errorf("health check failed: %v", check)
+			}
+		}
+	}
+	return nil
+}
+
+func processAlive(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+func init() {
+	rootCmd.AddCommand(restartCmd)
 
-	// Cobra supports local flags which will only run when this command
-	// is called directly, e.g.:
-	// restartCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	admin := os.Getenv("WEB_ADMIN_URL")
+	if admin == "" {
+		admin = "http://127.0.0.1:8088"
+	}
+	flags := restartCmd.Flags()
+	flags.StringVar(&restartCmdOpts.PIDFile, "pid-file", os.Getenv("WEB_PID_FILE"), "PID file of the server, see Listen.PIDFile (defaults to WEB_PID_FILE env var)")
+	flags.IntVar(&restartCmdOpts.PID, "pid", 0, "process ID of the server, instead of the PID file or the admin endpoint")
+	flags.StringVar(&restartCmdOpts.Admin, "admin", admin, "URL of the admin endpoint of the server (defaults to WEB_ADMIN_URL env var)")
+	flags.StringVar(&restartCmdOpts.HealthURL, "health-url", "", "URL reporting the health of the server (default the /healthcheck of the admin endpoint)")
+	flags.DurationVar(&restartCmdOpts.Timeout, "timeout", time.Minute, "time for the new process to become healthy before rolling back")
+	flags.DurationVar(&restartCmdOpts.ShutdownTimeout, "shutdown-timeout", 70*time.Second, "time for the old process to complete its requests")
+	flags.DurationVar(&restartCmdOpts.Interval, "interval", 500*time.Millisecond, "interval between checks")
 }
@@ -64,6 +64,10 @@ var CmdGenerate = &commands.Command{
 
      $ webutl generate routers [-ctrlDir=/path/to/controller/directory] [-routersFile=/path/to/routers/file.go] [-routersPkg=myPackage]
 
+  ▶ {{"To generate the typed ORM fields of the models of a package:"|bold}}
+
+     $ webutl generate fields [modelsdir]
+
   ▶ {{"To generate a test case:"|bold}}
 
      $ webutl generate test [routerfile]
@@ -119,6 +123,8 @@ func GenerateCode(cmd *commands.Command, args []string) int {
 		view(args, currpath)
 	case "routers":
 		genRouters(cmd, args)
+	case "fields":
+		fields(args, currpath)
 	default:
 		cliLogger.Log.Fatal("Command is missing")
 	}
@@ -231,6 +237,16 @@ func model(cmd *commands.Command, args []string, currpath string) {
 	generate.GenerateModel(sname, generate.Fields.String(), currpath)
 }
 
+func fields(args []string, currpath string) {
+	dir := "models"
+	if len(args) == 2 {
+		dir = args[1]
+	} else if len(args) > 2 {
+		cliLogger.Log.Fatal("Wrong number of arguments. Run: webutl help generate")
+	}
+	generate.GenerateFields(dir, currpath)
+}
+
 func view(args []string, currpath string) {
 	if len(args) == 2 {
 		cname := args[1]
@@ -22,9 +22,11 @@ package migrate
 
 import (
 	"database/sql"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"runtime"
 	"strconv"
 	"strings"
@@ -58,6 +60,14 @@ var CmdMigrate = &commands.Command{
   ▶ {{"To update your schema:"|bold}}
 
     $ webutl migrate refresh [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"] [-dir="path/to/migration"]
+
+  ▶ {{"To generate the migration of the changes of your models:"|bold}}
+
+    $ webutl migrate diff [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"] [-dir="path/to/migration"] [-models="app/models"] [-name=schema]
+
+  ▶ {{"To print the DDL of the changes of your models without generating the migration:"|bold}}
+
+    $ webutl migrate diff -dry-run [-driver=mysql] [-conn="root:@tcp(127.0.0.1:3306)/test"] [-models="app/models"]
 `,
 	PreRun: func(cmd *commands.Command, args []string) { version.ShowShortVersionBanner() },
 	Run:    RunMigration,
@@ -66,11 +76,17 @@ var CmdMigrate = &commands.Command{
 var mDriver utils.DocValue
 var mConn utils.DocValue
 var mDir utils.DocValue
+var mModels utils.DocValue
+var mName utils.DocValue
+var mDryRun bool
 
 func init() {
 	CmdMigrate.Flag.Var(&mDriver, "driver", "Database driver. Either mysql, postgres or sqlite.")
 	CmdMigrate.Flag.Var(&mConn, "conn", "Connection string used by the driver to connect to a database instance.")
 	CmdMigrate.Flag.Var(&mDir, "dir", "The directory where the migration files are stored")
+	CmdMigrate.Flag.Var(&mModels, "models", "The import path of the package registering the models, compared to the database by diff")
+	CmdMigrate.Flag.Var(&mName, "name", "The name of the migration generated by diff")
+	CmdMigrate.Flag.BoolVar(&mDryRun, "dry-run", false, "Print the DDL of diff instead of generating the migration")
 	commands.AvailableCommands = append(commands.AvailableCommands, CmdMigrate)
 }
 
@@ -129,6 +145,9 @@ func RunMigration(cmd *commands.Command, args []string) int {
 		case "refresh":
 			cliLogger.Log.Info("Refreshing all migrations")
 			MigrateRefresh(currpath, driverStr, connStr, dirStr)
+		case "diff":
+			cliLogger.Log.Info("Comparing the models to the database schema")
+			MigrateDiff(currpath, driverStr, connStr, dirStr, string(mModels), string(mName), mDryRun)
 		default:
 			cliLogger.Log.Fatal("Command is missing")
 		}
@@ -220,6 +239,8 @@ func driverImportStatement(driver string) string {
 		return "github.com/go-sql-driver/mysql"
 	case "postgres":
 		return "github.com/lib/pq"
+	case "sqlite3":
+		return "github.com/mattn/go-sqlite3"
 	default:
 		return "github.com/go-sql-driver/mysql"
 	}
@@ -304,6 +325,42 @@ func writeMigrationSourceFile(dir, source, driver, connStr string, latestTime in
 	}
 }
 
+// writeDiffSourceFile create the source file based on MigrationDiffTPL
+func writeDiffSourceFile(dir, source, driver, connStr, models, name string, dryRun bool) {
+	changeDir(dir)
+	if f, err := os.OpenFile(source, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0666); err != nil {
+		cliLogger.Log.Fatalf("Could not create file: %s", err)
+	} else {
+		content := strings.Replace(MigrationDiffTPL, "{{DBDriver}}", driver, -1)
+		content = strings.Replace(content, "{{DriverRepo}}", driverImportStatement(driver), -1)
+		content = strings.Replace(content, "{{ModelsRepo}}", models, -1)
+		content = strings.Replace(content, "{{ConnStr}}", connStr, -1)
+		content = strings.Replace(content, "{{Dir}}", filepath.ToSlash(dir), -1)
+		content = strings.Replace(content, "{{Name}}", name, -1)
+		content = strings.Replace(content, "{{DryRun}}", strconv.FormatBool(dryRun), -1)
+		if _, err := f.WriteString(content); err != nil {
+			cliLogger.Log.Fatalf("Could not write to file: %s", err)
+		}
+		utils.CloseFile(f)
+	}
+}
+
+// modelsPackage returns the import path of the models package of the
+// application in currpath, read from its go.mod
+func modelsPackage(currpath string) string {
+	data, err := ioutil.ReadFile(path.Join(currpath, "go.mod"))
+	if err != nil {
+		cliLogger.Log.Fatalf("Could not read go.mod, use -models to set the models package: %s", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "module" {
+			return strings.Trim(fields[1], `"`) + "/models"
+		}
+	}
+	cliLogger.Log.Fatal("Could not find the module of go.mod, use -models to set the models package")
+	return ""
+}
+
 // buildMigrationBinary changes directory to database/migrations folder and go-build the source
 func buildMigrationBinary(dir, binary string) {
 	changeDir(dir)
@@ -405,6 +462,45 @@ func main(){
 	}
 }
 
+`
+	// MigrationDiffTPL migration diff main template
+	MigrationDiffTPL = `package main
+
+import(
+	"fmt"
+	"os"
+
+	"github.com/bhojpur/web/pkg/client/orm"
+	"github.com/bhojpur/web/pkg/client/orm/migration"
+
+	_ "{{DriverRepo}}"
+	_ "{{ModelsRepo}}"
+)
+
+func init(){
+	orm.RegisterDataBase("default", "{{DBDriver}}","{{ConnStr}}")
+}
+
+func main(){
+	if {{DryRun}} {
+		if err := migration.DryRun("default", os.Stdout); err != nil {
+			fmt.Println(err)
+			os.Exit(2)
+		}
+		return
+	}
+	file, err := migration.Generate("default", "{{Dir}}", "{{Name}}")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(2)
+	}
+	if file == "" {
+		fmt.Println("the schema is up to date")
+	} else {
+		fmt.Println("create", file)
+	}
+}
+
 `
 	// MYSQLMigrationDDL MySQL migration SQL
 	MYSQLMigrationDDL = `
@@ -451,3 +547,29 @@ func MigrateReset(currpath, driver, connStr, dir string) {
 func MigrateRefresh(currpath, driver, connStr, dir string) {
 	migrate("refresh", currpath, driver, connStr, dir)
 }
+
+// MigrateDiff generates the migration of the differences between the models
+// and the database schema, or prints its DDL when dryRun is set
+func MigrateDiff(currpath, driver, connStr, dir, models, name string, dryRun bool) {
+	if models == "" {
+		models = modelsPackage(currpath)
+	}
+	if name == "" {
+		name = "schema"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		cliLogger.Log.Fatalf("Could not create migration directory: %s", err)
+	}
+	postfix := ""
+	if runtime.GOOS == "windows" {
+		postfix = ".exe"
+	}
+	binary := "m" + postfix
+	source := binary + ".go"
+
+	writeDiffSourceFile(dir, source, driver, connStr, models, name, dryRun)
+	buildMigrationBinary(dir, binary)
+	runMigrationBinary(dir, binary)
+	removeTempFile(dir, source)
+	removeTempFile(dir, binary)
+}
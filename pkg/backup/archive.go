@@ -0,0 +1,213 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FormatVersion is the version of the archive format written by this package
+const FormatVersion = 1
+
+// manifestName is the first entry of every archive
+const manifestName = "manifest.json"
+
+// Manifest describes the content of an archive
+type Manifest struct {
+	Format  int       `json:"format"`
+	Name    string    `json:"name"`
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Host    string    `json:"host,omitempty"`
+	Sources []string  `json:"sources"`
+	Files   []File    `json:"files"`
+}
+
+// File is a file of an archive
+type File struct {
+	Path   string      `json:"path"`
+	Size   int64       `json:"size"`
+	Mode   os.FileMode `json:"mode"`
+	SHA256 string      `json:"sha256"`
+}
+
+// hashFile returns the hex encoded SHA-256 checksum of a file
+func hashFile(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// manifestFiles lists and checksums the files under dir
+func manifestFiles(dir string) ([]File, error) {
+	var files []File
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(p)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: filepath.ToSlash(rel), Size: info.Size(), Mode: info.Mode().Perm(), SHA256: sum})
+		return nil
+	})
+	return files, err
+}
+
+// writeArchive writes the manifest and the files under dir it lists as a
+// gzip compressed tar archive
+func writeArchive(w io.Writer, m *Manifest, dir string) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: manifestName, Mode: 0600, Size: int64(len(data)), ModTime: m.Created}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, f := range m.Files {
+		if err := tw.WriteHeader(&tar.Header{Name: f.Path, Mode: int64(f.Mode), Size: f.Size, ModTime: m.Created}); err != nil {
+			return err
+		}
+		in, err := os.Open(filepath.Join(dir, filepath.FromSlash(f.Path)))
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(tw, in, f.Size)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("backup: %s changed while archiving: %v", f.Path, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// readManifest reads the manifest at the start of an archive
+func readManifest(r io.Reader) (*Manifest, *tar.Reader, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backup: not an archive: %v", err)
+	}
+	tr := tar.NewReader(zr)
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != manifestName {
+		return nil, nil, errors.New("backup: archive has no manifest")
+	}
+	m := &Manifest{}
+	if err := json.NewDecoder(tr).Decode(m); err != nil {
+		return nil, nil, fmt.Errorf("backup: invalid manifest: %v", err)
+	}
+	if m.Format > FormatVersion {
+		return nil, nil, fmt.Errorf("backup: archive format %d is newer than %d", m.Format, FormatVersion)
+	}
+	return m, tr, nil
+}
+
+// extractArchive verifies the files of an archive against its manifest and
+// extracts them to dir if it is not empty
+func extractArchive(r io.Reader, dir string) (*Manifest, error) {
+	m, tr, err := readManifest(r)
+	if err != nil {
+		return nil, err
+	}
+	want := make(map[string]File)
+	for _, f := range m.Files {
+		want[f.Path] = f
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup: corrupt archive: %v", err)
+		}
+		name := path.Clean(hdr.Name)
+		f, ok := want[name]
+		if !ok || name != hdr.Name || strings.HasPrefix(name, "../") || path.IsAbs(name) {
+			return nil, fmt.Errorf("backup: unexpected file %s in archive", hdr.Name)
+		}
+		delete(want, name)
+
+		h := sha256.New()
+		var w io.Writer = h
+		var out *os.File
+		if dir != "" {
+			target := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(target), 0700); err != nil {
+				return nil, err
+			}
+			if out, err = os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode|0600); err != nil {
+				return nil, err
+			}
+			w = io.MultiWriter(h, out)
+		}
+		n, err := io.Copy(w, tr)
+		if out != nil {
+			if cerr := out.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup: corrupt archive: %v", err)
+		}
+		if n != f.Size || hex.EncodeToString(h.Sum(nil)) != f.SHA256 {
+			return nil, fmt.Errorf("backup: checksum mismatch for %s", name)
+		}
+	}
+	for name := range want {
+		return nil, fmt.Errorf("backup: %s missing from archive", name)
+	}
+	return m, nil
+}
@@ -0,0 +1,138 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements backups of web applications: the databases registered with
+// the ORM, the conf directory, static and upload directories and file cache
+// directories are snapshotted into versioned, gzip compressed tar archives
+// with SHA-256 checksums of every file, kept in a repository directory with
+// a retention policy. Backups can be scheduled as pkg/task jobs.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/backup"
+//	)
+//
+//	repo, err := backup.NewRepository("/var/backups/myapp")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	b := &backup.Backup{
+//		Name:       "myapp",
+//		Repository: repo,
+//		Sources:    []backup.Source{backup.Database("default"), backup.Dir("conf", "conf")},
+//		Retention:  backup.Retention{KeepLast: 3, KeepDaily: 7, KeepWeekly: 4},
+//	}
+//	task.AddTask("backup", b.Task("0 0 3 * * *"))
+//	task.StartTask()
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+
+	"github.com/bhojpur/web/pkg/task"
+)
+
+// Source is a part of an application that is backed up
+type Source interface {
+	// Name identifies the source in archives, it must be unique within a backup
+	Name() string
+	// Backup writes the files of the source to dir
+	Backup(ctx context.Context, dir string) error
+	// Restore restores the source from the files in dir written by Backup
+	Restore(ctx context.Context, dir string) error
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// Backup snapshots sources into a repository
+type Backup struct {
+	// Name names the archives, e.g. the application name
+	Name       string
+	Repository *Repository
+	Sources    []Source
+	// Retention is applied to the archives of Name after every backup
+	Retention Retention
+}
+
+// Run snapshots the sources and prunes the archives of the backup
+func (b *Backup) Run(ctx context.Context) (*Snapshot, error) {
+	if !validName.MatchString(b.Name) {
+		return nil, fmt.Errorf("backup: invalid name %q", b.Name)
+	}
+	if b.Repository == nil || len(b.Sources) == 0 {
+		return nil, errors.New("backup: no repository or no sources")
+	}
+	seen := make(map[string]bool)
+	for _, s := range b.Sources {
+		if !validName.MatchString(s.Name()) || s.Name() == manifestName || seen[s.Name()] {
+			return nil, fmt.Errorf("backup: invalid or duplicate source name %q", s.Name())
+		}
+		seen[s.Name()] = true
+	}
+
+	staging, err := ioutil.TempDir("", "backup-"+b.Name)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(staging)
+
+	var names []string
+	for _, s := range b.Sources {
+		dir := filepath.Join(staging, s.Name())
+		if err := os.Mkdir(dir, 0700); err != nil {
+			return nil, err
+		}
+		if err := s.Backup(ctx, dir); err != nil {
+			return nil, fmt.Errorf("backup: source %s: %v", s.Name(), err)
+		}
+		names = append(names, s.Name())
+	}
+
+	snap, err := b.Repository.create(b.Name, names, staging)
+	if err != nil {
+		return nil, err
+	}
+	logs.Info("backup %s created, %d files, %d bytes", snap.ID, len(snap.Files), snap.Size)
+
+	if pruned, err := b.Repository.Prune(b.Name, b.Retention); err != nil {
+		logs.Warn("backup %s: pruning failed: %v", b.Name, err)
+	} else {
+		for _, p := range pruned {
+			logs.Info("backup %s pruned", p.ID)
+		}
+	}
+	return snap, nil
+}
+
+// Task returns a pkg/task job running the backup on the cron spec
+func (b *Backup) Task(spec string) *task.Task {
+	return task.NewTask("backup-"+b.Name, spec, func(ctx context.Context) error {
+		_, err := b.Run(ctx)
+		return err
+	})
+}
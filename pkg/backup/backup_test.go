@@ -0,0 +1,196 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/client/orm"
+)
+
+func setupDB(t *testing.T, dir, alias string) {
+	err := orm.RegisterDataBase(alias, "sqlite3", filepath.Join(dir, alias+".db")+"?_foreign_keys=1")
+	assert.Nil(t, err)
+	db, _ := orm.GetDB(alias)
+	_, err = db.Exec(`CREATE TABLE post (id INTEGER PRIMARY KEY AUTOINCREMENT, title TEXT, data BLOB, created DATETIME)`)
+	assert.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO post (title, data, created) VALUES ('hello', x'00ff', '2021-10-17 10:00:00'), ('world', NULL, NULL)`)
+	assert.Nil(t, err)
+	// comment sorts before the post it references, whose deletion cascades
+	_, err = db.Exec(`CREATE TABLE comment (id INTEGER PRIMARY KEY, post_id INTEGER REFERENCES post (id) ON DELETE CASCADE, body TEXT)`)
+	assert.Nil(t, err)
+	_, err = db.Exec(`INSERT INTO comment (post_id, body) VALUES (1, 'first'), (2, 'second')`)
+	assert.Nil(t, err)
+}
+
+func countComments(t *testing.T, alias string) int {
+	db, _ := orm.GetDB(alias)
+	var n int
+	assert.Nil(t, db.QueryRow(`SELECT COUNT(*) FROM comment`).Scan(&n))
+	return n
+}
+
+func titles(t *testing.T, alias string) []string {
+	db, _ := orm.GetDB(alias)
+	rows, err := db.Query(`SELECT title FROM post ORDER BY id`)
+	assert.Nil(t, err)
+	defer rows.Close()
+	var res []string
+	for rows.Next() {
+		var s string
+		rows.Scan(&s)
+		res = append(res, s)
+	}
+	return res
+}
+
+func TestBackupRestore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	setupDB(t, dir, "native")
+	setupDB(t, dir, "logical")
+	conf := filepath.Join(dir, "conf")
+	assert.Nil(t, os.MkdirAll(filepath.Join(conf, "locale"), 0755))
+	ioutil.WriteFile(filepath.Join(conf, "app.conf"), []byte("appname = demo\n"), 0644)
+	ioutil.WriteFile(filepath.Join(conf, "locale", "en.ini"), []byte("hello = Hello\n"), 0644)
+
+	repo, err := NewRepository(filepath.Join(dir, "repo"))
+	assert.Nil(t, err)
+	sources := []Source{Database("native"), &DatabaseSource{Alias: "logical", Logical: true}, Dir("conf", conf)}
+	b := &Backup{Name: "demo", Repository: repo, Sources: sources}
+	snap, err := b.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"db-native", "db-logical", "conf"}, snap.Sources)
+	assert.Equal(t, 4, len(snap.Files))
+	assert.Nil(t, repo.Verify(snap))
+
+	// damage everything
+	for _, alias := range []string{"native", "logical"} {
+		db, _ := orm.GetDB(alias)
+		_, err = db.Exec(`DELETE FROM post WHERE title = 'hello'`)
+		assert.Nil(t, err)
+		_, err = db.Exec(`INSERT INTO post (title) VALUES ('new')`)
+		assert.Nil(t, err)
+	}
+	ioutil.WriteFile(filepath.Join(conf, "app.conf"), []byte("broken"), 0644)
+	ioutil.WriteFile(filepath.Join(conf, "extra.conf"), []byte("extra"), 0644)
+
+	latest, err := repo.Get("demo", "latest")
+	assert.Nil(t, err)
+	assert.Equal(t, snap.ID, latest.ID)
+	assert.Nil(t, repo.Restore(context.Background(), latest, sources...))
+
+	for _, alias := range []string{"native", "logical"} {
+		assert.Equal(t, []string{"hello", "world"}, titles(t, alias), alias)
+		db, _ := orm.GetDB(alias)
+		var data []byte
+		assert.Nil(t, db.QueryRow(`SELECT data FROM post WHERE title = 'hello'`).Scan(&data))
+		assert.Equal(t, []byte{0, 0xff}, data, alias)
+		assert.Equal(t, 2, countComments(t, alias), alias)
+	}
+	data, _ := ioutil.ReadFile(filepath.Join(conf, "app.conf"))
+	assert.Equal(t, "appname = demo\n", string(data))
+	data, _ = ioutil.ReadFile(filepath.Join(conf, "locale", "en.ini"))
+	assert.Equal(t, "hello = Hello\n", string(data))
+	_, err = os.Stat(filepath.Join(conf, "extra.conf"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(conf+".pre-restore", "extra.conf"))
+	assert.Nil(t, err)
+
+	assert.NotNil(t, repo.Restore(context.Background(), latest, Dir("static", "static")))
+
+	// a damaged archive is detected before anything is restored
+	raw, _ := ioutil.ReadFile(snap.Path)
+	raw[len(raw)/2] ^= 0xff
+	ioutil.WriteFile(snap.Path, raw, 0600)
+	assert.NotNil(t, repo.Verify(snap))
+	assert.NotNil(t, repo.Restore(context.Background(), snap, Dir("conf", conf)))
+}
+
+func TestRetention(t *testing.T) {
+	day := 24 * time.Hour
+	now := time.Date(2021, 10, 17, 12, 0, 0, 0, time.UTC)
+	var snaps []*Snapshot
+	// two snapshots a day for 60 days, newest first
+	for i := 0; i < 120; i++ {
+		created := now.Add(-time.Duration(i) * 12 * time.Hour)
+		snaps = append(snaps, &Snapshot{Manifest: &Manifest{ID: created.Format(idFormat), Created: created}})
+	}
+
+	assert.Empty(t, Retention{}.apply(snaps))
+	assert.Equal(t, 117, len(Retention{KeepLast: 3}.apply(snaps)))
+
+	removed := Retention{KeepLast: 1, KeepDaily: 7, KeepMonthly: 3}.apply(snaps)
+	kept := make(map[string]bool)
+	for _, s := range snaps {
+		kept[s.ID] = true
+	}
+	for _, s := range removed {
+		delete(kept, s.ID)
+	}
+	// the newest, the newest of 7 days (one of which is the newest), and
+	// the newest of October (the newest), September and August
+	assert.Equal(t, 1+6+2, len(kept))
+	assert.True(t, kept[now.Format(idFormat)])
+	assert.True(t, kept[now.Add(-6*day).Format(idFormat)])
+	assert.True(t, kept[time.Date(2021, 9, 30, 12, 0, 0, 0, time.UTC).Format(idFormat)])
+	assert.True(t, kept[time.Date(2021, 8, 31, 12, 0, 0, 0, time.UTC).Format(idFormat)])
+}
+
+func TestPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "backup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	files := filepath.Join(dir, "files")
+	os.Mkdir(files, 0755)
+	ioutil.WriteFile(filepath.Join(files, "a"), []byte("a"), 0644)
+
+	repo, _ := NewRepository(filepath.Join(dir, "repo"))
+	b := &Backup{Name: "files", Repository: repo, Sources: []Source{Dir("files", files)}, Retention: Retention{KeepLast: 2}}
+	other := &Backup{Name: "other", Repository: repo, Sources: []Source{Dir("files", files)}, Retention: Retention{KeepLast: 2}}
+	for i := 0; i < 4; i++ {
+		_, err := b.Run(context.Background())
+		assert.Nil(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+	_, err = other.Run(context.Background())
+	assert.Nil(t, err)
+	snaps, _ := repo.List("files")
+	assert.Equal(t, 2, len(snaps))
+	snaps, _ = repo.List("")
+	assert.Equal(t, 3, len(snaps))
+	entries, _ := ioutil.ReadDir(filepath.Join(dir, "repo"))
+	assert.Equal(t, 6, len(entries))
+
+	_, err = (&Backup{Name: "../x", Repository: repo, Sources: b.Sources}).Run(context.Background())
+	assert.NotNil(t, err)
+	assert.NotNil(t, b.Task("0 0 3 * * *"))
+}
@@ -0,0 +1,248 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// idFormat is the layout of snapshot IDs, the UTC creation time
+const idFormat = "20060102T150405.000Z"
+
+const archiveExt = ".tar.gz"
+
+// Snapshot is an archive of a repository
+type Snapshot struct {
+	*Manifest
+	Path string
+	Size int64
+}
+
+// Repository is a directory of archives. Every archive NAME-ID.tar.gz has
+// a NAME-ID.tar.gz.sha256 checksum file in the format of sha256sum.
+type Repository struct {
+	dir string
+}
+
+// NewRepository returns the repository in dir, creating dir if needed
+func NewRepository(dir string) (*Repository, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Repository{dir: dir}, nil
+}
+
+// create archives the sources backed up in staging
+func (r *Repository) create(name string, sources []string, staging string) (*Snapshot, error) {
+	files, err := manifestFiles(staging)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	host, _ := os.Hostname()
+	m := &Manifest{
+		Format:  FormatVersion,
+		Name:    name,
+		ID:      name + "-" + now.Format(idFormat),
+		Created: now,
+		Host:    host,
+		Sources: sources,
+		Files:   files,
+	}
+
+	filename := filepath.Join(r.dir, m.ID+archiveExt)
+	tmp, err := ioutil.TempFile(r.dir, ".tmp-"+m.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	if err := writeArchive(tmp, m, staging); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	if err := tmp.Close(); err != nil {
+		return nil, err
+	}
+	sum, err := hashFile(tmp.Name())
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filename+".sha256", []byte(sum+"  "+filepath.Base(filename)+"\n"), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp.Name(), filename); err != nil {
+		return nil, err
+	}
+	return r.snapshot(filename)
+}
+
+func (r *Repository) snapshot(filename string) (*Snapshot, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	m, _, err := readManifest(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return &Snapshot{Manifest: m, Path: filename, Size: info.Size()}, nil
+}
+
+// List returns the snapshots of the repository, newest first. If name is
+// not empty, only the snapshots of that backup are returned.
+func (r *Repository) List(name string) ([]*Snapshot, error) {
+	entries, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	var snaps []*Snapshot
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), archiveExt) || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		snap, err := r.snapshot(filepath.Join(r.dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if name == "" || snap.Name == name {
+			snaps = append(snaps, snap)
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Created.After(snaps[j].Created)
+	})
+	return snaps, nil
+}
+
+// Get returns the snapshot with the given ID, or the latest snapshot of the
+// backup name if id is "latest"
+func (r *Repository) Get(name, id string) (*Snapshot, error) {
+	snaps, err := r.List(name)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range snaps {
+		if s.ID == id || id == "latest" {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("backup: snapshot %s not found", id)
+}
+
+// Verify checks the archive checksum and the checksums of all its files
+func (r *Repository) Verify(snap *Snapshot) error {
+	return r.extract(snap, "")
+}
+
+func (r *Repository) extract(snap *Snapshot, dir string) error {
+	data, err := ioutil.ReadFile(snap.Path + ".sha256")
+	if err != nil {
+		return err
+	}
+	sum, err := hashFile(snap.Path)
+	if err != nil {
+		return err
+	}
+	if fields := strings.Fields(string(data)); len(fields) == 0 || fields[0] != sum {
+		return fmt.Errorf("backup: checksum mismatch for %s", snap.Path)
+	}
+	f, err := os.Open(snap.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = extractArchive(f, dir)
+	return err
+}
+
+// Restore verifies a snapshot and restores the given sources from it. All
+// sources must be in the snapshot.
+func (r *Repository) Restore(ctx context.Context, snap *Snapshot, sources ...Source) error {
+	in := make(map[string]bool)
+	for _, name := range snap.Sources {
+		in[name] = true
+	}
+	for _, s := range sources {
+		if !in[s.Name()] {
+			return fmt.Errorf("backup: source %s is not in snapshot %s", s.Name(), snap.ID)
+		}
+	}
+
+	staging, err := ioutil.TempDir("", "restore-"+snap.Name)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+	if err := r.extract(snap, staging); err != nil {
+		return err
+	}
+	for _, s := range sources {
+		dir := filepath.Join(staging, s.Name())
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		if err := s.Restore(ctx, dir); err != nil {
+			return fmt.Errorf("backup: restoring %s: %v", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Remove deletes a snapshot
+func (r *Repository) Remove(snap *Snapshot) error {
+	if err := os.Remove(snap.Path); err != nil {
+		return err
+	}
+	return os.Remove(snap.Path + ".sha256")
+}
+
+// Prune removes the snapshots of the backup name that the retention policy
+// does not keep and returns them
+func (r *Repository) Prune(name string, policy Retention) ([]*Snapshot, error) {
+	snaps, err := r.List(name)
+	if err != nil {
+		return nil, err
+	}
+	var removed []*Snapshot
+	for _, s := range policy.apply(snaps) {
+		if err := r.Remove(s); err != nil {
+			return removed, err
+		}
+		removed = append(removed, s)
+	}
+	return removed, nil
+}
@@ -0,0 +1,80 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"time"
+)
+
+// Retention decides which snapshots of a backup are kept. A snapshot is
+// kept if it is one of the KeepLast newest, or the newest of one of the
+// KeepDaily last days, KeepWeekly last weeks or KeepMonthly last months
+// that have snapshots. The zero value keeps everything.
+type Retention struct {
+	KeepLast    int
+	KeepDaily   int
+	KeepWeekly  int
+	KeepMonthly int
+}
+
+func (p Retention) keepAll() bool {
+	return p.KeepLast <= 0 && p.KeepDaily <= 0 && p.KeepWeekly <= 0 && p.KeepMonthly <= 0
+}
+
+// apply returns the snapshots to remove, from snapshots sorted newest first
+func (p Retention) apply(snaps []*Snapshot) []*Snapshot {
+	if p.keepAll() {
+		return nil
+	}
+	type bucket struct {
+		keep int
+		key  func(t time.Time) string
+		seen map[string]bool
+	}
+	buckets := []*bucket{
+		{keep: p.KeepDaily, key: func(t time.Time) string { return t.Format("2006-01-02") }},
+		{keep: p.KeepWeekly, key: func(t time.Time) string {
+			y, w := t.ISOWeek()
+			return fmt.Sprintf("%d-%d", y, w)
+		}},
+		{keep: p.KeepMonthly, key: func(t time.Time) string { return t.Format("2006-01") }},
+	}
+	for _, b := range buckets {
+		b.seen = make(map[string]bool)
+	}
+
+	var remove []*Snapshot
+	for i, s := range snaps {
+		keep := i < p.KeepLast
+		for _, b := range buckets {
+			k := b.key(s.Created)
+			if len(b.seen) < b.keep && !b.seen[k] {
+				b.seen[k] = true
+				keep = true
+			}
+		}
+		if !keep {
+			remove = append(remove, s)
+		}
+	}
+	return remove
+}
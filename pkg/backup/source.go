@@ -0,0 +1,360 @@
+package backup
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bhojpur/web/pkg/client/orm"
+)
+
+// DirSource backs up a directory, such as conf, static, upload or file cache
+// directories. Only regular files are backed up.
+type DirSource struct {
+	name string
+	path string
+}
+
+// Dir returns a source backing up the directory at path
+func Dir(name, path string) *DirSource {
+	return &DirSource{name: name, path: path}
+}
+
+// Name returns the name of the source
+func (s *DirSource) Name() string {
+	return s.name
+}
+
+// Backup copies the directory to dir
+func (s *DirSource) Backup(ctx context.Context, dir string) error {
+	return copyTree(ctx, s.path, dir)
+}
+
+// Restore replaces the directory with the files in dir. The current
+// directory is kept next to it with a .pre-restore suffix until the next
+// restore.
+func (s *DirSource) Restore(ctx context.Context, dir string) error {
+	path := filepath.Clean(s.path)
+	tmp := path + ".restoring"
+	old := path + ".pre-restore"
+	if err := os.RemoveAll(tmp); err != nil {
+		return err
+	}
+	if err := copyTree(ctx, dir, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	if _, err := os.Stat(path); err == nil {
+		if err := os.RemoveAll(old); err != nil {
+			return err
+		}
+		if err := os.Rename(path, old); err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, path)
+}
+
+// copyTree copies the regular files under src to dst
+func copyTree(ctx context.Context, src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// file names of database backups
+const (
+	tableDumpFile = "tables.jsonl"
+	sqliteFile    = "database.sqlite"
+)
+
+// DatabaseSource backs up a database registered with orm.RegisterDataBase.
+// Sqlite databases are copied with VACUUM INTO unless Logical is set, other
+// databases are dumped table by table with orm.DumpTables. Restoring
+// replaces the rows of the backed up tables.
+type DatabaseSource struct {
+	Alias string
+	// Tables limits the backup to some tables
+	Tables []string
+	// Logical dumps sqlite databases table by table too
+	Logical bool
+}
+
+// Database returns a source backing up the database registered as alias
+func Database(alias string) *DatabaseSource {
+	return &DatabaseSource{Alias: alias}
+}
+
+// Name returns the name of the source
+func (s *DatabaseSource) Name() string {
+	return "db-" + s.Alias
+}
+
+func (s *DatabaseSource) native() (bool, error) {
+	typ, err := orm.GetDBDriverType(s.Alias)
+	if err != nil {
+		return false, err
+	}
+	return typ == orm.DRSqlite && !s.Logical && len(s.Tables) == 0, nil
+}
+
+// Backup writes the database to dir
+func (s *DatabaseSource) Backup(ctx context.Context, dir string) error {
+	native, err := s.native()
+	if err != nil {
+		return err
+	}
+	if native {
+		db, err := orm.GetDB(s.Alias)
+		if err != nil {
+			return err
+		}
+		_, err = db.ExecContext(ctx, "VACUUM INTO ?", filepath.Join(dir, sqliteFile))
+		return err
+	}
+
+	f, err := os.Create(filepath.Join(dir, tableDumpFile))
+	if err != nil {
+		return err
+	}
+	if err := orm.DumpTables(ctx, s.Alias, f, s.Tables...); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Restore loads the backed up tables into the database
+func (s *DatabaseSource) Restore(ctx context.Context, dir string) error {
+	if _, err := os.Stat(filepath.Join(dir, sqliteFile)); err == nil {
+		return s.restoreSqlite(ctx, filepath.Join(dir, sqliteFile))
+	}
+	f, err := os.Open(filepath.Join(dir, tableDumpFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return orm.LoadTables(ctx, s.Alias, f)
+}
+
+// restoreSqlite copies the tables of a sqlite snapshot into the database,
+// creating the tables missing from it
+func (s *DatabaseSource) restoreSqlite(ctx context.Context, file string) error {
+	if typ, err := orm.GetDBDriverType(s.Alias); err != nil {
+		return err
+	} else if typ != orm.DRSqlite {
+		return fmt.Errorf("database %s is not a sqlite database", s.Alias)
+	}
+	db, err := orm.GetDB(s.Alias)
+	if err != nil {
+		return err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS snapshot", file); err != nil {
+		return err
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE snapshot")
+
+	rows, err := conn.QueryContext(ctx, "SELECT name, sql FROM snapshot.sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return err
+	}
+	var names []string
+	creates := make(map[string]string)
+	for rows.Next() {
+		var name, sql string
+		if err := rows.Scan(&name, &sql); err != nil {
+			rows.Close()
+			return err
+		}
+		if strings.HasPrefix(name, "sqlite_") && name != "sqlite_sequence" {
+			continue
+		}
+		names = append(names, name)
+		creates[name] = sql
+	}
+	rows.Close()
+	references, err := snapshotReferences(ctx, conn, names)
+	if err != nil {
+		return err
+	}
+	names = orm.SortTables(names, references)
+
+	// sqlite ignores changes of foreign_keys inside a transaction
+	var fk int
+	if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&fk); err != nil {
+		return err
+	}
+	if fk == 1 {
+		if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		create := creates[name]
+		var n int
+		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM main.sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if n == 0 {
+			if name == "sqlite_sequence" {
+				continue
+			}
+			if _, err := tx.ExecContext(ctx, create); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		columns, err := snapshotColumns(ctx, tx, name)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		query := fmt.Sprintf(`DELETE FROM main."%s"; INSERT INTO main."%s" (%s) SELECT %s FROM snapshot."%s"`,
+			name, name, columns, columns, name)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// snapshotReferences returns the tables referenced by the foreign keys of
+// the tables of the snapshot
+func snapshotReferences(ctx context.Context, q querier, tables []string) (map[string][]string, error) {
+	references := make(map[string][]string)
+	for _, table := range tables {
+		rows, err := q.QueryContext(ctx, fmt.Sprintf(`PRAGMA snapshot.foreign_key_list("%s")`, table))
+		if err != nil {
+			return nil, err
+		}
+		cols, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		values := make([]interface{}, len(cols))
+		for rows.Next() {
+			var parent string
+			for i := range values {
+				values[i] = new(interface{})
+				if cols[i] == "table" {
+					values[i] = &parent
+				}
+			}
+			if err := rows.Scan(values...); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			references[table] = append(references[table], parent)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return references, nil
+}
+
+func snapshotColumns(ctx context.Context, q querier, table string) (string, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(`PRAGMA snapshot.table_info("%s")`, table))
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	var names []string
+	values := make([]interface{}, len(cols))
+	for rows.Next() {
+		var name string
+		for i := range values {
+			values[i] = new(interface{})
+			if cols[i] == "name" {
+				values[i] = &name
+			}
+		}
+		if err := rows.Scan(values...); err != nil {
+			return "", err
+		}
+		names = append(names, `"`+name+`"`)
+	}
+	return strings.Join(names, ", "), rows.Err()
+}
@@ -0,0 +1,169 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newService() *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/api/posts", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method == http.MethodPost {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.WriteHeader(http.StatusCreated)
+			w.Write(body)
+			return
+		}
+		w.Write([]byte(`{"total": 1000000, "posts": [{"id": 1, "title": "Hello", "tags": ["go", "web"]}]}`))
+	})
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/atom+xml")
+		w.Write([]byte(`<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom">
+<title>Bhojpur Blog</title><link rel="self" href="/feed"/>
+<entry><title>First</title></entry><entry><title>Second</title></entry></feed>`))
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestSuite(t *testing.T) {
+	srv := newService()
+	defer srv.Close()
+	os.Setenv("CHECK_TEST_TOKEN", "s3cret")
+	defer os.Unsetenv("CHECK_TEST_TOKEN")
+
+	suite, err := ParseSuite("yaml", []byte(`
+name: blog
+endpoint: `+srv.URL+`
+defaults:
+  headers:
+    Authorization: Bearer ${CHECK_TEST_TOKEN}
+checks:
+  - name: healthcheck
+    request:
+      path: /healthcheck
+    expect:
+      status: 200
+      body:
+        equals: OK
+  - name: list posts
+    request:
+      path: /api/posts
+    expect:
+      headers:
+        Content-Type: ^application/json
+      json:
+        - path: $.total
+          equals: 1000000
+        - path: $.posts[0].title
+          matches: ^Hel
+        - path: $.posts[-1]['tags']
+          length: 2
+        - path: $.drafts
+          exists: false
+  - name: create post
+    request:
+      method: post
+      path: /api/posts
+      json: {title: hello, draft: true}
+    expect:
+      status: [200, 201]
+      json:
+        - path: $.draft
+          equals: true
+  - name: feed
+    request:
+      path: /feed
+    expect:
+      xpath:
+        - path: /feed/title
+          equals: Bhojpur Blog
+        - path: //entry/title
+          length: 2
+        - path: //entry[2]/title
+          equals: Second
+        - path: /feed/link[@rel='self']/@href
+          equals: /feed
+`))
+	assert.Nil(t, err)
+	report, err := suite.Run(context.Background())
+	assert.Nil(t, err)
+	for _, res := range report.Results {
+		assert.True(t, res.Passed(), "%s: %v %s", res.Name, res.Failures, res.Error)
+	}
+	assert.True(t, report.Passed())
+}
+
+func TestSuiteFailures(t *testing.T) {
+	srv := newService()
+	defer srv.Close()
+
+	suite, err := ParseSuite("json", []byte(`{
+  "name": "blog",
+  "endpoint": "`+srv.URL+`",
+  "checks": [
+    {"name": "unauthorized", "request": {"path": "/api/posts"}},
+    {"name": "slow", "request": {"path": "/slow"}, "expect": {"max_latency": "10ms"}},
+    {"name": "wrong body", "request": {"path": "/healthcheck"}, "expect": {"json": [{"path": "$.status"}]}},
+    {"name": "down", "request": {"path": "/", "timeout": "1s"}}
+  ]
+}`))
+	assert.Nil(t, err)
+	srv.Config.Handler.(*http.ServeMux).HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})
+	report, err := suite.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 4, report.Failed())
+	assert.Equal(t, []string{"status 401, expected 2xx"}, report.Results[0].Failures)
+	assert.Contains(t, report.Results[1].Failures[0], "over budget of 10ms")
+	assert.Contains(t, report.Results[2].Failures[0], "body is not json")
+	assert.NotEmpty(t, report.Results[3].Error)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, report.WriteJUnit(buf))
+	assert.Contains(t, buf.String(), `tests="4" failures="3" errors="1"`)
+
+	_, err = ParseSuite("yaml", []byte("checks:\n  - request: {method: PATCH}\n"))
+	assert.NotNil(t, err)
+	_, err = ParseSuite("yaml", []byte("checks:\n  - expect: {xpath: [{path: feed}]}\n"))
+	assert.NotNil(t, err)
+}
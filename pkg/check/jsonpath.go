@@ -0,0 +1,106 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonStep is a member name or, if isIndex is set, an array index.
+// Negative indexes count from the end.
+type jsonStep struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parseJSONPath parses the subset of JSONPath made of member and index
+// selectors: $.items[0].name, $['content-type'], $.items[-1]
+func parseJSONPath(path string) ([]jsonStep, error) {
+	p := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	var steps []jsonStep
+	for len(p) > 0 {
+		switch p[0] {
+		case '.':
+			p = p[1:]
+			end := strings.IndexAny(p, ".[")
+			if end < 0 {
+				end = len(p)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("check: empty member name in json path %q", path)
+			}
+			steps = append(steps, jsonStep{key: p[:end]})
+			p = p[end:]
+		case '[':
+			end := strings.IndexByte(p, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("check: unclosed [ in json path %q", path)
+			}
+			sel := strings.TrimSpace(p[1:end])
+			p = p[end+1:]
+			if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				steps = append(steps, jsonStep{key: sel[1 : len(sel)-1]})
+				continue
+			}
+			i, err := strconv.Atoi(sel)
+			if err != nil {
+				return nil, fmt.Errorf("check: bad selector [%s] in json path %q", sel, path)
+			}
+			steps = append(steps, jsonStep{index: i, isIndex: true})
+		default:
+			return nil, fmt.Errorf("check: unexpected %q in json path %q", p[0], path)
+		}
+	}
+	return steps, nil
+}
+
+// evalJSONPath returns the value at path in a document decoded by encoding/json
+func evalJSONPath(doc interface{}, steps []jsonStep) (interface{}, bool) {
+	cur := doc
+	for _, step := range steps {
+		if step.isIndex {
+			arr, ok := cur.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			i := step.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i < 0 || i >= len(arr) {
+				return nil, false
+			}
+			cur = arr[i]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[step.key]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
@@ -0,0 +1,156 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Result is the outcome of a single check
+type Result struct {
+	Name     string        `json:"name"`
+	Method   string        `json:"method"`
+	URL      string        `json:"url"`
+	Status   int           `json:"status,omitempty"`
+	Duration time.Duration `json:"duration"`
+	Failures []string      `json:"failures,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Passed reports whether the request succeeded and all assertions held
+func (r *Result) Passed() bool {
+	return r.Error == "" && len(r.Failures) == 0
+}
+
+// Report is the outcome of running a suite
+type Report struct {
+	Suite    string        `json:"suite"`
+	Endpoint string        `json:"endpoint"`
+	Duration time.Duration `json:"duration"`
+	Results  []*Result     `json:"results"`
+}
+
+// Passed reports whether all checks passed
+func (r *Report) Passed() bool {
+	return r.Failed() == 0
+}
+
+// Failed returns the number of failed checks
+func (r *Report) Failed() int {
+	n := 0
+	for _, res := range r.Results {
+		if !res.Passed() {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteText writes one PASS or FAIL line per check, the reasons of the
+// failures and a summary
+func (r *Report) WriteText(w io.Writer) error {
+	for _, res := range r.Results {
+		verdict := "PASS"
+		if !res.Passed() {
+			verdict = "FAIL"
+		}
+		if _, err := fmt.Fprintf(w, "%s  %s (%s %s, %v)\n", verdict, res.Name, res.Method, res.URL, res.Duration.Round(time.Millisecond)); err != nil {
+			return err
+		}
+		if res.Error != "" {
+			fmt.Fprintf(w, "      error: %s\n", res.Error)
+		}
+		for _, f := range res.Failures {
+			fmt.Fprintf(w, "      %s\n", f)
+		}
+	}
+	_, err := fmt.Fprintf(w, "\n%d checks, %d passed, %d failed in %v\n",
+		len(r.Results), len(r.Results)-r.Failed(), r.Failed(), r.Duration.Round(time.Millisecond))
+	return err
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Errors   int         `xml:"errors,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as a JUnit XML test suite. Failed
+// assertions are failures, requests without response are errors.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suite := junitSuite{Name: r.Suite, Tests: len(r.Results), Time: seconds(r.Duration)}
+	for _, res := range r.Results {
+		c := junitCase{Name: res.Name, ClassName: r.Suite, Time: seconds(res.Duration)}
+		switch {
+		case res.Error != "":
+			suite.Errors++
+			c.Error = &junitFailure{Message: res.Error, Text: res.Method + " " + res.URL}
+		case len(res.Failures) > 0:
+			suite.Failures++
+			c.Failure = &junitFailure{Message: res.Failures[0], Text: strings.Join(res.Failures, "\n")}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
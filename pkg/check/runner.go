@@ -0,0 +1,298 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bhojpur/web/pkg/client/httplib"
+)
+
+// response collects what httplib.Client hands to the carriers
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+func (r *response) SetStatusCode(status int)             { r.status = status }
+func (r *response) SetHeader(header map[string][]string) { r.header = header }
+func (r *response) SetBytes(body []byte)                 { r.body = body }
+
+// Run runs the checks of the suite one after the other. It returns an error
+// only if the context is cancelled; failed checks end up in the report.
+func (s *Suite) Run(ctx context.Context, opts ...httplib.ClientOption) (*Report, error) {
+	client, err := httplib.NewClient(s.Name, strings.TrimSuffix(s.Endpoint, "/"), opts...)
+	if err != nil {
+		return nil, err
+	}
+	begin := time.Now()
+	report := &Report{Suite: s.Name, Endpoint: s.Endpoint}
+	for _, c := range s.Checks {
+		if err := ctx.Err(); err != nil {
+			report.Duration = time.Since(begin)
+			return report, err
+		}
+		report.Results = append(report.Results, s.run(client, c))
+	}
+	report.Duration = time.Since(begin)
+	return report, nil
+}
+
+func (s *Suite) run(client *httplib.Client, c *Check) *Result {
+	res := &Result{Name: c.Name, Method: c.Request.Method, URL: client.Endpoint + c.Request.Path}
+
+	reqOpts := []httplib.BhojpurHTTPRequestOption{httplib.WithTimeout(c.timeout, c.timeout)}
+	for k, v := range s.Defaults.Headers {
+		if _, ok := c.Request.Headers[k]; !ok {
+			reqOpts = append(reqOpts, httplib.WithHeader(k, v))
+		}
+	}
+	for k, v := range c.Request.Headers {
+		reqOpts = append(reqOpts, httplib.WithHeader(k, v))
+	}
+	for k, v := range c.Request.Params {
+		reqOpts = append(reqOpts, httplib.WithParam(k, v))
+	}
+	var body interface{}
+	if c.Request.Body != "" {
+		body = c.Request.Body
+	}
+	if c.Request.JSON != nil {
+		data, err := json.Marshal(jsonCompatible(c.Request.JSON))
+		if err != nil {
+			res.Error = err.Error()
+			return res
+		}
+		body = data
+		reqOpts = append(reqOpts, httplib.WithContentType("application/json"))
+	}
+
+	resp := &response{}
+	begin := time.Now()
+	var err error
+	switch c.Request.Method {
+	case http.MethodGet:
+		err = client.Get(resp, c.Request.Path, reqOpts...)
+	case http.MethodPost:
+		err = client.Post(resp, c.Request.Path, body, reqOpts...)
+	case http.MethodPut:
+		err = client.Put(resp, c.Request.Path, body, reqOpts...)
+	case http.MethodDelete:
+		err = client.Delete(resp, c.Request.Path, reqOpts...)
+	case http.MethodHead:
+		err = client.Head(resp, c.Request.Path, reqOpts...)
+	}
+	res.Duration = time.Since(begin)
+	// the client also tries to decode the body into resp, which fails for
+	// anything but JSON, YAML and XML; only a missing response is an error
+	if resp.status == 0 {
+		if err == nil {
+			err = fmt.Errorf("no response")
+		}
+		res.Error = err.Error()
+		return res
+	}
+	res.Status = resp.status
+	res.Failures = c.Expect.verify(resp, res.Duration, c.maxLatency)
+	return res
+}
+
+func (e *Expect) verify(resp *response, latency, maxLatency time.Duration) []string {
+	var failures []string
+	fail := func(format string, a ...interface{}) {
+		failures = append(failures, fmt.Sprintf(format, a...))
+	}
+
+	if len(e.Status) > 0 {
+		ok := false
+		for _, s := range e.Status {
+			ok = ok || s == resp.status
+		}
+		if !ok {
+			fail("status %d, expected %v", resp.status, []int(e.Status))
+		}
+	} else if resp.status < 200 || resp.status > 299 {
+		fail("status %d, expected 2xx", resp.status)
+	}
+	if maxLatency > 0 && latency > maxLatency {
+		fail("latency %v over budget of %v", latency.Round(time.Millisecond), maxLatency)
+	}
+	for name, re := range e.headers {
+		if v := http.Header(resp.header).Get(name); !re.MatchString(v) {
+			fail("header %s: %q does not match %s", name, v, re)
+		}
+	}
+	if e.Body != nil {
+		body := string(resp.body)
+		for _, msg := range e.Body.verify(body, utf8.RuneCountInString(body), true) {
+			fail("body: %s", msg)
+		}
+	}
+
+	if len(e.JSON) > 0 {
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(resp.body))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			fail("body is not json: %v", err)
+		} else {
+			for _, a := range e.JSON {
+				steps, _ := parseJSONPath(a.Path)
+				val, found := evalJSONPath(doc, steps)
+				for _, msg := range a.verify(jsonString(val), jsonLength(val), found) {
+					fail("%s: %s", a.Path, msg)
+				}
+			}
+		}
+	}
+
+	if len(e.XPath) > 0 {
+		doc, err := parseXML(resp.body)
+		if err != nil {
+			fail("body is not xml: %v", err)
+		} else {
+			for _, a := range e.XPath {
+				expr, _ := parseXPath(a.Path)
+				values := expr.eval(doc)
+				var val string
+				if len(values) > 0 {
+					val = values[0]
+				}
+				for _, msg := range a.verify(val, len(values), len(values) > 0) {
+					fail("%s: %s", a.Path, msg)
+				}
+			}
+		}
+	}
+	return failures
+}
+
+// verify returns what is wrong with a value found, or not, at the path
+func (a *Assertion) verify(val string, length int, found bool) []string {
+	if a.Exists != nil && *a.Exists != found {
+		if found {
+			return []string{"exists, expected it not to"}
+		}
+		return []string{"not found"}
+	}
+	if !found {
+		if a.Exists == nil {
+			return []string{"not found"}
+		}
+		return nil
+	}
+
+	var failures []string
+	if a.Equals != nil {
+		if want := expectedString(a.Equals); val != want {
+			failures = append(failures, fmt.Sprintf("%q, expected %q", val, want))
+		}
+	}
+	if a.Contains != "" && !strings.Contains(val, a.Contains) {
+		failures = append(failures, fmt.Sprintf("%q does not contain %q", val, a.Contains))
+	}
+	if a.matches != nil && !a.matches.MatchString(val) {
+		failures = append(failures, fmt.Sprintf("%q does not match %s", val, a.Matches))
+	}
+	if a.Length != nil && length != *a.Length {
+		failures = append(failures, fmt.Sprintf("length %d, expected %d", length, *a.Length))
+	}
+	return failures
+}
+
+// expectedString formats an Equals value from YAML or JSON like jsonString
+// formats the value it is compared with
+func expectedString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(jsonCompatible(t))
+		return string(data)
+	}
+	return fmt.Sprint(v)
+}
+
+// jsonString formats a value decoded with UseNumber: strings unquoted,
+// numbers as written, objects and arrays as compact JSON
+func jsonString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case bool:
+		return strconv.FormatBool(t)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func jsonLength(v interface{}) int {
+	switch t := v.(type) {
+	case string:
+		return utf8.RuneCountInString(t)
+	case []interface{}:
+		return len(t)
+	case map[string]interface{}:
+		return len(t)
+	}
+	return 0
+}
+
+// jsonCompatible converts the map[interface{}]interface{} of YAML documents
+// so that encoding/json can marshal them
+func jsonCompatible(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[fmt.Sprint(k)] = jsonCompatible(val)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, val := range t {
+			m[k] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, val := range t {
+			s[i] = jsonCompatible(val)
+		}
+		return s
+	}
+	return v
+}
@@ -0,0 +1,302 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements a declarative HTTP assertion runner. A suite lists requests
+// against an endpoint together with the expected status codes, headers,
+// JSONPath/XPath body values and latency budgets. Suites are YAML or JSON,
+// environment variables in them are expanded, and the requests are sent
+// with httplib.Client.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/check"
+//	)
+//
+//	suite, err := check.LoadSuite("smoke.yaml")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	report, err := suite.Run(context.Background())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	report.WriteText(os.Stdout)
+//	if !report.Passed() {
+//		os.Exit(1)
+//	}
+//
+// A suite looks like this:
+//
+//	name: blog
+//	endpoint: https://blog.bhojpur.net
+//	defaults:
+//	  timeout: 5s
+//	  headers:
+//	    Authorization: Bearer ${BLOG_TOKEN}
+//	checks:
+//	  - name: healthcheck
+//	    request:
+//	      path: /healthcheck
+//	    expect:
+//	      status: 200
+//	      max_latency: 300ms
+//	  - name: create post
+//	    request:
+//	      method: POST
+//	      path: /api/posts
+//	      json: {title: hello}
+//	    expect:
+//	      status: [200, 201]
+//	      headers:
+//	        Content-Type: ^application/json
+//	      json:
+//	        - path: $.title
+//	          equals: hello
+//	        - path: $.tags
+//	          length: 0
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Suite is a named list of checks against one endpoint
+type Suite struct {
+	Name     string   `yaml:"name" json:"name"`
+	Endpoint string   `yaml:"endpoint" json:"endpoint"`
+	Defaults Defaults `yaml:"defaults" json:"defaults"`
+	Checks   []*Check `yaml:"checks" json:"checks"`
+}
+
+// Defaults apply to every check of a suite
+type Defaults struct {
+	Timeout    string            `yaml:"timeout" json:"timeout"`
+	MaxLatency string            `yaml:"max_latency" json:"max_latency"`
+	Headers    map[string]string `yaml:"headers" json:"headers"`
+}
+
+// Check is a single request and what its response must look like
+type Check struct {
+	Name    string  `yaml:"name" json:"name"`
+	Request Request `yaml:"request" json:"request"`
+	Expect  Expect  `yaml:"expect" json:"expect"`
+
+	timeout    time.Duration
+	maxLatency time.Duration
+}
+
+// Request describes the request of a check. Params are sent as query for
+// GET, HEAD and DELETE and as form otherwise; Body and JSON are exclusive.
+type Request struct {
+	Method  string            `yaml:"method" json:"method"`
+	Path    string            `yaml:"path" json:"path"`
+	Headers map[string]string `yaml:"headers" json:"headers"`
+	Params  map[string]string `yaml:"params" json:"params"`
+	Body    string            `yaml:"body" json:"body"`
+	JSON    interface{}       `yaml:"json" json:"json"`
+	Timeout string            `yaml:"timeout" json:"timeout"`
+}
+
+// Expect holds the assertions on a response. Header values are regular
+// expressions matched against the header.
+type Expect struct {
+	Status     StatusList        `yaml:"status" json:"status"`
+	MaxLatency string            `yaml:"max_latency" json:"max_latency"`
+	Headers    map[string]string `yaml:"headers" json:"headers"`
+	Body       *Assertion        `yaml:"body" json:"body"`
+	JSON       []*Assertion      `yaml:"json" json:"json"`
+	XPath      []*Assertion      `yaml:"xpath" json:"xpath"`
+
+	headers map[string]*regexp.Regexp
+}
+
+// Assertion checks the value found at Path. All of the set conditions must
+// hold. Equals compares with the string form of the value, Length is the
+// length of a string, array or object, or the number of XPath matches.
+type Assertion struct {
+	Path     string      `yaml:"path" json:"path"`
+	Exists   *bool       `yaml:"exists" json:"exists"`
+	Equals   interface{} `yaml:"equals" json:"equals"`
+	Contains string      `yaml:"contains" json:"contains"`
+	Matches  string      `yaml:"matches" json:"matches"`
+	Length   *int        `yaml:"length" json:"length"`
+
+	matches *regexp.Regexp
+}
+
+// StatusList is a list of accepted status codes. It can be written as a
+// single code or as a list.
+type StatusList []int
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (s *StatusList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var code int
+	if err := unmarshal(&code); err == nil {
+		*s = StatusList{code}
+		return nil
+	}
+	var codes []int
+	if err := unmarshal(&codes); err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (s *StatusList) UnmarshalJSON(data []byte) error {
+	var code int
+	if err := json.Unmarshal(data, &code); err == nil {
+		*s = StatusList{code}
+		return nil
+	}
+	var codes []int
+	if err := json.Unmarshal(data, &codes); err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// LoadSuite reads a suite from a .json, .yaml or .yml file
+func LoadSuite(filename string) (*Suite, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		format = "json"
+	}
+	return ParseSuite(format, data)
+}
+
+// ParseSuite parses and validates a suite in the given format, json or
+// yaml, after expanding environment variables in it
+func ParseSuite(format string, data []byte) (*Suite, error) {
+	data = []byte(os.ExpandEnv(string(data)))
+	suite := &Suite{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, suite)
+	case "yaml", "yml":
+		err = yaml.Unmarshal(data, suite)
+	default:
+		return nil, fmt.Errorf("check: unknown suite format %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return suite, suite.validate()
+}
+
+func (s *Suite) validate() error {
+	if len(s.Checks) == 0 {
+		return errors.New("check: suite has no checks")
+	}
+	timeout, err := parseDuration(s.Defaults.Timeout, 30*time.Second)
+	if err != nil {
+		return err
+	}
+	maxLatency, err := parseDuration(s.Defaults.MaxLatency, 0)
+	if err != nil {
+		return err
+	}
+	for i, c := range s.Checks {
+		if c.Name == "" {
+			c.Name = fmt.Sprintf("check %d", i+1)
+		}
+		if err := c.validate(timeout, maxLatency); err != nil {
+			return fmt.Errorf("check: %s: %v", c.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Check) validate(timeout, maxLatency time.Duration) error {
+	var err error
+	if c.timeout, err = parseDuration(c.Request.Timeout, timeout); err != nil {
+		return err
+	}
+	if c.maxLatency, err = parseDuration(c.Expect.MaxLatency, maxLatency); err != nil {
+		return err
+	}
+	c.Request.Method = strings.ToUpper(c.Request.Method)
+	switch c.Request.Method {
+	case "":
+		c.Request.Method = http.MethodGet
+	case http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodHead:
+	default:
+		return fmt.Errorf("unsupported method %s", c.Request.Method)
+	}
+	if c.Request.Body != "" && c.Request.JSON != nil {
+		return errors.New("request cannot have both body and json")
+	}
+
+	c.Expect.headers = make(map[string]*regexp.Regexp, len(c.Expect.Headers))
+	for name, expr := range c.Expect.Headers {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("header %s: %v", name, err)
+		}
+		c.Expect.headers[name] = re
+	}
+	assertions := append(append([]*Assertion{}, c.Expect.JSON...), c.Expect.XPath...)
+	if c.Expect.Body != nil {
+		assertions = append(assertions, c.Expect.Body)
+	}
+	for _, a := range assertions {
+		if a.Matches != "" {
+			if a.matches, err = regexp.Compile(a.Matches); err != nil {
+				return fmt.Errorf("%s: %v", a.Path, err)
+			}
+		}
+	}
+	for _, a := range c.Expect.JSON {
+		if _, err := parseJSONPath(a.Path); err != nil {
+			return err
+		}
+	}
+	for _, a := range c.Expect.XPath {
+		if _, err := parseXPath(a.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
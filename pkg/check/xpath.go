@@ -0,0 +1,244 @@
+package check
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type xmlNode struct {
+	name     string
+	attrs    map[string]string
+	children []*xmlNode
+	// text is the character data directly inside the element, in order
+	text []string
+}
+
+// value is the XPath string-value: all character data of the subtree
+func (n *xmlNode) value() string {
+	var b strings.Builder
+	var walk func(n *xmlNode)
+	walk = func(n *xmlNode) {
+		for _, t := range n.text {
+			b.WriteString(t)
+		}
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.TrimSpace(b.String())
+}
+
+// parseXML returns a document node whose only child is the root element.
+// Namespaces are dropped, elements are matched by local name.
+func parseXML(data []byte) (*xmlNode, error) {
+	doc := &xmlNode{}
+	stack := []*xmlNode{doc}
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	dec.Strict = false
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		top := stack[len(stack)-1]
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local, attrs: make(map[string]string, len(t.Attr))}
+			for _, a := range t.Attr {
+				n.attrs[a.Name.Local] = a.Value
+			}
+			top.children = append(top.children, n)
+			stack = append(stack, n)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			top.text = append(top.text, string(t))
+		}
+	}
+	if len(doc.children) == 0 {
+		return nil, fmt.Errorf("check: no xml element in body")
+	}
+	return doc, nil
+}
+
+type xpathStep struct {
+	descendant bool
+	name       string // element name or *
+	position   int    // 1-based [n] predicate, 0 if none
+	attrName   string // [@name='value'] predicate
+	attrValue  string
+}
+
+type xpathExpr struct {
+	steps []xpathStep
+	// attr or text select from the matched elements instead of the elements
+	attr string
+	text bool
+}
+
+// parseXPath parses the subset of XPath made of child and descendant steps
+// with element names or *, [n] and [@attr='value'] predicates, ending in an
+// optional @attr or text() step: //entry[1]/title, /feed/link[@rel='self']/@href
+func parseXPath(path string) (*xpathExpr, error) {
+	p := strings.TrimSpace(path)
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("check: xpath %q must be absolute", path)
+	}
+	expr := &xpathExpr{}
+	for len(p) > 0 {
+		if expr.attr != "" || expr.text {
+			return nil, fmt.Errorf("check: @attr and text() must be the last step of xpath %q", path)
+		}
+		var step xpathStep
+		if strings.HasPrefix(p, "//") {
+			step.descendant = true
+			p = p[2:]
+		} else if strings.HasPrefix(p, "/") {
+			p = p[1:]
+		} else {
+			return nil, fmt.Errorf("check: bad xpath %q", path)
+		}
+		end := stepEnd(p)
+		s := p[:end]
+		p = p[end:]
+
+		switch {
+		case s == "text()":
+			expr.text = true
+			continue
+		case strings.HasPrefix(s, "@"):
+			expr.attr = s[1:]
+			continue
+		}
+		if i := strings.IndexByte(s, '['); i >= 0 {
+			if !strings.HasSuffix(s, "]") {
+				return nil, fmt.Errorf("check: unclosed [ in xpath %q", path)
+			}
+			pred := s[i+1 : len(s)-1]
+			s = s[:i]
+			if strings.HasPrefix(pred, "@") {
+				kv := strings.SplitN(pred[1:], "=", 2)
+				if len(kv) != 2 {
+					return nil, fmt.Errorf("check: bad predicate [%s] in xpath %q", pred, path)
+				}
+				step.attrName = strings.TrimSpace(kv[0])
+				step.attrValue = strings.Trim(strings.TrimSpace(kv[1]), `'"`)
+			} else {
+				n, err := strconv.Atoi(pred)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("check: bad predicate [%s] in xpath %q", pred, path)
+				}
+				step.position = n
+			}
+		}
+		if s == "" {
+			return nil, fmt.Errorf("check: empty step in xpath %q", path)
+		}
+		step.name = s
+		expr.steps = append(expr.steps, step)
+	}
+	return expr, nil
+}
+
+// stepEnd returns the end of the step at the start of p, skipping slashes
+// inside predicates
+func stepEnd(p string) int {
+	depth := 0
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '/':
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(p)
+}
+
+// eval returns the string values of all matches
+func (x *xpathExpr) eval(doc *xmlNode) []string {
+	nodes := []*xmlNode{doc}
+	for _, step := range x.steps {
+		var next []*xmlNode
+		for _, n := range nodes {
+			var candidates []*xmlNode
+			collect(n, step, &candidates)
+			if step.position > 0 {
+				if step.position <= len(candidates) {
+					next = append(next, candidates[step.position-1])
+				}
+				continue
+			}
+			next = append(next, candidates...)
+		}
+		nodes = next
+	}
+
+	var res []string
+	for _, n := range nodes {
+		switch {
+		case x.attr != "":
+			if v, ok := n.attrs[x.attr]; ok {
+				res = append(res, v)
+			}
+		case x.text:
+			res = append(res, strings.TrimSpace(strings.Join(n.text, "")))
+		default:
+			res = append(res, n.value())
+		}
+	}
+	return res
+}
+
+func collect(n *xmlNode, step xpathStep, out *[]*xmlNode) {
+	for _, c := range n.children {
+		if (step.name == "*" || step.name == c.name) && matchAttr(c, step) {
+			*out = append(*out, c)
+		}
+		if step.descendant {
+			collect(c, step, out)
+		}
+	}
+}
+
+func matchAttr(n *xmlNode, step xpathStep) bool {
+	if step.attrName == "" {
+		return true
+	}
+	v, ok := n.attrs[step.attrName]
+	return ok && v == step.attrValue
+}
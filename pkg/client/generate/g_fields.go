@@ -0,0 +1,262 @@
+package generate
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	cliLogger "github.com/bhojpur/web/pkg/client/logger"
+	"github.com/bhojpur/web/pkg/client/logger/colors"
+)
+
+// fieldsFileName is the file of the typed fields generated in the models
+// package
+const fieldsFileName = "orm_fields.go"
+
+const ormImportPath = "github.com/bhojpur/web/pkg/client/orm"
+
+type modelFields struct {
+	name   string
+	fields []modelField
+}
+
+type modelField struct {
+	name string
+	// typ is the accessor type, e.g. orm.Field[User, int]
+	typ string
+	// ctor is the accessor constructor, e.g. orm.NewField[User, int]
+	ctor string
+}
+
+// GenerateFields generates the typed orm fields of the models of the package
+// in dir, to build orm.Query conditions checked at compile time. The models
+// are the exported structs with a field tagged `orm` or named Id or ID.
+func GenerateFields(dir, currpath string) {
+	w := colors.NewColorWriter(os.Stdout)
+
+	if !path.IsAbs(dir) {
+		dir = path.Join(currpath, dir)
+	}
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		name := info.Name()
+		return !strings.HasSuffix(name, "_test.go") && name != fieldsFileName
+	}, 0)
+	if err != nil {
+		cliLogger.Log.Fatalf("Could not parse the models package: %s", err)
+	}
+	if len(pkgs) != 1 {
+		cliLogger.Log.Fatalf("Expected one package in '%s', found %d", dir, len(pkgs))
+	}
+
+	var (
+		packageName string
+		models      []modelFields
+		imports     = map[string]string{ormImportPath: "orm"}
+	)
+	for name, pkg := range pkgs {
+		packageName = name
+		files := make([]string, 0, len(pkg.Files))
+		for file := range pkg.Files {
+			files = append(files, file)
+		}
+		sort.Strings(files)
+		for _, file := range files {
+			models = append(models, fileModelFields(fset, pkg.Files[file], imports)...)
+		}
+	}
+	if len(models) == 0 {
+		cliLogger.Log.Fatalf("Could not find any model in '%s'", dir)
+	}
+
+	source, err := fieldsSource(packageName, models, imports)
+	if err != nil {
+		cliLogger.Log.Fatalf("Could not generate the fields: %s", err)
+	}
+	fpath := path.Join(dir, fieldsFileName)
+	if err := os.WriteFile(fpath, source, 0666); err != nil {
+		cliLogger.Log.Fatalf("Could not create fields file: %s", err)
+	}
+	fmt.Fprintf(w, "\t%s%screate%s\t %s%s\n", "\x1b[32m", "\x1b[1m", "\x1b[21m", fpath, "\x1b[0m")
+}
+
+// fileModelFields returns the fields of the models of file, and adds the
+// imports their types need to imports
+func fileModelFields(fset *token.FileSet, file *ast.File, imports map[string]string) []modelFields {
+	fileImports := make(map[string]string, len(file.Imports))
+	for _, spec := range file.Imports {
+		importPath, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(importPath)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		fileImports[name] = importPath
+	}
+
+	var models []modelFields
+	for _, decl := range file.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok || !ts.Name.IsExported() || ts.TypeParams != nil || !isModelStruct(st) {
+				continue
+			}
+			model := modelFields{name: ts.Name.Name}
+			for _, field := range st.Fields.List {
+				tag := ""
+				if field.Tag != nil {
+					tag, _ = strconv.Unquote(field.Tag.Value)
+				}
+				orm := reflect.StructTag(tag).Get("orm")
+				if len(field.Names) == 0 || orm == "-" || strings.Contains(orm, "reverse(") || strings.Contains(orm, "rel(m2m)") {
+					continue
+				}
+				typ := field.Type
+				isRel := strings.Contains(orm, "rel(fk)") || strings.Contains(orm, "rel(one)")
+				if star, ok := typ.(*ast.StarExpr); ok && isRel {
+					typ = star.X
+				}
+				usedImports(typ, fileImports, imports)
+				typeName := exprString(fset, typ)
+				for _, name := range field.Names {
+					if !name.IsExported() {
+						continue
+					}
+					f := modelField{name: name.Name}
+					switch {
+					case isRel:
+						f.typ = fmt.Sprintf("orm.Rel[%s, %s]", model.name, typeName)
+						f.ctor = fmt.Sprintf("orm.NewRel[%s, %s]", model.name, typeName)
+					case typeName == "string":
+						f.typ = fmt.Sprintf("orm.StringField[%s]", model.name)
+						f.ctor = fmt.Sprintf("orm.NewStringField[%s]", model.name)
+					default:
+						f.typ = fmt.Sprintf("orm.Field[%s, %s]", model.name, typeName)
+						f.ctor = fmt.Sprintf("orm.NewField[%s, %s]", model.name, typeName)
+					}
+					model.fields = append(model.fields, f)
+				}
+			}
+			models = append(models, model)
+		}
+	}
+	return models
+}
+
+// isModelStruct tells if st has a field tagged `orm` or named Id or ID
+func isModelStruct(st *ast.StructType) bool {
+	for _, field := range st.Fields.List {
+		if field.Tag != nil {
+			if tag, err := strconv.Unquote(field.Tag.Value); err == nil {
+				if _, ok := reflect.StructTag(tag).Lookup("orm"); ok {
+					return true
+				}
+			}
+		}
+		for _, name := range field.Names {
+			if name.Name == "Id" || name.Name == "ID" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usedImports adds the imports of the packages typ refers to to imports
+func usedImports(typ ast.Expr, fileImports, imports map[string]string) {
+	ast.Inspect(typ, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok {
+				if importPath, ok := fileImports[ident.Name]; ok {
+					imports[importPath] = ident.Name
+				}
+			}
+			return false
+		}
+		return true
+	})
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+// fieldsSource returns the formatted source of the fields file
+func fieldsSource(packageName string, models []modelFields, imports map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("// Code generated by webutl generate fields. DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\nimport (\n", packageName)
+	paths := make([]string, 0, len(imports))
+	for importPath := range imports {
+		paths = append(paths, importPath)
+	}
+	// the standard library first, then the other packages
+	sort.Slice(paths, func(i, j int) bool {
+		iStd, jStd := !strings.Contains(paths[i], "."), !strings.Contains(paths[j], ".")
+		if iStd != jStd {
+			return iStd
+		}
+		return paths[i] < paths[j]
+	})
+	for i, importPath := range paths {
+		if i > 0 && !strings.Contains(paths[i-1], ".") && strings.Contains(importPath, ".") {
+			buf.WriteString("\n")
+		}
+		if name := imports[importPath]; name != path.Base(importPath) {
+			fmt.Fprintf(&buf, "\t%s %q\n", name, importPath)
+		} else {
+			fmt.Fprintf(&buf, "\t%q\n", importPath)
+		}
+	}
+	buf.WriteString(")\n")
+
+	for _, model := range models {
+		fmt.Fprintf(&buf, "\n// %sFields are the typed fields of %s for orm.Query\n", model.name, model.name)
+		fmt.Fprintf(&buf, "var %sFields = struct {\n", model.name)
+		for _, f := range model.fields {
+			fmt.Fprintf(&buf, "\t%s %s\n", f.name, f.typ)
+		}
+		buf.WriteString("}{\n")
+		for _, f := range model.fields {
+			fmt.Fprintf(&buf, "\t%s: %s(%q),\n", f.name, f.ctor, f.name)
+		}
+		buf.WriteString("}\n")
+	}
+	return format.Source(buf.Bytes())
+}
@@ -356,7 +356,13 @@ func (d *dbBase) Read(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.Lo
 		forUpdate = "FOR UPDATE"
 	}
 
-	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ? %s", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q, forUpdate)
+	// soft deleted rows are not read, as with QuerySetter
+	softDelete := ""
+	if fi := mi.fields.softDelete; fi != nil {
+		softDelete = fmt.Sprintf("AND %s%s%s IS NULL ", Q, fi.column, Q)
+	}
+
+	query := fmt.Sprintf("SELECT %s%s%s FROM %s%s%s WHERE %s%s%s = ? %s%s", Q, sels, Q, Q, mi.table, Q, Q, wheres, Q, softDelete, forUpdate)
 
 	refs := make([]interface{}, colsNum)
 	for i := range refs {
@@ -669,6 +675,22 @@ func (d *dbBase) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 		}
 	}
 
+	// the update bumps the version, and only applies to the version read
+	version := mi.fields.version
+	var versionValue int64
+	if version != nil {
+		for i, col := range setNames {
+			if col == version.column {
+				setNames = append(setNames[:i], setNames[i+1:]...)
+				setValues = append(setValues[:i], setValues[i+1:]...)
+				break
+			}
+		}
+		versionValue = getVersion(ind, version)
+		setNames = append(setNames, version.column)
+		setValues = append(setValues, versionValue+1)
+	}
+
 	setValues = append(setValues, pkValue)
 
 	Q := d.ins.TableQuote()
@@ -677,14 +699,45 @@ func (d *dbBase) Update(q dbQuerier, mi *modelInfo, ind reflect.Value, tz *time.
 	setColumns := strings.Join(setNames, sep)
 
 	query := fmt.Sprintf("UPDATE %s%s%s SET %s%s%s = ? WHERE %s%s%s = ?", Q, mi.table, Q, Q, setColumns, Q, Q, pkName, Q)
+	if version != nil {
+		query += fmt.Sprintf(" AND %s%s%s = ?", Q, version.column, Q)
+		setValues = append(setValues, versionValue)
+	}
 
 	d.ins.ReplaceMarks(&query)
 
 	res, err := q.Exec(query, setValues...)
-	if err == nil {
-		return res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	num, err := res.RowsAffected()
+	if err != nil || version == nil {
+		return num, err
+	}
+	if num == 0 {
+		return 0, &StaleObjectError{Table: mi.table, Pk: pkValue, Version: versionValue}
+	}
+	setVersion(ind, version, versionValue+1)
+	return num, nil
+}
+
+// getVersion returns the value of the version field of the model
+func getVersion(ind reflect.Value, fi *fieldInfo) int64 {
+	field := ind.FieldByIndex(fi.fieldIndex)
+	if fi.fieldType&IsPositiveIntegerField > 0 {
+		return int64(field.Uint())
+	}
+	return field.Int()
+}
+
+// setVersion sets the version field of the model
+func setVersion(ind reflect.Value, fi *fieldInfo, version int64) {
+	field := ind.FieldByIndex(fi.fieldIndex)
+	if fi.fieldType&IsPositiveIntegerField > 0 {
+		field.SetUint(uint64(version))
+	} else {
+		field.SetInt(version)
 	}
-	return 0, err
 }
 
 // execute delete sql dbQuerier with given struct reflect.Value.
@@ -760,6 +813,18 @@ func (d *dbBase) UpdateBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Con
 		panic(fmt.Errorf("update params cannot empty"))
 	}
 
+	// the versions of the rows move on, so the models read before are stale
+	if fi := mi.fields.version; fi != nil {
+		versioned := false
+		for _, col := range columns {
+			versioned = versioned || col == fi.column
+		}
+		if !versioned {
+			columns = append(columns, fi.column)
+			values = append(values, ColValue(ColAdd, 1))
+		}
+	}
+
 	tables := newDbTables(mi, d.ins)
 	var specifyIndexes string
 	if qs != nil {
@@ -984,12 +1049,88 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 		}
 	}
 
+	query, args, tCols, tables, colsNum, err := d.readBatchSQL(qs, mi, cond, tz, cols)
+	if err != nil {
+		return 0, err
+	}
+
+	var rs *sql.Rows
+	if qs != nil && qs.forContext {
+		rs, err = q.QueryContext(qs.ctx, query, args...)
+		if err != nil {
+			return 0, err
+		}
+	} else {
+		rs, err = q.Query(query, args...)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	refs := make([]interface{}, colsNum)
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+
+	defer rs.Close()
+
+	slice := ind
+
+	var cnt int64
+	for rs.Next() {
+		if one && cnt == 0 || !one {
+			mind, err := d.readBatchRow(rs, refs, mi, tCols, tables, tz)
+			if err != nil {
+				return 0, err
+			}
+
+			if one {
+				ind.Set(mind)
+			} else {
+				if cnt == 0 {
+					// you can use a empty & caped container list
+					// orm will not replace it
+					if ind.Len() != 0 {
+						// if container is not empty
+						// create a new one
+						slice = reflect.New(ind.Type()).Elem()
+					}
+				}
+
+				if isPtr {
+					slice = reflect.Append(slice, mind.Addr())
+				} else {
+					slice = reflect.Append(slice, mind)
+				}
+			}
+		}
+		cnt++
+	}
+
+	if !one {
+		if cnt > 0 {
+			ind.Set(slice)
+		} else {
+			// when a result is empty and container is nil
+			// to set a empty container
+			if ind.IsNil() {
+				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
+			}
+		}
+	}
+
+	return cnt, nil
+}
+
+// readBatchSQL builds the SELECT of ReadBatch, and returns it with its args,
+// the columns of the model it reads and the tables it joins
+func (d *dbBase) readBatchSQL(qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (query string, args []interface{}, tCols []string, tables *dbTables, colsNum int, err error) {
 	rlimit := qs.limit
 	offset := qs.offset
 
 	Q := d.ins.TableQuote()
 
-	var tCols []string
 	if len(cols) > 0 {
 		hasRel := len(qs.related) > 0 || qs.relDepth > 0
 		tCols = make([]string, 0, len(cols))
@@ -1004,7 +1145,7 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 					maps[fi.column] = true
 				}
 			} else {
-				return 0, fmt.Errorf("wrong field/column name `%s`", col)
+				return "", nil, nil, nil, 0, fmt.Errorf("wrong field/column name `%s`", col)
 			}
 		}
 		if hasRel {
@@ -1020,11 +1161,11 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 		tCols = mi.fields.dbcols
 	}
 
-	colsNum := len(tCols)
+	colsNum = len(tCols)
 	sep := fmt.Sprintf("%s, T0.%s", Q, Q)
 	sels := fmt.Sprintf("T0.%s%s%s", Q, strings.Join(tCols, sep), Q)
 
-	tables := newDbTables(mi, d.ins)
+	tables = newDbTables(mi, d.ins)
 	tables.parseRelated(qs.related, qs.relDepth)
 
 	where, args := tables.getCondSQL(cond, false, tz)
@@ -1046,7 +1187,7 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 	if qs.distinct {
 		sqlSelect += " DISTINCT"
 	}
-	query := fmt.Sprintf("%s %s FROM %s%s%s T0 %s%s%s%s%s%s",
+	query = fmt.Sprintf("%s %s FROM %s%s%s T0 %s%s%s%s%s%s",
 		sqlSelect, sels, Q, mi.table, Q,
 		specifyIndexes, join, where, groupBy, orderBy, limit)
 
@@ -1056,125 +1197,93 @@ func (d *dbBase) ReadBatch(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condi
 
 	d.ins.ReplaceMarks(&query)
 
-	var rs *sql.Rows
-	var err error
-	if qs != nil && qs.forContext {
-		rs, err = q.QueryContext(qs.ctx, query, args...)
-		if err != nil {
-			return 0, err
-		}
-	} else {
-		rs, err = q.Query(query, args...)
-		if err != nil {
-			return 0, err
-		}
-	}
+	return query, args, tCols, tables, colsNum, nil
+}
 
-	refs := make([]interface{}, colsNum)
-	for i := range refs {
-		var ref interface{}
-		refs[i] = &ref
+// readBatchRow scans the current row of rs into a new model, together with
+// the related models of the tables joined
+func (d *dbBase) readBatchRow(rs *sql.Rows, refs []interface{}, mi *modelInfo, tCols []string, tables *dbTables, tz *time.Location) (reflect.Value, error) {
+	if err := rs.Scan(refs...); err != nil {
+		return reflect.Value{}, err
 	}
 
-	defer rs.Close()
+	elm := reflect.New(mi.addrField.Elem().Type())
+	mind := reflect.Indirect(elm)
 
-	slice := ind
+	cacheV := make(map[string]*reflect.Value)
+	cacheM := make(map[string]*modelInfo)
+	trefs := refs
 
-	var cnt int64
-	for rs.Next() {
-		if one && cnt == 0 || !one {
-			if err := rs.Scan(refs...); err != nil {
-				return 0, err
-			}
+	d.setColsValues(mi, &mind, tCols, refs[:len(tCols)], tz)
+	trefs = refs[len(tCols):]
 
-			elm := reflect.New(mi.addrField.Elem().Type())
-			mind := reflect.Indirect(elm)
-
-			cacheV := make(map[string]*reflect.Value)
-			cacheM := make(map[string]*modelInfo)
-			trefs := refs
-
-			d.setColsValues(mi, &mind, tCols, refs[:len(tCols)], tz)
-			trefs = refs[len(tCols):]
-
-			for _, tbl := range tables.tables {
-				// loop selected tables
-				if tbl.sel {
-					last := mind
-					names := ""
-					mmi := mi
-					// loop cascade models
-					for _, name := range tbl.names {
-						names += name
-						if val, ok := cacheV[names]; ok {
-							last = *val
-							mmi = cacheM[names]
-						} else {
-							fi := mmi.fields.GetByName(name)
-							lastm := mmi
-							mmi = fi.relModelInfo
-							field := last
-							if last.Kind() != reflect.Invalid {
-								field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
-								if field.IsValid() {
-									d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
-									for _, fi := range mmi.fields.fieldsReverse {
-										if fi.inModel && fi.reverseFieldInfo.mi == lastm {
-											if fi.reverseFieldInfo != nil {
-												f := field.FieldByIndex(fi.fieldIndex)
-												if f.Kind() == reflect.Ptr {
-													f.Set(last.Addr())
-												}
-											}
+	for _, tbl := range tables.tables {
+		// loop selected tables
+		if tbl.sel {
+			last := mind
+			names := ""
+			mmi := mi
+			// loop cascade models
+			for _, name := range tbl.names {
+				names += name
+				if val, ok := cacheV[names]; ok {
+					last = *val
+					mmi = cacheM[names]
+				} else {
+					fi := mmi.fields.GetByName(name)
+					lastm := mmi
+					mmi = fi.relModelInfo
+					field := last
+					if last.Kind() != reflect.Invalid {
+						field = reflect.Indirect(last.FieldByIndex(fi.fieldIndex))
+						if field.IsValid() {
+							d.setColsValues(mmi, &field, mmi.fields.dbcols, trefs[:len(mmi.fields.dbcols)], tz)
+							for _, fi := range mmi.fields.fieldsReverse {
+								if fi.inModel && fi.reverseFieldInfo.mi == lastm {
+									if fi.reverseFieldInfo != nil {
+										f := field.FieldByIndex(fi.fieldIndex)
+										if f.Kind() == reflect.Ptr {
+											f.Set(last.Addr())
 										}
 									}
-									last = field
 								}
 							}
-							cacheV[names] = &field
-							cacheM[names] = mmi
+							last = field
 						}
 					}
-					trefs = trefs[len(mmi.fields.dbcols):]
-				}
-			}
-
-			if one {
-				ind.Set(mind)
-			} else {
-				if cnt == 0 {
-					// you can use a empty & caped container list
-					// orm will not replace it
-					if ind.Len() != 0 {
-						// if container is not empty
-						// create a new one
-						slice = reflect.New(ind.Type()).Elem()
-					}
-				}
-
-				if isPtr {
-					slice = reflect.Append(slice, mind.Addr())
-				} else {
-					slice = reflect.Append(slice, mind)
+					cacheV[names] = &field
+					cacheM[names] = mmi
 				}
 			}
+			trefs = trefs[len(mmi.fields.dbcols):]
 		}
-		cnt++
 	}
+	return mind, nil
+}
 
-	if !one {
-		if cnt > 0 {
-			ind.Set(slice)
-		} else {
-			// when a result is empty and container is nil
-			// to set a empty container
-			if ind.IsNil() {
-				ind.Set(reflect.MakeSlice(ind.Type(), 0, 0))
-			}
-		}
+// read the rows of the query set one at a time with a cursor.
+func (d *dbBase) ReadCursor(q dbQuerier, qs *querySet, mi *modelInfo, cond *Condition, tz *time.Location, cols []string) (Cursor, error) {
+	query, args, tCols, tables, colsNum, err := d.readBatchSQL(qs, mi, cond, tz, cols)
+	if err != nil {
+		return nil, err
 	}
 
-	return cnt, nil
+	var rs *sql.Rows
+	if qs.forContext {
+		rs, err = q.QueryContext(qs.ctx, query, args...)
+	} else {
+		rs, err = q.Query(query, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]interface{}, colsNum)
+	for i := range refs {
+		var ref interface{}
+		refs[i] = &ref
+	}
+	return &queryCursor{d: d, rs: rs, refs: refs, mi: mi, tCols: tCols, tables: tables, tz: tz}, nil
 }
 
 // excute count sql and return count result int64.
@@ -1944,6 +2053,11 @@ func (d *dbBase) IndexExists(dbQuerier, string, string) bool {
 	panic(ErrNotImplement)
 }
 
+// not implement.
+func (d *dbBase) GetTableSchema(dbQuerier, string) (*tableSchema, error) {
+	return nil, ErrNotImplement
+}
+
 // GenerateSpecifyIndex return a specifying index clause
 func (d *dbBase) GenerateSpecifyIndex(tableName string, useIndex int, indexes []string) string {
 	var s []string
@@ -286,6 +286,13 @@ type alias struct {
 	DbBaser         dbBaser
 	TZ              *time.Location
 	Engine          string
+
+	replicaSources   []string
+	replicas         []*replica
+	replicaPolicy    ReplicaPolicy
+	replicaNext      uint32
+	maxReplicaLag    time.Duration
+	replicaLagProber ReplicaLagProber
 }
 
 func detectTZ(al *alias) {
@@ -356,6 +363,7 @@ func addAliasWthDB(aliasName, driverName string, db *sql.DB, params ...DBOption)
 	}
 
 	if !dataBaseCache.add(aliasName, al) {
+		al.closeReplicas()
 		return nil, existErr
 	}
 
@@ -406,6 +414,10 @@ func newAliasWithDb(aliasName, driverName string, db *sql.DB, params ...DBOption
 
 	detectTZ(al)
 
+	if err := al.openReplicas(); err != nil {
+		return nil, err
+	}
+
 	return al, nil
 }
 
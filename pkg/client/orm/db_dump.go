@@ -0,0 +1,388 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// dumpHeader starts the rows of a table in a dump
+type dumpHeader struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// dumpBytes holds binary values in a dump
+type dumpBytes struct {
+	Base64 string `json:"$base64"`
+}
+
+// GetDBAliases returns the names of the registered databases
+func GetDBAliases() []string {
+	dataBaseCache.mux.RLock()
+	defer dataBaseCache.mux.RUnlock()
+	names := make([]string, 0, len(dataBaseCache.cache))
+	for name := range dataBaseCache.cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetDBDriverType returns the driver type of a registered database
+func GetDBDriverType(aliasName string) (DriverType, error) {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return 0, fmt.Errorf("DataBase of alias name `%s` not found", aliasName)
+	}
+	return al.Driver, nil
+}
+
+// DumpTables writes the rows of the tables of a registered database to w as
+// JSON lines: for every table a {"table": ..., "columns": [...]} line
+// followed by a JSON array per row. All tables are dumped if none are given.
+// The tables are read in a single read-only transaction, so the dump is a
+// consistent snapshot, and written with the tables referenced by the
+// foreign keys of the registered models first, see SortTables.
+func DumpTables(ctx context.Context, aliasName string, w io.Writer, tables ...string) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase of alias name `%s` not found", aliasName)
+	}
+	tx, err := al.DB.BeginTx(ctx, snapshotTxOptions(al.Driver))
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if len(tables) == 0 {
+		all, err := al.DbBaser.GetTables(tx)
+		if err != nil {
+			return err
+		}
+		for t := range all {
+			if !strings.HasPrefix(t, "sqlite_") {
+				tables = append(tables, t)
+			}
+		}
+	}
+	tables = SortTables(tables, modelReferences())
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	Q := al.DbBaser.TableQuote()
+	for _, table := range tables {
+		rows, err := tx.QueryContext(ctx, fmt.Sprintf("SELECT * FROM %s%s%s", Q, table, Q))
+		if err != nil {
+			return fmt.Errorf("dump table `%s`, %s", table, err)
+		}
+		err = dumpRows(enc, al, table, rows)
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("dump table `%s`, %s", table, err)
+		}
+	}
+	return bw.Flush()
+}
+
+// snapshotTxOptions returns the options of a transaction reading a
+// consistent snapshot of a database. A sqlite transaction reads a snapshot
+// in any case.
+func snapshotTxOptions(driver DriverType) *sql.TxOptions {
+	switch driver {
+	case DRMySQL, DRTiDB, DRPostgres:
+		return &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true}
+	}
+	return &sql.TxOptions{ReadOnly: true}
+}
+
+// modelReferences returns the tables referenced by the foreign keys of the
+// tables of the registered models
+func modelReferences() map[string][]string {
+	references := make(map[string][]string)
+	for _, mi := range modelCache.allOrdered() {
+		for _, fi := range mi.fields.fieldsRel {
+			if fi.fieldType == RelForeignKey || fi.fieldType == RelOneToOne {
+				references[mi.table] = append(references[mi.table], fi.relModelInfo.table)
+			}
+		}
+	}
+	return references
+}
+
+// SortTables returns tables ordered so that the tables a table references,
+// as listed in references, come before it, and alphabetically otherwise.
+// The tables of a reference cycle come last, alphabetically.
+func SortTables(tables []string, references map[string][]string) []string {
+	pending := append([]string(nil), tables...)
+	sort.Strings(pending)
+	listed := make(map[string]bool, len(pending))
+	for _, t := range pending {
+		listed[t] = true
+	}
+	sorted := make([]string, 0, len(pending))
+	done := make(map[string]bool, len(pending))
+	for len(pending) > 0 {
+		var rest []string
+		for _, t := range pending {
+			ready := true
+			for _, ref := range references[t] {
+				if ref != t && listed[ref] && !done[ref] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sorted = append(sorted, t)
+				done[t] = true
+			} else {
+				rest = append(rest, t)
+			}
+		}
+		if len(rest) == len(pending) {
+			return append(sorted, rest...)
+		}
+		pending = rest
+	}
+	return sorted
+}
+
+func dumpRows(enc *json.Encoder, al *alias, table string, rows *sql.Rows) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	if err := enc.Encode(&dumpHeader{Table: table, Columns: columns}); err != nil {
+		return err
+	}
+	values := make([]interface{}, len(columns))
+	ptrs := make([]interface{}, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		row := make([]interface{}, len(values))
+		for i, v := range values {
+			switch v := v.(type) {
+			case []byte:
+				if utf8.Valid(v) {
+					row[i] = string(v)
+				} else {
+					row[i] = &dumpBytes{Base64: base64.StdEncoding.EncodeToString(v)}
+				}
+			case time.Time:
+				if al.Driver == DRMySQL || al.Driver == DRTiDB {
+					row[i] = v.In(al.TZ).Format("2006-01-02 15:04:05.999999")
+				} else {
+					row[i] = v.Format(time.RFC3339Nano)
+				}
+			default:
+				row[i] = v
+			}
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// LoadTables replaces the rows of the tables in a dump written by DumpTables
+// with the dumped rows, in a single transaction. The tables must exist. The
+// foreign keys are not checked while the tables are loaded: on postgres, the
+// database user must be allowed to set session_replication_role, or the
+// tables are loaded in the order of the dump.
+func LoadTables(ctx context.Context, aliasName string, r io.Reader) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase of alias name `%s` not found", aliasName)
+	}
+	conn, err := al.DB.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	// sqlite ignores changes of foreign_keys inside a transaction
+	if al.Driver == DRSqlite {
+		var enabled int
+		if err := conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&enabled); err != nil {
+			return err
+		}
+		if enabled == 1 {
+			if _, err := conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+				return err
+			}
+			defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+		}
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := loadRows(ctx, al, tx, r); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func loadRows(ctx context.Context, al *alias, tx *sql.Tx, r io.Reader) error {
+	switch al.Driver {
+	case DRMySQL, DRTiDB:
+		if _, err := tx.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 0"); err != nil {
+			return err
+		}
+		defer tx.ExecContext(ctx, "SET FOREIGN_KEY_CHECKS = 1")
+	case DRPostgres:
+		// a failed SET aborts the transaction unless it is rolled back to
+		// a savepoint
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT load_tables"); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "SET LOCAL session_replication_role = replica"); err != nil {
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT load_tables"); err != nil {
+				return err
+			}
+		}
+	}
+
+	Q := al.DbBaser.TableQuote()
+	dec := json.NewDecoder(bufio.NewReader(r))
+	dec.UseNumber()
+	var (
+		header *dumpHeader
+		insert string
+	)
+	for {
+		var line json.RawMessage
+		if err := dec.Decode(&line); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("load dump, %s", err)
+		}
+		if len(line) > 0 && line[0] == '{' {
+			if header != nil {
+				if err := resetSequences(ctx, al, tx, header); err != nil {
+					return err
+				}
+			}
+			header = new(dumpHeader)
+			if err := json.Unmarshal(line, header); err != nil || header.Table == "" {
+				return fmt.Errorf("load dump, invalid table header %s", line)
+			}
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s%s%s", Q, header.Table, Q)); err != nil {
+				return fmt.Errorf("load table `%s`, %s", header.Table, err)
+			}
+			marks := make([]string, len(header.Columns))
+			for i := range marks {
+				marks[i] = "?"
+			}
+			sep := fmt.Sprintf("%s, %s", Q, Q)
+			insert = fmt.Sprintf("INSERT INTO %s%s%s (%s%s%s) VALUES (%s)",
+				Q, header.Table, Q, Q, strings.Join(header.Columns, sep), Q, strings.Join(marks, ", "))
+			al.DbBaser.ReplaceMarks(&insert)
+			continue
+		}
+		if header == nil {
+			return errors.New("load dump, rows before a table header")
+		}
+		var row []interface{}
+		if err := json.Unmarshal(line, &row); err != nil || len(row) != len(header.Columns) {
+			return fmt.Errorf("load table `%s`, invalid row %s", header.Table, line)
+		}
+		for i, v := range row {
+			row[i] = loadValue(v)
+		}
+		if _, err := tx.ExecContext(ctx, insert, row...); err != nil {
+			return fmt.Errorf("load table `%s`, %s", header.Table, err)
+		}
+	}
+	if header != nil {
+		return resetSequences(ctx, al, tx, header)
+	}
+	return nil
+}
+
+func loadValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		if s, ok := v["$base64"].(string); ok {
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err == nil {
+				return b
+			}
+		}
+	}
+	return v
+}
+
+// resetSequences moves the serial sequences of a postgres table past the
+// loaded rows
+func resetSequences(ctx context.Context, al *alias, tx *sql.Tx, header *dumpHeader) error {
+	if al.Driver != DRPostgres {
+		return nil
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT column_name FROM information_schema.columns "+
+		"WHERE table_name = $1 AND column_default LIKE 'nextval%'", header.Table)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			rows.Close()
+			return err
+		}
+		columns = append(columns, c)
+	}
+	rows.Close()
+	for _, c := range columns {
+		query := fmt.Sprintf(`SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX("%s"), 0) + 1, false) FROM "%s"`,
+			header.Table, c, c, header.Table)
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("load table `%s`, %s", header.Table, err)
+		}
+	}
+	return nil
+}
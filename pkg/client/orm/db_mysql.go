@@ -107,6 +107,68 @@ func (d *dbBaseMysql) IndexExists(db dbQuerier, table string, name string) bool
 	return cnt > 0
 }
 
+// GetTableSchema reads the columns, indexes and foreign keys of a table.
+func (d *dbBaseMysql) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	return mysqlTableSchema(db, table)
+}
+
+// mysqlTableSchema reads the schema of a table in information_schema, for mysql and tidb.
+func mysqlTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := new(tableSchema)
+
+	rows, err := db.Query("SELECT column_name, column_type, is_nullable FROM information_schema.columns "+
+		"WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position", table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, typ, null string
+		if err := rows.Scan(&name, &typ, &null); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.columns = append(schema.columns, &columnSchema{name: name, typ: typ, null: null == "YES"})
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT index_name, non_unique, column_name FROM information_schema.statistics "+
+		"WHERE table_schema = DATABASE() AND table_name = ? AND index_name != 'PRIMARY' ORDER BY index_name, seq_in_index", table)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, column string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if n := len(schema.indexes); n > 0 && schema.indexes[n-1].name == name {
+			schema.indexes[n-1].columns = append(schema.indexes[n-1].columns, column)
+			continue
+		}
+		schema.indexes = append(schema.indexes, &indexSchema{name: name, columns: []string{column}, unique: nonUnique == 0})
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT k.constraint_name, k.column_name, k.referenced_table_name, k.referenced_column_name, r.delete_rule "+
+		"FROM information_schema.key_column_usage k JOIN information_schema.referential_constraints r "+
+		"ON r.constraint_schema = k.constraint_schema AND r.constraint_name = k.constraint_name "+
+		"WHERE k.table_schema = DATABASE() AND k.table_name = ? AND k.referenced_table_name IS NOT NULL", table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fk := new(foreignKeySchema)
+		if err := rows.Scan(&fk.name, &fk.column, &fk.refTable, &fk.refColumn, &fk.onDelete); err != nil {
+			return nil, err
+		}
+		schema.foreignKeys = append(schema.foreignKeys, fk)
+	}
+	return schema, rows.Err()
+}
+
 // InsertOrUpdate a row
 // If your primary key or unique column conflict will update
 // If no will insert
@@ -188,6 +188,82 @@ func (d *dbBasePostgres) IndexExists(db dbQuerier, table string, name string) bo
 	return cnt > 0
 }
 
+// GetTableSchema reads the columns, indexes and foreign keys of a table in the current schema.
+func (d *dbBasePostgres) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := new(tableSchema)
+
+	rows, err := db.Query(fmt.Sprintf("SELECT a.attname, format_type(a.atttypid, a.atttypmod), NOT a.attnotnull "+
+		"FROM pg_attribute a JOIN pg_class c ON c.oid = a.attrelid JOIN pg_namespace n ON n.oid = c.relnamespace "+
+		"WHERE c.relname = '%s' AND n.nspname = current_schema() AND a.attnum > 0 AND NOT a.attisdropped ORDER BY a.attnum", table))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		c := new(columnSchema)
+		if err := rows.Scan(&c.name, &c.typ, &c.null); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.columns = append(schema.columns, c)
+	}
+	rows.Close()
+
+	rows, err = db.Query(fmt.Sprintf("SELECT i.relname, ix.indisunique, "+
+		"EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = ix.indexrelid), a.attname "+
+		"FROM pg_index ix JOIN pg_class t ON t.oid = ix.indrelid JOIN pg_class i ON i.oid = ix.indexrelid "+
+		"JOIN pg_namespace n ON n.oid = t.relnamespace "+
+		"JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true "+
+		"JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = k.attnum "+
+		"WHERE t.relname = '%s' AND n.nspname = current_schema() AND NOT ix.indisprimary ORDER BY i.relname, k.ord", table))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var name, column string
+		var unique, constraint bool
+		if err := rows.Scan(&name, &unique, &constraint, &column); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if n := len(schema.indexes); n > 0 && schema.indexes[n-1].name == name {
+			schema.indexes[n-1].columns = append(schema.indexes[n-1].columns, column)
+			continue
+		}
+		schema.indexes = append(schema.indexes, &indexSchema{name: name, columns: []string{column}, unique: unique, constraint: constraint})
+	}
+	rows.Close()
+
+	rows, err = db.Query(fmt.Sprintf("SELECT con.conname, a.attname, rt.relname, ra.attname, con.confdeltype "+
+		"FROM pg_constraint con JOIN pg_class t ON t.oid = con.conrelid JOIN pg_namespace n ON n.oid = t.relnamespace "+
+		"JOIN pg_class rt ON rt.oid = con.confrelid "+
+		"JOIN pg_attribute a ON a.attrelid = con.conrelid AND a.attnum = con.conkey[1] "+
+		"JOIN pg_attribute ra ON ra.attrelid = con.confrelid AND ra.attnum = con.confkey[1] "+
+		"WHERE con.contype = 'f' AND t.relname = '%s' AND n.nspname = current_schema()", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		fk := new(foreignKeySchema)
+		var onDelete string
+		if err := rows.Scan(&fk.name, &fk.column, &fk.refTable, &fk.refColumn, &onDelete); err != nil {
+			return nil, err
+		}
+		fk.onDelete = postgresDeleteRules[onDelete]
+		schema.foreignKeys = append(schema.foreignKeys, fk)
+	}
+	return schema, rows.Err()
+}
+
+// postgresDeleteRules maps the pg_constraint.confdeltype codes to their actions
+var postgresDeleteRules = map[string]string{
+	"a": "NO ACTION",
+	"r": "RESTRICT",
+	"c": "CASCADE",
+	"n": "SET NULL",
+	"d": "SET DEFAULT",
+}
+
 // GenerateSpecifyIndex return a specifying index clause
 func (d *dbBasePostgres) GenerateSpecifyIndex(tableName string, useIndex int, indexes []string) string {
 	DebugLog.Println("[WARN] Not support any specifying index action, so that action is ignored")
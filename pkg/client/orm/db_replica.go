@@ -0,0 +1,320 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReplicaPolicy selects the replica of an alias a read is sent to
+type ReplicaPolicy int
+
+// Enum the replica policies
+const (
+	RandomReplica     ReplicaPolicy = iota // pick a replica at random
+	RoundRobinReplica                      // pick the replicas in turn
+	LagAwareReplica                        // pick at random among the replicas lagging less than MaxReplicaLag
+)
+
+// ReplicaLagProber measures how far a replica lags behind the primary
+type ReplicaLagProber func(ctx context.Context, db *sql.DB) (time.Duration, error)
+
+var (
+	// DefaultMaxReplicaLag is the replication lag LagAwareReplica tolerates
+	// unless the alias sets MaxReplicaLag
+	DefaultMaxReplicaLag = time.Second
+
+	// replicaLagInterval is how long a measured replication lag is trusted
+	replicaLagInterval = 5 * time.Second
+
+	errReplicationStopped = errors.New("replication is not running")
+)
+
+type replica struct {
+	db      *DB
+	lag     int64 // nanoseconds, negative when the replica is unavailable
+	probed  int64 // unix nanoseconds of the last measure
+	probing int32
+}
+
+// lagBehind returns the last replication lag measured, and measures it
+// again in the background once it is older than replicaLagInterval.
+// The first measure is made synchronously.
+func (r *replica) lagBehind(prober ReplicaLagProber) time.Duration {
+	if prober == nil {
+		return 0
+	}
+	probed := atomic.LoadInt64(&r.probed)
+	if time.Since(time.Unix(0, probed)) >= replicaLagInterval && atomic.CompareAndSwapInt32(&r.probing, 0, 1) {
+		if probed == 0 {
+			r.probe(prober)
+		} else {
+			go r.probe(prober)
+		}
+	}
+	return time.Duration(atomic.LoadInt64(&r.lag))
+}
+
+func (r *replica) probe(prober ReplicaLagProber) {
+	defer atomic.StoreInt32(&r.probing, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), replicaLagInterval)
+	defer cancel()
+	lag, err := prober(ctx, r.db.DB)
+	if err != nil {
+		DebugLog.Printf("Probe DB replica lag: %s\n", err.Error())
+		lag = -1
+	}
+	atomic.StoreInt64(&r.lag, int64(lag))
+	atomic.StoreInt64(&r.probed, time.Now().UnixNano())
+}
+
+// replica returns the replica a read is sent to, or nil when the alias has
+// no replica available
+func (al *alias) replica() *DB {
+	n := len(al.replicas)
+	if n == 0 {
+		return nil
+	}
+	switch al.replicaPolicy {
+	case RoundRobinReplica:
+		i := atomic.AddUint32(&al.replicaNext, 1) - 1
+		return al.replicas[i%uint32(n)].db
+	case LagAwareReplica:
+		maxLag := al.maxReplicaLag
+		if maxLag <= 0 {
+			maxLag = DefaultMaxReplicaLag
+		}
+		candidates := make([]*replica, 0, n)
+		for _, r := range al.replicas {
+			if lag := r.lagBehind(al.replicaLagProber); lag >= 0 && lag <= maxLag {
+				candidates = append(candidates, r)
+			}
+		}
+		if len(candidates) == 0 {
+			return nil
+		}
+		return candidates[rand.Intn(len(candidates))].db
+	default:
+		return al.replicas[rand.Intn(n)].db
+	}
+}
+
+// addReplica adds db to the replicas of the alias, with the connection pool
+// settings of the primary
+func (al *alias) addReplica(db *sql.DB) error {
+	if err := db.Ping(); err != nil {
+		return fmt.Errorf("register db replica Ping `%s`, %s", al.Name, err.Error())
+	}
+	if al.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(al.MaxIdleConns)
+	}
+	if al.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(al.MaxOpenConns)
+	}
+	if al.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(al.ConnMaxLifetime)
+	}
+	r := &replica{db: &DB{RWMutex: new(sync.RWMutex), DB: db}}
+	if al.StmtCacheSize > 0 {
+		stmtCache, err := newStmtDecoratorLruWithEvict(al.StmtCacheSize)
+		if err != nil {
+			return err
+		}
+		r.db.stmtDecorators = stmtCache
+		r.db.stmtDecoratorsLimit = al.StmtCacheSize
+	}
+	if al.replicaLagProber == nil {
+		al.replicaLagProber = defaultReplicaLagProber(al.Driver)
+	}
+	al.replicas = append(al.replicas, r)
+	return nil
+}
+
+// openReplicas opens the replicas registered by data source
+func (al *alias) openReplicas() error {
+	for _, dataSource := range al.replicaSources {
+		db, err := sql.Open(al.DriverName, dataSource)
+		if err != nil {
+			al.closeReplicas()
+			return fmt.Errorf("register db replica `%s`, %s", al.Name, err.Error())
+		}
+		if err = al.addReplica(db); err != nil {
+			db.Close()
+			al.closeReplicas()
+			return err
+		}
+	}
+	return nil
+}
+
+func (al *alias) closeReplicas() {
+	for _, r := range al.replicas {
+		r.db.DB.Close()
+	}
+	al.replicas = nil
+}
+
+func defaultReplicaLagProber(dr DriverType) ReplicaLagProber {
+	switch dr {
+	case DRMySQL:
+		return mysqlReplicaLag
+	case DRPostgres:
+		return postgresReplicaLag
+	}
+	return nil
+}
+
+// mysqlReplicaLag reads Seconds_Behind_Master, a server which is not a
+// replica does not lag
+func mysqlReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err = rows.Scan(dest...); err != nil {
+		return 0, err
+	}
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" && column != "Seconds_Behind_Source" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, errReplicationStopped
+		}
+		seconds, err := strconv.ParseInt(string(values[i]), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return 0, nil
+}
+
+// postgresReplicaLag measures the time since the last transaction replayed,
+// a server which is not in recovery or has replayed all it received does
+// not lag
+func postgresReplicaLag(ctx context.Context, db *sql.DB) (time.Duration, error) {
+	var seconds float64
+	err := db.QueryRowContext(ctx, `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0) END`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+type readYourWritesKey struct{}
+
+type readYourWrites struct {
+	written int32
+}
+
+// WithReadYourWrites returns a copy of ctx whose QuerySetter reads go to the
+// primary once a write was made with it, so that they see the writes the
+// replicas may not have replayed yet. Use it for the context of a request
+// or a job.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, readYourWritesKey{}, new(readYourWrites))
+}
+
+// markWritten makes the reads of ctx stick to the primary
+func markWritten(ctx context.Context) {
+	if ctx == nil {
+		return
+	}
+	if s, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites); ok {
+		atomic.StoreInt32(&s.written, 1)
+	}
+}
+
+// wroteWith reports whether a write was made with ctx
+func wroteWith(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	s, ok := ctx.Value(readYourWritesKey{}).(*readYourWrites)
+	return ok && atomic.LoadInt32(&s.written) == 1
+}
+
+// AddReplicaWithDB adds db to the replicas of a registered alias.
+// Add the replicas at start-up, before the alias serves queries.
+func AddReplicaWithDB(aliasName string, db *sql.DB) error {
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+	return al.addReplica(db)
+}
+
+// Replicas return a hint about the data sources of the read replicas, opened
+// with the driver of the primary
+func Replicas(dataSources ...string) DBOption {
+	return func(al *alias) {
+		al.replicaSources = append(al.replicaSources, dataSources...)
+	}
+}
+
+// ReplicaSelection return a hint about the policy selecting the replica of a read
+func ReplicaSelection(policy ReplicaPolicy) DBOption {
+	return func(al *alias) {
+		al.replicaPolicy = policy
+	}
+}
+
+// MaxReplicaLag return a hint about the replication lag LagAwareReplica tolerates
+func MaxReplicaLag(v time.Duration) DBOption {
+	return func(al *alias) {
+		al.maxReplicaLag = v
+	}
+}
+
+// ReplicaLagProbe return a hint about how LagAwareReplica measures the
+// replication lag, instead of the default query of the driver
+func ReplicaLagProbe(prober ReplicaLagProber) DBOption {
+	return func(al *alias) {
+		al.replicaLagProber = prober
+	}
+}
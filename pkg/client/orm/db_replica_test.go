@@ -0,0 +1,123 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterDataBase_Replicas(t *testing.T) {
+	err := RegisterDataBase("test-replicas", DBARGS.Driver, DBARGS.Source,
+		MaxIdleConnections(5),
+		Replicas(DBARGS.Source, DBARGS.Source),
+		ReplicaSelection(RoundRobinReplica))
+	assert.Nil(t, err)
+
+	al := getDbAlias("test-replicas")
+	assert.Equal(t, 2, len(al.replicas))
+	first, second := al.replicas[0].db, al.replicas[1].db
+	assert.NotEqual(t, al.DB, first)
+	assert.True(t, al.replica() == first)
+	assert.True(t, al.replica() == second)
+	assert.True(t, al.replica() == first)
+}
+
+func TestReplicaRouting(t *testing.T) {
+	debug := Debug
+	Debug = false
+	defer func() { Debug = debug }()
+
+	db, err := sql.Open(DBARGS.Driver, DBARGS.Source)
+	assert.Nil(t, err)
+	err = AddAliasWthDB("test-routing", DBARGS.Driver, db)
+	assert.Nil(t, err)
+	replicaDB, err := sql.Open(DBARGS.Driver, DBARGS.Source)
+	assert.Nil(t, err)
+	assert.Nil(t, AddReplicaWithDB("test-routing", replicaDB))
+
+	al := getDbAlias("test-routing")
+	replica := al.replicas[0].db
+	o := &ormBase{alias: al, db: al.DB}
+	qs := newQuerySet(o, nil).(*querySet)
+
+	assert.True(t, qs.reader() == replica)
+	assert.True(t, qs.ForUpdate().(*querySet).reader() == al.DB)
+	assert.True(t, qs.ForcePrimary().(*querySet).reader() == al.DB)
+
+	tx := &ormBase{alias: al, db: &TxDB{}}
+	assert.True(t, newQuerySet(tx, nil).(*querySet).reader() == tx.db)
+
+	ctx := WithReadYourWrites(context.Background())
+	assert.True(t, ctx == WithReadYourWrites(ctx))
+	qs = qs.WithContext(ctx).(*querySet)
+	assert.True(t, qs.reader() == replica)
+	markWritten(ctx)
+	assert.True(t, qs.reader() == al.DB)
+	// the writes of other contexts do not stick
+	assert.True(t, qs.WithContext(context.Background()).(*querySet).reader() == replica)
+
+	assert.NotNil(t, AddReplicaWithDB("test-routing-unknown", replicaDB))
+}
+
+func TestLagAwareReplica(t *testing.T) {
+	lags := map[*sql.DB]time.Duration{}
+	prober := func(ctx context.Context, db *sql.DB) (time.Duration, error) {
+		lag, ok := lags[db]
+		if !ok {
+			return 0, errors.New("replica down")
+		}
+		return lag, nil
+	}
+
+	db, err := sql.Open(DBARGS.Driver, DBARGS.Source)
+	assert.Nil(t, err)
+	err = AddAliasWthDB("test-lag-aware", DBARGS.Driver, db,
+		ReplicaSelection(LagAwareReplica),
+		MaxReplicaLag(time.Second),
+		ReplicaLagProbe(prober))
+	assert.Nil(t, err)
+
+	fresh, _ := sql.Open(DBARGS.Driver, DBARGS.Source)
+	lagging, _ := sql.Open(DBARGS.Driver, DBARGS.Source)
+	down, _ := sql.Open(DBARGS.Driver, DBARGS.Source)
+	lags[fresh] = 100 * time.Millisecond
+	lags[lagging] = time.Minute
+	for _, r := range []*sql.DB{lagging, down, fresh} {
+		assert.Nil(t, AddReplicaWithDB("test-lag-aware", r))
+	}
+
+	al := getDbAlias("test-lag-aware")
+	for i := 0; i < 10; i++ {
+		assert.True(t, al.replica().DB == fresh)
+	}
+
+	lags[fresh] = time.Minute
+	for _, r := range al.replicas {
+		r.probe(prober)
+	}
+	assert.Nil(t, al.replica())
+}
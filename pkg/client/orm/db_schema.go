@@ -0,0 +1,533 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// columnSchema is a column of the live schema
+type columnSchema struct {
+	name string
+	typ  string
+	null bool
+}
+
+// indexSchema is an index of the live schema, the primary key excepted
+type indexSchema struct {
+	name    string
+	columns []string
+	unique  bool
+	// constraint is set when the index backs a constraint, which owns it
+	constraint bool
+}
+
+// foreignKeySchema is a single column foreign key of the live schema
+type foreignKeySchema struct {
+	name      string
+	column    string
+	refTable  string
+	refColumn string
+	onDelete  string
+}
+
+// tableSchema is the live schema of a table
+type tableSchema struct {
+	columns     []*columnSchema
+	indexes     []*indexSchema
+	foreignKeys []*foreignKeySchema
+}
+
+// SchemaChangeKind is the kind of a SchemaChange
+type SchemaChangeKind string
+
+// Enum the kinds of schema changes
+const (
+	SchemaCreateTable    SchemaChangeKind = "create table"
+	SchemaAddColumn      SchemaChangeKind = "add column"
+	SchemaDropColumn     SchemaChangeKind = "drop column"
+	SchemaAlterColumn    SchemaChangeKind = "alter column"
+	SchemaAddIndex       SchemaChangeKind = "add index"
+	SchemaDropIndex      SchemaChangeKind = "drop index"
+	SchemaAddUnique      SchemaChangeKind = "add unique"
+	SchemaDropUnique     SchemaChangeKind = "drop unique"
+	SchemaAddForeignKey  SchemaChangeKind = "add foreign key"
+	SchemaDropForeignKey SchemaChangeKind = "drop foreign key"
+)
+
+// SchemaChange is a difference between the registered models and the live
+// schema of a database, with the DDL applying it and the DDL reverting it
+type SchemaChange struct {
+	Kind  SchemaChangeKind
+	Table string
+	// Name is the column, index or constraint changed, empty for tables
+	Name string
+	Up   []string
+	Down []string
+	// Unsupported tells why the driver cannot apply the change, which has
+	// no DDL then
+	Unsupported string
+}
+
+func (c *SchemaChange) String() string {
+	if c.Name == "" {
+		return fmt.Sprintf("%s `%s`", c.Kind, c.Table)
+	}
+	return fmt.Sprintf("%s `%s` on `%s`", c.Kind, c.Name, c.Table)
+}
+
+// DiffSchema compares the registered models to the live schema of the
+// database alias and returns the changes bringing the schema up to date:
+// tables to create, columns to add, drop or alter, indexes, unique keys and
+// foreign keys to add or drop. The tables of no model are left alone.
+//
+// The foreign keys follow the rel(fk) and rel(one) fields, except those whose
+// on_delete is do_nothing.
+func DiffSchema(aliasName string) ([]*SchemaChange, error) {
+	BootStrap()
+
+	al, ok := dataBaseCache.get(aliasName)
+	if !ok {
+		return nil, fmt.Errorf("DataBase alias name `%s` not registered", aliasName)
+	}
+
+	createQueries, indexes, err := modelCache.getDbCreateSQL(al)
+	if err != nil {
+		return nil, err
+	}
+	tables, err := al.DbBaser.GetTables(al.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	// the foreign keys are added once all the tables exist
+	var changes, foreignKeys []*SchemaChange
+	for i, mi := range modelCache.allOrdered() {
+		if !isApplicableTableForDB(mi.addrField, al.Name) {
+			continue
+		}
+		d := &schemaDiffer{al: al, mi: mi, Q: al.DbBaser.TableQuote()}
+		if !tables[mi.table] {
+			changes = append(changes, d.createTable(createQueries[i], indexes[mi.table]))
+			foreignKeys = append(foreignKeys, d.diffForeignKeys(nil)...)
+			continue
+		}
+		live, err := al.DbBaser.GetTableSchema(al.DB, mi.table)
+		if err != nil {
+			return nil, fmt.Errorf("inspect table `%s`, %s", mi.table, err.Error())
+		}
+		tableChanges, tableForeignKeys := d.alterTable(live)
+		changes = append(changes, tableChanges...)
+		foreignKeys = append(foreignKeys, tableForeignKeys...)
+	}
+	return append(changes, foreignKeys...), nil
+}
+
+type schemaDiffer struct {
+	al *alias
+	mi *modelInfo
+	Q  string
+}
+
+func (d *schemaDiffer) quote(name string) string {
+	return d.Q + name + d.Q
+}
+
+func (d *schemaDiffer) createTable(query string, indexes []dbIndex) *SchemaChange {
+	var lines []string
+	for _, line := range strings.Split(query, "\n") {
+		if !strings.HasPrefix(line, "--") {
+			lines = append(lines, line)
+		}
+	}
+	up := []string{strings.Join(lines, "\n")}
+	for _, idx := range indexes {
+		up = append(up, idx.SQL)
+	}
+	return &SchemaChange{
+		Kind:  SchemaCreateTable,
+		Table: d.mi.table,
+		Up:    up,
+		Down:  []string{fmt.Sprintf("DROP TABLE %s", d.quote(d.mi.table))},
+	}
+}
+
+// alterTable returns the changes of an existing table, and apart the
+// foreign keys to add
+func (d *schemaDiffer) alterTable(live *tableSchema) ([]*SchemaChange, []*SchemaChange) {
+	var dropForeignKeys, foreignKeys []*SchemaChange
+	for _, c := range d.diffForeignKeys(live.foreignKeys) {
+		if c.Kind == SchemaDropForeignKey {
+			dropForeignKeys = append(dropForeignKeys, c)
+		} else {
+			foreignKeys = append(foreignKeys, c)
+		}
+	}
+
+	adds, alters, drops := d.diffColumns(live.columns)
+	dropIndexes, addIndexes := d.diffIndexes(live)
+
+	changes := append(dropForeignKeys, dropIndexes...)
+	changes = append(changes, adds...)
+	changes = append(changes, alters...)
+	changes = append(changes, addIndexes...)
+	changes = append(changes, drops...)
+	return changes, foreignKeys
+}
+
+func (d *schemaDiffer) diffColumns(live []*columnSchema) (adds, alters, drops []*SchemaChange) {
+	columns := make(map[string]*columnSchema, len(live))
+	for _, c := range live {
+		columns[c.name] = c
+	}
+
+	for _, fi := range d.mi.fields.fieldsDB {
+		c, ok := columns[fi.column]
+		delete(columns, fi.column)
+		if !ok {
+			adds = append(adds, &SchemaChange{
+				Kind:  SchemaAddColumn,
+				Table: d.mi.table,
+				Name:  fi.column,
+				Up:    []string{strings.Replace(getColumnAddQuery(d.al, fi), "%COL%", fi.column, -1)},
+				Down:  []string{d.dropColumnSQL(fi.column)},
+			})
+			continue
+		}
+		if fi.pk {
+			continue
+		}
+		want := &columnSchema{name: fi.column, typ: d.columnType(fi), null: fi.null}
+		if normalizeColumnType(d.al.Driver, want.typ) == normalizeColumnType(d.al.Driver, c.typ) && want.null == c.null {
+			continue
+		}
+		change := &SchemaChange{Kind: SchemaAlterColumn, Table: d.mi.table, Name: fi.column}
+		if d.al.Driver == DRSqlite {
+			change.Unsupported = "SQLite cannot alter a column, rebuild the table"
+		} else {
+			change.Up = d.modifyColumnSQL(want, getColumnDefault(fi))
+			change.Down = d.modifyColumnSQL(c, "")
+		}
+		alters = append(alters, change)
+	}
+
+	// the dropped columns in the order of the table
+	for _, c := range live {
+		if _, ok := columns[c.name]; !ok {
+			continue
+		}
+		drops = append(drops, &SchemaChange{
+			Kind:  SchemaDropColumn,
+			Table: d.mi.table,
+			Name:  c.name,
+			Up:    []string{d.dropColumnSQL(c.name)},
+			Down:  []string{d.addColumnSQL(c)},
+		})
+	}
+	return
+}
+
+// columnType returns the column type of a field, without the CHECK
+// constraints postgres types carry
+func (d *schemaDiffer) columnType(fi *fieldInfo) string {
+	typ := getColumnTyp(d.al, fi)
+	if i := strings.Index(typ, " CHECK("); i >= 0 {
+		typ = typ[:i]
+	}
+	return typ
+}
+
+func (d *schemaDiffer) diffIndexes(live *tableSchema) (drops, adds []*SchemaChange) {
+	indexes, uniques := modelIndexes(d.mi)
+	want := make(map[string]bool, len(indexes)+len(uniques))
+	for _, cols := range indexes {
+		want[indexKey(cols, false)] = true
+	}
+	for _, cols := range uniques {
+		want[indexKey(cols, true)] = true
+	}
+	// the indexes MySQL creates for the foreign keys are named after them
+	foreignKeys := make(map[string]bool, len(live.foreignKeys))
+	for _, fk := range live.foreignKeys {
+		foreignKeys[fk.name] = true
+	}
+
+	have := make(map[string]bool, len(live.indexes))
+	for _, idx := range live.indexes {
+		key := indexKey(idx.columns, idx.unique)
+		have[key] = true
+		if want[key] || (!idx.unique && foreignKeys[idx.name]) {
+			continue
+		}
+		change := &SchemaChange{Kind: SchemaDropIndex, Table: d.mi.table, Name: idx.name}
+		if idx.unique {
+			change.Kind = SchemaDropUnique
+		}
+		if d.al.Driver == DRSqlite && idx.constraint {
+			change.Unsupported = "SQLite cannot drop the unique constraint of a table, rebuild the table"
+		} else {
+			change.Up = []string{d.dropIndexSQL(idx)}
+			change.Down = []string{d.createIndexSQL(idx.name, idx.columns, idx.unique)}
+		}
+		drops = append(drops, change)
+	}
+
+	add := func(kind SchemaChangeKind, cols []string, unique bool) {
+		if have[indexKey(cols, unique)] {
+			return
+		}
+		have[indexKey(cols, unique)] = true
+		name := d.mi.table + "_" + strings.Join(cols, "_")
+		if unique {
+			name += "_uniq"
+		}
+		adds = append(adds, &SchemaChange{
+			Kind:  kind,
+			Table: d.mi.table,
+			Name:  name,
+			Up:    []string{d.createIndexSQL(name, cols, unique)},
+			Down:  []string{d.dropIndexSQL(&indexSchema{name: name, columns: cols, unique: unique})},
+		})
+	}
+	for _, cols := range uniques {
+		add(SchemaAddUnique, cols, true)
+	}
+	for _, cols := range indexes {
+		add(SchemaAddIndex, cols, false)
+	}
+	return
+}
+
+func indexKey(columns []string, unique bool) string {
+	return fmt.Sprintf("%t:%s", unique, strings.Join(columns, ","))
+}
+
+// diffForeignKeys compares the foreign keys of the model to the live ones
+func (d *schemaDiffer) diffForeignKeys(live []*foreignKeySchema) []*SchemaChange {
+	var changes []*SchemaChange
+	want := modelForeignKeys(d.mi)
+	wanted := make(map[string]bool, len(want))
+	for _, fk := range want {
+		wanted[fk.column+"|"+fk.refTable] = true
+	}
+	have := make(map[string]bool, len(live))
+	for _, fk := range live {
+		have[fk.column+"|"+fk.refTable] = true
+		if wanted[fk.column+"|"+fk.refTable] {
+			continue
+		}
+		changes = append(changes, d.foreignKeyChange(SchemaDropForeignKey, fk))
+	}
+	for _, fk := range want {
+		if !have[fk.column+"|"+fk.refTable] {
+			changes = append(changes, d.foreignKeyChange(SchemaAddForeignKey, fk))
+		}
+	}
+	return changes
+}
+
+func (d *schemaDiffer) foreignKeyChange(kind SchemaChangeKind, fk *foreignKeySchema) *SchemaChange {
+	change := &SchemaChange{Kind: kind, Table: d.mi.table, Name: fk.name}
+	if d.al.Driver == DRSqlite {
+		change.Unsupported = "SQLite cannot alter the foreign keys of a table, rebuild the table"
+		return change
+	}
+	add, drop := d.addForeignKeySQL(fk), d.dropForeignKeySQL(fk)
+	if kind == SchemaAddForeignKey {
+		change.Up, change.Down = []string{add}, []string{drop}
+	} else {
+		change.Up, change.Down = []string{drop}, []string{add}
+	}
+	return change
+}
+
+func (d *schemaDiffer) addColumnSQL(c *columnSchema) string {
+	typ := c.typ
+	if !c.null {
+		typ += " NOT NULL"
+	}
+	return fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", d.quote(d.mi.table), d.quote(c.name), typ)
+}
+
+func (d *schemaDiffer) dropColumnSQL(column string) string {
+	return fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", d.quote(d.mi.table), d.quote(column))
+}
+
+func (d *schemaDiffer) modifyColumnSQL(c *columnSchema, def string) []string {
+	table, column := d.quote(d.mi.table), d.quote(c.name)
+	if d.al.Driver == DRPostgres {
+		null := "DROP NOT NULL"
+		if !c.null {
+			null = "SET NOT NULL"
+		}
+		return []string{
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s USING %s::%s", table, column, c.typ, column, c.typ),
+			fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, column, null),
+		}
+	}
+	typ := c.typ
+	if !c.null {
+		typ += " NOT NULL"
+	}
+	return []string{strings.TrimSpace(fmt.Sprintf("ALTER TABLE %s MODIFY COLUMN %s %s%s", table, column, typ, def))}
+}
+
+func (d *schemaDiffer) createIndexSQL(name string, columns []string, unique bool) string {
+	create := "CREATE INDEX"
+	if unique {
+		create = "CREATE UNIQUE INDEX"
+	}
+	sep := fmt.Sprintf("%s, %s", d.Q, d.Q)
+	return fmt.Sprintf("%s %s ON %s (%s)", create, d.quote(name), d.quote(d.mi.table), d.quote(strings.Join(columns, sep)))
+}
+
+func (d *schemaDiffer) dropIndexSQL(idx *indexSchema) string {
+	switch {
+	case d.al.Driver == DRMySQL || d.al.Driver == DRTiDB:
+		return fmt.Sprintf("ALTER TABLE %s DROP INDEX %s", d.quote(d.mi.table), d.quote(idx.name))
+	case d.al.Driver == DRPostgres && idx.constraint:
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", d.quote(d.mi.table), d.quote(idx.name))
+	}
+	return fmt.Sprintf("DROP INDEX %s", d.quote(idx.name))
+}
+
+func (d *schemaDiffer) addForeignKeySQL(fk *foreignKeySchema) string {
+	query := fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s FOREIGN KEY (%s) REFERENCES %s (%s)",
+		d.quote(d.mi.table), d.quote(fk.name), d.quote(fk.column), d.quote(fk.refTable), d.quote(fk.refColumn))
+	if fk.onDelete != "" {
+		query += " ON DELETE " + fk.onDelete
+	}
+	return query
+}
+
+func (d *schemaDiffer) dropForeignKeySQL(fk *foreignKeySchema) string {
+	if d.al.Driver == DRPostgres {
+		return fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", d.quote(d.mi.table), d.quote(fk.name))
+	}
+	return fmt.Sprintf("ALTER TABLE %s DROP FOREIGN KEY %s", d.quote(d.mi.table), d.quote(fk.name))
+}
+
+// modelIndexes returns the columns of the indexes and of the unique keys of
+// a model, as syncdb creates them
+func modelIndexes(mi *modelInfo) (indexes [][]string, uniques [][]string) {
+	for _, fi := range mi.fields.fieldsDB {
+		if fi.pk || fi.auto {
+			continue
+		}
+		if fi.unique {
+			uniques = append(uniques, []string{fi.column})
+		}
+		if fi.index {
+			indexes = append(indexes, []string{fi.column})
+		}
+	}
+	if mi.model == nil {
+		return
+	}
+
+	columns := func(names []string, clause string) []string {
+		cols := make([]string, 0, len(names))
+		for _, name := range names {
+			if fi, ok := mi.fields.GetByAny(name); ok && fi.dbcol {
+				cols = append(cols, fi.column)
+			} else {
+				panic(fmt.Errorf("cannot found column `%s` when parse %s in `%s.Table%s`", name, strings.ToUpper(clause), mi.fullName, clause))
+			}
+		}
+		return cols
+	}
+	allnames := getTableUnique(mi.addrField)
+	if !mi.manual && len(mi.uniques) > 0 {
+		allnames = append(allnames, mi.uniques)
+	}
+	for _, names := range allnames {
+		uniques = append(uniques, columns(names, "Unique"))
+	}
+	for _, names := range getTableIndex(mi.addrField) {
+		indexes = append(indexes, columns(names, "Index"))
+	}
+	return
+}
+
+// modelForeignKeys returns the foreign keys of the relation fields of a
+// model, named fk_<table>_<column>
+func modelForeignKeys(mi *modelInfo) []*foreignKeySchema {
+	var foreignKeys []*foreignKeySchema
+	for _, fi := range mi.fields.fieldsDB {
+		if fi.fieldType != RelForeignKey && fi.fieldType != RelOneToOne {
+			continue
+		}
+		var onDelete string
+		switch fi.onDelete {
+		case odDoNothing:
+			continue
+		case odSetNULL:
+			onDelete = "SET NULL"
+		case odSetDefault:
+			onDelete = "SET DEFAULT"
+		default:
+			onDelete = "CASCADE"
+		}
+		foreignKeys = append(foreignKeys, &foreignKeySchema{
+			name:      "fk_" + mi.table + "_" + fi.column,
+			column:    fi.column,
+			refTable:  fi.relModelInfo.table,
+			refColumn: fi.relModelInfo.fields.pk.column,
+			onDelete:  onDelete,
+		})
+	}
+	return foreignKeys
+}
+
+var (
+	columnTypeSpaces   = regexp.MustCompile(`\s+`)
+	columnTypeIntWidth = regexp.MustCompile(`^(tinyint|smallint|mediumint|int|integer|bigint)\(\d+\)`)
+)
+
+// normalizeColumnType rewrites a column type to compare the types of the
+// models to the types the database reports
+func normalizeColumnType(dr DriverType, typ string) string {
+	typ = strings.ToLower(strings.TrimSpace(typ))
+	typ = columnTypeSpaces.ReplaceAllString(typ, " ")
+	typ = strings.Replace(typ, ", ", ",", -1)
+
+	switch dr {
+	case DRMySQL, DRTiDB:
+		if typ == "tinyint(1)" || typ == "boolean" {
+			return "bool"
+		}
+		typ = columnTypeIntWidth.ReplaceAllString(typ, "$1")
+		typ = strings.Replace(typ, "integer", "int", 1)
+		typ = strings.Replace(typ, "double precision", "double", 1)
+		typ = strings.Replace(typ, "numeric", "decimal", 1)
+	case DRPostgres:
+		typ = strings.Replace(typ, "character varying", "varchar", 1)
+		typ = strings.Replace(typ, "character", "char", 1)
+		if typ == "boolean" {
+			return "bool"
+		}
+	case DRSqlite:
+		typ = strings.Replace(typ, "character", "char", 1)
+	}
+	return typ
+}
@@ -145,6 +145,81 @@ func (d *dbBaseSqlite) ShowColumnsQuery(table string) string {
 	return fmt.Sprintf("pragma table_info('%s')", table)
 }
 
+// GetTableSchema reads the columns, indexes and foreign keys of a table.
+// The foreign keys of sqlite have no name, they are named fk_<table>_<column>.
+func (d *dbBaseSqlite) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	schema := new(tableSchema)
+
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tmp, name, typ sql.NullString
+		var notNull int
+		if err := rows.Scan(&tmp, &name, &typ, &notNull, &tmp, &tmp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		schema.columns = append(schema.columns, &columnSchema{name: name.String, typ: typ.String, null: notNull == 0})
+	}
+	rows.Close()
+
+	rows, err = db.Query(fmt.Sprintf("PRAGMA index_list('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tmp, name, origin sql.NullString
+		var unique int
+		if err := rows.Scan(&tmp, &name, &unique, &origin, &tmp); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if origin.String == "pk" {
+			continue
+		}
+		schema.indexes = append(schema.indexes, &indexSchema{name: name.String, unique: unique == 1, constraint: origin.String == "u"})
+	}
+	rows.Close()
+
+	for _, idx := range schema.indexes {
+		rows, err = db.Query(fmt.Sprintf("PRAGMA index_info('%s')", idx.name))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var tmp, column sql.NullString
+			if err := rows.Scan(&tmp, &tmp, &column); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			idx.columns = append(idx.columns, column.String)
+		}
+		rows.Close()
+	}
+
+	rows, err = db.Query(fmt.Sprintf("PRAGMA foreign_key_list('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tmp, refTable, column, refColumn, onDelete sql.NullString
+		if err := rows.Scan(&tmp, &tmp, &refTable, &column, &refColumn, &tmp, &onDelete, &tmp); err != nil {
+			return nil, err
+		}
+		schema.foreignKeys = append(schema.foreignKeys, &foreignKeySchema{
+			name:      "fk_" + table + "_" + column.String,
+			column:    column.String,
+			refTable:  refTable.String,
+			refColumn: refColumn.String,
+			onDelete:  onDelete.String,
+		})
+	}
+	return schema, rows.Err()
+}
+
 // check index exist in sqlite.
 func (d *dbBaseSqlite) IndexExists(db dbQuerier, table string, name string) bool {
 	query := fmt.Sprintf("PRAGMA index_list('%s')", table)
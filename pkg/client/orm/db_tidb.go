@@ -61,6 +61,11 @@ func (d *dbBaseTidb) IndexExists(db dbQuerier, table string, name string) bool {
 	return cnt > 0
 }
 
+// GetTableSchema reads the columns, indexes and foreign keys of a table.
+func (d *dbBaseTidb) GetTableSchema(db dbQuerier, table string) (*tableSchema, error) {
+	return mysqlTableSchema(db, table)
+}
+
 // create new mysql dbBaser.
 func newdbBaseTidb() dbBaser {
 	b := new(dbBaseTidb)
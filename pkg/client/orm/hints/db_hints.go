@@ -34,6 +34,7 @@ const (
 	KeyOffset
 	KeyOrderBy
 	KeyRelDepth
+	KeyForcePrimary
 )
 
 type Hint struct {
@@ -75,6 +76,12 @@ func ForUpdate() *Hint {
 	return NewHint(KeyForUpdate, true)
 }
 
+// ForcePrimary return a hint about ForcePrimary, the reads go to the primary
+// even if the alias has read replicas
+func ForcePrimary() *Hint {
+	return NewHint(KeyForcePrimary, true)
+}
+
 // DefaultRelDepth return a hint about DefaultRelDepth
 func DefaultRelDepth() *Hint {
 	return NewHint(KeyRelDepth, true)
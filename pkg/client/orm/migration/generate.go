@@ -0,0 +1,189 @@
+package migration
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/bhojpur/web/pkg/client/orm"
+)
+
+// Generate compares the registered models to the schema of the database
+// alias, and writes the migration bringing the schema up to date to dir, in
+// a file named <timestamp>_<name>.go. Down reverts the changes of Up.
+// It returns the path of the file, or "" when the schema is up to date.
+func Generate(aliasName, dir, name string) (string, error) {
+	changes, err := orm.DiffSchema(aliasName)
+	if err != nil {
+		return "", err
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+
+	created := time.Now().Format(DateFormat)
+	source, err := migrationSource(migrationStructName(name, created), created, changes)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, fmt.Sprintf("%s_%s.go", created, name))
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	_, err = f.Write(source)
+	return file, err
+}
+
+// DryRun prints the DDL bringing the schema of the database alias up to
+// date, without applying it
+func DryRun(aliasName string, w io.Writer) error {
+	changes, err := orm.DiffSchema(aliasName)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		_, err = fmt.Fprintln(w, "-- the schema is up to date")
+		return err
+	}
+	for _, c := range changes {
+		if c.Unsupported != "" {
+			fmt.Fprintf(w, "-- %s: not applied, %s\n\n", c, c.Unsupported)
+			continue
+		}
+		fmt.Fprintf(w, "-- %s\n", c)
+		for _, query := range c.Up {
+			fmt.Fprintf(w, "%s;\n", strings.TrimSuffix(query, ";"))
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+// migrationStructName names the migration like the generated ones, e.g.
+// AddUserEmail_20060102_150405
+func migrationStructName(name, created string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	structName := strings.Join(words, "")
+	if structName == "" || !unicode.IsLetter(rune(structName[0])) {
+		structName = "Migration" + structName
+	}
+	return structName + "_" + created
+}
+
+type migrationStep struct {
+	Comment string
+	SQL     []string
+}
+
+func migrationSource(structName, created string, changes []*orm.SchemaChange) ([]byte, error) {
+	var up, down []migrationStep
+	for _, c := range changes {
+		if c.Unsupported != "" {
+			up = append(up, migrationStep{Comment: fmt.Sprintf("%s: not applied, %s", c, c.Unsupported)})
+			continue
+		}
+		up = append(up, migrationStep{Comment: c.String(), SQL: quoteAll(c.Up)})
+	}
+	for i := len(changes) - 1; i >= 0; i-- {
+		if c := changes[i]; c.Unsupported == "" {
+			down = append(down, migrationStep{Comment: "revert " + c.String(), SQL: quoteAll(c.Down)})
+		}
+	}
+
+	var buf bytes.Buffer
+	err := migrationTemplate.Execute(&buf, map[string]interface{}{
+		"StructName": structName,
+		"Created":    created,
+		"Up":         up,
+		"Down":       down,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func quoteAll(queries []string) []string {
+	quoted := make([]string, len(queries))
+	for i, query := range queries {
+		quoted[i] = strconv.Quote(strings.TrimSuffix(query, ";"))
+	}
+	return quoted
+}
+
+var migrationTemplate = template.Must(template.New("migration").Parse(`package main
+
+import (
+	"github.com/bhojpur/web/pkg/client/orm/migration"
+)
+
+// DO NOT MODIFY
+type {{.StructName}} struct {
+	migration.Migration
+}
+
+// DO NOT MODIFY
+func init() {
+	m := &{{.StructName}}{}
+	m.Created = "{{.Created}}"
+	migration.Register("{{.StructName}}", m)
+}
+
+// Run the migrations
+func (m *{{.StructName}}) Up() {
+{{- range .Up}}
+	// {{.Comment}}
+{{- range .SQL}}
+	m.SQL({{.}})
+{{- end}}
+{{- end}}
+}
+
+// Reverse the migrations
+func (m *{{.StructName}}) Down() {
+{{- range .Down}}
+	// {{.Comment}}
+{{- range .SQL}}
+	m.SQL({{.}})
+{{- end}}
+{{- end}}
+}
+`))
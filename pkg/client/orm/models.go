@@ -49,6 +49,7 @@ type _modelCache struct {
 	cache           map[string]*modelInfo
 	cacheByFullName map[string]*modelInfo
 	done            bool
+	hooks           bool // any model implements the hooks
 }
 
 //NewModelCacheHandler generator of _modelCache
@@ -117,6 +118,7 @@ func (mc *_modelCache) clean() {
 	mc.cache = make(map[string]*modelInfo)
 	mc.cacheByFullName = make(map[string]*modelInfo)
 	mc.done = false
+	mc.hooks = false
 }
 
 //bootstrap bootstrap for models
@@ -382,6 +384,9 @@ func (mc *_modelCache) register(prefixOrSuffixStr string, prefixOrSuffix bool, m
 		}
 
 		mi := newModelInfo(val)
+		if hasHooks(model) {
+			mc.hooks = true
+		}
 		if mi.fields.pk == nil {
 		outFor:
 			for _, fi := range mi.fields.fieldsDB {
@@ -450,8 +455,6 @@ func (mc *_modelCache) getDbCreateSQL(al *alias) (queries []string, tableIndexes
 
 		columns := make([]string, 0, len(mi.fields.fieldsDB))
 
-		sqlIndexes := [][]string{}
-
 		for _, fi := range mi.fields.fieldsDB {
 
 			column := fmt.Sprintf("    %s%s%s ", Q, fi.column, Q)
@@ -483,10 +486,6 @@ func (mc *_modelCache) getDbCreateSQL(al *alias) (queries []string, tableIndexes
 				if fi.unique {
 					column += " " + "UNIQUE"
 				}
-
-				if fi.index {
-					sqlIndexes = append(sqlIndexes, []string{fi.column})
-				}
 			}
 
 			if strings.Contains(column, "%COL%") {
@@ -536,20 +535,7 @@ func (mc *_modelCache) getDbCreateSQL(al *alias) (queries []string, tableIndexes
 		sql += ";"
 		queries = append(queries, sql)
 
-		if mi.model != nil {
-			for _, names := range getTableIndex(mi.addrField) {
-				cols := make([]string, 0, len(names))
-				for _, name := range names {
-					if fi, ok := mi.fields.GetByAny(name); ok && fi.dbcol {
-						cols = append(cols, fi.column)
-					} else {
-						panic(fmt.Errorf("cannot found column `%s` when parse INDEX in `%s.TableIndex`", name, mi.fullName))
-					}
-				}
-				sqlIndexes = append(sqlIndexes, cols)
-			}
-		}
-
+		sqlIndexes, _ := modelIndexes(mi)
 		for _, names := range sqlIndexes {
 			name := mi.table + "_" + strings.Join(names, "_")
 			cols := strings.Join(names, sep)
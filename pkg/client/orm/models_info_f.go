@@ -32,6 +32,8 @@ var errSkipField = errors.New("skip field")
 // field info collection
 type fields struct {
 	pk            *fieldInfo
+	softDelete    *fieldInfo
+	version       *fieldInfo
 	columns       map[string]*fieldInfo
 	fields        map[string]*fieldInfo
 	fieldsLow     map[string]*fieldInfo
@@ -128,6 +130,8 @@ type fieldInfo struct {
 	toText              bool
 	autoNow             bool
 	autoNowAdd          bool
+	softDelete          bool // the deletion time of a soft deleted row
+	version             bool // the version of the optimistic locking
 	rel                 bool // if type equal to RelForeignKey, RelOneToOne, RelManyToMany then true
 	reverse             bool
 	reverseField        string
@@ -401,6 +405,10 @@ checkType:
 		} else if attrs["auto_now_add"] {
 			fi.autoNowAdd = true
 		}
+		if attrs["soft_delete"] {
+			fi.softDelete = true
+			fi.null = true
+		}
 	case TypeFloatField:
 	case TypeDecimalField:
 		d1 := digits
@@ -425,6 +433,21 @@ checkType:
 			err = fmt.Errorf("non-integer type cannot set auto")
 			goto end
 		}
+		if attrs["version"] {
+			err = fmt.Errorf("non-integer type cannot set version")
+			goto end
+		}
+	} else if attrs["version"] {
+		if addrField.Elem().Kind() == reflect.Ptr {
+			err = fmt.Errorf("version cannot be a pointer")
+			goto end
+		}
+		fi.version = true
+	}
+
+	if attrs["soft_delete"] && !fi.softDelete {
+		err = fmt.Errorf("non-time type cannot set soft_delete")
+		goto end
 	}
 
 	if fi.auto || fi.pk {
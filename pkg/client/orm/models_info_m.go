@@ -97,6 +97,20 @@ func addModelFields(mi *modelInfo, ind reflect.Value, mName string, index []int)
 				mi.fields.pk = fi
 			}
 		}
+		if fi.softDelete {
+			if mi.fields.softDelete != nil {
+				err = fmt.Errorf("one model must have one soft_delete field only")
+				break
+			}
+			mi.fields.softDelete = fi
+		}
+		if fi.version {
+			if mi.fields.version != nil {
+				err = fmt.Errorf("one model must have one version field only")
+				break
+			}
+			mi.fields.version = fi
+		}
 	}
 
 	if err != nil {
@@ -21,8 +21,10 @@ package orm
 // THE SOFTWARE.
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -246,6 +248,58 @@ type UserBig struct {
 	Name string
 }
 
+var errTicketTitle = errors.New("ticket needs a title")
+
+// Ticket is soft deleted, versioned and records its hooks
+type Ticket struct {
+	ID        int `orm:"column(id)"`
+	Title     string
+	Version   int       `orm:"version"`
+	DeletedAt time.Time `orm:"soft_delete"`
+	hooks     []string
+}
+
+func (t *Ticket) BeforeInsert(ctx context.Context) error {
+	t.hooks = append(t.hooks, "BeforeInsert")
+	if t.Title == "" {
+		return errTicketTitle
+	}
+	return nil
+}
+
+func (t *Ticket) AfterInsert(ctx context.Context) error {
+	t.hooks = append(t.hooks, "AfterInsert")
+	return nil
+}
+
+func (t *Ticket) BeforeUpdate(ctx context.Context) error {
+	t.hooks = append(t.hooks, "BeforeUpdate")
+	if t.Title == "" {
+		return errTicketTitle
+	}
+	return nil
+}
+
+func (t *Ticket) AfterUpdate(ctx context.Context) error {
+	t.hooks = append(t.hooks, "AfterUpdate")
+	return nil
+}
+
+func (t *Ticket) BeforeDelete(ctx context.Context) error {
+	t.hooks = append(t.hooks, "BeforeDelete")
+	return nil
+}
+
+func (t *Ticket) AfterDelete(ctx context.Context) error {
+	t.hooks = append(t.hooks, "AfterDelete")
+	return nil
+}
+
+func (t *Ticket) AfterRead(ctx context.Context) error {
+	t.hooks = append(t.hooks, "AfterRead")
+	return nil
+}
+
 type TM struct {
 	ID           int       `orm:"column(id)"`
 	TMPrecision1 time.Time `orm:"type(datetime);precision(3)"`
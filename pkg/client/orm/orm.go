@@ -96,6 +96,19 @@ var (
 	ErrLastInsertIdUnavailable = errors.New("<Ormer> last insert id is unavailable")
 )
 
+// StaleObjectError is returned by Update when the model has a version field
+// and its row was changed since the model was read: the row has another
+// version, or was deleted
+type StaleObjectError struct {
+	Table   string
+	Pk      interface{}
+	Version int64
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("<Ormer.Update> stale object: `%s` %v is not at version %d anymore", e.Table, e.Pk, e.Version)
+}
+
 // Params stores the Params
 type Params map[string]interface{}
 
@@ -184,6 +197,7 @@ func (o *ormBase) Insert(md interface{}) (int64, error) {
 	return o.InsertWithCtx(context.Background(), md)
 }
 func (o *ormBase) InsertWithCtx(ctx context.Context, md interface{}) (int64, error) {
+	markWritten(ctx)
 	mi, ind := o.getMiInd(md, true)
 	id, err := o.alias.DbBaser.Insert(o.db, mi, ind, o.alias.TZ)
 	if err != nil {
@@ -211,6 +225,7 @@ func (o *ormBase) InsertMulti(bulk int, mds interface{}) (int64, error) {
 	return o.InsertMultiWithCtx(context.Background(), bulk, mds)
 }
 func (o *ormBase) InsertMultiWithCtx(ctx context.Context, bulk int, mds interface{}) (int64, error) {
+	markWritten(ctx)
 	var cnt int64
 
 	sind := reflect.Indirect(reflect.ValueOf(mds))
@@ -249,6 +264,7 @@ func (o *ormBase) InsertOrUpdate(md interface{}, colConflictAndArgs ...string) (
 	return o.InsertOrUpdateWithCtx(context.Background(), md, colConflictAndArgs...)
 }
 func (o *ormBase) InsertOrUpdateWithCtx(ctx context.Context, md interface{}, colConflitAndArgs ...string) (int64, error) {
+	markWritten(ctx)
 	mi, ind := o.getMiInd(md, true)
 	id, err := o.alias.DbBaser.InsertOrUpdate(o.db, mi, ind, o.alias, colConflitAndArgs...)
 	if err != nil {
@@ -266,6 +282,7 @@ func (o *ormBase) Update(md interface{}, cols ...string) (int64, error) {
 	return o.UpdateWithCtx(context.Background(), md, cols...)
 }
 func (o *ormBase) UpdateWithCtx(ctx context.Context, md interface{}, cols ...string) (int64, error) {
+	markWritten(ctx)
 	mi, ind := o.getMiInd(md, true)
 	return o.alias.DbBaser.Update(o.db, mi, ind, o.alias.TZ, cols)
 }
@@ -276,7 +293,11 @@ func (o *ormBase) Delete(md interface{}, cols ...string) (int64, error) {
 	return o.DeleteWithCtx(context.Background(), md, cols...)
 }
 func (o *ormBase) DeleteWithCtx(ctx context.Context, md interface{}, cols ...string) (int64, error) {
+	markWritten(ctx)
 	mi, ind := o.getMiInd(md, true)
+	if mi.fields.softDelete != nil {
+		return o.softDelete(ctx, mi, ind, cols)
+	}
 	num, err := o.alias.DbBaser.Delete(o.db, mi, ind, o.alias.TZ, cols)
 	if err != nil {
 		return num, err
@@ -287,6 +308,38 @@ func (o *ormBase) DeleteWithCtx(ctx context.Context, md interface{}, cols ...str
 	return num, nil
 }
 
+// softDelete sets the deletion time of the rows of the model instead of
+// deleting them, and keeps its pk
+func (o *ormBase) softDelete(ctx context.Context, mi *modelInfo, ind reflect.Value, cols []string) (int64, error) {
+	qs := newQuerySet(o, mi).(*querySet).WithContext(ctx)
+	if len(cols) == 0 {
+		pkName, pkValue, ok := getExistPk(mi, ind)
+		if !ok {
+			return 0, ErrMissPK
+		}
+		qs = qs.Filter(pkName, pkValue)
+	}
+	for _, col := range cols {
+		fi, ok := mi.fields.GetByAny(col)
+		if !ok {
+			panic(fmt.Errorf("wrong field/column name `%s`", col))
+		}
+		qs = qs.Filter(fi.name, ind.FieldByIndex(fi.fieldIndex).Interface())
+	}
+
+	now := time.Now()
+	num, err := qs.Update(Params{mi.fields.softDelete.name: now})
+	if err == nil && num > 0 {
+		field := ind.FieldByIndex(mi.fields.softDelete.fieldIndex)
+		if field.Kind() == reflect.Ptr {
+			field.Set(reflect.ValueOf(&now))
+		} else {
+			field.Set(reflect.ValueOf(now))
+		}
+	}
+	return num, err
+}
+
 // create a models to models queryer
 func (o *ormBase) QueryM2M(md interface{}, name string) QueryM2Mer {
 	return o.QueryM2MWithCtx(context.Background(), md, name)
@@ -318,6 +371,7 @@ func (o *ormBase) LoadRelated(md interface{}, name string, args ...utils.KV) (in
 }
 func (o *ormBase) LoadRelatedWithCtx(ctx context.Context, md interface{}, name string, args ...utils.KV) (int64, error) {
 	_, fi, ind, qs := o.queryRelated(md, name)
+	qs.ctx = ctx
 
 	var relDepth int
 	var limit, offset int64
@@ -344,6 +398,10 @@ func (o *ormBase) LoadRelatedWithCtx(ctx context.Context, md interface{}, name s
 		if v, ok := value.(string); ok {
 			order = v
 		}
+	}).IfContains(hints.KeyForcePrimary, func(value interface{}) {
+		if v, ok := value.(bool); ok {
+			qs.forcePrimary = v
+		}
 	})
 
 	switch fi.fieldType {
@@ -464,12 +522,12 @@ func (o *ormBase) QueryTableWithCtx(ctx context.Context, ptrStructOrTableName in
 	if table, ok := ptrStructOrTableName.(string); ok {
 		name = nameStrategyMap[defaultNameStrategy](table)
 		if mi, ok := modelCache.get(name); ok {
-			qs = newQuerySet(o, mi)
+			qs = newQuerySet(o, mi).(*querySet).WithContext(ctx)
 		}
 	} else {
 		name = getFullName(indirectType(reflect.TypeOf(ptrStructOrTableName)))
 		if mi, ok := modelCache.getByFullName(name); ok {
-			qs = newQuerySet(o, mi)
+			qs = newQuerySet(o, mi).(*querySet).WithContext(ctx)
 		}
 	}
 	if qs == nil {
@@ -483,7 +541,7 @@ func (o *ormBase) Raw(query string, args ...interface{}) RawSetter {
 	return o.RawWithCtx(context.Background(), query, args...)
 }
 func (o *ormBase) RawWithCtx(ctx context.Context, query string, args ...interface{}) RawSetter {
-	return newRawSet(o, query, args)
+	return newRawSet(ctx, o, query, args)
 }
 
 // return current using database Driver
@@ -519,6 +577,7 @@ func (o *orm) BeginWithOpts(opts *sql.TxOptions) (TxOrmer, error) {
 }
 
 func (o *orm) BeginWithCtxAndOpts(ctx context.Context, opts *sql.TxOptions) (TxOrmer, error) {
+	markWritten(ctx)
 	tx, err := o.db.(txer).BeginTx(ctx, opts)
 	if err != nil {
 		return nil, err
@@ -626,8 +685,12 @@ func newDBWithAlias(al *alias) Ormer {
 		o.db = al.DB
 	}
 
-	if len(globalFilterChains) > 0 {
-		return NewFilterOrmDecorator(o, globalFilterChains...)
+	chains := globalFilterChains
+	if modelCache.hooks {
+		chains = append(chains[:len(chains):len(chains)], hooksFilterChain)
+	}
+	if len(chains) > 0 {
+		return NewFilterOrmDecorator(o, chains...)
 	}
 	return o
 }
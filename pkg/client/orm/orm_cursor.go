@@ -0,0 +1,348 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// queryCursor streams the rows of a query set into models
+type queryCursor struct {
+	d      *dbBase
+	rs     *sql.Rows
+	refs   []interface{}
+	mi     *modelInfo
+	tCols  []string
+	tables *dbTables
+	tz     *time.Location
+}
+
+var _ Cursor = new(queryCursor)
+
+func (c *queryCursor) Next() bool {
+	return c.rs.Next()
+}
+
+// Scan maps the current row to a model, or to a pointer to a model
+func (c *queryCursor) Scan(containers ...interface{}) error {
+	if len(containers) != 1 {
+		panic(fmt.Errorf("<Cursor.Scan> need one container, *%s", c.mi.fullName))
+	}
+	val := reflect.ValueOf(containers[0])
+	ind := reflect.Indirect(val)
+	isPtr := ind.Kind() == reflect.Ptr
+	typ := ind.Type()
+	if isPtr {
+		typ = typ.Elem()
+	}
+	if val.Kind() != reflect.Ptr || getFullName(typ) != c.mi.fullName {
+		panic(fmt.Errorf("wrong object type `%s` for rows scan, need *%s or **%s", val.Type(), c.mi.fullName, c.mi.fullName))
+	}
+
+	mind, err := c.d.readBatchRow(c.rs, c.refs, c.mi, c.tCols, c.tables, c.tz)
+	if err != nil {
+		return err
+	}
+	if isPtr {
+		ind.Set(mind.Addr())
+	} else {
+		ind.Set(mind)
+	}
+	return nil
+}
+
+func (c *queryCursor) Err() error {
+	return c.rs.Err()
+}
+
+func (c *queryCursor) Close() error {
+	return c.rs.Close()
+}
+
+// rawCursor streams the rows of a raw query
+type rawCursor struct {
+	o          *rawSet
+	rs         *sql.Rows
+	row        *rawRow
+	containers []interface{}
+}
+
+var _ Cursor = new(rawCursor)
+
+func (c *rawCursor) Next() bool {
+	return c.rs.Next()
+}
+
+// Scan maps the current row to the containers, like RawSetter.QueryRow
+func (c *rawCursor) Scan(containers ...interface{}) error {
+	if !c.sameContainers(containers) {
+		c.row, c.containers = newRawRow(containers), containers
+	}
+	return c.o.scanRow(c.rs, c.row)
+}
+
+// sameContainers tells if the containers are those of the last Scan, whose
+// mapping is reused
+func (c *rawCursor) sameContainers(containers []interface{}) bool {
+	if c.row == nil || len(containers) != len(c.containers) {
+		return false
+	}
+	for i, container := range containers {
+		if container != c.containers[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *rawCursor) Err() error {
+	return c.rs.Err()
+}
+
+func (c *rawCursor) Close() error {
+	return c.rs.Close()
+}
+
+// iterate scans the rows of cur into container and calls fn after each
+func iterate(cur Cursor, container interface{}, fn func() error) error {
+	defer cur.Close()
+	for cur.Next() {
+		if err := cur.Scan(container); err != nil {
+			return err
+		}
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+// return a cursor streaming the rows of the query
+func (o *querySet) Cursor(cols ...string) (Cursor, error) {
+	return o.orm.alias.DbBaser.ReadCursor(o.reader(), o, o.mi, o.condition(), o.orm.alias.TZ, cols)
+}
+
+// stream the rows of the query into container
+func (o *querySet) Iterate(ctx context.Context, container interface{}, fn func() error, cols ...string) error {
+	cur, err := o.WithContext(ctx).Cursor(cols...)
+	if err != nil {
+		return err
+	}
+	return iterate(cur, container, fn)
+}
+
+// seekOrder is a column of the ORDER BY of a keyset pagination
+type seekOrder struct {
+	fi   *fieldInfo
+	desc bool
+}
+
+// seekOrders returns the ORDER BY of the query ended with the primary key
+func (o *querySet) seekOrders() []seekOrder {
+	orders := make([]seekOrder, 0, len(o.orders)+1)
+	hasPk := false
+	for _, expr := range o.orders {
+		desc := strings.HasPrefix(expr, "-")
+		name := strings.TrimPrefix(expr, "-")
+		fi, ok := o.mi.fields.GetByAny(name)
+		if !ok || strings.Contains(name, ExprSep) {
+			panic(fmt.Errorf("<QuerySeter.SeekAfter> cannot seek on `%s`, only on the fields of `%s`", name, o.mi.fullName))
+		}
+		orders = append(orders, seekOrder{fi: fi, desc: desc})
+		hasPk = hasPk || fi == o.mi.fields.pk
+	}
+	if !hasPk {
+		orders = append(orders, seekOrder{fi: o.mi.fields.pk})
+	}
+	return orders
+}
+
+// seekOrderBy sets the ORDER BY of the keyset pagination
+func (o *querySet) seekOrderBy(orders []seekOrder) {
+	o.orders = make([]string, 0, len(orders))
+	for _, order := range orders {
+		expr := order.fi.name
+		if order.desc {
+			expr = "-" + expr
+		}
+		o.orders = append(o.orders, expr)
+	}
+}
+
+// filter the rows following row in the order of the query:
+// a > ? OR (a = ? AND b > ?) OR ...
+func (o querySet) SeekAfter(row interface{}) QuerySetter {
+	ind := reflect.Indirect(reflect.ValueOf(row))
+	if ind.Kind() == reflect.Ptr {
+		ind = ind.Elem()
+	}
+	if !ind.IsValid() || getFullName(ind.Type()) != o.mi.fullName {
+		panic(fmt.Errorf("<QuerySeter.SeekAfter> wrong object type `%T`, need *%s", row, o.mi.fullName))
+	}
+
+	orders := o.seekOrders()
+	seek := NewCondition()
+	for i, order := range orders {
+		cond := NewCondition()
+		for _, prev := range orders[:i] {
+			cond = cond.And(prev.fi.name, ind.FieldByIndex(prev.fi.fieldIndex).Interface())
+		}
+		operator := "gt"
+		if order.desc {
+			operator = "lt"
+		}
+		cond = cond.And(order.fi.name+ExprSep+operator, ind.FieldByIndex(order.fi.fieldIndex).Interface())
+		seek = seek.OrCond(cond)
+	}
+
+	if o.cond == nil {
+		o.cond = NewCondition()
+	}
+	o.cond = o.cond.AndCond(seek)
+	o.seekOrderBy(orders)
+	o.offset = 0
+	return &o
+}
+
+// read the rows page by page with SeekAfter
+func (o *querySet) IteratePages(ctx context.Context, size int, container interface{}, fn func() error) error {
+	val := reflect.ValueOf(container)
+	ind := reflect.Indirect(val)
+	if val.Kind() != reflect.Ptr || ind.Kind() != reflect.Slice {
+		panic(fmt.Errorf("<QuerySeter.IteratePages> container must be a ptr slice"))
+	}
+	if size <= 0 {
+		return ErrArgs
+	}
+
+	first := o.WithContext(ctx).(*querySet)
+	first.seekOrderBy(first.seekOrders())
+	page := first.Limit(size, 0)
+	for {
+		num, err := page.All(container)
+		if err != nil {
+			return err
+		}
+		if num == 0 {
+			return nil
+		}
+		last := ind.Index(ind.Len() - 1).Interface()
+		if err := fn(); err != nil {
+			return err
+		}
+		if num < int64(size) {
+			return nil
+		}
+		page = first.SeekAfter(last).Limit(size)
+	}
+}
+
+// execute update in chunks of primary keys
+func (o *querySet) UpdateInBatches(bulk int, values Params) (int64, error) {
+	return o.inBatches(bulk, func(qs QuerySetter) (int64, error) {
+		return qs.Update(values)
+	})
+}
+
+// delete in chunks of primary keys
+func (o *querySet) DeleteInBatches(bulk int) (int64, error) {
+	return o.inBatches(bulk, QuerySetter.Delete)
+}
+
+// inBatches reads the primary keys of the rows bulk at a time from the
+// primary, and applies the change to the rows of each chunk of keys
+func (o *querySet) inBatches(bulk int, apply func(QuerySetter) (int64, error)) (int64, error) {
+	if bulk <= 0 {
+		return 0, ErrArgs
+	}
+	pk := o.mi.fields.pk.name
+
+	keys := *o
+	keys.forcePrimary = true
+	keys.orders = []string{pk}
+	keys.limit = int64(bulk)
+	keys.offset = 0
+
+	var (
+		cnt  int64
+		last interface{}
+	)
+	for {
+		qs := QuerySetter(&keys)
+		if last != nil {
+			qs = qs.Filter(pk+ExprSep+"gt", last)
+		}
+		var pks ParamsList
+		num, err := qs.ValuesFlat(&pks, pk)
+		if err != nil {
+			return cnt, err
+		}
+		if num == 0 {
+			return cnt, nil
+		}
+
+		chunk := newQuerySet(o.orm, o.mi).(*querySet)
+		chunk.ctx, chunk.forContext = o.ctx, o.forContext
+		chunk.unscoped = o.unscoped
+		n, err := apply(chunk.Filter(pk+ExprSep+"in", pks))
+		cnt += n
+		if err != nil || num < int64(bulk) {
+			return cnt, err
+		}
+		last = pks[len(pks)-1]
+	}
+}
+
+// return a cursor streaming the rows of the raw query
+func (o *rawSet) Cursor() (Cursor, error) {
+	query := o.query
+	o.orm.alias.DbBaser.ReplaceMarks(&query)
+
+	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
+	var (
+		rs  *sql.Rows
+		err error
+	)
+	if o.ctx != nil {
+		rs, err = o.orm.db.QueryContext(o.ctx, query, args...)
+	} else {
+		rs, err = o.orm.db.Query(query, args...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rawCursor{o: o, rs: rs}, nil
+}
+
+// stream the rows of the raw query into container
+func (o rawSet) Iterate(ctx context.Context, container interface{}, fn func() error) error {
+	o.ctx = ctx
+	cur, err := o.Cursor()
+	if err != nil {
+		return err
+	}
+	return iterate(cur, container, fn)
+}
@@ -0,0 +1,532 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+)
+
+// DefaultIterBatch is the number of rows an Iter reads per query when no batch
+// size is given
+const DefaultIterBatch = 500
+
+// Column is a field of the model M, accepted by Query.Select and Query.GroupBy
+type Column[M any] interface {
+	expr() string
+}
+
+// Field is a typed accessor of a field of the model M whose values are V, so
+// that the filters built with it are checked at compile time:
+//
+//	var UserFields = struct {
+//		Age orm.Field[User, int]
+//	}{
+//		Age: orm.NewField[User, int]("Age"),
+//	}
+//
+//	orm.NewQuery[User](o).Where(UserFields.Age.Gte(18)).All()
+//
+// The accessors of the models of a package are generated by
+// `webutl generate fields`.
+type Field[M any, V any] struct {
+	name string
+}
+
+// NewField returns the accessor of the field or column name of the model M
+func NewField[M any, V any](name string) Field[M, V] {
+	return Field[M, V]{name: name}
+}
+
+// Name returns the expression of the field, as used by QuerySetter
+func (f Field[M, V]) Name() string {
+	return f.name
+}
+
+func (f Field[M, V]) expr() string {
+	return f.name
+}
+
+func (f Field[M, V]) cond(operator string, arg interface{}) Cond[M] {
+	expr := f.name
+	if operator != "" {
+		expr += ExprSep + operator
+	}
+	return Cond[M]{cond: NewCondition().And(expr, arg)}
+}
+
+// Eq is the condition field = v
+func (f Field[M, V]) Eq(v V) Cond[M] {
+	return f.cond("", v)
+}
+
+// Ne is the condition field != v
+func (f Field[M, V]) Ne(v V) Cond[M] {
+	return Not(f.Eq(v))
+}
+
+// Gt is the condition field > v
+func (f Field[M, V]) Gt(v V) Cond[M] {
+	return f.cond("gt", v)
+}
+
+// Gte is the condition field >= v
+func (f Field[M, V]) Gte(v V) Cond[M] {
+	return f.cond("gte", v)
+}
+
+// Lt is the condition field < v
+func (f Field[M, V]) Lt(v V) Cond[M] {
+	return f.cond("lt", v)
+}
+
+// Lte is the condition field <= v
+func (f Field[M, V]) Lte(v V) Cond[M] {
+	return f.cond("lte", v)
+}
+
+// In is the condition field IN (vs...)
+func (f Field[M, V]) In(vs ...V) Cond[M] {
+	return f.cond("in", vs)
+}
+
+// Between is the condition field BETWEEN from AND to
+func (f Field[M, V]) Between(from, to V) Cond[M] {
+	return f.cond("between", []V{from, to})
+}
+
+// IsNull is the condition field IS NULL, or IS NOT NULL when null is false
+func (f Field[M, V]) IsNull(null bool) Cond[M] {
+	return f.cond("isnull", null)
+}
+
+// Asc orders by the field ascending
+func (f Field[M, V]) Asc() Order[M] {
+	return Order[M]{expr: f.name}
+}
+
+// Desc orders by the field descending
+func (f Field[M, V]) Desc() Order[M] {
+	return Order[M]{expr: "-" + f.name}
+}
+
+// Set assigns v to the field in Query.Update
+func (f Field[M, V]) Set(v V) Assignment[M] {
+	return Assignment[M]{name: f.name, value: v}
+}
+
+// StringField is a Field of strings, with the text operators
+type StringField[M any] struct {
+	Field[M, string]
+}
+
+// NewStringField returns the accessor of the string field or column name of
+// the model M
+func NewStringField[M any](name string) StringField[M] {
+	return StringField[M]{Field: NewField[M, string](name)}
+}
+
+// IEq is the case insensitive condition field = s
+func (f StringField[M]) IEq(s string) Cond[M] {
+	return f.cond("iexact", s)
+}
+
+// Contains is the condition field LIKE %s%
+func (f StringField[M]) Contains(s string) Cond[M] {
+	return f.cond("contains", s)
+}
+
+// IContains is the case insensitive condition field LIKE %s%
+func (f StringField[M]) IContains(s string) Cond[M] {
+	return f.cond("icontains", s)
+}
+
+// StartsWith is the condition field LIKE s%
+func (f StringField[M]) StartsWith(s string) Cond[M] {
+	return f.cond("startswith", s)
+}
+
+// IStartsWith is the case insensitive condition field LIKE s%
+func (f StringField[M]) IStartsWith(s string) Cond[M] {
+	return f.cond("istartswith", s)
+}
+
+// EndsWith is the condition field LIKE %s
+func (f StringField[M]) EndsWith(s string) Cond[M] {
+	return f.cond("endswith", s)
+}
+
+// IEndsWith is the case insensitive condition field LIKE %s
+func (f StringField[M]) IEndsWith(s string) Cond[M] {
+	return f.cond("iendswith", s)
+}
+
+// Rel is a typed accessor of the rel(fk) or rel(one) field of the model M
+// pointing to the model R
+type Rel[M any, R any] struct {
+	name string
+}
+
+// NewRel returns the accessor of the relation field name of the model M
+func NewRel[M any, R any](name string) Rel[M, R] {
+	return Rel[M, R]{name: name}
+}
+
+// Name returns the expression of the relation, as used by QuerySetter
+func (r Rel[M, R]) Name() string {
+	return r.name
+}
+
+func (r Rel[M, R]) expr() string {
+	return r.name
+}
+
+// Is is the condition the relation points to the row of r
+func (r Rel[M, R]) Is(related *R) Cond[M] {
+	return Cond[M]{cond: NewCondition().And(r.name, related)}
+}
+
+// IsNull is the condition the relation is NULL, or is not when null is false
+func (r Rel[M, R]) IsNull(null bool) Cond[M] {
+	return Cond[M]{cond: NewCondition().And(r.name+ExprSep+"isnull", null)}
+}
+
+// Related returns the field f of the model R seen from the model M through
+// the relation r, e.g. Related(UserFields.Profile, ProfileFields.Age) for
+// "Profile__Age"
+func Related[M any, R any, V any](r Rel[M, R], f Field[R, V]) Field[M, V] {
+	return Field[M, V]{name: r.name + ExprSep + f.name}
+}
+
+// RelatedString is Related for a StringField
+func RelatedString[M any, R any](r Rel[M, R], f StringField[R]) StringField[M] {
+	return StringField[M]{Field: Related(r, f.Field)}
+}
+
+// RelatedRel returns the relation r2 of the model R seen from the model M
+// through the relation r, to reach the fields of further models
+func RelatedRel[M any, R any, S any](r Rel[M, R], r2 Rel[R, S]) Rel[M, S] {
+	return Rel[M, S]{name: r.name + ExprSep + r2.name}
+}
+
+// Cond is a condition on the model M, combined with And, Or and Not
+type Cond[M any] struct {
+	cond *Condition
+}
+
+// And returns the condition c AND others
+func (c Cond[M]) And(others ...Cond[M]) Cond[M] {
+	cond := c.cond
+	for _, other := range others {
+		cond = cond.AndCond(other.cond)
+	}
+	return Cond[M]{cond: cond}
+}
+
+// Or returns the condition c OR others
+func (c Cond[M]) Or(others ...Cond[M]) Cond[M] {
+	cond := NewCondition().AndCond(c.cond)
+	for _, other := range others {
+		cond = cond.OrCond(other.cond)
+	}
+	return Cond[M]{cond: cond}
+}
+
+// Condition returns the untyped condition, for QuerySetter.SetCond
+func (c Cond[M]) Condition() *Condition {
+	return c.cond
+}
+
+// Not returns the condition NOT c
+func Not[M any](c Cond[M]) Cond[M] {
+	return Cond[M]{cond: NewCondition().AndNotCond(c.cond)}
+}
+
+// Order is an ORDER BY expression on the model M
+type Order[M any] struct {
+	expr string
+}
+
+// Assignment is a field value of the model M set by Query.Update
+type Assignment[M any] struct {
+	name  string
+	value interface{}
+}
+
+// Query is a QuerySetter of the model M with typed conditions and results.
+// Like QuerySetter, its methods return a new query and leave the receiver
+// unchanged.
+type Query[M any] struct {
+	qs     QuerySetter
+	cond   *Condition
+	limit  int64
+	offset int64
+	cols   []string
+}
+
+// NewQuery returns the query of the table of the model M
+func NewQuery[M any](o DQL) *Query[M] {
+	return &Query[M]{qs: o.QueryTable(new(M))}
+}
+
+// NewQueryWithCtx returns the query of the table of the model M bound to ctx
+func NewQueryWithCtx[M any](ctx context.Context, o DQL) *Query[M] {
+	return &Query[M]{qs: o.QueryTableWithCtx(ctx, new(M))}
+}
+
+func (q Query[M]) with(qs QuerySetter) *Query[M] {
+	q.qs = qs
+	return &q
+}
+
+func (q Query[M]) where(c *Condition, not bool) *Query[M] {
+	switch {
+	case q.cond == nil && !not:
+		q.cond = c
+	case q.cond == nil:
+		q.cond = NewCondition().AndNotCond(c)
+	case not:
+		q.cond = q.cond.AndNotCond(c)
+	default:
+		q.cond = q.cond.AndCond(c)
+	}
+	q.qs = q.qs.SetCond(q.cond)
+	return &q
+}
+
+func joinConds[M any](conds []Cond[M]) *Condition {
+	if len(conds) == 1 {
+		return conds[0].cond
+	}
+	cond := NewCondition()
+	for _, c := range conds {
+		cond = cond.AndCond(c.cond)
+	}
+	return cond
+}
+
+// Where adds the conditions, all of which the rows must match
+func (q *Query[M]) Where(conds ...Cond[M]) *Query[M] {
+	if len(conds) == 0 {
+		return q
+	}
+	return q.where(joinConds(conds), false)
+}
+
+// Exclude excludes the rows matching all of the conditions
+func (q *Query[M]) Exclude(conds ...Cond[M]) *Query[M] {
+	if len(conds) == 0 {
+		return q
+	}
+	return q.where(joinConds(conds), true)
+}
+
+// OrderBy orders the rows
+func (q *Query[M]) OrderBy(orders ...Order[M]) *Query[M] {
+	exprs := make([]string, 0, len(orders))
+	for _, order := range orders {
+		exprs = append(exprs, order.expr)
+	}
+	return q.with(q.qs.OrderBy(exprs...))
+}
+
+// GroupBy groups the rows by the columns
+func (q *Query[M]) GroupBy(cols ...Column[M]) *Query[M] {
+	return q.with(q.qs.GroupBy(columnExprs(cols)...))
+}
+
+// Select reads only the columns into the models returned by All, One and Iter
+func (q Query[M]) Select(cols ...Column[M]) *Query[M] {
+	q.cols = columnExprs(cols)
+	return &q
+}
+
+// RelatedSel loads the related models of the relations along with the rows,
+// or all of them when no relation is given
+func (q *Query[M]) RelatedSel(rels ...Column[M]) *Query[M] {
+	params := make([]interface{}, 0, len(rels))
+	for _, rel := range rels {
+		params = append(params, rel.expr())
+	}
+	return q.with(q.qs.RelatedSel(params...))
+}
+
+// Limit limits the number of rows
+func (q Query[M]) Limit(limit int64) *Query[M] {
+	q.limit = limit
+	q.qs = q.qs.Limit(limit, q.offset)
+	return &q
+}
+
+// Offset skips the first rows
+func (q Query[M]) Offset(offset int64) *Query[M] {
+	q.offset = offset
+	q.qs = q.qs.Offset(offset)
+	return &q
+}
+
+// Distinct reads the distinct rows
+func (q *Query[M]) Distinct() *Query[M] {
+	return q.with(q.qs.Distinct())
+}
+
+// ForUpdate locks the rows read, see QuerySetter.ForUpdate
+func (q *Query[M]) ForUpdate() *Query[M] {
+	return q.with(q.qs.ForUpdate())
+}
+
+// ForcePrimary reads from the primary database, see QuerySetter.ForcePrimary
+func (q *Query[M]) ForcePrimary() *Query[M] {
+	return q.with(q.qs.ForcePrimary())
+}
+
+// Unscoped reads and deletes the soft deleted rows too, see
+// QuerySetter.Unscoped
+func (q *Query[M]) Unscoped() *Query[M] {
+	return q.with(q.qs.Unscoped())
+}
+
+// QuerySetter returns the untyped query, with the conditions, orders and
+// limits of q
+func (q *Query[M]) QuerySetter() QuerySetter {
+	return q.qs
+}
+
+// Count returns the number of rows
+func (q *Query[M]) Count() (int64, error) {
+	return q.qs.Count()
+}
+
+// Exist tells if any row matches
+func (q *Query[M]) Exist() bool {
+	return q.qs.Exist()
+}
+
+// All returns the models of the rows
+func (q *Query[M]) All() ([]M, error) {
+	var models []M
+	_, err := q.qs.All(&models, q.cols...)
+	return models, err
+}
+
+// One returns the model of the single row, or ErrNoRows or ErrMultiRows
+func (q *Query[M]) One() (M, error) {
+	var model M
+	err := q.qs.One(&model, q.cols...)
+	return model, err
+}
+
+// Update sets the fields of the rows and returns the number of rows changed
+func (q *Query[M]) Update(values ...Assignment[M]) (int64, error) {
+	params := make(Params, len(values))
+	for _, v := range values {
+		params[v.name] = v.value
+	}
+	return q.qs.Update(params)
+}
+
+// Delete deletes the rows and returns their number
+func (q *Query[M]) Delete() (int64, error) {
+	return q.qs.Delete()
+}
+
+// Iter returns an iterator over the models of the rows which reads them
+// batch rows at a time, DefaultIterBatch when batch is not positive. The
+// batches are pages of the query, so it should be ordered on a unique key.
+//
+//	it := orm.NewQuery[User](o).OrderBy(UserFields.ID.Asc()).Iter(0)
+//	for it.Next() {
+//		user := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+func (q *Query[M]) Iter(batch int) *Iter[M] {
+	if batch <= 0 {
+		batch = DefaultIterBatch
+	}
+	return &Iter[M]{query: q, batch: int64(batch), offset: q.offset, remain: q.limit}
+}
+
+// Each calls fn with every model until it returns an error
+func (q *Query[M]) Each(batch int, fn func(M) error) error {
+	it := q.Iter(batch)
+	for it.Next() {
+		if err := fn(it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+func columnExprs[M any](cols []Column[M]) []string {
+	exprs := make([]string, 0, len(cols))
+	for _, col := range cols {
+		exprs = append(exprs, col.expr())
+	}
+	return exprs
+}
+
+// Iter iterates over the models of a Query
+type Iter[M any] struct {
+	query  *Query[M]
+	batch  int64
+	offset int64
+	// remain is the number of rows left under the limit of the query, none
+	// when it has no limit
+	remain int64
+	rows   []M
+	pos    int
+	done   bool
+	err    error
+}
+
+// Next moves to the next model and tells if there is one
+func (it *Iter[M]) Next() bool {
+	if it.pos+1 < len(it.rows) {
+		it.pos++
+		return true
+	}
+	if it.done || it.err != nil {
+		return false
+	}
+	limit := it.batch
+	if it.query.limit > 0 && it.remain < limit {
+		limit = it.remain
+	}
+	var rows []M
+	if limit > 0 {
+		_, it.err = it.query.qs.Limit(limit, it.offset).All(&rows, it.query.cols...)
+	}
+	it.offset += int64(len(rows))
+	it.remain -= int64(len(rows))
+	it.done = int64(len(rows)) < limit || it.query.limit > 0 && it.remain <= 0
+	it.rows, it.pos = rows, 0
+	return it.err == nil && len(rows) > 0
+}
+
+// Value returns the current model
+func (it *Iter[M]) Value() M {
+	return it.rows[it.pos]
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *Iter[M]) Err() error {
+	return it.err
+}
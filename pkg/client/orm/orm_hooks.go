@@ -0,0 +1,192 @@
+package orm
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"reflect"
+)
+
+// BeforeInserter is a model called before it is inserted by Ormer.Insert or
+// Ormer.InsertMulti, whose error cancels the insert
+type BeforeInserter interface {
+	BeforeInsert(ctx context.Context) error
+}
+
+// AfterInserter is a model called after it is inserted by Ormer.Insert or
+// Ormer.InsertMulti, whose error is returned by them
+type AfterInserter interface {
+	AfterInsert(ctx context.Context) error
+}
+
+// BeforeUpdater is a model called before it is updated by Ormer.Update,
+// whose error cancels the update
+type BeforeUpdater interface {
+	BeforeUpdate(ctx context.Context) error
+}
+
+// AfterUpdater is a model called after it is updated by Ormer.Update, whose
+// error is returned by it
+type AfterUpdater interface {
+	AfterUpdate(ctx context.Context) error
+}
+
+// BeforeDeleter is a model called before it is deleted by Ormer.Delete,
+// whose error cancels the delete
+type BeforeDeleter interface {
+	BeforeDelete(ctx context.Context) error
+}
+
+// AfterDeleter is a model called after it is deleted by Ormer.Delete, whose
+// error is returned by it
+type AfterDeleter interface {
+	AfterDelete(ctx context.Context) error
+}
+
+// AfterReader is a model called after it is read by Ormer.Read or
+// Ormer.ReadForUpdate, whose error is returned by them
+type AfterReader interface {
+	AfterRead(ctx context.Context) error
+}
+
+// hook calls a hook of the model if it has it
+type hook func(ctx context.Context, md interface{}) error
+
+func beforeInsert(ctx context.Context, md interface{}) error {
+	if h, ok := md.(BeforeInserter); ok {
+		return h.BeforeInsert(ctx)
+	}
+	return nil
+}
+
+func afterInsert(ctx context.Context, md interface{}) error {
+	if h, ok := md.(AfterInserter); ok {
+		return h.AfterInsert(ctx)
+	}
+	return nil
+}
+
+func beforeUpdate(ctx context.Context, md interface{}) error {
+	if h, ok := md.(BeforeUpdater); ok {
+		return h.BeforeUpdate(ctx)
+	}
+	return nil
+}
+
+func afterUpdate(ctx context.Context, md interface{}) error {
+	if h, ok := md.(AfterUpdater); ok {
+		return h.AfterUpdate(ctx)
+	}
+	return nil
+}
+
+func beforeDelete(ctx context.Context, md interface{}) error {
+	if h, ok := md.(BeforeDeleter); ok {
+		return h.BeforeDelete(ctx)
+	}
+	return nil
+}
+
+func afterDelete(ctx context.Context, md interface{}) error {
+	if h, ok := md.(AfterDeleter); ok {
+		return h.AfterDelete(ctx)
+	}
+	return nil
+}
+
+func afterRead(ctx context.Context, md interface{}) error {
+	if h, ok := md.(AfterReader); ok {
+		return h.AfterRead(ctx)
+	}
+	return nil
+}
+
+// hasHooks tells if the model implements any of the hooks
+func hasHooks(md interface{}) bool {
+	switch md.(type) {
+	case BeforeInserter, AfterInserter, BeforeUpdater, AfterUpdater, BeforeDeleter, AfterDeleter, AfterReader:
+		return true
+	}
+	return false
+}
+
+// hooksFilterChain calls the hooks of the models around the Ormer methods.
+// It is the last of the filter chain, so the hooks see the models as the
+// other filters leave them, and their errors go through the other filters.
+func hooksFilterChain(next Filter) Filter {
+	return func(ctx context.Context, inv *Invocation) []interface{} {
+		var (
+			mds           []interface{}
+			before, after hook
+		)
+		switch inv.Method {
+		case "InsertWithCtx":
+			mds, before, after = inv.Args[:1], beforeInsert, afterInsert
+		case "InsertMultiWithCtx":
+			mds, before, after = hookModels(inv.Args[1]), beforeInsert, afterInsert
+		case "UpdateWithCtx":
+			mds, before, after = inv.Args[:1], beforeUpdate, afterUpdate
+		case "DeleteWithCtx":
+			mds, before, after = inv.Args[:1], beforeDelete, afterDelete
+		case "ReadWithCtx", "ReadForUpdateWithCtx":
+			mds, after = inv.Args[:1], afterRead
+		default:
+			return next(ctx, inv)
+		}
+
+		if before != nil {
+			for _, md := range mds {
+				if err := before(ctx, md); err != nil {
+					return []interface{}{int64(0), err}
+				}
+			}
+		}
+		res := next(ctx, inv)
+		if err, _ := res[len(res)-1].(error); err != nil {
+			return res
+		}
+		for _, md := range mds {
+			if err := after(ctx, md); err != nil {
+				res[len(res)-1] = err
+				break
+			}
+		}
+		return res
+	}
+}
+
+// hookModels returns the models of the slice of InsertMulti
+func hookModels(mds interface{}) []interface{} {
+	sind := reflect.Indirect(reflect.ValueOf(mds))
+	if sind.Kind() != reflect.Array && sind.Kind() != reflect.Slice {
+		return []interface{}{mds}
+	}
+	models := make([]interface{}, 0, sind.Len())
+	for i := 0; i < sind.Len(); i++ {
+		ind := reflect.Indirect(sind.Index(i))
+		if ind.CanAddr() {
+			models = append(models, ind.Addr().Interface())
+		} else {
+			models = append(models, ind.Interface())
+		}
+	}
+	return models
+}
@@ -23,6 +23,7 @@ package orm
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/bhojpur/web/pkg/client/orm/hints"
 )
@@ -70,21 +71,23 @@ func ColValue(opt operator, value interface{}) interface{} {
 
 // real query struct
 type querySet struct {
-	mi         *modelInfo
-	cond       *Condition
-	related    []string
-	relDepth   int
-	limit      int64
-	offset     int64
-	groups     []string
-	orders     []string
-	distinct   bool
-	forUpdate  bool
-	useIndex   int
-	indexes    []string
-	orm        *ormBase
-	ctx        context.Context
-	forContext bool
+	mi           *modelInfo
+	cond         *Condition
+	related      []string
+	relDepth     int
+	limit        int64
+	offset       int64
+	groups       []string
+	orders       []string
+	distinct     bool
+	forUpdate    bool
+	forcePrimary bool
+	unscoped     bool
+	useIndex     int
+	indexes      []string
+	orm          *ormBase
+	ctx          context.Context
+	forContext   bool
 }
 
 var _ QuerySetter = new(querySet)
@@ -162,6 +165,18 @@ func (o querySet) ForUpdate() QuerySetter {
 	return &o
 }
 
+// ForcePrimary sends the reads to the primary even if the alias has replicas
+func (o querySet) ForcePrimary() QuerySetter {
+	o.forcePrimary = true
+	return &o
+}
+
+// Unscoped includes the soft deleted rows, and makes Delete delete them
+func (o querySet) Unscoped() QuerySetter {
+	o.unscoped = true
+	return &o
+}
+
 // ForceIndex force index for query
 func (o querySet) ForceIndex(indexes ...string) QuerySetter {
 	o.useIndex = hints.KeyForceIndex
@@ -214,25 +229,44 @@ func (o querySet) GetCond() *Condition {
 	return o.cond
 }
 
+// condition returns the conditions of the query, which exclude the soft
+// deleted rows unless it is unscoped
+func (o *querySet) condition() *Condition {
+	fi := o.mi.fields.softDelete
+	if fi == nil || o.unscoped {
+		return o.cond
+	}
+	cond := NewCondition().And(fi.name+ExprSep+"isnull", true)
+	if o.cond == nil || o.cond.IsEmpty() {
+		return cond
+	}
+	return cond.AndCond(o.cond)
+}
+
 // return QuerySeter execution result number
 func (o *querySet) Count() (int64, error) {
-	return o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.Count(o.reader(), o, o.mi, o.condition(), o.orm.alias.TZ)
 }
 
 // check result empty or not after QuerySeter executed
 func (o *querySet) Exist() bool {
-	cnt, _ := o.orm.alias.DbBaser.Count(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	cnt, _ := o.orm.alias.DbBaser.Count(o.reader(), o, o.mi, o.condition(), o.orm.alias.TZ)
 	return cnt > 0
 }
 
 // execute update with parameters
 func (o *querySet) Update(values Params) (int64, error) {
-	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.cond, values, o.orm.alias.TZ)
+	markWritten(o.ctx)
+	return o.orm.alias.DbBaser.UpdateBatch(o.orm.db, o, o.mi, o.condition(), values, o.orm.alias.TZ)
 }
 
-// execute delete
+// execute delete, which sets the deletion time of the models soft deleted
 func (o *querySet) Delete() (int64, error) {
-	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.cond, o.orm.alias.TZ)
+	markWritten(o.ctx)
+	if fi := o.mi.fields.softDelete; fi != nil && !o.unscoped {
+		return o.Update(Params{fi.name: time.Now()})
+	}
+	return o.orm.alias.DbBaser.DeleteBatch(o.orm.db, o, o.mi, o.condition(), o.orm.alias.TZ)
 }
 
 // return a insert queryer.
@@ -241,20 +275,21 @@ func (o *querySet) Delete() (int64, error) {
 // 	i,err := sq.PrepareInsert()
 // 	i.Add(&user1{},&user2{})
 func (o *querySet) PrepareInsert() (Inserter, error) {
+	markWritten(o.ctx)
 	return newInsertSet(o.orm, o.mi)
 }
 
 // query all data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) All(container interface{}, cols ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	return o.orm.alias.DbBaser.ReadBatch(o.reader(), o, o.mi, o.condition(), container, o.orm.alias.TZ, cols)
 }
 
 // query one row data and map to containers.
 // cols means the columns when querying.
 func (o *querySet) One(container interface{}, cols ...string) error {
 	o.limit = 1
-	num, err := o.orm.alias.DbBaser.ReadBatch(o.orm.db, o, o.mi, o.cond, container, o.orm.alias.TZ, cols)
+	num, err := o.orm.alias.DbBaser.ReadBatch(o.reader(), o, o.mi, o.condition(), container, o.orm.alias.TZ, cols)
 	if err != nil {
 		return err
 	}
@@ -272,19 +307,19 @@ func (o *querySet) One(container interface{}, cols ...string) error {
 // expres means condition expression.
 // it converts data to []map[column]value.
 func (o *querySet) Values(results *[]Params, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.reader(), o, o.mi, o.condition(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to [][]interface
 // it converts data to [][column_index]value
 func (o *querySet) ValuesList(results *[]ParamsList, exprs ...string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, exprs, results, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.reader(), o, o.mi, o.condition(), exprs, results, o.orm.alias.TZ)
 }
 
 // query all data and map to []interface.
 // it's designed for one row record set, auto change to []value, not [][column]value.
 func (o *querySet) ValuesFlat(result *ParamsList, expr string) (int64, error) {
-	return o.orm.alias.DbBaser.ReadValues(o.orm.db, o, o.mi, o.cond, []string{expr}, result, o.orm.alias.TZ)
+	return o.orm.alias.DbBaser.ReadValues(o.reader(), o, o.mi, o.condition(), []string{expr}, result, o.orm.alias.TZ)
 }
 
 // query all rows into map[string]interface with specify key and value column name.
@@ -293,10 +328,11 @@ func (o *querySet) ValuesFlat(result *ParamsList, expr string) (int64, error) {
 // name  | value
 // total | 100
 // found | 200
-// to map[string]interface{}{
-// 	"total": 100,
-// 	"found": 200,
-// }
+//
+//	to map[string]interface{}{
+//		"total": 100,
+//		"found": 200,
+//	}
 func (o *querySet) RowsToMap(result *Params, keyCol, valueCol string) (int64, error) {
 	panic(ErrNotImplement)
 }
@@ -307,10 +343,11 @@ func (o *querySet) RowsToMap(result *Params, keyCol, valueCol string) (int64, er
 // name  | value
 // total | 100
 // found | 200
-// to struct {
-// 	Total int
-// 	Found int
-// }
+//
+//	to struct {
+//		Total int
+//		Found int
+//	}
 func (o *querySet) RowsToStruct(ptrStruct interface{}, keyCol, valueCol string) (int64, error) {
 	panic(ErrNotImplement)
 }
@@ -322,6 +359,26 @@ func (o querySet) WithContext(ctx context.Context) QuerySetter {
 	return &o
 }
 
+// reader returns the querier the reads are made with: a replica of the alias,
+// unless they lock rows, run in a transaction, are forced to the primary or
+// must see the writes made with the context of the query set
+func (o *querySet) reader() dbQuerier {
+	if o.forUpdate || o.forcePrimary || wroteWith(o.ctx) {
+		return o.orm.db
+	}
+	if _, ok := o.orm.db.(*TxDB); ok {
+		return o.orm.db
+	}
+	db := o.orm.alias.replica()
+	if db == nil {
+		return o.orm.db
+	}
+	if Debug {
+		return newDbQueryLog(o.orm.alias, db)
+	}
+	return db
+}
+
 // create new QuerySeter.
 func newQuerySet(orm *ormBase, mi *modelInfo) QuerySetter {
 	o := new(querySet)
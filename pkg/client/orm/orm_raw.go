@@ -21,6 +21,7 @@ package orm
 // THE SOFTWARE.
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"reflect"
@@ -40,6 +41,7 @@ func (o *rawPrepare) Exec(args ...interface{}) (sql.Result, error) {
 	if o.closed {
 		return nil, ErrStmtClosed
 	}
+	markWritten(o.rs.ctx)
 	flatParams := getFlatParams(nil, args, o.rs.orm.alias.TZ)
 	return o.stmt.Exec(flatParams...)
 }
@@ -73,6 +75,7 @@ type rawSet struct {
 	query string
 	args  []interface{}
 	orm   *ormBase
+	ctx   context.Context
 }
 
 var _ RawSetter = new(rawSet)
@@ -85,6 +88,7 @@ func (o rawSet) SetArgs(args ...interface{}) RawSetter {
 
 // execute raw sql and return sql.Result
 func (o *rawSet) Exec() (sql.Result, error) {
+	markWritten(o.ctx)
 	query := o.query
 	o.orm.alias.DbBaser.ReplaceMarks(&query)
 
@@ -282,8 +286,18 @@ func (o *rawSet) loopSetRefs(refs []interface{}, sInds []reflect.Value, nIndsPtr
 	}
 }
 
-// query data and map to container
-func (o *rawSet) QueryRow(containers ...interface{}) error {
+// rawRow is the containers QueryRow maps a row to
+type rawRow struct {
+	refs         []interface{}
+	sInds        []reflect.Value
+	eTyps        []reflect.Type
+	sMi          *modelInfo
+	structMode   bool
+	structTagMap map[reflect.StructTag]map[string]string
+}
+
+// newRawRow checks the containers of QueryRow and prepares their mapping
+func newRawRow(containers []interface{}) *rawRow {
 	var (
 		refs  = make([]interface{}, 0, len(containers))
 		sInds []reflect.Value
@@ -324,127 +338,144 @@ func (o *rawSet) QueryRow(containers ...interface{}) error {
 		}
 	}
 
-	query := o.query
-	o.orm.alias.DbBaser.ReplaceMarks(&query)
-
-	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
-	rows, err := o.orm.db.Query(query, args...)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return ErrNoRows
-		}
-		return err
+	return &rawRow{
+		refs:         refs,
+		sInds:        sInds,
+		eTyps:        eTyps,
+		sMi:          sMi,
+		structMode:   structMode,
+		structTagMap: make(map[reflect.StructTag]map[string]string),
 	}
+}
 
-	structTagMap := make(map[reflect.StructTag]map[string]string)
+// scanRow maps the current row of rows to the containers of r
+func (o *rawSet) scanRow(rows *sql.Rows, r *rawRow) error {
+	refs, sInds, eTyps, sMi, structTagMap := r.refs, r.sInds, r.eTyps, r.sMi, r.structTagMap
 
-	defer rows.Close()
-
-	if rows.Next() {
-		if structMode {
-			columns, err := rows.Columns()
-			if err != nil {
-				return err
-			}
+	if r.structMode {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
 
-			columnsMp := make(map[string]interface{}, len(columns))
+		columnsMp := make(map[string]interface{}, len(columns))
 
-			refs = make([]interface{}, 0, len(columns))
-			for _, col := range columns {
-				var ref interface{}
-				columnsMp[col] = &ref
-				refs = append(refs, &ref)
-			}
+		refs = make([]interface{}, 0, len(columns))
+		for _, col := range columns {
+			var ref interface{}
+			columnsMp[col] = &ref
+			refs = append(refs, &ref)
+		}
 
-			if err := rows.Scan(refs...); err != nil {
-				return err
-			}
+		if err := rows.Scan(refs...); err != nil {
+			return err
+		}
 
-			ind := sInds[0]
+		ind := sInds[0]
 
-			if ind.Kind() == reflect.Ptr {
-				if ind.IsNil() || !ind.IsValid() {
-					ind.Set(reflect.New(eTyps[0].Elem()))
-				}
-				ind = ind.Elem()
+		if ind.Kind() == reflect.Ptr {
+			if ind.IsNil() || !ind.IsValid() {
+				ind.Set(reflect.New(eTyps[0].Elem()))
 			}
+			ind = ind.Elem()
+		}
 
-			if sMi != nil {
-				for _, col := range columns {
-					if fi := sMi.fields.GetByColumn(col); fi != nil {
-						value := reflect.ValueOf(columnsMp[col]).Elem().Interface()
-						field := ind.FieldByIndex(fi.fieldIndex)
-						if fi.fieldType&IsRelField > 0 {
-							mf := reflect.New(fi.relModelInfo.addrField.Elem().Type())
-							field.Set(mf)
-							field = mf.Elem().FieldByIndex(fi.relModelInfo.fields.pk.fieldIndex)
-						}
-						if fi.isFielder {
-							fd := field.Addr().Interface().(Fielder)
-							err := fd.SetRaw(value)
-							if err != nil {
-								return errors.Errorf("set raw error:%s", err)
-							}
-						} else {
-							o.setFieldValue(field, value)
-						}
+		if sMi != nil {
+			for _, col := range columns {
+				if fi := sMi.fields.GetByColumn(col); fi != nil {
+					value := reflect.ValueOf(columnsMp[col]).Elem().Interface()
+					field := ind.FieldByIndex(fi.fieldIndex)
+					if fi.fieldType&IsRelField > 0 {
+						mf := reflect.New(fi.relModelInfo.addrField.Elem().Type())
+						field.Set(mf)
+						field = mf.Elem().FieldByIndex(fi.relModelInfo.fields.pk.fieldIndex)
 					}
-				}
-			} else {
-				// define recursive function
-				var recursiveSetField func(rv reflect.Value)
-				recursiveSetField = func(rv reflect.Value) {
-					for i := 0; i < rv.NumField(); i++ {
-						f := rv.Field(i)
-						fe := rv.Type().Field(i)
-
-						// check if the field is a Struct
-						// recursive the Struct type
-						if fe.Type.Kind() == reflect.Struct {
-							recursiveSetField(f)
-						}
-
-						// thanks @Gazeboxu.
-						tags := structTagMap[fe.Tag]
-						if tags == nil {
-							_, tags = parseStructTag(fe.Tag.Get(defaultStructTagName))
-							structTagMap[fe.Tag] = tags
-						}
-						var col string
-						if col = tags["column"]; col == "" {
-							col = nameStrategyMap[nameStrategy](fe.Name)
-						}
-						if v, ok := columnsMp[col]; ok {
-							value := reflect.ValueOf(v).Elem().Interface()
-							o.setFieldValue(f, value)
+					if fi.isFielder {
+						fd := field.Addr().Interface().(Fielder)
+						err := fd.SetRaw(value)
+						if err != nil {
+							return errors.Errorf("set raw error:%s", err)
 						}
+					} else {
+						o.setFieldValue(field, value)
 					}
 				}
-
-				// init call the recursive function
-				recursiveSetField(ind)
 			}
-
 		} else {
-			if err := rows.Scan(refs...); err != nil {
-				return err
-			}
+			// define recursive function
+			var recursiveSetField func(rv reflect.Value)
+			recursiveSetField = func(rv reflect.Value) {
+				for i := 0; i < rv.NumField(); i++ {
+					f := rv.Field(i)
+					fe := rv.Type().Field(i)
+
+					// check if the field is a Struct
+					// recursive the Struct type
+					if fe.Type.Kind() == reflect.Struct {
+						recursiveSetField(f)
+					}
 
-			nInds := make([]reflect.Value, len(sInds))
-			o.loopSetRefs(refs, sInds, &nInds, eTyps, true)
-			for i, sInd := range sInds {
-				nInd := nInds[i]
-				sInd.Set(nInd)
+					// thanks @Gazeboxu.
+					tags := structTagMap[fe.Tag]
+					if tags == nil {
+						_, tags = parseStructTag(fe.Tag.Get(defaultStructTagName))
+						structTagMap[fe.Tag] = tags
+					}
+					var col string
+					if col = tags["column"]; col == "" {
+						col = nameStrategyMap[nameStrategy](fe.Name)
+					}
+					if v, ok := columnsMp[col]; ok {
+						value := reflect.ValueOf(v).Elem().Interface()
+						o.setFieldValue(f, value)
+					}
+				}
 			}
+
+			// init call the recursive function
+			recursiveSetField(ind)
 		}
 
 	} else {
-		return ErrNoRows
+		if err := rows.Scan(refs...); err != nil {
+			return err
+		}
+
+		nInds := make([]reflect.Value, len(sInds))
+		o.loopSetRefs(refs, sInds, &nInds, eTyps, true)
+		for i, sInd := range sInds {
+			nInd := nInds[i]
+			sInd.Set(nInd)
+		}
 	}
 
 	return nil
 }
 
+// query data and map to container
+func (o *rawSet) QueryRow(containers ...interface{}) error {
+	row := newRawRow(containers)
+
+	query := o.query
+	o.orm.alias.DbBaser.ReplaceMarks(&query)
+
+	args := getFlatParams(nil, o.args, o.orm.alias.TZ)
+	rows, err := o.orm.db.Query(query, args...)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return ErrNoRows
+		}
+		return err
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		return ErrNoRows
+	}
+	return o.scanRow(rows, row)
+}
+
 // query data rows and map to container
 func (o *rawSet) QueryRows(containers ...interface{}) (int64, error) {
 	var (
@@ -904,10 +935,11 @@ func (o *rawSet) Prepare() (RawPreparer, error) {
 	return newRawPreparer(o)
 }
 
-func newRawSet(orm *ormBase, query string, args []interface{}) RawSetter {
+func newRawSet(ctx context.Context, orm *ormBase, query string, args []interface{}) RawSetter {
 	o := new(rawSet)
 	o.query = query
 	o.args = args
 	o.orm = orm
+	o.ctx = ctx
 	return o
 }
@@ -27,6 +27,7 @@ import (
 	"bytes"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math"
@@ -212,6 +213,7 @@ func TestSyncDb(t *testing.T) {
 	RegisterModel(new(Index))
 	RegisterModel(new(StrPk))
 	RegisterModel(new(TM))
+	RegisterModel(new(Ticket))
 
 	err := RunSyncdb("default", true, Debug)
 	throwFail(t, err)
@@ -239,6 +241,7 @@ func TestRegisterModels(t *testing.T) {
 	RegisterModel(new(Index))
 	RegisterModel(new(StrPk))
 	RegisterModel(new(TM))
+	RegisterModel(new(Ticket))
 
 	BootStrap()
 
@@ -260,6 +263,54 @@ func TestModelSyntax(t *testing.T) {
 	}
 }
 
+func TestDiffSchema(t *testing.T) {
+	onlyForeignKeys := func() {
+		changes, err := DiffSchema("default")
+		throwFailNow(t, err)
+		for _, c := range changes {
+			throwFail(t, AssertIs(c.Kind, SchemaAddForeignKey), c.String())
+		}
+	}
+	onlyForeignKeys()
+
+	if !IsSqlite {
+		return
+	}
+	_, err := dORM.Raw("ALTER TABLE user ADD COLUMN legacy INTEGER").Exec()
+	throwFailNow(t, err)
+	_, err = dORM.Raw("DROP INDEX user_id_created").Exec()
+	throwFailNow(t, err)
+
+	changes, err := DiffSchema("default")
+	throwFailNow(t, err)
+	found := make(map[SchemaChangeKind]*SchemaChange)
+	for _, c := range changes {
+		if c.Kind != SchemaAddForeignKey {
+			found[c.Kind] = c
+		}
+	}
+	throwFailNow(t, AssertIs(len(found), 2))
+
+	drop := found[SchemaDropColumn]
+	throwFailNow(t, AssertIs(drop != nil, true))
+	throwFail(t, AssertIs(drop.String(), "drop column `legacy` on `user`"))
+	throwFail(t, AssertIs(drop.Up[0], "ALTER TABLE `user` DROP COLUMN `legacy`"))
+	throwFail(t, AssertIs(drop.Down[0], "ALTER TABLE `user` ADD COLUMN `legacy` INTEGER"))
+
+	add := found[SchemaAddIndex]
+	throwFailNow(t, AssertIs(add != nil, true))
+	throwFail(t, AssertIs(add.Name, "user_id_created"))
+	throwFail(t, AssertIs(add.Up[0], "CREATE INDEX `user_id_created` ON `user` (`id`, `created`)"))
+
+	for _, c := range []*SchemaChange{drop, add} {
+		for _, query := range c.Up {
+			_, err = dORM.Raw(query).Exec()
+			throwFailNow(t, err)
+		}
+	}
+	onlyForeignKeys()
+}
+
 var DataValues = map[string]interface{}{
 	"Boolean":  true,
 	"Char":     "char",
@@ -1219,6 +1270,329 @@ func TestValuesFlat(t *testing.T) {
 	}
 }
 
+var userFields = struct {
+	ID       Field[User, int]
+	UserName StringField[User]
+	Status   Field[User, int16]
+	IsStaff  Field[User, bool]
+	Profile  Rel[User, Profile]
+}{
+	ID:       NewField[User, int]("ID"),
+	UserName: NewStringField[User]("UserName"),
+	Status:   NewField[User, int16]("Status"),
+	IsStaff:  NewField[User, bool]("IsStaff"),
+	Profile:  NewRel[User, Profile]("Profile"),
+}
+
+var profileFields = struct {
+	Age Field[Profile, int16]
+}{
+	Age: NewField[Profile, int16]("Age"),
+}
+
+func TestQuery(t *testing.T) {
+	users := NewQuery[User](dORM)
+
+	num, err := users.Where(userFields.UserName.Eq("pramila")).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = users.Where(userFields.Status.Gte(2), userFields.IsStaff.Eq(true)).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = users.Where(userFields.Status.Eq(1).Or(userFields.UserName.Contains("obo"))).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+
+	num, err = users.Exclude(userFields.Status.In(1, 2)).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = users.Where(Related(userFields.Profile, profileFields.Age).Gt(28)).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	num, err = users.Where(userFields.Profile.IsNull(true)).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+
+	list, err := users.OrderBy(userFields.Status.Desc()).Select(userFields.ID, userFields.UserName).All()
+	throwFail(t, err)
+	throwFailNow(t, AssertIs(len(list), 3))
+	throwFail(t, AssertIs(list[0].UserName, "nobody"))
+	throwFail(t, AssertIs(list[2].UserName, "pramila"))
+	throwFail(t, AssertIs(list[2].Email, ""))
+
+	user, err := users.Where(userFields.UserName.IEq("Bhojpur")).One()
+	throwFail(t, err)
+	throwFail(t, AssertIs(user.Status, 2))
+
+	_, err = users.Where(userFields.UserName.Eq("missing")).One()
+	throwFail(t, AssertIs(err, ErrNoRows))
+
+	var names []string
+	it := users.OrderBy(userFields.ID.Asc()).Offset(1).Iter(1)
+	for it.Next() {
+		names = append(names, it.Value().UserName)
+	}
+	throwFail(t, it.Err())
+	throwFail(t, AssertIs(strings.Join(names, ","), "bhojpur,nobody"))
+
+	names = names[:0]
+	err = users.OrderBy(userFields.ID.Asc()).Limit(2).Each(1, func(user User) error {
+		names = append(names, user.UserName)
+		return nil
+	})
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(names, ","), "pramila,bhojpur"))
+
+	num, err = users.Where(userFields.UserName.Eq("nobody")).Update(userFields.Status.Set(4))
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = users.Where(userFields.Status.Eq(4)).Update(userFields.Status.Set(3))
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+}
+
+func TestCursor(t *testing.T) {
+	qs := dORM.QueryTable("user").OrderBy("id")
+
+	cur, err := qs.Cursor("ID", "UserName")
+	throwFailNow(t, err)
+	var names []string
+	for cur.Next() {
+		var user User
+		throwFailNow(t, cur.Scan(&user))
+		throwFail(t, AssertIs(user.Email, ""))
+		names = append(names, user.UserName)
+	}
+	throwFail(t, cur.Err())
+	throwFail(t, cur.Close())
+	throwFail(t, AssertIs(strings.Join(names, ","), "pramila,bhojpur,nobody"))
+
+	var user *User
+	names = names[:0]
+	err = qs.Filter("status__gt", 1).Iterate(context.Background(), &user, func() error {
+		names = append(names, user.UserName)
+		return nil
+	})
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(names, ","), "bhojpur,nobody"))
+
+	stop := errors.New("stop")
+	err = qs.Iterate(context.Background(), &user, func() error {
+		return stop
+	})
+	throwFail(t, AssertIs(err, stop))
+
+	var name string
+	names = names[:0]
+	Q := dDbBaser.TableQuote()
+	query := fmt.Sprintf("SELECT %suser_name%s FROM %suser%s ORDER BY %sid%s DESC", Q, Q, Q, Q, Q, Q)
+	err = dORM.Raw(query).Iterate(context.Background(), &name, func() error {
+		names = append(names, name)
+		return nil
+	})
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(names, ","), "nobody,bhojpur,pramila"))
+
+	rawCur, err := dORM.Raw(query).Cursor()
+	throwFailNow(t, err)
+	defer rawCur.Close()
+	throwFailNow(t, AssertIs(rawCur.Next(), true))
+	var raw User
+	throwFail(t, rawCur.Scan(&raw))
+	throwFail(t, AssertIs(raw.UserName, "nobody"))
+}
+
+func TestSeekAfter(t *testing.T) {
+	qs := dORM.QueryTable("user")
+
+	var users []*User
+	num, err := qs.OrderBy("-status").Limit(1).All(&users)
+	throwFail(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(users[0].UserName, "nobody"))
+
+	num, err = qs.OrderBy("-status").SeekAfter(users[0]).Limit(1).All(&users)
+	throwFail(t, err)
+	throwFailNow(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(users[0].UserName, "bhojpur"))
+
+	num, err = qs.OrderBy("is_staff").SeekAfter(&User{ID: 2, IsStaff: false}).All(&users)
+	throwFail(t, err)
+	throwFailNow(t, AssertIs(num, 2))
+	throwFail(t, AssertIs(users[0].UserName, "nobody"))
+	throwFail(t, AssertIs(users[1].UserName, "bhojpur"))
+
+	var pages []string
+	err = qs.OrderBy("-id").IteratePages(context.Background(), 2, &users, func() error {
+		names := make([]string, 0, len(users))
+		for _, user := range users {
+			names = append(names, user.UserName)
+		}
+		pages = append(pages, strings.Join(names, ","))
+		return nil
+	})
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(pages, "|"), "nobody,bhojpur|pramila"))
+}
+
+func TestInBatches(t *testing.T) {
+	for i := 0; i < 5; i++ {
+		_, err := dORM.Insert(&UserBig{Name: fmt.Sprintf("batch%d", i)})
+		throwFailNow(t, err)
+	}
+	qs := dORM.QueryTable("user_big").Filter("name__startswith", "batch")
+
+	num, err := qs.UpdateInBatches(2, Params{"name": "batched"})
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 5))
+
+	num, err = qs.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 5))
+
+	num, err = qs.DeleteInBatches(2)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 5))
+
+	num, err = dORM.QueryTable("user_big").Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+
+	_, err = qs.DeleteInBatches(0)
+	throwFail(t, AssertIs(err, ErrArgs))
+}
+
+func TestSoftDelete(t *testing.T) {
+	for _, title := range []string{"open", "closed"} {
+		_, err := dORM.Insert(&Ticket{Title: title})
+		throwFailNow(t, err)
+	}
+	qs := dORM.QueryTable("ticket")
+
+	ticket := Ticket{}
+	err := qs.Filter("title", "closed").One(&ticket)
+	throwFailNow(t, err)
+	num, err := dORM.Delete(&ticket)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(ticket.DeletedAt.IsZero(), false))
+
+	num, err = qs.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.Unscoped().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	err = qs.Filter("title", "closed").One(&ticket)
+	throwFail(t, AssertIs(err, ErrNoRows))
+	err = dORM.Read(&Ticket{ID: ticket.ID})
+	throwFail(t, AssertIs(err, ErrNoRows))
+
+	num, err = qs.Filter("title", "open").Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	num, err = qs.Unscoped().Filter("deleted_at__isnull", false).Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+
+	tickets := NewQuery[Ticket](dORM).Unscoped()
+	num, err = tickets.Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+
+	num, err = qs.Unscoped().Filter("id__gt", 0).Delete()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	num, err = qs.Unscoped().Count()
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 0))
+}
+
+func TestOptimisticLock(t *testing.T) {
+	ticket := Ticket{Title: "draft"}
+	id, err := dORM.Insert(&ticket)
+	throwFailNow(t, err)
+	throwFail(t, AssertIs(ticket.Version, 0))
+
+	stale := Ticket{ID: int(id)}
+	err = dORM.Read(&stale)
+	throwFailNow(t, err)
+
+	ticket.Title = "review"
+	num, err := dORM.Update(&ticket)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	throwFail(t, AssertIs(ticket.Version, 1))
+
+	stale.Title = "publish"
+	num, err = dORM.Update(&stale)
+	throwFail(t, AssertIs(num, 0))
+	var conflict *StaleObjectError
+	throwFailNow(t, AssertIs(errors.As(err, &conflict), true))
+	throwFail(t, AssertIs(conflict.Table, "ticket"))
+	throwFail(t, AssertIs(conflict.Version, 0))
+	throwFail(t, AssertIs(stale.Version, 0))
+
+	err = dORM.Read(&stale)
+	throwFail(t, err)
+	throwFail(t, AssertIs(stale.Title, "review"))
+	throwFail(t, AssertIs(stale.Version, 1))
+
+	// batch updates move the version on too
+	num, err = dORM.QueryTable("ticket").Filter("id", id).Update(Params{"title": "batch"})
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 1))
+	stale.Title = "publish"
+	_, err = dORM.Update(&stale)
+	throwFailNow(t, AssertIs(errors.As(err, &conflict), true))
+	throwFail(t, AssertIs(conflict.Version, 1))
+	err = dORM.Read(&stale)
+	throwFail(t, err)
+	throwFail(t, AssertIs(stale.Title, "batch"))
+	throwFail(t, AssertIs(stale.Version, 2))
+
+	_, err = dORM.QueryTable("ticket").Unscoped().Filter("id__gt", 0).Delete()
+	throwFail(t, err)
+}
+
+func TestModelHooks(t *testing.T) {
+	ticket := Ticket{}
+	_, err := dORM.Insert(&ticket)
+	throwFail(t, AssertIs(err, errTicketTitle))
+	throwFail(t, AssertIs(strings.Join(ticket.hooks, ","), "BeforeInsert"))
+
+	ticket = Ticket{Title: "hooked"}
+	_, err = dORM.Insert(&ticket)
+	throwFailNow(t, err)
+	ticket.Title = ""
+	_, err = dORM.Update(&ticket)
+	throwFail(t, AssertIs(err, errTicketTitle))
+	ticket.Title = "hooked"
+	_, err = dORM.Update(&ticket)
+	throwFail(t, err)
+	read := Ticket{ID: ticket.ID}
+	err = dORM.Read(&read)
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(read.hooks, ","), "AfterRead"))
+	_, err = dORM.Delete(&ticket)
+	throwFail(t, err)
+	throwFail(t, AssertIs(strings.Join(ticket.hooks, ","),
+		"BeforeInsert,AfterInsert,BeforeUpdate,BeforeUpdate,AfterUpdate,BeforeDelete,AfterDelete"))
+
+	tickets := []*Ticket{{Title: "one"}, {Title: "two"}}
+	num, err := dORM.InsertMulti(2, tickets)
+	throwFail(t, err)
+	throwFail(t, AssertIs(num, 2))
+	throwFail(t, AssertIs(strings.Join(tickets[1].hooks, ","), "BeforeInsert,AfterInsert"))
+
+	_, err = dORM.QueryTable("ticket").Unscoped().Filter("id__gt", 0).Delete()
+	throwFail(t, err)
+}
+
 func TestRelatedSel(t *testing.T) {
 	if IsTidb {
 		// Skip it. TiDB does not support relation now.
@@ -2719,3 +3093,12 @@ func TestCondition(t *testing.T) {
 	throwFail(t, AssertIs(!cycleFlag, true))
 	return
 }
+
+func TestNormalizeColumnType(t *testing.T) {
+	throwFail(t, AssertIs(normalizeColumnType(DRMySQL, "int(11)"), normalizeColumnType(DRMySQL, "integer")))
+	throwFail(t, AssertIs(normalizeColumnType(DRMySQL, "tinyint(1)"), "bool"))
+	throwFail(t, AssertIs(normalizeColumnType(DRMySQL, "numeric(10, 2)"), normalizeColumnType(DRMySQL, "decimal(10,2)")))
+	throwFail(t, AssertIs(normalizeColumnType(DRPostgres, "character varying(255)"), "varchar(255)"))
+	throwFail(t, AssertIs(normalizeColumnType(DRPostgres, "BOOLEAN"), "bool"))
+	throwFail(t, AssertIs(normalizeColumnType(DRSqlite, "varchar(255)  NOT NULL"), "varchar(255) not null"))
+}
@@ -170,6 +170,7 @@ type DQL interface {
 	//	this will find User by UserName field
 	// 	u = &User{UserName: "bhojpur", Password: "pass"}
 	//	err = Ormer.Read(u, "UserName")
+	// soft deleted rows are not read, it returns ErrNoRows for them
 	Read(md interface{}, cols ...string) error
 	ReadWithCtx(ctx context.Context, md interface{}, cols ...string) error
 
@@ -329,6 +330,16 @@ type QuerySetter interface {
 	// for example:
 	//  o.QueryTable("user").Filter("uid", uid).ForUpdate().All(&users)
 	ForUpdate() QuerySetter
+	// send the reads to the primary even if the alias has read replicas.
+	// for example:
+	//  o.QueryTable("user").Filter("uid", uid).ForcePrimary().One(&user)
+	ForcePrimary() QuerySetter
+	// include the soft deleted rows of the models with a soft_delete
+	// field, which the queries exclude by default, and make Delete delete
+	// the rows instead of setting their deletion time.
+	// for example:
+	//  o.QueryTable("user").Unscoped().Filter("deleted_at__isnull", false).Delete()
+	Unscoped() QuerySetter
 	// return QuerySeter execution result number
 	// for example:
 	//	num, err = qs.Filter("profile__age__gt", 28).Count()
@@ -350,6 +361,17 @@ type QuerySetter interface {
 	//	num ,err = qs.Filter("user_name__in", "testing1", "testing2").Delete()
 	// 	//delete two user  who's name is testing1 or testing2
 	Delete() (int64, error)
+	// execute update with parameters in chunks of at most bulk rows, each
+	// a statement of its own, so that no statement locks the whole table.
+	// for example:
+	//	num, err = qs.Filter("status", 1).UpdateInBatches(1000, Params{
+	//		"status": 2,
+	//	})
+	UpdateInBatches(bulk int, values Params) (int64, error)
+	// delete from table in chunks of at most bulk rows, like UpdateInBatches
+	// for example:
+	//	num, err = qs.Filter("created__lt", expired).DeleteInBatches(1000)
+	DeleteInBatches(bulk int) (int64, error)
 	// return a insert queryer.
 	// it can be used in times.
 	// example:
@@ -370,6 +392,45 @@ type QuerySetter interface {
 	//	var user User
 	//	qs.One(&user) //user.UserName == "pramila"
 	One(container interface{}, cols ...string) error
+	// return a cursor streaming the rows one at a time instead of reading
+	// them all, don't forget to Close it.
+	// cols means the columns when querying.
+	// for example:
+	//	cur, err := qs.Cursor()
+	//	defer cur.Close()
+	//	for cur.Next() {
+	//		var user User
+	//		err = cur.Scan(&user)
+	//	}
+	//	err = cur.Err()
+	Cursor(cols ...string) (Cursor, error)
+	// stream the rows into container one at a time and call fn after each,
+	// until fn returns an error or ctx is done.
+	// cols means the columns when querying.
+	// for example:
+	//	var user User
+	//	err = qs.Iterate(ctx, &user, func() error {
+	//		return export(&user)
+	//	})
+	Iterate(ctx context.Context, container interface{}, fn func() error, cols ...string) error
+	// filter the rows following row in the ORDER BY of the query, which
+	// ends with the primary key when it doesn't order by it already:
+	// the keyset (seek) pagination, which unlike Offset doesn't get slower
+	// on the last pages. The columns ordered by can't be NULL.
+	// for example:
+	//	qs = qs.OrderBy("-created")
+	//	qs.Limit(100).All(&users)
+	//	qs.SeekAfter(users[len(users)-1]).Limit(100).All(&users)
+	SeekAfter(row interface{}) QuerySetter
+	// read the rows into container, a pointer to a slice, size rows at a
+	// time with SeekAfter and call fn after each page, until fn returns
+	// an error or ctx is done. It replaces the limit and offset.
+	// for example:
+	//	var users []*User
+	//	err = qs.OrderBy("-created").IteratePages(ctx, 1000, &users, func() error {
+	//		return export(users)
+	//	})
+	IteratePages(ctx context.Context, size int, container interface{}, fn func() error) error
 	// query all data and map to []map[string]interface.
 	// expres means condition expression.
 	// it converts data to []map[column]value.
@@ -507,6 +568,37 @@ type RawSetter interface {
 	// 	pre, err := dORM.Raw("INSERT INTO tag (name) VALUES (?)").Prepare()
 	// 	r, err := pre.Exec("name1") // INSERT INTO tag (name) VALUES (`name1`)
 	Prepare() (RawPreparer, error)
+	// return a cursor streaming the rows one at a time instead of reading
+	// them all, don't forget to Close it. Scan maps a row like QueryRow.
+	// for example:
+	//	cur, err := o.Raw("SELECT * FROM user").Cursor()
+	//	defer cur.Close()
+	//	for cur.Next() {
+	//		var user User
+	//		err = cur.Scan(&user)
+	//	}
+	//	err = cur.Err()
+	Cursor() (Cursor, error)
+	// stream the rows into container one at a time and call fn after each,
+	// until fn returns an error or ctx is done.
+	// for example:
+	//	var user User
+	//	err = o.Raw("SELECT * FROM user").Iterate(ctx, &user, func() error {
+	//		return export(&user)
+	//	})
+	Iterate(ctx context.Context, container interface{}, fn func() error) error
+}
+
+// Cursor streams the rows of a query, see QuerySetter.Cursor and
+// RawSetter.Cursor
+type Cursor interface {
+	// move to the next row and tell if there is one
+	Next() bool
+	// map the current row to the containers
+	Scan(containers ...interface{}) error
+	// the error which stopped the iteration, if any
+	Err() error
+	Close() error
 }
 
 // stmtQuerier statement querier
@@ -556,6 +648,7 @@ type txEnder interface {
 type dbBaser interface {
 	Read(dbQuerier, *modelInfo, reflect.Value, *time.Location, []string, bool) error
 	ReadBatch(dbQuerier, *querySet, *modelInfo, *Condition, interface{}, *time.Location, []string) (int64, error)
+	ReadCursor(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location, []string) (Cursor, error)
 	Count(dbQuerier, *querySet, *modelInfo, *Condition, *time.Location) (int64, error)
 	ReadValues(dbQuerier, *querySet, *modelInfo, *Condition, []string, interface{}, *time.Location) (int64, error)
 
@@ -588,6 +681,7 @@ type dbBaser interface {
 	ShowTablesQuery() string
 	ShowColumnsQuery(string) string
 	IndexExists(dbQuerier, string, string) bool
+	GetTableSchema(dbQuerier, string) (*tableSchema, error)
 	collectFieldValue(*modelInfo, *fieldInfo, reflect.Value, bool, *time.Location) (interface{}, error)
 	setval(dbQuerier, *modelInfo, []string) error
 
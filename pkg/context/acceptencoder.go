@@ -28,9 +28,13 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 var (
@@ -79,6 +83,9 @@ type acceptEncoder struct {
 	levelEncode             func(int) resetWriter
 	customCompressLevelPool *sync.Pool
 	bestCompressionPool     *sync.Pool
+	// preference breaks the ties between encodings of the same quality,
+	// the encodings compressing better are preferred
+	preference int
 }
 
 func (ac acceptEncoder) encode(wr io.Writer, level int) resetWriter {
@@ -117,7 +124,7 @@ func (ac acceptEncoder) put(wr resetWriter, level int) {
 }
 
 var (
-	noneCompressEncoder = acceptEncoder{"", nil, nil, nil}
+	noneCompressEncoder = acceptEncoder{name: ""}
 	gzipCompressEncoder = acceptEncoder{
 		name:                    "gzip",
 		levelEncode:             func(level int) resetWriter { wr, _ := gzip.NewWriterLevel(nil, level); return wr },
@@ -135,21 +142,76 @@ var (
 		customCompressLevelPool: &sync.Pool{New: func() interface{} { wr, _ := zlib.NewWriterLevel(nil, gzipCompressLevel); return wr }},
 		bestCompressionPool:     &sync.Pool{New: func() interface{} { wr, _ := zlib.NewWriterLevel(nil, flate.BestCompression); return wr }},
 	}
+
+	// brotli levels range from 0 to 11, the deflate levels map to the same
+	// levels except BestCompression which maps to the best brotli level
+	brotliCompressEncoder = acceptEncoder{
+		name:                    "br",
+		levelEncode:             func(level int) resetWriter { return brotli.NewWriterLevel(nil, brotliLevel(level)) },
+		customCompressLevelPool: &sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(nil, brotliLevel(gzipCompressLevel)) }},
+		bestCompressionPool:     &sync.Pool{New: func() interface{} { return brotli.NewWriterLevel(nil, brotli.BestCompression) }},
+		preference:              2,
+	}
+
+	zstdCompressEncoder = acceptEncoder{
+		name:                    "zstd",
+		levelEncode:             func(level int) resetWriter { return newZstdWriter(level) },
+		customCompressLevelPool: &sync.Pool{New: func() interface{} { return newZstdWriter(gzipCompressLevel) }},
+		bestCompressionPool:     &sync.Pool{New: func() interface{} { return newZstdWriter(flate.BestCompression) }},
+		preference:              1,
+	}
 )
 
+func brotliLevel(level int) int {
+	if level >= flate.BestCompression {
+		return brotli.BestCompression
+	}
+	if level < brotli.BestSpeed {
+		return brotli.DefaultCompression
+	}
+	return level
+}
+
+// newZstdWriter returns a zstd encoder of the speed closest to a deflate level
+func newZstdWriter(level int) resetWriter {
+	speed := zstd.SpeedDefault
+	switch {
+	case level == flate.BestSpeed:
+		speed = zstd.SpeedFastest
+	case level >= flate.BestCompression:
+		speed = zstd.SpeedBestCompression
+	case level >= 6:
+		speed = zstd.SpeedBetterCompression
+	}
+	wr, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(speed), zstd.WithEncoderConcurrency(1))
+	return wr
+}
+
 var encoderMap = map[string]acceptEncoder{ // all the other compress methods will ignore
+	"br":       brotliCompressEncoder,
+	"zstd":     zstdCompressEncoder,
 	"gzip":     gzipCompressEncoder,
 	"deflate":  deflateCompressEncoder,
 	"*":        gzipCompressEncoder, // * means any compress will accept,we prefer gzip
 	"identity": noneCompressEncoder, // identity means none-compress
 }
 
-// WriteFile reads from file and writes to writer by the specific encoding(gzip/deflate)
+// Encodings returns the content codings the encoders support, in the order
+// they are preferred
+func Encodings() []string {
+	return []string{"br", "zstd", "gzip", "deflate"}
+}
+
+// WriteFile reads from file and writes to writer by the specific encoding(br/zstd/gzip/deflate).
+// Files smaller than gzipMinLength are not compressed.
 func WriteFile(encoding string, writer io.Writer, file *os.File) (bool, string, error) {
+	if fi, err := file.Stat(); err == nil && fi.Size() < int64(gzipMinLength) {
+		encoding = ""
+	}
 	return writeLevel(encoding, writer, file, flate.BestCompression)
 }
 
-// WriteBody reads writes content to writer by the specific encoding(gzip/deflate)
+// WriteBody reads writes content to writer by the specific encoding(br/zstd/gzip/deflate)
 func WriteBody(encoding string, writer io.Writer, content []byte) (bool, string, error) {
 	if encoding == "" || len(content) < gzipMinLength {
 		_, err := writer.Write(content)
@@ -197,40 +259,92 @@ func ParseEncoding(r *http.Request) string {
 	return ""
 }
 
-type q struct {
-	name  string
-	value float64
+// NegotiateEncoding returns the content coding of offers the request
+// accepts best, or "" when it accepts none of them or prefers identity.
+// The codings of the same quality are ranked by how well they compress, then
+// by their order in Accept-Encoding.
+func NegotiateEncoding(r *http.Request, offers ...string) string {
+	if r == nil {
+		return ""
+	}
+	return negotiateEncoding(r.Header.Get("Accept-Encoding"), offers)
+}
+
+// AcceptedEncodings returns the content codings of offers the request
+// accepts, best first as ranked by NegotiateEncoding. The codings the request
+// ranks below identity are left out.
+func AcceptedEncodings(r *http.Request, offers ...string) []string {
+	if r == nil {
+		return nil
+	}
+	return acceptedEncodings(r.Header.Get("Accept-Encoding"), offers)
 }
 
 func parseEncoding(r *http.Request) string {
-	acceptEncoding := r.Header.Get("Accept-Encoding")
+	return negotiateEncoding(r.Header.Get("Accept-Encoding"), nil)
+}
+
+// negotiateEncoding selects the coding of the Accept-Encoding header
+// with the highest quality, among offers when they are given
+func negotiateEncoding(acceptEncoding string, offers []string) string {
+	if encodings := acceptedEncodings(acceptEncoding, offers); len(encodings) > 0 {
+		return encodings[0]
+	}
+	return ""
+}
+
+// acceptedEncodings ranks the codings of the Accept-Encoding header, among
+// offers when they are given, down to identity
+func acceptedEncodings(acceptEncoding string, offers []string) []string {
 	if acceptEncoding == "" {
-		return ""
+		return nil
+	}
+	type accepted struct {
+		cf acceptEncoder
+		q  float64
 	}
-	var lastQ q
+	var ranked []accepted
 	for _, v := range strings.Split(acceptEncoding, ",") {
-		v = strings.TrimSpace(v)
-		if v == "" {
+		vs := strings.Split(v, ";")
+		cf, ok := encoderMap[strings.ToLower(strings.TrimSpace(vs[0]))]
+		if !ok || (cf.name != "" && offers != nil && !containsEncoding(offers, cf.name)) {
 			continue
 		}
-		vs := strings.Split(v, ";")
-		var cf acceptEncoder
-		var ok bool
-		if cf, ok = encoderMap[vs[0]]; !ok {
+		f := 1.0
+		for _, p := range vs[1:] {
+			p = strings.TrimSpace(p)
+			if len(p) > 2 && strings.EqualFold(p[:2], "q=") {
+				f, _ = strconv.ParseFloat(p[2:], 64)
+			}
+		}
+		if f <= 0 {
 			continue
 		}
-		if len(vs) == 1 {
-			return cf.name
+		ranked = append(ranked, accepted{cf, f})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].q != ranked[j].q {
+			return ranked[i].q > ranked[j].q
 		}
-		if len(vs) == 2 {
-			f, _ := strconv.ParseFloat(strings.Replace(vs[1], "q=", "", -1), 64)
-			if f == 0 {
-				continue
-			}
-			if f > lastQ.value {
-				lastQ = q{cf.name, f}
-			}
+		return ranked[i].cf.preference > ranked[j].cf.preference
+	})
+	var encodings []string
+	for _, a := range ranked {
+		if a.cf.name == "" {
+			break
+		}
+		if !containsEncoding(encodings, a.cf.name) {
+			encodings = append(encodings, a.cf.name)
+		}
+	}
+	return encodings
+}
+
+func containsEncoding(offers []string, name string) bool {
+	for _, o := range offers {
+		if o == name {
+			return true
 		}
 	}
-	return lastQ.name
+	return false
 }
@@ -21,8 +21,16 @@ package context
 // THE SOFTWARE.
 
 import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
 	"net/http"
+	"reflect"
 	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
 func Test_ExtractEncoding(t *testing.T) {
@@ -62,4 +70,70 @@ func Test_ExtractEncoding(t *testing.T) {
 	if parseEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"gzip;q=0.5,x;q=0.8"}}}) != "gzip" {
 		t.Fail()
 	}
+	if parseEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"gzip, deflate, br"}}}) != "br" {
+		t.Fail()
+	}
+	if parseEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"gzip, zstd, br;q=0.9"}}}) != "zstd" {
+		t.Fail()
+	}
+	if parseEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"br;q=0, gzip;Q=0.8"}}}) != "gzip" {
+		t.Fail()
+	}
+	if NegotiateEncoding(&http.Request{Header: map[string][]string{"Accept-Encoding": {"br, gzip"}}}, "gzip") != "gzip" {
+		t.Fail()
+	}
+}
+
+func TestAcceptedEncodings(t *testing.T) {
+	for accept, want := range map[string][]string{
+		"gzip, deflate, br":            {"br", "gzip"},
+		"gzip, br;q=0.5, zstd":         {"zstd", "gzip", "br"},
+		"br;q=0.4, identity;q=0.5, gz": nil,
+		"*, gzip;q=0.1":                {"gzip"},
+		"deflate":                      nil,
+	} {
+		r := &http.Request{Header: map[string][]string{"Accept-Encoding": {accept}}}
+		if got := AcceptedEncodings(r, "br", "zstd", "gzip"); !reflect.DeepEqual(got, want) {
+			t.Errorf("Accept-Encoding %q: got %v, want %v", accept, got, want)
+		}
+	}
+}
+
+func TestWriteBodyEncodings(t *testing.T) {
+	InitGzip(-1, -1, nil)
+	content := bytes.Repeat([]byte("Bhojpur Web compresses responses. "), 100)
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"br": func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+		"zstd": func(r io.Reader) (io.Reader, error) {
+			d, err := zstd.NewReader(r)
+			return d, err
+		},
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		// twice, so that the pooled encoders are reused
+		for i := 0; i < 2; i++ {
+			var buf bytes.Buffer
+			ok, name, err := WriteBody(encoding, &buf, content)
+			if err != nil || !ok || name != encoding {
+				t.Fatalf("%s: WriteBody returned %v %q %v", encoding, ok, name, err)
+			}
+			if buf.Len() >= len(content) {
+				t.Errorf("%s: %d bytes were not compressed", encoding, buf.Len())
+			}
+			r, err := decode(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			decoded, err := ioutil.ReadAll(r)
+			if err != nil || !bytes.Equal(decoded, content) {
+				t.Errorf("%s: the body does not decode: %v", encoding, err)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if ok, _, _ := WriteBody("br", &buf, []byte("tiny")); ok {
+		t.Error("a body shorter than the minimum length was compressed")
+	}
 }
@@ -0,0 +1,277 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"mime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v2"
+)
+
+// Codec encodes the responses and decodes the requests of a media type
+type Codec struct {
+	// Marshal encodes a value, indented if the media type supports it
+	Marshal func(v interface{}, indent bool) ([]byte, error)
+	// Unmarshal decodes a request body into a value, nil if requests of
+	// the media type can not be bound
+	Unmarshal func(data []byte, v interface{}) error
+	// Supports reports whether a value can be encoded, nil for all values
+	Supports func(v interface{}) bool
+	// Suffix is the structured syntax suffix the codec handles, e.g. json
+	// for vendor media types such as application/vnd.bhojpur.v2+json
+	Suffix string
+	// Charset is added to the Content-Type of text media types
+	Charset string
+}
+
+func (c Codec) supports(v interface{}) bool {
+	return c.Marshal != nil && (c.Supports == nil || c.Supports(v))
+}
+
+var codecs = struct {
+	sync.RWMutex
+	types map[string]Codec
+	// order is the order of registration, the first codec supporting a
+	// value is used for wildcard media ranges
+	order []string
+}{types: make(map[string]Codec)}
+
+// RegisterCodec registers the codec of a media type, replacing the codec
+// registered for it if any. Codecs registered first are preferred when
+// clients accept any media type.
+// usage:
+//
+//	context.RegisterCodec("application/cbor", context.Codec{
+//		Marshal: func(v interface{}, indent bool) ([]byte, error) {
+//			return cbor.Marshal(v)
+//		},
+//		Unmarshal: cbor.Unmarshal,
+//		Suffix:    "cbor",
+//	})
+func RegisterCodec(mediaType string, codec Codec) {
+	mediaType = strings.ToLower(mediaType)
+	codecs.Lock()
+	defer codecs.Unlock()
+	if _, ok := codecs.types[mediaType]; !ok {
+		codecs.order = append(codecs.order, mediaType)
+	}
+	codecs.types[mediaType] = codec
+}
+
+// LookupCodec returns the codec of a media type, vendor media types use the
+// codec of their suffix. Standard media types with a suffix, such as
+// application/xhtml+xml, are documents of their own and need a codec of
+// their own.
+func LookupCodec(mediaType string) (Codec, bool) {
+	mediaType = strings.ToLower(mediaType)
+	codecs.RLock()
+	defer codecs.RUnlock()
+	if codec, ok := codecs.types[mediaType]; ok {
+		return codec, true
+	}
+	if i := strings.LastIndexByte(mediaType, '+'); i >= 0 && vendorTree(mediaType) {
+		suffix := mediaType[i+1:]
+		for _, mt := range codecs.order {
+			if codec := codecs.types[mt]; codec.Suffix == suffix {
+				return codec, true
+			}
+		}
+	}
+	return Codec{}, false
+}
+
+// vendorTree reports whether a media type is in the vendor, personal or
+// unregistered tree, see RFC 6838 section 3
+func vendorTree(mediaType string) bool {
+	i := strings.IndexByte(mediaType, '/')
+	if i < 0 {
+		return false
+	}
+	subtype := mediaType[i+1:]
+	return strings.HasPrefix(subtype, "vnd.") || strings.HasPrefix(subtype, "prs.") ||
+		strings.HasPrefix(subtype, "x.") || strings.HasPrefix(subtype, "x-")
+}
+
+// mediaRange is a media range of an Accept header
+type mediaRange struct {
+	mediaType string
+	q         float64
+	// specificity is 0 for */*, 1 for type/* and 2 for type/subtype
+	specificity int
+}
+
+// parseAccept returns the acceptable media ranges of an Accept header, in
+// the order of preference
+func parseAccept(accept string) []mediaRange {
+	var ranges []mediaRange
+	for _, s := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(s)
+		if err != nil {
+			continue
+		}
+		r := mediaRange{mediaType: mt, q: 1, specificity: 2}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			r.q = q
+		}
+		if r.q <= 0 {
+			continue
+		}
+		if mt == "*/*" {
+			r.specificity = 0
+		} else if strings.HasSuffix(mt, "/*") {
+			r.specificity = 1
+		}
+		ranges = append(ranges, r)
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].q != ranges[j].q {
+			return ranges[i].q > ranges[j].q
+		}
+		return ranges[i].specificity > ranges[j].specificity
+	})
+	return ranges
+}
+
+// NegotiateCodec returns the media type and the codec of the response of a
+// value to a request with an Accept header, following the quality values of
+// the media ranges. Without an Accept header, the first codec registered
+// supporting the value is returned. It returns false if no codec matches.
+func NegotiateCodec(accept string, v interface{}) (string, Codec, bool) {
+	acceptable := negotiateCodecs(accept, v)
+	if len(acceptable) == 0 {
+		return "", Codec{}, false
+	}
+	return acceptable[0].mediaType, acceptable[0].codec, true
+}
+
+// negotiated is a media type acceptable to a request and its codec
+type negotiated struct {
+	mediaType string
+	codec     Codec
+}
+
+// negotiateCodecs returns the media types acceptable to a request with an
+// Accept header whose codecs support a value, in the order of preference
+func negotiateCodecs(accept string, v interface{}) []negotiated {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+	var acceptable []negotiated
+	add := func(mediaType string, codec Codec) {
+		for _, n := range acceptable {
+			if n.mediaType == mediaType {
+				return
+			}
+		}
+		acceptable = append(acceptable, negotiated{mediaType: mediaType, codec: codec})
+	}
+	for _, r := range parseAccept(accept) {
+		if r.specificity == 2 {
+			if codec, ok := LookupCodec(r.mediaType); ok && codec.supports(v) {
+				add(r.mediaType, codec)
+			}
+			continue
+		}
+		prefix := strings.TrimSuffix(r.mediaType, "*")
+		if r.specificity == 0 {
+			prefix = ""
+		}
+		codecs.RLock()
+		for _, mt := range codecs.order {
+			if codec := codecs.types[mt]; strings.HasPrefix(mt, prefix) && codec.supports(v) {
+				add(mt, codec)
+			}
+		}
+		codecs.RUnlock()
+	}
+	return acceptable
+}
+
+// contentType returns the Content-Type of a media type encoded by a codec
+func (c Codec) contentType(mediaType string) string {
+	if c.Charset == "" {
+		return mediaType
+	}
+	return mediaType + "; charset=" + c.Charset
+}
+
+func marshalJSON(v interface{}, indent bool) ([]byte, error) {
+	if indent {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+func marshalXML(v interface{}, indent bool) ([]byte, error) {
+	if indent {
+		return xml.MarshalIndent(v, "", "  ")
+	}
+	return xml.Marshal(v)
+}
+
+func marshalYAML(v interface{}, _ bool) ([]byte, error) {
+	return yaml.Marshal(v)
+}
+
+func marshalProto(v interface{}, _ bool) ([]byte, error) {
+	return proto.Marshal(v.(proto.Message))
+}
+
+func unmarshalProto(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return errors.New("protobuf: the value is not a proto.Message")
+	}
+	return proto.Unmarshal(data, m)
+}
+
+func isProto(v interface{}) bool {
+	_, ok := v.(proto.Message)
+	return ok
+}
+
+func init() {
+	jsonCodec := Codec{Marshal: marshalJSON, Unmarshal: json.Unmarshal, Suffix: "json", Charset: "utf-8"}
+	xmlCodec := Codec{Marshal: marshalXML, Unmarshal: xml.Unmarshal, Suffix: "xml", Charset: "utf-8"}
+	yamlCodec := Codec{Marshal: marshalYAML, Unmarshal: yaml.Unmarshal, Suffix: "yaml", Charset: "utf-8"}
+	protoCodec := Codec{Marshal: marshalProto, Unmarshal: unmarshalProto, Supports: isProto, Suffix: "proto"}
+	msgpackCodec := Codec{Marshal: marshalMsgpack, Unmarshal: unmarshalMsgpack, Suffix: "msgpack"}
+	csvCodec := Codec{Marshal: marshalCSV, Unmarshal: unmarshalCSV, Supports: isCSV, Suffix: "csv", Charset: "utf-8"}
+
+	RegisterCodec(ApplicationJSON, jsonCodec)
+	RegisterCodec(ApplicationXML, xmlCodec)
+	RegisterCodec(TextXML, xmlCodec)
+	RegisterCodec(ApplicationYAML, yamlCodec)
+	RegisterCodec("application/yaml", yamlCodec)
+	RegisterCodec(ApplicationProto, protoCodec)
+	RegisterCodec("application/protobuf", protoCodec)
+	RegisterCodec(ApplicationMsgpack, msgpackCodec)
+	RegisterCodec("application/x-msgpack", msgpackCodec)
+	RegisterCodec(TextCSV, csvCodec)
+}
@@ -0,0 +1,194 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type codecTree struct {
+	Name    string    `json:"name" xml:"name" form:"name"`
+	Height  float64   `json:"height" xml:"height" form:"height"`
+	Planted time.Time `json:"planted" xml:"planted" form:"planted"`
+	Secret  string    `json:"-" xml:"-" yaml:"-" form:"-"`
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	trees := []codecTree{{Name: "oak"}}
+	tests := []struct {
+		accept    string
+		value     interface{}
+		mediaType string
+	}{
+		{"", trees, ApplicationJSON},
+		{"*/*", trees, ApplicationJSON},
+		{"application/xml", trees, ApplicationXML},
+		{"application/xml;q=0.5, application/x-yaml", trees, ApplicationYAML},
+		{"text/*, application/json;q=0.1", trees, TextXML},
+		{"text/csv;q=0.9, application/msgpack", trees, ApplicationMsgpack},
+		{"text/csv, application/json;q=0.5", trees, TextCSV},
+		{"text/csv, application/json;q=0.5", trees[0], ApplicationJSON},
+		{"application/vnd.bhojpur.v2+json", trees, "application/vnd.bhojpur.v2+json"},
+		{"application/x-protobuf, application/xml;q=0.5", trees, ApplicationXML},
+		{"application/json;q=0, text/html", trees, ""},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", trees, ApplicationXML},
+		{"application/xhtml+xml, application/json;q=0.5", trees, ApplicationJSON},
+		{"image/svg+xml", trees, ""},
+	}
+	for _, test := range tests {
+		mediaType, _, ok := NegotiateCodec(test.accept, test.value)
+		assert.Equal(t, test.mediaType != "", ok, test.accept)
+		assert.Equal(t, test.mediaType, mediaType, test.accept)
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	planted := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	trees := []codecTree{{Name: "oak", Height: 3.5, Planted: planted, Secret: "x"}, {Name: "elm, old", Height: -1}}
+
+	for _, mediaType := range []string{ApplicationJSON, ApplicationYAML, ApplicationMsgpack, TextCSV} {
+		codec, ok := LookupCodec(mediaType)
+		require.True(t, ok, mediaType)
+		data, err := codec.Marshal(trees, false)
+		require.Nil(t, err, mediaType)
+		var decoded []codecTree
+		require.Nil(t, codec.Unmarshal(data, &decoded), mediaType)
+		require.Len(t, decoded, 2, mediaType)
+		assert.Equal(t, "oak", decoded[0].Name, mediaType)
+		assert.Equal(t, 3.5, decoded[0].Height, mediaType)
+		assert.True(t, planted.Equal(decoded[0].Planted), mediaType)
+		assert.Equal(t, "", decoded[0].Secret, mediaType)
+		assert.Equal(t, "elm, old", decoded[1].Name, mediaType)
+		assert.Equal(t, -1.0, decoded[1].Height, mediaType)
+	}
+
+	codec, _ := LookupCodec(TextCSV)
+	data, err := codec.Marshal(trees, false)
+	require.Nil(t, err)
+	assert.Equal(t, "name,height,planted\noak,3.5,2021-03-01T10:00:00Z\n\"elm, old\",-1,0001-01-01T00:00:00Z\n", string(data))
+
+	data, err = codec.Marshal([]map[string]interface{}{{"b": 1, "a": "x"}, {"c": true}}, false)
+	require.Nil(t, err)
+	assert.Equal(t, "a,b,c\nx,1,\n,,true\n", string(data))
+}
+
+type msgpackFile struct {
+	Name    string `json:"name"`
+	Content []byte `json:"content"`
+	Skipped string `json:"-"`
+}
+
+func TestMsgpack(t *testing.T) {
+	value := map[string]interface{}{
+		"nil": nil, "t": true, "small": 1, "negative": -33, "int32": -100000,
+		"float": 1.5, "array": []interface{}{"a", 2}, "bytes": []byte{1, 2},
+	}
+	data, err := marshalMsgpack(value, false)
+	require.Nil(t, err)
+	// fixmap of 8 entries with sorted keys, as laid out by the msgpack spec
+	assert.Equal(t, []byte{
+		0x88,
+		0xa5, 'a', 'r', 'r', 'a', 'y', 0x92, 0xa1, 'a', 0x02,
+		0xa5, 'b', 'y', 't', 'e', 's', 0xc4, 0x02, 0x01, 0x02,
+		0xa5, 'f', 'l', 'o', 'a', 't', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa5, 'i', 'n', 't', '3', '2', 0xd2, 0xff, 0xfe, 0x79, 0x60,
+		0xa8, 'n', 'e', 'g', 'a', 't', 'i', 'v', 'e', 0xd0, 0xdf,
+		0xa3, 'n', 'i', 'l', 0xc0,
+		0xa5, 's', 'm', 'a', 'l', 'l', 0x01,
+		0xa1, 't', 0xc3,
+	}, data)
+
+	// byte slices of the structs are binaries, named by their json tags
+	data, err = marshalMsgpack(&msgpackFile{Name: "a", Content: []byte("bin"), Skipped: "x"}, false)
+	require.Nil(t, err)
+	assert.Equal(t, []byte{
+		0x82,
+		0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a',
+		0xa7, 'c', 'o', 'n', 't', 'e', 'n', 't', 0xc4, 0x03, 'b', 'i', 'n',
+	}, data)
+
+	// binaries and strings sent by other clients are bound
+	var file msgpackFile
+	require.Nil(t, unmarshalMsgpack([]byte{
+		0x82,
+		0xa7, 'c', 'o', 'n', 't', 'e', 'n', 't', 0xc5, 0x00, 0x02, 0xff, 0x00,
+		0xa4, 'n', 'a', 'm', 'e', 0xd9, 0x01, 'b',
+	}, &file))
+	assert.Equal(t, msgpackFile{Name: "b", Content: []byte{0xff, 0x00}}, file)
+
+	var decoded map[string]interface{}
+	assert.NotNil(t, unmarshalMsgpack(data[:len(data)-1], &decoded))
+	assert.NotNil(t, unmarshalMsgpack([]byte{0xdd, 0xff, 0xff, 0xff, 0xff}, &decoded))
+}
+
+func TestServeFormattedAndBind(t *testing.T) {
+	tree := &codecTree{Name: "oak", Height: 3}
+	for accept, contentType := range map[string]string{
+		"application/vnd.bhojpur.v2+json":   "application/vnd.bhojpur.v2+json; charset=utf-8",
+		"application/xml, application/json": "application/xml; charset=utf-8",
+		"application/msgpack":               "application/msgpack",
+		"text/html":                         "application/json; charset=utf-8",
+	} {
+		r, _ := http.NewRequest(http.MethodGet, "/tree", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		ctx := NewContext()
+		ctx.Reset(w, r)
+		require.Nil(t, ctx.Output.ServeFormatted(tree, false))
+		assert.Equal(t, contentType, w.Header().Get("Content-Type"), accept)
+		assert.Equal(t, "Accept", w.Header().Get("Vary"))
+
+		// the response body is bound back with its Content-Type
+		r, _ = http.NewRequest(http.MethodPost, "/tree", nil)
+		r.Header.Set("Content-Type", contentType)
+		ctx.Reset(httptest.NewRecorder(), r)
+		ctx.Input.RequestBody = w.Body.Bytes()
+		decoded := &codecTree{}
+		require.Nil(t, ctx.Bind(decoded), accept)
+		// msgpack timestamps carry no location
+		assert.True(t, tree.Planted.Equal(decoded.Planted), accept)
+		decoded.Planted = tree.Planted
+		assert.Equal(t, tree, decoded, accept)
+	}
+
+	// a browser is served JSON when XML can not encode the value
+	r, _ := http.NewRequest(http.MethodGet, "/counts", nil)
+	r.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8")
+	w := httptest.NewRecorder()
+	ctx := NewContext()
+	ctx.Reset(w, r)
+	require.Nil(t, ctx.Output.ServeFormatted(map[string]int{"oak": 3}, false))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"oak":3}`, w.Body.String())
+
+	r, _ = http.NewRequest(http.MethodPost, "/tree", nil)
+	r.Header.Set("Content-Type", "text/plain")
+	ctx = NewContext()
+	ctx.Reset(httptest.NewRecorder(), r)
+	assert.NotNil(t, ctx.Bind(&codecTree{}))
+}
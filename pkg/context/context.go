@@ -36,6 +36,7 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"mime"
 	"net"
 	"net/http"
 	"net/url"
@@ -53,12 +54,14 @@ import (
 
 // Commonly used mime-types
 const (
-	ApplicationJSON  = "application/json"
-	ApplicationXML   = "application/xml"
-	ApplicationForm  = "application/x-www-form-urlencoded"
-	ApplicationProto = "application/x-protobuf"
-	ApplicationYAML  = "application/x-yaml"
-	TextXML          = "text/xml"
+	ApplicationJSON    = "application/json"
+	ApplicationXML     = "application/xml"
+	ApplicationForm    = "application/x-www-form-urlencoded"
+	ApplicationProto   = "application/x-protobuf"
+	ApplicationYAML    = "application/x-yaml"
+	TextXML            = "text/xml"
+	ApplicationMsgpack = "application/msgpack"
+	TextCSV            = "text/csv"
 
 	formatTime      = "15:04:05"
 	formatDate      = "2006-01-02"
@@ -84,45 +87,32 @@ type Context struct {
 	_xsrfToken     string
 }
 
+// Bind decodes the request body into obj with the codec of its Content-Type,
+// see RegisterCodec. Forms are parsed by BindForm and bodies without
+// Content-Type are decoded as JSON.
 func (ctx *Context) Bind(obj interface{}) error {
-	ct, exist := ctx.Request.Header["Content-Type"]
-	if !exist || len(ct) == 0 {
+	ct := ctx.Request.Header.Get("Content-Type")
+	if ct == "" {
 		return ctx.BindJSON(obj)
 	}
-	i, l := 0, len(ct[0])
-	for i < l && ct[0][i] != ';' {
-		i++
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return errors.New("Unsupported Content-Type:" + ct)
 	}
-	switch ct[0][0:i] {
-	case ApplicationJSON:
-		return ctx.BindJSON(obj)
-	case ApplicationXML, TextXML:
-		return ctx.BindXML(obj)
-	case ApplicationForm:
+	if mediaType == ApplicationForm || mediaType == "multipart/form-data" {
 		return ctx.BindForm(obj)
-	case ApplicationProto:
-		return ctx.BindProtobuf(obj.(proto.Message))
-	case ApplicationYAML:
-		return ctx.BindYAML(obj)
-	default:
-		return errors.New("Unsupported Content-Type:" + ct[0])
 	}
+	codec, ok := LookupCodec(mediaType)
+	if !ok || codec.Unmarshal == nil {
+		return errors.New("Unsupported Content-Type:" + ct)
+	}
+	return codec.Unmarshal(ctx.Input.RequestBody, obj)
 }
 
-// Resp sends response based on the Accept Header
+// Resp sends response based on the Accept Header, see ServeFormatted
 // By default response will be in JSON
 func (ctx *Context) Resp(data interface{}) error {
-	accept := ctx.Input.Header("Accept")
-	switch accept {
-	case ApplicationYAML:
-		return ctx.YamlResp(data)
-	case ApplicationXML, TextXML:
-		return ctx.XMLResp(data)
-	case ApplicationProto:
-		return ctx.ProtoResp(data.(proto.Message))
-	default:
-		return ctx.JSONResp(data)
-	}
+	return ctx.Output.ServeFormatted(data, false)
 }
 
 func (ctx *Context) JSONResp(data interface{}) error {
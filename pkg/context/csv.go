@@ -0,0 +1,234 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The CSV codec encodes slices, one record per element. Structs are records
+// with a header of their field names, named as for forms by the form tag,
+// maps are records with a header of their sorted keys and slices are records
+// without header. Bodies are bound to slices of structs the way forms are.
+
+// isCSV reports whether a value is a slice or an array of records
+func isCSV(v interface{}) bool {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+func marshalCSV(v interface{}, _ bool) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	for rv.Kind() == reflect.Ptr {
+		rv = reflect.Indirect(rv)
+	}
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("csv: %T is not a slice", v)
+	}
+	elemT := rv.Type().Elem()
+	for elemT.Kind() == reflect.Ptr {
+		elemT = elemT.Elem()
+	}
+
+	var records [][]string
+	switch elemT.Kind() {
+	case reflect.Struct:
+		var names []string
+		csvFields(elemT, nil, &names, nil)
+		records = append(records, names)
+		for i := 0; i < rv.Len(); i++ {
+			var record []string
+			if e := reflect.Indirect(rv.Index(i)); e.IsValid() {
+				csvFields(elemT, &e, nil, &record)
+			} else {
+				record = make([]string, len(names))
+			}
+			records = append(records, record)
+		}
+	case reflect.Map:
+		var names []string
+		seen := make(map[string]bool)
+		for i := 0; i < rv.Len(); i++ {
+			for _, k := range rv.Index(i).MapKeys() {
+				if name := fmt.Sprint(k.Interface()); !seen[name] {
+					seen[name] = true
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		records = append(records, names)
+		for i := 0; i < rv.Len(); i++ {
+			values := make(map[string]string, len(names))
+			iter := rv.Index(i).MapRange()
+			for iter.Next() {
+				values[fmt.Sprint(iter.Key().Interface())] = csvValue(iter.Value())
+			}
+			record := make([]string, len(names))
+			for j, name := range names {
+				record[j] = values[name]
+			}
+			records = append(records, record)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			e := rv.Index(i)
+			record := make([]string, e.Len())
+			for j := range record {
+				record[j] = csvValue(e.Index(j))
+			}
+			records = append(records, record)
+		}
+	default:
+		for i := 0; i < rv.Len(); i++ {
+			records = append(records, []string{csvValue(rv.Index(i))})
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	if err := w.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// csvFields appends the names, or the values if v is not nil, of the fields
+// of a struct
+func csvFields(t reflect.Type, v *reflect.Value, names *[]string, values *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			if v == nil {
+				csvFields(f.Type, nil, names, values)
+			} else {
+				fv := v.Field(i)
+				csvFields(f.Type, &fv, names, values)
+			}
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		name, ok := formTagName(f)
+		if !ok {
+			continue
+		}
+		if v == nil {
+			*names = append(*names, name)
+		} else {
+			*values = append(*values, csvValue(v.Field(i)))
+		}
+	}
+}
+
+// csvValue formats a value as parsed by forms
+func csvValue(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// unmarshalCSV binds the records of a body to a pointer to a slice of
+// structs, of maps of strings or of slices of strings
+func unmarshalCSV(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("csv: %T is not a pointer to a slice", v)
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil {
+		return err
+	}
+	slice := rv.Elem()
+	elemT := slice.Type().Elem()
+	ptr := elemT.Kind() == reflect.Ptr
+	if ptr {
+		elemT = elemT.Elem()
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, len(records))
+	switch {
+	case elemT.Kind() == reflect.Struct:
+		if len(records) == 0 {
+			break
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			form := make(url.Values, len(header))
+			for i, name := range header {
+				if i < len(record) {
+					form.Add(name, record[i])
+				}
+			}
+			e := reflect.New(elemT)
+			if err := parseFormToStruct(form, elemT, e.Elem()); err != nil {
+				return err
+			}
+			if !ptr {
+				e = e.Elem()
+			}
+			result = reflect.Append(result, e)
+		}
+	case elemT.Kind() == reflect.Map && elemT.Key().Kind() == reflect.String && !ptr &&
+		(elemT.Elem().Kind() == reflect.String || elemT.Elem().Kind() == reflect.Interface):
+		if len(records) == 0 {
+			break
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			m := reflect.MakeMapWithSize(elemT, len(header))
+			for i, name := range header {
+				if i < len(record) {
+					m.SetMapIndex(reflect.ValueOf(name).Convert(elemT.Key()), reflect.ValueOf(record[i]).Convert(elemT.Elem()))
+				}
+			}
+			result = reflect.Append(result, m)
+		}
+	case elemT == reflect.TypeOf([]string{}) && !ptr:
+		for _, record := range records {
+			result = reflect.Append(result, reflect.ValueOf(record))
+		}
+	default:
+		return fmt.Errorf("csv: can not bind records to %T", v)
+	}
+	slice.Set(result)
+	return nil
+}
@@ -287,17 +287,37 @@ func (output *BhojpurOutput) XML(data interface{}, hasIndent bool) error {
 	return output.Body(content)
 }
 
-// ServeFormatted serves YAML, XML or JSON, depending on the value of the Accept header
+// ServeFormatted serves data in the media type preferred by the Accept
+// header among the registered codecs, see RegisterCodec. Vendor media types
+// such as application/vnd.bhojpur.v2+json are served by the codec of their
+// suffix. If no codec is acceptable, or none of the acceptable codecs can
+// encode data, data is served as JSON.
+// if hasEncode is true, JSON converts utf-8 to \u0000 type.
 func (output *BhojpurOutput) ServeFormatted(data interface{}, hasIndent bool, hasEncode ...bool) error {
-	accept := output.Context.Input.Header("Accept")
-	switch accept {
-	case ApplicationYAML:
-		return output.YAML(data)
-	case ApplicationXML, TextXML:
-		return output.XML(data, hasIndent)
-	default:
-		return output.JSON(data, hasIndent, len(hasEncode) > 0 && hasEncode[0])
+	acceptable := negotiateCodecs(output.Context.Input.Header("Accept"), data)
+	acceptable = append(acceptable, negotiateCodecs(ApplicationJSON, data)...)
+	var (
+		mediaType string
+		codec     Codec
+		content   []byte
+		err       error
+	)
+	for _, n := range acceptable {
+		if content, err = n.codec.Marshal(data, hasIndent); err == nil {
+			mediaType, codec = n.mediaType, n.codec
+			break
+		}
+	}
+	if err != nil {
+		http.Error(output.Context.ResponseWriter, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	if codec.Suffix == "json" && len(hasEncode) > 0 && hasEncode[0] {
+		content = []byte(stringsToJSON(string(content)))
 	}
+	output.Context.ResponseWriter.Header().Add("Vary", "Accept")
+	output.Header("Content-Type", codec.contentType(mediaType))
+	return output.Body(content)
 }
 
 // Download forces response for download file.
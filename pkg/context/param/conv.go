@@ -74,6 +74,17 @@ func parseValue(param *MethodParam, paramValue string, paramType reflect.Type) (
 	if paramValue == "" {
 		return reflect.Zero(paramType), nil
 	}
+	if t, ok := LookupType(param.typ); ok && t.Convert != nil {
+		value, err := t.Convert(paramValue)
+		if err != nil {
+			return result, err
+		}
+		// a value the argument can not hold, e.g. a uuid.UUID for a string,
+		// is parsed as usual
+		if v := reflect.ValueOf(value); v.Type().ConvertibleTo(paramType) {
+			return v.Convert(paramType), nil
+		}
+	}
 	parser := getParser(param, paramType)
 	value, err := parser.parse(paramValue, paramType)
 	if err != nil {
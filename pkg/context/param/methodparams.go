@@ -31,6 +31,7 @@ type MethodParam struct {
 	in           paramType
 	required     bool
 	defaultValue string
+	typ          string
 }
 
 type paramType byte
@@ -63,6 +64,39 @@ func Make(list ...*MethodParam) []*MethodParam {
 	return nil
 }
 
+// Name returns the name of the parameter
+func (mp *MethodParam) Name() string {
+	return mp.name
+}
+
+// In returns where the parameter is read from: query, path, header or body
+func (mp *MethodParam) In() string {
+	switch mp.in {
+	case path:
+		return "path"
+	case body:
+		return "body"
+	case header:
+		return "header"
+	}
+	return "query"
+}
+
+// Required reports whether the parameter is required
+func (mp *MethodParam) Required() bool {
+	return mp.required
+}
+
+// DefaultValue returns the default value of the parameter
+func (mp *MethodParam) DefaultValue() string {
+	return mp.defaultValue
+}
+
+// TypeName returns the name of the type set with OfType
+func (mp *MethodParam) TypeName() string {
+	return mp.typ
+}
+
 func (mp *MethodParam) String() string {
 	options := []string{}
 	result := "param.New(\"" + mp.name + "\""
@@ -80,6 +114,9 @@ func (mp *MethodParam) String() string {
 	if mp.defaultValue != "" {
 		options = append(options, fmt.Sprintf(`param.Default("%s")`, mp.defaultValue))
 	}
+	if mp.typ != "" {
+		options = append(options, fmt.Sprintf(`param.OfType("%s")`, mp.typ))
+	}
 	if len(options) > 0 {
 		result += ", "
 	}
@@ -55,3 +55,11 @@ func Default(defaultValue interface{}) MethodParamOption {
 		}
 	}
 }
+
+// OfType converts the parameter with the Convert function of a type
+// registered with RegisterType, e.g. a uuid path parameter to uuid.UUID
+func OfType(name string) MethodParamOption {
+	return func(p *MethodParam) {
+		p.typ = name
+	}
+}
@@ -0,0 +1,130 @@
+package param
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type is a named type of path parameters, used in router patterns as
+// :name:type, e.g. /user/:id:uuid. Pattern and Validate are checked once the
+// route matched, the requests failing them get the ParamErrorStatus of the
+// router; Convert is applied to the valid value. A parameter sharing its path
+// segment with other text, e.g. read_:id:int.htm, only matches values
+// matching Pattern.
+type Type struct {
+	// Pattern is the regular expression of a value, without capturing
+	// groups. It defaults to [^/]+
+	Pattern string
+	// Validate reports whether a value matching Pattern is valid, e.g. that
+	// 2021-02-30 is not a date. A nil Validate accepts every value
+	Validate func(value string) error
+	// Convert turns a value into the argument of controller methods, e.g.
+	// a uuid.UUID. A nil Convert leaves it to the argument type
+	Convert func(value string) (interface{}, error)
+
+	re *regexp.Regexp
+}
+
+var (
+	typesLock sync.RWMutex
+	types     = make(map[string]Type)
+)
+
+func init() {
+	RegisterType("int", Type{Pattern: `[0-9]+`})
+	RegisterType("string", Type{Pattern: `[\w]+`})
+	RegisterType("uuid", Type{
+		Pattern: `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+		Convert: func(value string) (interface{}, error) {
+			return uuid.Parse(value)
+		},
+	})
+	RegisterType("slug", Type{Pattern: `[a-z0-9]+(?:-[a-z0-9]+)*`})
+	RegisterType("date", Type{
+		Pattern: `[0-9]{4}-[0-9]{2}-[0-9]{2}`,
+		Validate: func(value string) error {
+			_, err := time.Parse("2006-01-02", value)
+			return err
+		},
+		Convert: func(value string) (interface{}, error) {
+			return time.Parse("2006-01-02", value)
+		},
+	})
+	RegisterType("semver", Type{
+		Pattern: `v?(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)\.(?:0|[1-9][0-9]*)` +
+			`(?:-[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?(?:\+[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?`,
+	})
+}
+
+// RegisterType registers a type of path parameters, replacing a type with
+// the same name. Names are case insensitive. It panics if the pattern is not
+// a valid regular expression or has capturing groups, which would shift the
+// parameters of the route.
+// usage:
+//
+//	param.RegisterType("sku", param.Type{Pattern: `[A-Z]{3}-[0-9]{4}`})
+//	param.RegisterType("even", param.Type{Validate: func(v string) error {...}})
+func RegisterType(name string, t Type) {
+	if name == "" {
+		panic("param: type name is empty")
+	}
+	if t.Pattern == "" {
+		t.Pattern = `[^/]+`
+	}
+	re, err := regexp.Compile(`^(?:` + t.Pattern + `)$`)
+	if err != nil {
+		panic(fmt.Sprintf("param: invalid pattern of type %s: %v", name, err))
+	}
+	if re.NumSubexp() > 0 {
+		panic(fmt.Sprintf("param: pattern of type %s has capturing groups, use (?:...)", name))
+	}
+	t.re = re
+	typesLock.Lock()
+	types[strings.ToLower(name)] = t
+	typesLock.Unlock()
+}
+
+// LookupType returns the type registered with name
+func LookupType(name string) (Type, bool) {
+	typesLock.RLock()
+	t, ok := types[strings.ToLower(name)]
+	typesLock.RUnlock()
+	return t, ok
+}
+
+// Check reports whether value matches the pattern of the type and passes
+// its validation
+func (t Type) Check(value string) error {
+	if t.re != nil && !t.re.MatchString(value) {
+		return fmt.Errorf("%q does not match %s", value, t.Pattern)
+	}
+	if t.Validate != nil {
+		return t.Validate(value)
+	}
+	return nil
+}
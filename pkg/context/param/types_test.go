@@ -0,0 +1,81 @@
+package param
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func Test_Types(t *testing.T) {
+	id, ok := LookupType("UUID")
+	if !ok {
+		t.Fatal("uuid should be a registered type")
+	}
+	if id.Check("1b4e28ba-2fa1-11d2-883f-0016d3cca427") != nil || id.Check("123") == nil {
+		t.Error("uuid should check its pattern")
+	}
+	date, _ := LookupType("date")
+	if date.Check("2021-02-03") != nil || date.Check("2021-02-30") == nil {
+		t.Error("date should validate days")
+	}
+
+	RegisterType("even", Type{Validate: func(value string) error {
+		if n, err := strconv.Atoi(value); err != nil || n%2 != 0 {
+			return errors.New("not even")
+		}
+		return nil
+	}})
+	even, _ := LookupType("even")
+	if even.Pattern != `[^/]+` || even.Check("4") != nil || even.Check("5") == nil {
+		t.Error("custom types should be validated")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("patterns with capturing groups should panic")
+		}
+	}()
+	RegisterType("bad", Type{Pattern: `(a|b)`})
+}
+
+func Test_TypedParams(t *testing.T) {
+	value, err := parseValue(New("id", OfType("uuid")), "1b4e28ba-2fa1-11d2-883f-0016d3cca427", reflect.TypeOf(uuid.UUID{}))
+	if err != nil || value.Interface() != uuid.MustParse("1b4e28ba-2fa1-11d2-883f-0016d3cca427") {
+		t.Errorf("uuid should convert to uuid.UUID, got %v %v", value, err)
+	}
+	value, err = parseValue(New("id", OfType("uuid")), "1b4e28ba-2fa1-11d2-883f-0016d3cca427", reflect.TypeOf(""))
+	if err != nil || value.Interface() != "1b4e28ba-2fa1-11d2-883f-0016d3cca427" {
+		t.Errorf("uuid should convert to string, got %v %v", value, err)
+	}
+	value, err = parseValue(New("day", OfType("date")), "2021-02-03", reflect.TypeOf(time.Time{}))
+	if err != nil || !value.Interface().(time.Time).Equal(time.Date(2021, 2, 3, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("date should convert to time.Time, got %v %v", value, err)
+	}
+	if s := New("id", InPath, OfType("uuid")).String(); s != `param.New("id", param.InPath, param.OfType("uuid"))` {
+		t.Errorf("unexpected %s", s)
+	}
+}
@@ -0,0 +1,298 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/bhojpur/web/pkg/core/berror"
+)
+
+// Media types of RFC 7807 problem details
+const (
+	ApplicationProblemJSON = "application/problem+json"
+	ApplicationProblemXML  = "application/problem+xml"
+)
+
+// problemNamespace is the XML namespace of problem details
+const problemNamespace = "urn:ietf:rfc:7807"
+
+// Problem is an RFC 7807 problem detail, a machine readable error of an
+// HTTP API. Its Extensions are additional members, such as the code of a
+// berror.
+type Problem struct {
+	Type       string
+	Title      string
+	Status     int
+	Detail     string
+	Instance   string
+	Extensions map[string]interface{}
+}
+
+// NewProblem returns the problem of an HTTP status, without a type
+func NewProblem(status int, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// ProblemFromError returns the problem of an error. The status, type and
+// title of errors with a berror code come from the problem type registered
+// for the code, other errors are 500 Internal Server Error.
+func ProblemFromError(err error) *Problem {
+	var problem *Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+	var status StatusCode
+	if errors.As(err, &status) {
+		return NewProblem(int(status), "")
+	}
+	p := NewProblem(http.StatusInternalServerError, err.Error())
+	code, ok := berror.FromError(err)
+	if !ok {
+		return p
+	}
+	p.Detail = strings.TrimPrefix(p.Detail, fmt.Sprintf("ERROR-%d, ", code.Code()))
+	p.Extensions = map[string]interface{}{"code": code.Code()}
+	if t, ok := LookupProblemType(code); ok {
+		if t.Status != 0 {
+			p.Status = t.Status
+			p.Title = http.StatusText(t.Status)
+		}
+		if t.Type != "" {
+			p.Type = t.Type
+		}
+		if t.Title != "" {
+			p.Title = t.Title
+		}
+	}
+	return p
+}
+
+// Error returns the title and the detail of the problem
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+	return p.Title + ": " + p.Detail
+}
+
+// members returns the members of the problem, its extensions can not
+// override the ones of RFC 7807
+func (p *Problem) members() map[string]interface{} {
+	m := make(map[string]interface{}, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		m[k] = v
+	}
+	m["type"] = p.Type
+	m["title"] = p.Title
+	m["status"] = p.Status
+	delete(m, "detail")
+	delete(m, "instance")
+	if p.Detail != "" {
+		m["detail"] = p.Detail
+	}
+	if p.Instance != "" {
+		m["instance"] = p.Instance
+	}
+	return m
+}
+
+// MarshalJSON encodes the problem with its extensions as members
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.members())
+}
+
+// UnmarshalJSON decodes a problem, unknown members go to the extensions
+func (p *Problem) UnmarshalJSON(data []byte) error {
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*p = Problem{}
+	for k, v := range m {
+		switch k {
+		case "type":
+			p.Type, _ = v.(string)
+		case "title":
+			p.Title, _ = v.(string)
+		case "status":
+			status, _ := v.(float64)
+			p.Status = int(status)
+		case "detail":
+			p.Detail, _ = v.(string)
+		case "instance":
+			p.Instance, _ = v.(string)
+		default:
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]interface{})
+			}
+			p.Extensions[k] = v
+		}
+	}
+	return nil
+}
+
+// MarshalXML encodes the problem in the XML format of RFC 7807, extensions
+// are encoded as elements, in the order of their names
+func (p *Problem) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: problemNamespace, Local: "problem"}}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	m := p.members()
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sortProblemMembers(names)
+	for _, name := range names {
+		if err := e.EncodeElement(m[name], xml.StartElement{Name: xml.Name{Local: name}}); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+// problemMembers are the members of RFC 7807, in their order
+var problemMembers = map[string]int{"type": 1, "title": 2, "status": 3, "detail": 4, "instance": 5}
+
+// sortProblemMembers puts the members of RFC 7807 first
+func sortProblemMembers(names []string) {
+	sort.Slice(names, func(i, j int) bool {
+		ri, rj := problemMembers[names[i]], problemMembers[names[j]]
+		if ri == 0 || rj == 0 {
+			if ri != rj {
+				return rj == 0
+			}
+			return names[i] < names[j]
+		}
+		return ri < rj
+	})
+}
+
+// ProblemType is the type of the problems of a berror code
+type ProblemType struct {
+	// Status is the HTTP status of the problems, 500 if it is 0
+	Status int
+	// Type is a URI identifying the type, about:blank if it is empty
+	Type string
+	// Title is a short summary of the type, the text of the status if it
+	// is empty
+	Title string
+}
+
+var problemTypes = struct {
+	sync.RWMutex
+	types map[uint32]ProblemType
+}{types: make(map[uint32]ProblemType)}
+
+// RegisterProblemType maps a berror code to the status, type and title of
+// the problems of its errors.
+// usage:
+//
+//	var NoSuchTree = berror.DefineCode(4040001, "trees", "NoSuchTree", "the tree does not exist")
+//
+//	func init() {
+//		context.RegisterProblemType(NoSuchTree, context.ProblemType{
+//			Status: http.StatusNotFound,
+//			Type:   "https://example.com/problems/no-such-tree",
+//			Title:  "No such tree",
+//		})
+//	}
+func RegisterProblemType(code berror.Code, t ProblemType) {
+	problemTypes.Lock()
+	defer problemTypes.Unlock()
+	problemTypes.types[code.Code()] = t
+}
+
+// LookupProblemType returns the problem type registered for a berror code
+func LookupProblemType(code berror.Code) (ProblemType, bool) {
+	problemTypes.RLock()
+	defer problemTypes.RUnlock()
+	t, ok := problemTypes.types[code.Code()]
+	return t, ok
+}
+
+// Problem writes a problem to the response, as application/problem+xml if
+// the Accept header prefers XML, as application/problem+json otherwise.
+// The instance of the problem defaults to the path of the request.
+func (output *BhojpurOutput) Problem(p *Problem) error {
+	problem := *p
+	if problem.Instance == "" && output.Context.Request != nil {
+		problem.Instance = output.Context.Request.URL.Path
+	}
+	var content []byte
+	var err error
+	if output.acceptsProblemXML() {
+		output.Header("Content-Type", ApplicationProblemXML+"; charset=utf-8")
+		content, err = xml.Marshal(&problem)
+	} else {
+		output.Header("Content-Type", ApplicationProblemJSON+"; charset=utf-8")
+		content, err = json.Marshal(&problem)
+	}
+	if err != nil {
+		http.Error(output.Context.ResponseWriter, err.Error(), http.StatusInternalServerError)
+		return err
+	}
+	output.Header("X-Content-Type-Options", "nosniff")
+	output.SetStatus(problem.Status)
+	return output.Body(content)
+}
+
+// acceptsProblemXML reports whether the first XML media type of the Accept
+// header comes before the first JSON one
+func (output *BhojpurOutput) acceptsProblemXML() bool {
+	xmlAt, jsonAt := -1, -1
+	for i, accept := range strings.Split(output.Context.Input.Header("Accept"), ",") {
+		mt, params, err := mime.ParseMediaType(accept)
+		if err != nil {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			continue
+		}
+		switch mt {
+		case ApplicationXML, TextXML, ApplicationProblemXML:
+			if xmlAt < 0 {
+				xmlAt = i
+			}
+		case ApplicationJSON, ApplicationProblemJSON:
+			if jsonAt < 0 {
+				jsonAt = i
+			}
+		}
+	}
+	return xmlAt >= 0 && (jsonAt < 0 || xmlAt < jsonAt)
+}
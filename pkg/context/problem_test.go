@@ -0,0 +1,109 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/core/berror"
+)
+
+var (
+	testConflict = berror.DefineCode(4090001, "context_test", "Conflict", "the resource exists")
+	testCoded    = berror.DefineCode(5000002, "context_test", "Coded", "an error with a code")
+)
+
+func TestProblemFromError(t *testing.T) {
+	RegisterProblemType(testConflict, ProblemType{
+		Status: http.StatusConflict,
+		Type:   "https://example.com/problems/conflict",
+	})
+
+	p := ProblemFromError(berror.Errorf(testConflict, "tree %d exists", 1))
+	assert.Equal(t, http.StatusConflict, p.Status)
+	assert.Equal(t, "https://example.com/problems/conflict", p.Type)
+	assert.Equal(t, "Conflict", p.Title)
+	assert.Equal(t, "tree 1 exists", p.Detail)
+	assert.Equal(t, uint32(4090001), p.Extensions["code"])
+
+	p = ProblemFromError(berror.Error(testCoded, "failed"))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Equal(t, "about:blank", p.Type)
+	assert.Equal(t, "failed", p.Detail)
+
+	p = ProblemFromError(errors.New("failed"))
+	assert.Equal(t, http.StatusInternalServerError, p.Status)
+	assert.Nil(t, p.Extensions)
+
+	conflict := NewProblem(http.StatusConflict, "")
+	assert.Equal(t, conflict, ProblemFromError(conflict))
+
+	p = ProblemFromError(NotFound)
+	assert.Equal(t, http.StatusNotFound, p.Status)
+	assert.Equal(t, "Not Found", p.Title)
+}
+
+func TestProblemJSON(t *testing.T) {
+	p := NewProblem(http.StatusBadRequest, "invalid tree")
+	p.Extensions = map[string]interface{}{"status": 200, "field": "name"}
+	data, err := json.Marshal(p)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"about:blank","title":"Bad Request","status":400,"detail":"invalid tree","field":"name"}`, string(data))
+
+	decoded := &Problem{}
+	assert.Nil(t, json.Unmarshal(data, decoded))
+	assert.Equal(t, 400, decoded.Status)
+	assert.Equal(t, "name", decoded.Extensions["field"])
+}
+
+func TestOutputProblem(t *testing.T) {
+	tests := map[string]string{
+		"":                                  ApplicationProblemJSON,
+		"text/html":                         ApplicationProblemJSON,
+		"application/json, application/xml": ApplicationProblemJSON,
+		"application/xml, application/json": ApplicationProblemXML,
+		"application/problem+xml":           ApplicationProblemXML,
+		"application/xml;q=0, text/html":    ApplicationProblemJSON,
+	}
+	for accept, contentType := range tests {
+		r, _ := http.NewRequest(http.MethodGet, "/trees/1", nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		ctx := NewContext()
+		ctx.Reset(&Response{ResponseWriter: w}, r)
+
+		assert.Nil(t, ctx.Output.Problem(NewProblem(http.StatusNotFound, "")))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, contentType+"; charset=utf-8", w.Header().Get("Content-Type"), accept)
+		if contentType == ApplicationProblemXML {
+			assert.Equal(t, `<problem xmlns="urn:ietf:rfc:7807"><type>about:blank</type><title>Not Found</title>`+
+				`<status>404</status><instance>/trees/1</instance></problem>`, w.Body.String())
+		} else {
+			assert.JSONEq(t, `{"type":"about:blank","title":"Not Found","status":404,"instance":"/trees/1"}`, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TextEventStream is the media type of server-sent events
+const TextEventStream = "text/event-stream"
+
+// ErrSSEUnsupported is returned when the response can not be flushed, so
+// that events can not be streamed
+var ErrSSEUnsupported = errors.New("sse: the response writer does not support flushing")
+
+// Event is a server-sent event
+type Event struct {
+	// ID is the id of the event, sent back by the clients reconnecting in
+	// the Last-Event-ID header
+	ID string
+	// Event is the type of the event, message if it is empty
+	Event string
+	// Data is the payload of the event, strings and bytes are sent as is,
+	// other values as JSON
+	Data interface{}
+	// Retry asks the clients to wait as long before reconnecting
+	Retry time.Duration
+}
+
+// encode writes the event in the event stream format
+func (e *Event) encode(buf *bytes.Buffer) error {
+	if e.ID != "" {
+		buf.WriteString("id: " + sseField(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		buf.WriteString("event: " + sseField(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		buf.WriteString("retry: " + strconv.FormatInt(e.Retry.Milliseconds(), 10) + "\n")
+	}
+	var data string
+	switch d := e.Data.(type) {
+	case nil:
+	case string:
+		data = d
+	case []byte:
+		data = string(d)
+	default:
+		content, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		data = string(content)
+	}
+	if e.Data != nil {
+		for _, line := range strings.Split(normalizeNewlines(data), "\n") {
+			buf.WriteString("data: " + line + "\n")
+		}
+	}
+	buf.WriteString("\n")
+	return nil
+}
+
+func normalizeNewlines(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\r", "\n")
+}
+
+// sseField removes the line breaks of a single line field
+func sseField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// SSE writes server-sent events to a response. Its methods are safe for
+// concurrent use.
+type SSE struct {
+	ctx     *Context
+	flusher http.Flusher
+	mu      sync.Mutex
+	err     error
+}
+
+// SSE starts a stream of server-sent events as the response of the request
+// usage:
+//
+//	sse, err := ctx.SSE()
+//	if err != nil {
+//		return err
+//	}
+//	for {
+//		select {
+//		case tick := <-ticker.C:
+//			sse.Send(context.Event{Event: "tick", Data: tick})
+//		case <-sse.Done():
+//			return nil
+//		}
+//	}
+func (ctx *Context) SSE() (*SSE, error) {
+	flusher, ok := ctx.ResponseWriter.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, ErrSSEUnsupported
+	}
+	header := ctx.ResponseWriter.Header()
+	header.Set("Content-Type", TextEventStream+"; charset=utf-8")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	// disable the buffering of proxies such as nginx
+	header.Set("X-Accel-Buffering", "no")
+	header.Del("Content-Length")
+	ctx.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	return &SSE{ctx: ctx, flusher: flusher}, nil
+}
+
+// LastEventID returns the id of the last event received by a client
+// reconnecting, empty for new clients
+func (s *SSE) LastEventID() string {
+	return s.ctx.Input.Header("Last-Event-ID")
+}
+
+// Done is closed when the client goes away
+func (s *SSE) Done() <-chan struct{} {
+	return s.ctx.Request.Context().Done()
+}
+
+// Send writes events and flushes them to the client. Once a write failed,
+// the error is returned for all the events sent after.
+func (s *SSE) Send(events ...Event) error {
+	buf := &bytes.Buffer{}
+	for i := range events {
+		if err := events[i].encode(buf); err != nil {
+			return err
+		}
+	}
+	return s.write(buf.Bytes())
+}
+
+// Comment writes a comment, ignored by clients, e.g. to keep the connection
+// alive through proxies
+func (s *SSE) Comment(text string) error {
+	buf := &bytes.Buffer{}
+	for _, line := range strings.Split(normalizeNewlines(text), "\n") {
+		buf.WriteString(": " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return s.write(buf.Bytes())
+}
+
+// Retry asks the clients to wait as long before reconnecting
+func (s *SSE) Retry(d time.Duration) error {
+	return s.write([]byte("retry: " + strconv.FormatInt(d.Milliseconds(), 10) + "\n\n"))
+}
+
+// Heartbeat writes a comment at every interval until the client goes away
+// or stop is called
+func (s *SSE) Heartbeat(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			case <-s.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+		})
+	}
+}
+
+func (s *SSE) write(p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if _, err := s.ctx.ResponseWriter.Write(p); err != nil {
+		s.err = err
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
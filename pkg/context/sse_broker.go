@@ -0,0 +1,411 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSSESlowSubscriber is returned by SSEBroker.Serve when a subscriber is
+// disconnected for not keeping up with the events
+var ErrSSESlowSubscriber = errors.New("sse: the subscriber is too slow")
+
+// Backpressure is what a broker does when the buffer of a subscriber is full
+type Backpressure int
+
+const (
+	// Disconnect closes the subscriber, its client reconnects and resumes
+	// from its last event with the history of the broker
+	Disconnect Backpressure = iota
+	// DropOldest drops the oldest event waiting for the subscriber
+	DropOldest
+	// DropNewest drops the new event
+	DropNewest
+)
+
+// SSEBrokerOption configures an SSEBroker
+type SSEBrokerOption func(b *SSEBroker)
+
+// WithSSEBuffer sets the number of events waiting for each subscriber
+func WithSSEBuffer(size int) SSEBrokerOption {
+	return func(b *SSEBroker) {
+		b.buffer = size
+	}
+}
+
+// WithSSEHistory sets the number of events kept per topic to resume the
+// streams of the clients reconnecting
+func WithSSEHistory(size int) SSEBrokerOption {
+	return func(b *SSEBroker) {
+		b.history = size
+	}
+}
+
+// WithSSEBackpressure sets what happens to the subscribers not keeping up
+func WithSSEBackpressure(policy Backpressure) SSEBrokerOption {
+	return func(b *SSEBroker) {
+		b.backpressure = policy
+	}
+}
+
+// WithSSEHeartbeat sets the interval of the heartbeat comments, 0 disables
+// them
+func WithSSEHeartbeat(interval time.Duration) SSEBrokerOption {
+	return func(b *SSEBroker) {
+		b.heartbeat = interval
+	}
+}
+
+// WithSSEResume sets the hook returning the events to replay to a client
+// reconnecting after an event the history does not hold anymore, e.g. from
+// a database. It is called for every topic missing events, without locking
+// the broker.
+func WithSSEResume(resume func(topic, lastEventID string) []Event) SSEBrokerOption {
+	return func(b *SSEBroker) {
+		b.resume = resume
+	}
+}
+
+// SSEBroker fans out the events published to topics to their subscribers
+// usage:
+//
+//	var broker = context.NewSSEBroker(context.WithSSEHistory(100))
+//
+//	func (c *NewsController) Stream() {
+//		broker.Serve(c.Ctx, "news")
+//	}
+//
+//	func (c *NewsController) Post() {
+//		broker.Publish("news", context.Event{Event: "article", Data: article})
+//	}
+type SSEBroker struct {
+	mu           sync.Mutex
+	topics       map[string]*sseTopic
+	seq          uint64
+	buffer       int
+	history      int
+	backpressure Backpressure
+	heartbeat    time.Duration
+	resume       func(topic, lastEventID string) []Event
+	closed       bool
+}
+
+type sseTopic struct {
+	subscribers map[*SSESubscriber]struct{}
+	history     []sseEntry
+	// trimmed is the sequence number of the last event dropped from the
+	// history
+	trimmed uint64
+}
+
+// sseEntry is an event of the history with its sequence number, ordering
+// the events of several topics
+type sseEntry struct {
+	seq   uint64
+	event Event
+}
+
+// SSESubscriber receives the events of topics
+type SSESubscriber struct {
+	broker  *SSEBroker
+	topics  []string
+	events  chan Event
+	closed  bool
+	slow    bool
+	dropped uint64
+}
+
+// NewSSEBroker returns a broker keeping 64 events per subscriber, disconnecting
+// the slower ones, and sending a heartbeat every 15 seconds
+func NewSSEBroker(opts ...SSEBrokerOption) *SSEBroker {
+	b := &SSEBroker{
+		topics:       make(map[string]*sseTopic),
+		buffer:       64,
+		backpressure: Disconnect,
+		heartbeat:    15 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+func (b *SSEBroker) topic(name string) *sseTopic {
+	t, ok := b.topics[name]
+	if !ok {
+		t = &sseTopic{subscribers: make(map[*SSESubscriber]struct{})}
+		b.topics[name] = t
+	}
+	return t
+}
+
+// Publish sends an event to the subscribers of a topic. Events without id
+// get a sequence number as id.
+func (b *SSEBroker) Publish(topic string, e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	if e.ID == "" {
+		e.ID = strconv.FormatUint(b.seq, 10)
+	}
+	t := b.topic(topic)
+	if b.history > 0 {
+		t.history = append(t.history, sseEntry{seq: b.seq, event: e})
+		if len(t.history) > b.history {
+			t.trimmed = t.history[len(t.history)-b.history-1].seq
+			t.history = append(t.history[:0:0], t.history[len(t.history)-b.history:]...)
+		}
+	}
+	for s := range t.subscribers {
+		b.deliver(s, e)
+	}
+}
+
+// deliver queues an event for a subscriber, following the backpressure
+// policy if its buffer is full
+func (b *SSEBroker) deliver(s *SSESubscriber, e Event) {
+	select {
+	case s.events <- e:
+		return
+	default:
+	}
+	s.dropped++
+	switch b.backpressure {
+	case DropOldest:
+		select {
+		case <-s.events:
+		default:
+		}
+		select {
+		case s.events <- e:
+		default:
+		}
+	case DropNewest:
+	default:
+		s.slow = true
+		b.remove(s)
+	}
+}
+
+// Subscribe subscribes to topics. The events published after lastEventID,
+// if not empty, are replayed from the histories of the topics, or from the
+// resume hook for the topics whose history does not go back to it.
+func (b *SSEBroker) Subscribe(lastEventID string, topics ...string) *SSESubscriber {
+	// the resume hook runs unlocked, so it can neither stall nor deadlock
+	// the broker, and the topics are checked again once it returns
+	resumed := make(map[string][]Event)
+	marks := make(map[string]uint64)
+	for {
+		b.mu.Lock()
+		lost := b.lost(lastEventID, topics, resumed)
+		if len(lost) == 0 || b.resume == nil {
+			break
+		}
+		mark := b.seq
+		b.mu.Unlock()
+		for _, name := range lost {
+			resumed[name] = b.resume(name, lastEventID)
+			marks[name] = mark
+		}
+	}
+	defer b.mu.Unlock()
+
+	var replay []sseEntry
+	if lastEventID != "" {
+		lastSeq, found := b.sequence(lastEventID)
+		for _, name := range topics {
+			t := b.topic(name)
+			if events, ok := resumed[name]; ok {
+				for _, e := range events {
+					replay = append(replay, sseEntry{event: e})
+				}
+				replay = append(replay, t.since(marks[name])...)
+			} else if found {
+				replay = append(replay, t.since(lastSeq)...)
+			}
+		}
+		sort.SliceStable(replay, func(i, j int) bool {
+			return replay[i].seq < replay[j].seq
+		})
+	}
+
+	s := &SSESubscriber{
+		broker: b,
+		topics: topics,
+		events: make(chan Event, b.buffer+len(replay)),
+	}
+	for _, entry := range replay {
+		s.events <- entry.event
+	}
+	if b.closed {
+		s.closed = true
+		close(s.events)
+		return s
+	}
+	for _, name := range topics {
+		b.topic(name).subscribers[s] = struct{}{}
+	}
+	return s
+}
+
+// sequence returns the sequence number of an event of the histories
+func (b *SSEBroker) sequence(id string) (uint64, bool) {
+	var (
+		seq   uint64
+		found bool
+	)
+	for _, t := range b.topics {
+		for i := len(t.history) - 1; i >= 0; i-- {
+			if t.history[i].event.ID == id {
+				if !found || t.history[i].seq > seq {
+					seq, found = t.history[i].seq, true
+				}
+				break
+			}
+		}
+	}
+	return seq, found
+}
+
+// lost returns the topics not resumed yet whose history misses events
+// published after lastEventID
+func (b *SSEBroker) lost(lastEventID string, topics []string, resumed map[string][]Event) []string {
+	if lastEventID == "" {
+		return nil
+	}
+	lastSeq, found := b.sequence(lastEventID)
+	var lost []string
+	for _, name := range topics {
+		if _, ok := resumed[name]; ok {
+			continue
+		}
+		if !found || b.topic(name).trimmed > lastSeq {
+			lost = append(lost, name)
+		}
+	}
+	return lost
+}
+
+// since returns the events of the history published after a sequence
+// number
+func (t *sseTopic) since(seq uint64) []sseEntry {
+	i := sort.Search(len(t.history), func(i int) bool {
+		return t.history[i].seq > seq
+	})
+	return append([]sseEntry{}, t.history[i:]...)
+}
+
+// Unsubscribe stops the events of a subscriber and closes its channel
+func (b *SSEBroker) Unsubscribe(s *SSESubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(s)
+}
+
+func (b *SSEBroker) remove(s *SSESubscriber) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	for _, name := range s.topics {
+		if t, ok := b.topics[name]; ok {
+			delete(t.subscribers, s)
+		}
+	}
+	close(s.events)
+}
+
+// Close disconnects all the subscribers, the events published after are
+// dropped
+func (b *SSEBroker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for _, t := range b.topics {
+		for s := range t.subscribers {
+			b.remove(s)
+		}
+	}
+}
+
+// Subscribers returns the number of subscribers of a topic
+func (b *SSEBroker) Subscribers(topic string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if t, ok := b.topics[topic]; ok {
+		return len(t.subscribers)
+	}
+	return 0
+}
+
+// Events returns the channel of the events, closed when the subscriber is
+// unsubscribed or disconnected
+func (s *SSESubscriber) Events() <-chan Event {
+	return s.events
+}
+
+// Dropped returns the number of events the subscriber did not keep up with
+func (s *SSESubscriber) Dropped() uint64 {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.dropped
+}
+
+// Serve streams the events of topics as the response of a request until
+// the client goes away, resuming from the Last-Event-ID of the request
+func (b *SSEBroker) Serve(ctx *Context, topics ...string) error {
+	sse, err := ctx.SSE()
+	if err != nil {
+		return err
+	}
+	sub := b.Subscribe(sse.LastEventID(), topics...)
+	defer b.Unsubscribe(sub)
+	if b.heartbeat > 0 {
+		stop := sse.Heartbeat(b.heartbeat)
+		defer stop()
+	}
+	for {
+		select {
+		case e, ok := <-sub.events:
+			if !ok {
+				b.mu.Lock()
+				slow := sub.slow
+				b.mu.Unlock()
+				if slow {
+					return ErrSSESlowSubscriber
+				}
+				return nil
+			}
+			if err := sse.Send(e); err != nil {
+				return err
+			}
+		case <-sse.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package context
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	ctx "context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSSE(t *testing.T, header http.Header) (*SSE, *httptest.ResponseRecorder) {
+	r, _ := http.NewRequest(http.MethodGet, "/events", nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	c := NewContext()
+	c.Reset(w, r)
+	sse, err := c.SSE()
+	require.Nil(t, err)
+	return sse, w
+}
+
+func TestSSE(t *testing.T) {
+	sse, w := newSSE(t, http.Header{"Last-Event-Id": {"41"}})
+	assert.Equal(t, "text/event-stream; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Equal(t, "41", sse.LastEventID())
+	assert.True(t, w.Flushed)
+
+	require.Nil(t, sse.Send(
+		Event{ID: "42", Event: "tree", Data: map[string]string{"name": "oak"}},
+		Event{Data: "two\nlines", Retry: 3 * time.Second},
+		Event{ID: "4\n3", Data: []byte("bytes")},
+	))
+	require.Nil(t, sse.Comment("hello"))
+	require.Nil(t, sse.Retry(time.Second))
+	assert.Equal(t, "id: 42\nevent: tree\ndata: {\"name\":\"oak\"}\n\n"+
+		"retry: 3000\ndata: two\ndata: lines\n\n"+
+		"id: 43\ndata: bytes\n\n"+
+		": hello\n\n"+
+		"retry: 1000\n\n", w.Body.String())
+}
+
+func TestSSEBroker(t *testing.T) {
+	b := NewSSEBroker(WithSSEHistory(3), WithSSEBuffer(2))
+	s := b.Subscribe("", "trees", "forests")
+	assert.Equal(t, 1, b.Subscribers("trees"))
+
+	b.Publish("trees", Event{Data: "oak"})
+	b.Publish("forests", Event{Data: "black"})
+	assert.Equal(t, Event{ID: "1", Data: "oak"}, <-s.Events())
+	assert.Equal(t, Event{ID: "2", Data: "black"}, <-s.Events())
+
+	// the slow subscriber is disconnected
+	for i := 0; i < 3; i++ {
+		b.Publish("trees", Event{Data: i})
+	}
+	assert.Equal(t, uint64(1), s.Dropped())
+	n := 0
+	for range s.Events() {
+		n++
+	}
+	assert.Equal(t, 2, n)
+	assert.Equal(t, 0, b.Subscribers("trees"))
+
+	// the history replays the events after the last one received
+	r := b.Subscribe("3", "trees", "forests")
+	assert.Equal(t, "4", (<-r.Events()).ID)
+	assert.Equal(t, "5", (<-r.Events()).ID)
+	b.Unsubscribe(r)
+	b.Unsubscribe(r)
+
+	resumed := NewSSEBroker(WithSSEResume(func(topic, lastEventID string) []Event {
+		return []Event{{ID: lastEventID + "+1", Data: topic}}
+	}))
+	r = resumed.Subscribe("7", "trees")
+	assert.Equal(t, Event{ID: "7+1", Data: "trees"}, <-r.Events())
+
+	b.Close()
+	_, ok := <-b.Subscribe("", "trees").Events()
+	assert.False(t, ok)
+}
+
+func TestSSEBrokerResume(t *testing.T) {
+	var b *SSEBroker
+	b = NewSSEBroker(WithSSEHistory(2), WithSSEResume(func(topic, lastEventID string) []Event {
+		// the hook may use the broker
+		return []Event{{ID: lastEventID + "+" + topic, Data: b.Subscribers(topic)}}
+	}))
+	b.Publish("trees", Event{Data: "oak"})
+	b.Publish("forests", Event{Data: "black"})
+	b.Publish("trees", Event{Data: "elm"})
+	b.Publish("forests", Event{Data: "boreal"})
+
+	// the events of every topic after the last one received are replayed
+	ids := func(s *SSESubscriber) []string {
+		var ids []string
+		for len(s.Events()) > 0 {
+			ids = append(ids, (<-s.Events()).ID)
+		}
+		b.Unsubscribe(s)
+		return ids
+	}
+	assert.Equal(t, []string{"3", "4"}, ids(b.Subscribe("2", "trees", "forests")))
+	assert.Equal(t, []string{"4"}, ids(b.Subscribe("3", "trees", "forests")))
+
+	// a topic whose history does not go back to the last event received is
+	// resumed by the hook
+	b.Publish("trees", Event{Data: "ash"})
+	b.Publish("trees", Event{Data: "yew"})
+	assert.Equal(t, []string{"5", "6"}, ids(b.Subscribe("4", "trees", "forests")))
+	assert.Equal(t, []string{"2+trees", "4"}, ids(b.Subscribe("2", "trees", "forests")))
+	assert.Equal(t, []string{"1+trees", "1+forests"}, ids(b.Subscribe("1", "trees", "forests")))
+}
+
+func TestSSEBrokerBackpressure(t *testing.T) {
+	for policy, want := range map[Backpressure][]interface{}{
+		DropOldest: {2, 3},
+		DropNewest: {1, 2},
+	} {
+		b := NewSSEBroker(WithSSEBuffer(2), WithSSEBackpressure(policy))
+		s := b.Subscribe("", "trees")
+		for i := 1; i <= 3; i++ {
+			b.Publish("trees", Event{Data: i})
+		}
+		assert.Equal(t, uint64(1), s.Dropped())
+		assert.Equal(t, want[0], (<-s.Events()).Data)
+		assert.Equal(t, want[1], (<-s.Events()).Data)
+		assert.Equal(t, 1, b.Subscribers("trees"))
+	}
+}
+
+func TestSSEBrokerServe(t *testing.T) {
+	b := NewSSEBroker(WithSSEHistory(10), WithSSEHeartbeat(10*time.Millisecond))
+	b.Publish("trees", Event{Data: "oak"})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := NewContext()
+		c.Reset(w, r)
+		b.Serve(c, "trees")
+	}))
+	defer server.Close()
+
+	cancelCtx, cancel := ctx.WithCancel(ctx.Background())
+	defer cancel()
+	r, _ := http.NewRequestWithContext(cancelCtx, http.MethodGet, server.URL, nil)
+	r.Header.Set("Last-Event-ID", "0")
+	resp, err := http.DefaultClient.Do(r)
+	require.Nil(t, err)
+	defer resp.Body.Close()
+
+	lines := bufio.NewScanner(resp.Body)
+	next := func() string {
+		for lines.Scan() {
+			if line := lines.Text(); line != "" && !strings.HasPrefix(line, ":") {
+				return line
+			}
+		}
+		return ""
+	}
+	// the event published before the subscription is missed: "0" is not in
+	// the history, and there is no resume hook
+	for b.Subscribers("trees") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	b.Publish("trees", Event{Event: "tree", Data: "elm"})
+	assert.Equal(t, "id: 2", next())
+	assert.Equal(t, "event: tree", next())
+	assert.Equal(t, "data: elm", next())
+
+	cancel()
+	for b.Subscribers("trees") != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,499 @@
+package crawler
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements a site crawler checking links and assets of web applications.
+// Pages on the allowed hosts are crawled breadth first up to a maximum depth,
+// every <a>, <link>, <script> and <img> reference is checked, and broken
+// links, redirect chains, slow pages and mixed content are reported. All
+// requests go through pkg/client/httplib, so its filter chains apply.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/crawler"
+//	)
+//
+//	c, err := crawler.NewCrawler("https://bhojpur.net", crawler.WithMaxDepth(3))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	report, err := c.Run(context.Background())
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	report.WriteJUnit(os.Stdout)
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/bhojpur/web/pkg/client/httplib"
+)
+
+const maxBodySize = 10 << 20
+
+// Option configures a Crawler
+type Option func(c *Crawler)
+
+// WithMaxDepth limits how many links away from the start page are crawled
+func WithMaxDepth(depth int) Option {
+	return func(c *Crawler) {
+		c.maxDepth = depth
+	}
+}
+
+// WithAllowedHosts adds hosts whose pages are crawled, next to the host of
+// the start URL. References to other hosts are only checked.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(c *Crawler) {
+		for _, h := range hosts {
+			c.hosts[strings.ToLower(h)] = true
+		}
+	}
+}
+
+// WithExternal enables or disables checking references to other hosts
+func WithExternal(enable bool) Option {
+	return func(c *Crawler) {
+		c.external = enable
+	}
+}
+
+// WithRobots enables or disables honoring robots.txt
+func WithRobots(enable bool) Option {
+	return func(c *Crawler) {
+		c.robots = enable
+	}
+}
+
+// WithSlowThreshold sets the duration above which a page is reported slow
+func WithSlowThreshold(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.slow = d
+	}
+}
+
+// WithConcurrency sets the number of parallel requests
+func WithConcurrency(n int) Option {
+	return func(c *Crawler) {
+		if n > 0 {
+			c.concurrency = n
+		}
+	}
+}
+
+// WithUserAgent sets the user agent of the requests and for robots.txt
+func WithUserAgent(userAgent string) Option {
+	return func(c *Crawler) {
+		c.userAgent = userAgent
+	}
+}
+
+// WithTimeout sets the connect and read/write timeouts of the requests
+func WithTimeout(d time.Duration) Option {
+	return func(c *Crawler) {
+		c.timeout = d
+	}
+}
+
+// WithFilterChains adds httplib filters in front of the default ones
+func WithFilterChains(fcs ...httplib.FilterChain) Option {
+	return func(c *Crawler) {
+		c.filters = append(c.filters, fcs...)
+	}
+}
+
+// PageHandler receives every HTML page crawled on the allowed hosts with its
+// body. Handlers are called concurrently.
+type PageHandler func(page *Page, body []byte)
+
+// WithPageHandler calls h for every HTML page crawled on the allowed hosts,
+// including the pages at the maximum depth whose links are not followed
+func WithPageHandler(h PageHandler) Option {
+	return func(c *Crawler) {
+		c.onPage = h
+	}
+}
+
+// WithTLSClientConfig sets the TLS configuration of the requests
+func WithTLSClientConfig(config *tls.Config) Option {
+	return func(c *Crawler) {
+		c.tlsConfig = config
+	}
+}
+
+// Crawler crawls a site from a start URL. A Crawler runs once.
+type Crawler struct {
+	start        *url.URL
+	maxDepth     int
+	hosts        map[string]bool
+	external     bool
+	robots       bool
+	slow         time.Duration
+	concurrency  int
+	userAgent    string
+	timeout      time.Duration
+	maxRedirects int
+	filters      []httplib.FilterChain
+	tlsConfig    *tls.Config
+	onPage       PageHandler
+
+	setting httplib.BhojpurHTTPSettings
+
+	mu          sync.Mutex
+	seen        map[string]bool
+	robotsCache map[string]*robots
+	report      *Report
+}
+
+// target is a URL waiting to be fetched
+type target struct {
+	url    *url.URL
+	source string
+	depth  int
+	asset  bool
+	// subresource is an asset the browser loads with the page
+	subresource bool
+}
+
+// NewCrawler returns a crawler starting at startURL
+func NewCrawler(startURL string, opts ...Option) (*Crawler, error) {
+	u, err := url.Parse(startURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("crawler: unsupported start url %s", startURL)
+	}
+	u.Fragment = ""
+	c := &Crawler{
+		start:        u,
+		maxDepth:     3,
+		hosts:        map[string]bool{strings.ToLower(u.Host): true},
+		external:     true,
+		robots:       true,
+		slow:         2 * time.Second,
+		concurrency:  4,
+		userAgent:    httplib.GetDefaultSetting().UserAgent,
+		timeout:      30 * time.Second,
+		maxRedirects: 10,
+		seen:         make(map[string]bool),
+		robotsCache:  make(map[string]*robots),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	c.setting = httplib.GetDefaultSetting()
+	c.setting.UserAgent = c.userAgent
+	c.setting.ConnectTimeout = c.timeout
+	c.setting.ReadWriteTimeout = c.timeout
+	c.setting.Retries = 0
+	c.setting.EnableCookie = false
+	c.setting.FilterChains = append(append([]httplib.FilterChain(nil), c.filters...), c.setting.FilterChains...)
+	// redirects are followed by fetch, so that every hop is seen by the filters
+	c.setting.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	tlsConfig := c.tlsConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	// fully populated, so that httplib does not modify the shared transport
+	c.setting.Transport = &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		Proxy:               http.ProxyFromEnvironment,
+		DialContext:         httplib.TimeoutDialerCtx(c.timeout, c.timeout),
+		MaxIdleConnsPerHost: c.concurrency,
+	}
+	return c, nil
+}
+
+// Run crawls the site and returns the report. It returns an error only if
+// the context is cancelled; problems with the site end up in the report.
+func (c *Crawler) Run(ctx context.Context) (*Report, error) {
+	begin := time.Now()
+	c.report = &Report{Start: c.start.String()}
+	c.seen[c.start.String()] = true
+
+	level := []*target{{url: c.start}}
+	for len(level) > 0 {
+		if err := ctx.Err(); err != nil {
+			return c.report, err
+		}
+		level = c.crawlLevel(ctx, level)
+	}
+	c.report.Duration = time.Since(begin)
+	return c.report, ctx.Err()
+}
+
+// crawlLevel fetches the targets in parallel and returns the targets they reference
+func (c *Crawler) crawlLevel(ctx context.Context, level []*target) []*target {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		next []*target
+	)
+	work := make(chan *target)
+	for i := 0; i < c.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range work {
+				found := c.visit(ctx, t)
+				lock.Lock()
+				next = append(next, found...)
+				lock.Unlock()
+			}
+		}()
+	}
+	for _, t := range level {
+		work <- t
+	}
+	close(work)
+	wg.Wait()
+	return next
+}
+
+func (c *Crawler) internal(u *url.URL) bool {
+	return c.hosts[strings.ToLower(u.Host)]
+}
+
+func (c *Crawler) visit(ctx context.Context, t *target) []*target {
+	if c.robots && c.internal(t.url) && !c.robotsFor(ctx, t.url).allowed(t.url.EscapedPath()) {
+		c.mu.Lock()
+		c.report.Skipped = append(c.report.Skipped, t.url.String())
+		c.mu.Unlock()
+		return nil
+	}
+
+	// the pages past the maximum depth are parsed too, for their mixed
+	// content, but their links are not followed
+	follow := t.depth < c.maxDepth
+	parse := !t.asset && c.internal(t.url)
+	page, body := c.fetch(ctx, t, parse)
+	if body != nil && c.onPage != nil {
+		c.onPage(page, body)
+	}
+	var issues []*Issue
+	switch {
+	case page.Error != "":
+		issues = append(issues, &Issue{Kind: BrokenLink, URL: page.URL, Source: t.source, Detail: page.Error})
+	case page.Status >= 400:
+		issues = append(issues, &Issue{Kind: BrokenLink, URL: page.URL, Source: t.source, Detail: fmt.Sprintf("status %d", page.Status)})
+	}
+	if len(page.Redirects) > 1 {
+		issues = append(issues, &Issue{Kind: RedirectChain, URL: page.URL, Source: t.source,
+			Detail: fmt.Sprintf("%d redirects: %s", len(page.Redirects), strings.Join(page.Redirects, " -> "))})
+	}
+	if !t.asset && c.internal(t.url) && c.slow > 0 && page.Duration > c.slow {
+		issues = append(issues, &Issue{Kind: SlowPage, URL: page.URL, Source: t.source,
+			Detail: fmt.Sprintf("took %v (threshold %v)", page.Duration.Round(time.Millisecond), c.slow)})
+	}
+
+	var found []*target
+	if body != nil {
+		base := t.url
+		if len(page.Redirects) > 0 {
+			base, _ = url.Parse(page.Redirects[len(page.Redirects)-1])
+		}
+		for _, ref := range extractRefs(base, body) {
+			if base.Scheme == "https" && ref.url.Scheme == "http" && ref.subresource {
+				issues = append(issues, &Issue{Kind: MixedContent, URL: ref.url.String(), Source: page.URL,
+					Detail: "insecure asset on a secure page"})
+			}
+			if !follow || !c.internal(ref.url) && !c.external {
+				continue
+			}
+			key := ref.url.String()
+			c.mu.Lock()
+			seen := c.seen[key]
+			c.seen[key] = true
+			c.mu.Unlock()
+			if !seen {
+				ref.source = page.URL
+				ref.depth = t.depth + 1
+				found = append(found, ref)
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.report.Pages = append(c.report.Pages, page)
+	c.report.Issues = append(c.report.Issues, issues...)
+	c.mu.Unlock()
+	return found
+}
+
+// fetch requests t, following redirects, and returns the body if it is
+// wanted and turns out to be HTML
+func (c *Crawler) fetch(ctx context.Context, t *target, wantBody bool) (*Page, []byte) {
+	page := &Page{URL: t.url.String(), Source: t.source, Depth: t.depth, Asset: t.asset}
+	begin := time.Now()
+	defer func() {
+		page.Duration = time.Since(begin)
+	}()
+
+	u := t.url
+	for hop := 0; ; hop++ {
+		resp, err := httplib.NewBhojpurRequest(u.String(), http.MethodGet).Setting(c.setting).DoRequestWithCtx(ctx)
+		if err != nil {
+			page.Error = err.Error()
+			return page, nil
+		}
+		page.Status = resp.StatusCode
+		loc := resp.Header.Get("Location")
+		if resp.StatusCode >= 300 && resp.StatusCode < 400 && loc != "" {
+			resp.Body.Close()
+			if hop >= c.maxRedirects {
+				page.Error = fmt.Sprintf("more than %d redirects", c.maxRedirects)
+				return page, nil
+			}
+			next, err := u.Parse(loc)
+			if err != nil {
+				page.Error = fmt.Sprintf("bad redirect location %q", loc)
+				return page, nil
+			}
+			next.Fragment = ""
+			page.Redirects = append(page.Redirects, next.String())
+			u = next
+			continue
+		}
+
+		defer resp.Body.Close()
+		page.ContentType = resp.Header.Get("Content-Type")
+		mediaType, _, _ := mime.ParseMediaType(page.ContentType)
+		if !wantBody || resp.StatusCode >= 400 || mediaType != "text/html" || !c.internal(u) {
+			io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxBodySize))
+			return page, nil
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		if err != nil {
+			page.Error = err.Error()
+			return page, nil
+		}
+		return page, body
+	}
+}
+
+// robotsFor returns the cached robots.txt rules of the host of u
+func (c *Crawler) robotsFor(ctx context.Context, u *url.URL) *robots {
+	key := u.Scheme + "://" + u.Host
+	c.mu.Lock()
+	r, ok := c.robotsCache[key]
+	c.mu.Unlock()
+	if ok {
+		return r
+	}
+
+	resp, err := httplib.NewBhojpurRequest(key+"/robots.txt", http.MethodGet).Setting(c.setting).DoRequestWithCtx(ctx)
+	if err == nil {
+		if resp.StatusCode == http.StatusOK {
+			r = parseRobots(io.LimitReader(resp.Body, maxBodySize), c.userAgent)
+		}
+		resp.Body.Close()
+	}
+	c.mu.Lock()
+	c.robotsCache[key] = r
+	c.mu.Unlock()
+	return r
+}
+
+// subresourceRels are the link relations whose targets the browser loads
+// with the page
+var subresourceRels = map[string]bool{
+	"stylesheet":    true,
+	"preload":       true,
+	"icon":          true,
+	"modulepreload": true,
+	"manifest":      true,
+}
+
+// extractRefs returns the http(s) references of an HTML document
+func extractRefs(base *url.URL, body []byte) []*target {
+	var refs []*target
+	z := html.NewTokenizer(strings.NewReader(string(body)))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return refs
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		name, hasAttr := z.TagName()
+		if !hasAttr {
+			continue
+		}
+		var attr string
+		asset := true
+		switch string(name) {
+		case "a":
+			attr, asset = "href", false
+		case "base", "link":
+			attr = "href"
+		case "script", "img":
+			attr = "src"
+		default:
+			continue
+		}
+		var val, rel string
+		for {
+			key, v, more := z.TagAttr()
+			switch string(key) {
+			case attr:
+				val = string(v)
+			case "rel":
+				rel = strings.ToLower(string(v))
+			}
+			if !more {
+				break
+			}
+		}
+		ref, err := base.Parse(strings.TrimSpace(val))
+		if val == "" || err != nil || (ref.Scheme != "http" && ref.Scheme != "https") {
+			continue
+		}
+		ref.Fragment = ""
+		switch string(name) {
+		case "base":
+			base = ref
+		case "link":
+			subresource := false
+			for _, r := range strings.Fields(rel) {
+				subresource = subresource || subresourceRels[r]
+			}
+			refs = append(refs, &target{url: ref, asset: asset, subresource: subresource})
+		default:
+			refs = append(refs, &target{url: ref, asset: asset, subresource: asset})
+		}
+	}
+}
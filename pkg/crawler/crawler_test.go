@@ -0,0 +1,209 @@
+package crawler
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/client/httplib"
+)
+
+func newSite() *httptest.Server {
+	mux := http.NewServeMux()
+	page := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(body))
+		}
+	}
+	mux.HandleFunc("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("User-agent: *\nDisallow: /private\n"))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		page(`<html><head><link rel="stylesheet" href="/style.css"><script src="/app.js"></script></head>
+<body><a href="/about#team">About</a> <a href="/missing">Missing</a> <a href="/old">Old</a>
+<a href="/private/admin">Admin</a> <a href="mailto:info@bhojpur.net">Mail</a></body></html>`)(w, r)
+	})
+	mux.HandleFunc("/about", page(`<a href="/">Home</a><a href="/slow">Slow</a><img src="/logo.png">`))
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(60 * time.Millisecond)
+		page(`<a href="/deep">Deep</a>`)(w, r)
+	})
+	mux.HandleFunc("/deep", page(`<a href="/deeper">Deeper</a>`))
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/older", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/older", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/about", http.StatusFound)
+	})
+	for _, asset := range []string{"/style.css", "/app.js", "/logo.png"} {
+		mux.HandleFunc(asset, func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("asset"))
+		})
+	}
+	return httptest.NewServer(mux)
+}
+
+func kinds(r *Report, url string) []IssueKind {
+	var res []IssueKind
+	for _, issue := range r.Issues {
+		if strings.HasSuffix(issue.URL, url) {
+			res = append(res, issue.Kind)
+		}
+	}
+	return res
+}
+
+func TestCrawler(t *testing.T) {
+	site := newSite()
+	defer site.Close()
+
+	var requests int32
+	counter := func(next httplib.Filter) httplib.Filter {
+		return func(ctx context.Context, req *httplib.BhojpurHTTPRequest) (*http.Response, error) {
+			atomic.AddInt32(&requests, 1)
+			return next(ctx, req)
+		}
+	}
+
+	c, err := NewCrawler(site.URL, WithMaxDepth(3), WithSlowThreshold(50*time.Millisecond), WithFilterChains(counter))
+	assert.Nil(t, err)
+	report, err := c.Run(context.Background())
+	assert.Nil(t, err)
+
+	assert.Equal(t, []IssueKind{BrokenLink}, kinds(report, "/missing"))
+	assert.Equal(t, []IssueKind{RedirectChain}, kinds(report, "/old"))
+	assert.Equal(t, []IssueKind{SlowPage}, kinds(report, "/slow"))
+	assert.Equal(t, []string{site.URL + "/private/admin"}, report.Skipped)
+
+	urls := make(map[string]bool)
+	for _, p := range report.Pages {
+		urls[strings.TrimPrefix(p.URL, site.URL)] = true
+	}
+	// /deep is checked at the maximum depth, so /deeper is never found
+	assert.True(t, urls["/deep"])
+	assert.False(t, urls["/deeper"])
+	assert.True(t, urls["/logo.png"])
+	assert.Equal(t, 3, report.Count())
+	// every redirect hop and the robots.txt went through the filter chain
+	assert.Equal(t, int32(len(report.Pages)+3), atomic.LoadInt32(&requests))
+}
+
+func TestPageHandler(t *testing.T) {
+	site := newSite()
+	defer site.Close()
+
+	var lock sync.Mutex
+	pages := make(map[string]string)
+	c, _ := NewCrawler(site.URL, WithMaxDepth(3), WithExternal(false), WithPageHandler(func(page *Page, body []byte) {
+		lock.Lock()
+		pages[strings.TrimPrefix(page.URL, site.URL)] = string(body)
+		lock.Unlock()
+	}))
+	_, err := c.Run(context.Background())
+	assert.Nil(t, err)
+	// pages at the maximum depth are handled too, assets and errors are not
+	assert.Equal(t, `<a href="/deeper">Deeper</a>`, pages["/deep"])
+	assert.Contains(t, pages, "/old")
+	assert.NotContains(t, pages, "/deeper")
+	assert.NotContains(t, pages, "/missing")
+	assert.NotContains(t, pages, "/logo.png")
+}
+
+func TestMixedContent(t *testing.T) {
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<img src="http://127.0.0.1:1/logo.png"><a href="http://127.0.0.1:1/">plain link</a>`))
+	}))
+	defer site.Close()
+
+	c, err := NewCrawler(site.URL, WithExternal(false), WithRobots(false),
+		WithTLSClientConfig(site.Client().Transport.(*http.Transport).TLSClientConfig))
+	assert.Nil(t, err)
+	report, err := c.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Count(MixedContent))
+	assert.Equal(t, 1, len(report.Pages))
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, report.WriteJUnit(buf))
+	assert.Contains(t, buf.String(), `<testsuite name="crawler `+site.URL+`" tests="1" failures="0"`)
+}
+
+func TestMixedContentLinks(t *testing.T) {
+	site := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<link rel="canonical" href="http://127.0.0.1:1/">` +
+			`<link rel="alternate" hreflang="de" href="http://127.0.0.1:1/de">` +
+			`<link rel="Preload stylesheet" href="http://127.0.0.1:1/site.css">` +
+			`<a href="/next">next</a>`))
+	}))
+	defer site.Close()
+
+	tls := site.Client().Transport.(*http.Transport).TLSClientConfig
+	c, err := NewCrawler(site.URL, WithExternal(false), WithRobots(false), WithTLSClientConfig(tls))
+	assert.Nil(t, err)
+	report, err := c.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Count(MixedContent))
+	assert.Equal(t, 2, len(report.Pages))
+
+	// the start page is checked when no link is followed
+	c, err = NewCrawler(site.URL, WithMaxDepth(0), WithExternal(false), WithRobots(false), WithTLSClientConfig(tls))
+	assert.Nil(t, err)
+	report, err = c.Run(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Count(MixedContent))
+	assert.Equal(t, 1, len(report.Pages))
+}
+
+func TestRobots(t *testing.T) {
+	r := parseRobots(strings.NewReader(`
+User-agent: *
+Disallow: /
+
+User-agent: webctl
+User-agent: other
+Disallow: /admin
+Allow: /admin/public
+`), "Webctl/1.0")
+	assert.True(t, r.allowed("/"))
+	assert.False(t, r.allowed("/admin/users"))
+	assert.True(t, r.allowed("/admin/public/index.html"))
+
+	r = parseRobots(strings.NewReader("User-agent: *\nDisallow: /\n"), "crawler")
+	assert.False(t, r.allowed("/index.html"))
+	assert.True(t, (*robots)(nil).allowed("/"))
+}
@@ -0,0 +1,171 @@
+package crawler
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// IssueKind classifies the problems found while crawling
+type IssueKind string
+
+const (
+	// BrokenLink is a reference answering with a 4xx/5xx status or not at all
+	BrokenLink IssueKind = "broken_link"
+	// RedirectChain is a reference taking more than one redirect to resolve
+	RedirectChain IssueKind = "redirect_chain"
+	// SlowPage is a page taking longer than the slow threshold
+	SlowPage IssueKind = "slow_page"
+	// MixedContent is a plain http asset referenced from an https page
+	MixedContent IssueKind = "mixed_content"
+)
+
+// Issue is a problem with a single URL
+type Issue struct {
+	Kind   IssueKind `json:"kind"`
+	URL    string    `json:"url"`
+	Source string    `json:"source,omitempty"`
+	Detail string    `json:"detail"`
+}
+
+// Page is the result of fetching a single URL
+type Page struct {
+	URL         string        `json:"url"`
+	Source      string        `json:"source,omitempty"`
+	Depth       int           `json:"depth"`
+	Status      int           `json:"status"`
+	ContentType string        `json:"content_type,omitempty"`
+	Redirects   []string      `json:"redirects,omitempty"`
+	Duration    time.Duration `json:"duration"`
+	Error       string        `json:"error,omitempty"`
+	Asset       bool          `json:"asset,omitempty"`
+}
+
+// Report is the outcome of a crawl
+type Report struct {
+	Start    string        `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Pages    []*Page       `json:"pages"`
+	Issues   []*Issue      `json:"issues"`
+	// Skipped lists the URLs disallowed by robots.txt
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// Count returns the number of issues of the given kinds, or of all kinds
+// if none is given
+func (r *Report) Count(kinds ...IssueKind) int {
+	if len(kinds) == 0 {
+		return len(r.Issues)
+	}
+	n := 0
+	for _, issue := range r.Issues {
+		for _, k := range kinds {
+			if issue.Kind == k {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit writes the report as a JUnit XML test suite with one test case
+// per fetched URL, failing if the URL has issues
+func (r *Report) WriteJUnit(w io.Writer) error {
+	byURL := make(map[string][]*Issue)
+	for _, issue := range r.Issues {
+		byURL[issue.URL] = append(byURL[issue.URL], issue)
+	}
+
+	suite := junitSuite{
+		Name:  "crawler " + r.Start,
+		Tests: len(r.Pages),
+		Time:  seconds(r.Duration),
+	}
+	for _, p := range r.Pages {
+		c := junitCase{Name: p.URL, ClassName: "page", Time: seconds(p.Duration)}
+		if p.Asset {
+			c.ClassName = "asset"
+		}
+		if issues := byURL[p.URL]; len(issues) > 0 {
+			suite.Failures++
+			var text []string
+			for _, issue := range issues {
+				text = append(text, fmt.Sprintf("%s: %s (from %s)", issue.Kind, issue.Detail, issue.Source))
+			}
+			c.Failure = &junitFailure{
+				Message: issues[0].Detail,
+				Type:    string(issues[0].Kind),
+				Text:    strings.Join(text, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
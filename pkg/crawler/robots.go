@@ -0,0 +1,110 @@
+package crawler
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// robots holds the rules of a robots.txt that apply to our user agent
+type robots struct {
+	rules []robotsRule
+}
+
+type robotsRule struct {
+	prefix string
+	allow  bool
+}
+
+// parseRobots keeps the group of the user agent, or the "*" group if the
+// user agent has none of its own.
+func parseRobots(r io.Reader, userAgent string) *robots {
+	agent := strings.ToLower(userAgent)
+	if i := strings.IndexAny(agent, "/ "); i >= 0 {
+		agent = agent[:i]
+	}
+
+	var own, any []robotsRule
+	var agents []string
+	inRules := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		i := strings.IndexByte(line, ':')
+		if i < 0 {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(line[:i]))
+		val := strings.TrimSpace(line[i+1:])
+		switch key {
+		case "user-agent":
+			// a user-agent after rules starts a new group
+			if inRules {
+				agents, inRules = nil, false
+			}
+			agents = append(agents, strings.ToLower(val))
+		case "allow", "disallow":
+			inRules = true
+			if key == "disallow" && val == "" {
+				// an empty disallow allows everything
+				continue
+			}
+			rule := robotsRule{prefix: val, allow: key == "allow"}
+			for _, a := range agents {
+				switch {
+				case a == "*":
+					any = append(any, rule)
+				case agent != "" && strings.HasPrefix(agent, a):
+					own = append(own, rule)
+				}
+			}
+		}
+	}
+	if len(own) > 0 {
+		return &robots{rules: own}
+	}
+	return &robots{rules: any}
+}
+
+// allowed applies the longest matching rule, allowing ties
+func (r *robots) allowed(path string) bool {
+	if r == nil {
+		return true
+	}
+	if path == "" {
+		path = "/"
+	}
+	best, allow := -1, true
+	for _, rule := range r.rules {
+		if !strings.HasPrefix(path, rule.prefix) {
+			continue
+		}
+		if l := len(rule.prefix); l > best || (l == best && rule.allow) {
+			best, allow = l, rule.allow
+		}
+	}
+	return allow
+}
@@ -0,0 +1,450 @@
+package domain
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements the domains hosted by a web server and their certificates.
+// A Registry maps domains to applications, and a Manager serves their TLS
+// certificates from a tls.Config: custom certificates uploaded to the
+// registry, or certificates issued and renewed automatically by an ACME
+// certificate authority such as Let's Encrypt. The Manager watches the
+// registry, so domains and certificates are swapped into a running HTTPS
+// listener without a restart.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/domain"
+//	)
+//
+//	reg, err := domain.OpenRegistry("conf/domains")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	m, err := domain.NewManager(reg, domain.WithEmail("admin@example.com"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	go m.Watch(context.Background(), domain.DefaultWatchInterval)
+//	server := &http.Server{Addr: ":443", Handler: handler, TLSConfig: m.TLSConfig()}
+//	go http.ListenAndServe(":80", m.HTTPHandler(nil))
+//	server.ListenAndServeTLS("", "")
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// DefaultWatchInterval is how often a watched registry is checked for changes
+const DefaultWatchInterval = 5 * time.Second
+
+// Manager serves the certificates of the domains of a registry
+type Manager struct {
+	registry *Registry
+
+	static      []string
+	email       string
+	directory   string
+	rootCAs     *x509.CertPool
+	renewBefore time.Duration
+	cacheDir    string
+
+	acme    *autocert.Manager
+	state   atomic.Value // *state
+	mu      sync.Mutex   // serializes reloads
+	version string
+}
+
+// state is a snapshot of the registry; it is replaced as a whole on reload
+type state struct {
+	domains map[string]*Domain
+	certs   map[string]*tls.Certificate
+}
+
+// lookup returns the domain serving a host name: the domain itself, or the
+// wildcard domain of its parent
+func (s *state) lookup(host string) *Domain {
+	if d, ok := s.domains[host]; ok {
+		return d
+	}
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		return s.domains["*"+host[i:]]
+	}
+	return nil
+}
+
+// Option configures a Manager
+type Option func(*Manager)
+
+// WithDomains adds domains with ACME certificates which are not in the
+// registry, such as the domains of the configuration of an application
+func WithDomains(names ...string) Option {
+	return func(m *Manager) {
+		for _, name := range names {
+			if name = Normalize(name); name != "" {
+				m.static = append(m.static, name)
+			}
+		}
+	}
+}
+
+// WithEmail sets the contact email of the ACME account
+func WithEmail(email string) Option {
+	return func(m *Manager) {
+		m.email = email
+	}
+}
+
+// WithDirectoryURL sets the directory URL of the ACME certificate authority,
+// Let's Encrypt by default. Use the staging directory of Let's Encrypt or a
+// local test server such as pebble for tests.
+func WithDirectoryURL(url string) Option {
+	return func(m *Manager) {
+		m.directory = url
+	}
+}
+
+// WithRootCAs sets the certificate authorities trusted when connecting to
+// the ACME server, for test servers with a self-signed certificate
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(m *Manager) {
+		m.rootCAs = pool
+	}
+}
+
+// WithRenewBefore sets how long before expiry ACME certificates are renewed,
+// 30 days by default
+func WithRenewBefore(d time.Duration) Option {
+	return func(m *Manager) {
+		m.renewBefore = d
+	}
+}
+
+// WithCacheDir sets the directory caching the ACME account and certificates,
+// the acme directory of the registry by default
+func WithCacheDir(dir string) Option {
+	return func(m *Manager) {
+		m.cacheDir = dir
+	}
+}
+
+// NewManager returns a manager of the certificates of the registry. The
+// ACME certificates missing from the cache are requested in the background.
+func NewManager(registry *Registry, opts ...Option) (*Manager, error) {
+	m := &Manager{registry: registry, cacheDir: registry.ACMEDir()}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.acme = &autocert.Manager{
+		Prompt:      autocert.AcceptTOS,
+		Cache:       autocert.DirCache(m.cacheDir),
+		HostPolicy:  m.hostPolicy,
+		RenewBefore: m.renewBefore,
+		Email:       m.email,
+	}
+	if m.directory != "" || m.rootCAs != nil {
+		client := &acme.Client{DirectoryURL: m.directory}
+		if m.rootCAs != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{RootCAs: m.rootCAs}
+			client.HTTPClient = &http.Client{Transport: transport}
+		}
+		m.acme.Client = client
+	}
+	m.state.Store(&state{})
+	if err := m.Reload(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Registry returns the registry of the manager
+func (m *Manager) Registry() *Registry {
+	return m.registry
+}
+
+// Lookup returns the domain serving a host name, or nil
+func (m *Manager) Lookup(host string) *Domain {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return m.current().lookup(Normalize(host))
+}
+
+func (m *Manager) current() *state {
+	return m.state.Load().(*state)
+}
+
+// Reload reads the registry and the custom certificates again. The new
+// state replaces the old one at once, new handshakes get the new
+// certificates while established connections are not affected.
+func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	version, err := m.registryVersion()
+	if err != nil {
+		return err
+	}
+	domains, err := m.registry.List()
+	if err != nil {
+		return err
+	}
+	next := &state{domains: make(map[string]*Domain), certs: make(map[string]*tls.Certificate)}
+	for _, name := range m.static {
+		next.domains[name] = &Domain{Name: name, Certificate: CertACME}
+	}
+	for _, d := range domains {
+		next.domains[d.Name] = d
+		if d.Certificate != CertCustom {
+			continue
+		}
+		certFile, keyFile := m.registry.CertFiles(d.Name)
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			// keep serving the domain with the certificate loaded before
+			logs.Warn("domain: cannot load the certificate of %s: %v", d.Name, err)
+			if prev := m.current().certs[d.Name]; prev != nil {
+				next.certs[d.Name] = prev
+			}
+			continue
+		}
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			logs.Warn("domain: cannot parse the certificate of %s: %v", d.Name, err)
+			continue
+		}
+		next.certs[d.Name] = &cert
+	}
+
+	prev := m.current()
+	m.state.Store(next)
+	m.version = version
+	for name, d := range next.domains {
+		if d.Certificate == CertACME && !(prev.domains[name] != nil && prev.domains[name].Certificate == CertACME) {
+			go m.obtain(name)
+		}
+	}
+	return nil
+}
+
+// obtain loads or requests the ACME certificate of a domain, which then
+// gets renewed automatically
+func (m *Manager) obtain(name string) {
+	hello := &tls.ClientHelloInfo{
+		ServerName:   name,
+		CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+	}
+	if _, err := m.acme.GetCertificate(hello); err != nil {
+		logs.Warn("domain: cannot obtain a certificate for %s: %v", name, err)
+		return
+	}
+	logs.Info("domain: certificate of %s is ready", name)
+}
+
+// registryVersion identifies the content of the registry by the sizes and
+// modification times of its files
+func (m *Manager) registryVersion() (string, error) {
+	var b strings.Builder
+	files := []string{filepath.Join(m.registry.Dir(), registryFile)}
+	certs, err := ioutil.ReadDir(filepath.Join(m.registry.Dir(), "certs"))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, fi := range certs {
+		files = append(files, filepath.Join(m.registry.Dir(), "certs", fi.Name()))
+	}
+	for _, file := range files {
+		fi, err := os.Stat(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", fi.Name(), fi.Size(), fi.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
+
+// Watch reloads the registry when it changes, until ctx is done
+func (m *Manager) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		version, err := m.registryVersion()
+		if err != nil {
+			logs.Warn("domain: cannot watch the registry: %v", err)
+			continue
+		}
+		m.mu.Lock()
+		changed := version != m.version
+		m.mu.Unlock()
+		if !changed {
+			continue
+		}
+		if err := m.Reload(); err != nil {
+			logs.Warn("domain: cannot reload the registry: %v", err)
+			continue
+		}
+		logs.Info("domain: registry reloaded, %d domains", len(m.current().domains))
+	}
+}
+
+func (m *Manager) hostPolicy(_ context.Context, host string) error {
+	if d := m.current().domains[host]; d != nil && d.Certificate == CertACME {
+		return nil
+	}
+	return fmt.Errorf("domain: no ACME certificate for host %q", host)
+}
+
+// GetCertificate returns the certificate of the domain of the server name
+// of a TLS handshake, for tls.Config.GetCertificate
+func (m *Manager) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	// tls-alpn-01 challenges are answered by autocert
+	if len(hello.SupportedProtos) == 1 && hello.SupportedProtos[0] == acme.ALPNProto {
+		return m.acme.GetCertificate(hello)
+	}
+	name := Normalize(hello.ServerName)
+	if name == "" {
+		return nil, errors.New("domain: missing server name")
+	}
+	st := m.current()
+	d := st.lookup(name)
+	if d == nil {
+		return nil, fmt.Errorf("domain: unknown host %q", name)
+	}
+	if d.Certificate == CertCustom {
+		if cert := st.certs[d.Name]; cert != nil {
+			return cert, nil
+		}
+		return nil, fmt.Errorf("domain: no certificate for host %q", name)
+	}
+	return m.acme.GetCertificate(hello)
+}
+
+// TLSConfig returns a TLS configuration serving the certificates of the
+// registry, with HTTP/2 and tls-alpn-01 ACME challenges enabled
+func (m *Manager) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetCertificate: m.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1", acme.ALPNProto},
+	}
+}
+
+// HTTPHandler answers http-01 ACME challenges and passes the other requests
+// to fallback, or redirects them to HTTPS if fallback is nil
+func (m *Manager) HTTPHandler(fallback http.Handler) http.Handler {
+	return m.acme.HTTPHandler(fallback)
+}
+
+// Handler dispatches requests to the handler of the app of their host, as
+// returned by apps. Requests for unknown hosts or apps get 404 responses.
+func (m *Manager) Handler(apps func(app string) http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d := m.Lookup(r.Host)
+		if d == nil || d.App == "" {
+			http.NotFound(w, r)
+			return
+		}
+		h := apps(d.App)
+		if h == nil {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// CertInfo describes the certificate of a domain
+type CertInfo struct {
+	Source   string    `json:"source"`
+	Issuer   string    `json:"issuer,omitempty"`
+	DNSNames []string  `json:"dns_names,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+}
+
+// Status returns the certificate of a domain, custom or from the ACME cache.
+// A domain waiting for its ACME certificate has a zero NotAfter.
+func (m *Manager) Status(name string) (*CertInfo, error) {
+	return Status(m.registry, m.cacheDir, name)
+}
+
+// Status returns the certificate of a domain of a registry, reading ACME
+// certificates from cacheDir, the acme directory of the registry if empty.
+// It does not need a running server.
+func Status(registry *Registry, cacheDir, name string) (*CertInfo, error) {
+	d, err := registry.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	if cacheDir == "" {
+		cacheDir = registry.ACMEDir()
+	}
+	info := &CertInfo{Source: d.Certificate}
+	var data []byte
+	if d.Certificate == CertCustom {
+		certFile, _ := registry.CertFiles(d.Name)
+		data, err = ioutil.ReadFile(certFile)
+	} else {
+		data, err = autocert.DirCache(cacheDir).Get(context.Background(), d.Name)
+		if err == autocert.ErrCacheMiss {
+			data, err = autocert.DirCache(cacheDir).Get(context.Background(), d.Name+"+rsa")
+		}
+		if err == autocert.ErrCacheMiss {
+			return info, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		info.Issuer = leaf.Issuer.CommonName
+		info.DNSNames = leaf.DNSNames
+		info.NotAfter = leaf.NotAfter
+		break
+	}
+	return info, nil
+}
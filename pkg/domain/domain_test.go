@@ -0,0 +1,241 @@
+package domain
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// selfSigned returns a PEM encoded self-signed certificate and key
+func selfSigned(t *testing.T, cn string, names ...string) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     names,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func newRegistry(t *testing.T) (*Registry, func()) {
+	dir, err := ioutil.TempDir("", "domain")
+	assert.Nil(t, err)
+	reg, err := OpenRegistry(dir)
+	assert.Nil(t, err)
+	return reg, func() { os.RemoveAll(dir) }
+}
+
+// newManager returns a manager whose ACME server is unreachable
+func newManager(t *testing.T, reg *Registry) (*Manager, func()) {
+	acmeServer := httptest.NewServer(http.NotFoundHandler())
+	m, err := NewManager(reg, WithDirectoryURL(acmeServer.URL))
+	assert.Nil(t, err)
+	return m, acmeServer.Close
+}
+
+func TestRegistry(t *testing.T) {
+	reg, cleanup := newRegistry(t)
+	defer cleanup()
+
+	_, err := reg.Add("not a domain", "")
+	assert.NotNil(t, err)
+	_, err = reg.Add("*.example.org", "http://127.0.0.1:8080")
+	assert.NotNil(t, err)
+
+	d, err := reg.Add("Shop.Example.com.", "http://127.0.0.1:8080")
+	assert.Nil(t, err)
+	assert.Equal(t, "shop.example.com", d.Name)
+	assert.Equal(t, CertACME, d.Certificate)
+	d, err = reg.Add("shop.example.com", "http://127.0.0.1:9090")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://127.0.0.1:9090", d.App)
+
+	certPEM, keyPEM := selfSigned(t, "example.org", "*.example.org")
+	assert.NotNil(t, reg.SetCertificate("shop.example.com", certPEM, keyPEM))
+	_, otherKey := selfSigned(t, "example.org", "*.example.org")
+	assert.NotNil(t, reg.SetCertificate("*.example.org", certPEM, otherKey))
+	assert.Nil(t, reg.SetCertificate("*.example.org", certPEM, keyPEM))
+	_, err = reg.Add("*.example.org", "http://127.0.0.1:8081")
+	assert.Nil(t, err)
+
+	domains, err := reg.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(domains))
+	assert.Equal(t, "*.example.org", domains[0].Name)
+	assert.Equal(t, CertCustom, domains[0].Certificate)
+	assert.Equal(t, "http://127.0.0.1:8081", domains[0].App)
+
+	info, err := Status(reg, "", "*.example.org")
+	assert.Nil(t, err)
+	assert.Equal(t, "example.org", info.Issuer)
+	assert.Equal(t, []string{"*.example.org"}, info.DNSNames)
+	info, err = Status(reg, "", "shop.example.com")
+	assert.Nil(t, err)
+	assert.True(t, info.NotAfter.IsZero())
+
+	assert.NotNil(t, reg.ClearCertificate("*.example.org"))
+	assert.Nil(t, reg.Remove("*.example.org"))
+	assert.Equal(t, ErrNotFound, reg.Remove("*.example.org"))
+	certFile, _ := reg.CertFiles("*.example.org")
+	assert.False(t, fileExists(certFile))
+	_, err = reg.Get("*.example.org")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestRegistryConcurrentUpdates(t *testing.T) {
+	reg, cleanup := newRegistry(t)
+	defer cleanup()
+
+	// registries opened on the same directory stand for separate processes,
+	// they do not share a mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		other, err := OpenRegistry(reg.Dir())
+		assert.Nil(t, err)
+		wg.Add(1)
+		go func(i int, other *Registry) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, err := other.Add("shop"+strconv.Itoa(i*10+j)+".example.com", "")
+				assert.Nil(t, err)
+			}
+		}(i, other)
+	}
+	wg.Wait()
+
+	domains, err := reg.List()
+	assert.Nil(t, err)
+	assert.Equal(t, 40, len(domains))
+}
+
+func TestManager(t *testing.T) {
+	reg, cleanup := newRegistry(t)
+	defer cleanup()
+	certPEM, keyPEM := selfSigned(t, "first", "*.example.org")
+	assert.Nil(t, reg.SetCertificate("*.example.org", certPEM, keyPEM))
+	_, err := reg.Add("*.example.org", "blog")
+	assert.Nil(t, err)
+	_, err = reg.Add("shop.example.com", "shop")
+	assert.Nil(t, err)
+
+	m, stop := newManager(t, reg)
+	defer stop()
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.Example.org"})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "a.b.example.org"})
+	assert.NotNil(t, err)
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "unknown.net"})
+	assert.NotNil(t, err)
+	assert.Nil(t, m.hostPolicy(context.Background(), "shop.example.com"))
+	assert.NotNil(t, m.hostPolicy(context.Background(), "www.example.org"))
+
+	// the new certificate is served once the registry is reloaded
+	certPEM, keyPEM = selfSigned(t, "second", "*.example.org")
+	assert.Nil(t, reg.SetCertificate("*.example.org", certPEM, keyPEM))
+	cert, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.Nil(t, err)
+	assert.Equal(t, "first", cert.Leaf.Subject.CommonName)
+	assert.Nil(t, m.Reload())
+	cert, err = m.GetCertificate(&tls.ClientHelloInfo{ServerName: "www.example.org"})
+	assert.Nil(t, err)
+	assert.Equal(t, "second", cert.Leaf.Subject.CommonName)
+
+	apps := func(app string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(app))
+		})
+	}
+	for host, body := range map[string]string{"www.example.org:443": "blog", "shop.example.com": "shop", "example.net": "404 page not found\n"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Host = host
+		m.Handler(apps).ServeHTTP(w, r)
+		assert.Equal(t, body, w.Body.String())
+	}
+}
+
+func TestWatch(t *testing.T) {
+	reg, cleanup := newRegistry(t)
+	defer cleanup()
+	m, stop := newManager(t, reg)
+	defer stop()
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello " + r.Host))
+	}))
+	server.TLS = m.TLSConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Watch(ctx, 10*time.Millisecond)
+
+	// the domain is added while the server is running
+	certPEM, keyPEM := selfSigned(t, "api", "api.example.com")
+	assert.Nil(t, reg.SetCertificate("api.example.com", certPEM, keyPEM))
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(certPEM)
+	client := server.Client()
+	client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{RootCAs: pool, ServerName: "api.example.com"}
+
+	var body []byte
+	assert.Eventually(t, func() bool {
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		body, _ = ioutil.ReadAll(resp.Body)
+		return true
+	}, 2*time.Second, 20*time.Millisecond)
+	assert.Equal(t, "hello "+server.Listener.Addr().String(), string(body))
+}
@@ -0,0 +1,327 @@
+package domain
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate sources of a domain
+const (
+	// CertACME certificates are issued and renewed by an ACME certificate
+	// authority, Let's Encrypt by default
+	CertACME = "acme"
+	// CertCustom certificates are uploaded with Registry.SetCertificate
+	CertCustom = "custom"
+)
+
+const registryFile = "domains.json"
+
+// lockFileName is the sidecar file locked by the processes updating the
+// registry. The registry file itself is replaced on update, so it cannot
+// hold the lock.
+const lockFileName = ".domains.lock"
+
+// ErrNotFound is returned for a domain missing from the registry
+var ErrNotFound = errors.New("domain: not found")
+
+var domainName = regexp.MustCompile(`^(\*\.)?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Domain is a domain name served by an application
+type Domain struct {
+	Name string `json:"name"`
+	// App is the application serving the domain, such as the URL of an
+	// upstream server
+	App string `json:"app,omitempty"`
+	// Certificate is the source of the certificate, CertACME or CertCustom
+	Certificate string    `json:"certificate"`
+	Added       time.Time `json:"added"`
+}
+
+// Wildcard reports whether the domain is a wildcard domain, *.example.com
+func (d *Domain) Wildcard() bool {
+	return strings.HasPrefix(d.Name, "*.")
+}
+
+// Registry is the list of domains in a directory, together with their
+// custom certificates in the certs subdirectory and the ACME account and
+// certificates in the acme subdirectory. The registry is shared between
+// processes: websvr domain edits it while a running server watches it.
+type Registry struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// OpenRegistry opens the registry in dir, creating the directory if needed
+func OpenRegistry(dir string) (*Registry, error) {
+	for _, d := range []string{dir, filepath.Join(dir, "certs"), filepath.Join(dir, "acme")} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return nil, err
+		}
+	}
+	return &Registry{dir: dir}, nil
+}
+
+// Dir returns the directory of the registry
+func (r *Registry) Dir() string {
+	return r.dir
+}
+
+// ACMEDir returns the directory caching the ACME account and certificates
+func (r *Registry) ACMEDir() string {
+	return filepath.Join(r.dir, "acme")
+}
+
+// CertFiles returns the certificate and key files of a custom certificate
+func (r *Registry) CertFiles(name string) (certFile, keyFile string) {
+	base := filepath.Join(r.dir, "certs", fileName(name))
+	return base + ".crt", base + ".key"
+}
+
+// fileName maps a wildcard domain to a file name
+func fileName(name string) string {
+	return strings.Replace(name, "*", "_wildcard", 1)
+}
+
+// Normalize returns the canonical form of a domain name: lower case
+// without the trailing dot
+func Normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// List returns the domains of the registry sorted by name
+func (r *Registry) List() ([]*Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.load()
+}
+
+// Get returns a domain of the registry
+func (r *Registry) Get(name string) (*Domain, error) {
+	domains, err := r.List()
+	if err != nil {
+		return nil, err
+	}
+	name = Normalize(name)
+	for _, d := range domains {
+		if d.Name == name {
+			return d, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// Add registers a domain for an app, or moves a registered domain to
+// another app. New domains get ACME certificates; wildcard domains need a
+// custom certificate since they cannot be validated over HTTP or TLS.
+func (r *Registry) Add(name, app string) (*Domain, error) {
+	name = Normalize(name)
+	if !domainName.MatchString(name) {
+		return nil, fmt.Errorf("domain: invalid domain name %q", name)
+	}
+	var res *Domain
+	err := r.update(func(domains []*Domain) ([]*Domain, error) {
+		for _, d := range domains {
+			if d.Name == name {
+				d.App = app
+				res = d
+				return domains, nil
+			}
+		}
+		res = &Domain{Name: name, App: app, Certificate: CertACME, Added: time.Now().UTC()}
+		if res.Wildcard() {
+			certFile, keyFile := r.CertFiles(name)
+			if !fileExists(certFile) || !fileExists(keyFile) {
+				return nil, fmt.Errorf("domain: %s is a wildcard domain, upload its certificate first", name)
+			}
+			res.Certificate = CertCustom
+		}
+		return append(domains, res), nil
+	})
+	return res, err
+}
+
+// Remove removes a domain and its custom certificate from the registry
+func (r *Registry) Remove(name string) error {
+	name = Normalize(name)
+	err := r.update(func(domains []*Domain) ([]*Domain, error) {
+		for i, d := range domains {
+			if d.Name == name {
+				return append(domains[:i], domains[i+1:]...), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+	if err != nil {
+		return err
+	}
+	certFile, keyFile := r.CertFiles(name)
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	return nil
+}
+
+// SetCertificate stores a custom certificate for a domain, which is
+// registered without an app if needed. The PEM encoded chain must be valid
+// for the domain, not expired, and match the private key.
+func (r *Registry) SetCertificate(name string, certPEM, keyPEM []byte) error {
+	name = Normalize(name)
+	if !domainName.MatchString(name) {
+		return fmt.Errorf("domain: invalid domain name %q", name)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return fmt.Errorf("domain: invalid certificate for %s: %v", name, err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return fmt.Errorf("domain: invalid certificate for %s: %v", name, err)
+	}
+	if err := leaf.VerifyHostname(strings.Replace(name, "*", "wildcard", 1)); err != nil {
+		return fmt.Errorf("domain: invalid certificate for %s: %v", name, err)
+	}
+	if time.Now().After(leaf.NotAfter) {
+		return fmt.Errorf("domain: the certificate for %s expired on %s", name, leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	certFile, keyFile := r.CertFiles(name)
+	if err := writeFile(keyFile, keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := writeFile(certFile, certPEM, 0644); err != nil {
+		return err
+	}
+	return r.update(func(domains []*Domain) ([]*Domain, error) {
+		for _, d := range domains {
+			if d.Name == name {
+				d.Certificate = CertCustom
+				return domains, nil
+			}
+		}
+		return append(domains, &Domain{Name: name, Certificate: CertCustom, Added: time.Now().UTC()}), nil
+	})
+}
+
+// ClearCertificate removes the custom certificate of a domain, which then
+// gets an ACME certificate
+func (r *Registry) ClearCertificate(name string) error {
+	name = Normalize(name)
+	if strings.HasPrefix(name, "*.") {
+		return fmt.Errorf("domain: %s is a wildcard domain, it needs a custom certificate", name)
+	}
+	err := r.update(func(domains []*Domain) ([]*Domain, error) {
+		for _, d := range domains {
+			if d.Name == name {
+				d.Certificate = CertACME
+				return domains, nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+	if err != nil {
+		return err
+	}
+	certFile, keyFile := r.CertFiles(name)
+	os.Remove(certFile)
+	os.Remove(keyFile)
+	return nil
+}
+
+func (r *Registry) load() ([]*Domain, error) {
+	data, err := ioutil.ReadFile(filepath.Join(r.dir, registryFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var domains []*Domain
+	if err := json.Unmarshal(data, &domains); err != nil {
+		return nil, fmt.Errorf("domain: invalid registry %s: %v", filepath.Join(r.dir, registryFile), err)
+	}
+	return domains, nil
+}
+
+func (r *Registry) update(fn func([]*Domain) ([]*Domain, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	lock, err := os.OpenFile(filepath.Join(r.dir, lockFileName), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := lockFile(lock); err != nil {
+		return fmt.Errorf("domain: cannot lock the registry: %v", err)
+	}
+	defer unlockFile(lock)
+	domains, err := r.load()
+	if err != nil {
+		return err
+	}
+	if domains, err = fn(domains); err != nil {
+		return err
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Name < domains[j].Name })
+	data, err := json.MarshalIndent(domains, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(r.dir, registryFile), append(data, '\n'), 0644)
+}
+
+// writeFile replaces a file atomically, so that a watching server never
+// reads a partial file
+func writeFile(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -115,7 +115,9 @@ func registerAdmin() error {
 		webAdminApp.Router("/qps", c, "get:QpsIndex")
 		webAdminApp.Router("/prof", c, "get:ProfIndex")
 		webAdminApp.Router("/healthcheck", c, "get:Healthcheck")
+		webAdminApp.Router("/process", c, "get:Process")
 		webAdminApp.Router("/task", c, "get:TaskStatus")
+		webAdminApp.Router("/cache/purge", c, "post:CachePurge")
 		webAdminApp.Router("/listconf", c, "get:ListConf")
 		webAdminApp.Router("/metrics", c, "get:PrometheusMetrics")
 
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 	"strconv"
 	"text/template"
 
@@ -82,6 +83,14 @@ func (a *adminController) PrometheusMetrics() {
 	promhttp.Handler().ServeHTTP(a.Ctx.ResponseWriter, a.Ctx.Request)
 }
 
+// Process is a http.Handler showing the process serving the admin module,
+// used by websvr restart to tell the old process from the new one.
+// it's in "/process" pattern in admin module.
+func (a *adminController) Process() {
+	data, _ := json.Marshal(map[string]int{"pid": os.Getpid(), "ppid": os.Getppid()})
+	writeJSON(a.Ctx.ResponseWriter, data)
+}
+
 // TaskStatus is a http.Handler with running task status (task name, status and the last execution).
 // it's in "/task" pattern in admin module.
 func (a *adminController) TaskStatus() {
@@ -124,6 +133,24 @@ func (a *adminController) TaskStatus() {
 	writeTemplate(rw, data, tasksTpl, defaultScriptsTpl)
 }
 
+// CachePurge is a http.Handler purging the cached responses tagged with the tag parameters.
+// it's in "/cache/purge" pattern in admin module.
+func (a *adminController) CachePurge() {
+	rw, r := a.Ctx.ResponseWriter, a.Ctx.Request
+	r.ParseForm()
+	params := make([]interface{}, 0, len(r.Form["tag"]))
+	for _, tag := range r.Form["tag"] {
+		params = append(params, tag)
+	}
+	res := webadm.GetCommand("cache", "purge").Execute(params...)
+	if !res.IsSuccess() {
+		http.Error(rw, res.Error.Error(), res.Status)
+		return
+	}
+	data, _ := json.Marshal(map[string]interface{}{"purged": res.Content})
+	writeJSON(rw, data)
+}
+
 func (a *adminController) AdminIndex() {
 	// AdminIndex is the default http.Handler for admin module.
 	// it matches url pattern "/".
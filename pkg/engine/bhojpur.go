@@ -57,6 +57,7 @@ func AddAPPStartHook(hf ...hookfunc) {
 func Run(params ...string) {
 	if len(params) > 0 && params[0] != "" {
 		BhojpurApp.Run(params[0])
+		return
 	}
 	BhojpurApp.Run("")
 }
@@ -80,6 +81,7 @@ func initBeforeHTTPRun() {
 			registerTemplate,
 			registerAdmin,
 			registerGzip,
+			registerDocs,
 			// registerCommentRouter,
 		)
 
@@ -64,6 +64,15 @@ type Config struct {
 	// 2. If this is false and the request URL is "/Hello", it will match this pattern
 	// @Default true
 	RouterCaseSensitive bool
+	// ParamErrorStatus
+	// @Description the http status of requests whose typed router parameters are invalid,
+	// e.g. 123 for the parameter :id:uuid or 2021-02-30 for the parameter :day:date.
+	// Only the typed parameters sharing their path segment with other text, such as
+	// read_:id:int.htm, keep values not matching the pattern of the type from matching the router.
+	// 1. If this is 404, invalid parameters are treated as pages which do not exist
+	// 2. If this is 400, they are treated as bad requests
+	// @Default 404
+	ParamErrorStatus int
 	// RecoverPanic
 	// @Description if it was true, Bhojpur Web will try to recover from panic when it serves your http request
 	// So you should notice that it doesn't mean that Bhojpur Web will recover all panic cases.
@@ -97,6 +106,15 @@ type Config struct {
 	// And this configure item only work in dev run mode (see RunMode)
 	// @Default true
 	EnableErrorsRender bool
+	// ProblemErrors
+	// @Description If it's true, errors are rendered as RFC 7807 problem details instead of HTML pages:
+	// application/problem+json, or application/problem+xml if the Accept header prefers XML.
+	// It covers Abort, CustomAbort, recovered panics, the default error handlers and the errors
+	// returned by controller methods. Errors with a berror code get the status, type and title
+	// registered with context.RegisterProblemType.
+	// Handlers registered with ErrorHandler or ErrorController still take precedence.
+	// @Default false
+	ProblemErrors bool
 	// ServerName
 	// @Description server name. For example, in large scale system,
 	// you may want to deploy your application to several machines, so that each of them has a server name
@@ -142,6 +160,12 @@ type Listen struct {
 	// @Description means use graceful module to start the server
 	// @Default false
 	Graceful bool
+	// PIDFile
+	// @Description In graceful mode, Bhojpur Web writes the process ID to this file,
+	// websvr restart uses it to find the server
+	// see Graceful
+	// @Default ""
+	PIDFile string
 	// ListenTCP4
 	// @Description if it's true, means that Bhojpur Web only work for TCP4
 	// please check net.Listen function
@@ -210,6 +234,13 @@ type Listen struct {
 	// @Description Bhojpur Web use this as cache dir to store TLS cert data
 	// @Default ""
 	TLSCacheDir string
+	// DomainRegistry
+	// @Description With AutoTLS, Bhojpur Web serves the domains of the domain registry in this directory
+	// in addition to Domains, and picks up the domains and certificates added by websvr domain
+	// without a restart. The ACME certificates are then cached in the registry, not in TLSCacheDir.
+	// see Domains, pkg/domain
+	// @Default ""
+	DomainRegistry string
 	// HTTPSAddr
 	// @Description Bhojpur Web will listen to this address to accept HTTPS request
 	// see EnableHTTPS
@@ -259,8 +290,16 @@ type WebConfig struct {
 	// you can set it to false
 	// @Default true
 	AutoRender bool
-	// Deprecated: Bhojpur Web didn't use it anymore
+	// EnableDocs
+	// @Description If it's true, Bhojpur Web serves the OpenAPI 3.1 document of its routers at DocsPath.
+	// The document is generated from the registered routers and the signatures of their controller methods,
+	// the bodies of the routers registered with Get, Post and the like are described by DocumentTypes
+	// @Default false
 	EnableDocs bool
+	// DocsPath
+	// @Description the path of the OpenAPI document when EnableDocs is true
+	// @Default /openapi.json
+	DocsPath string
 	// EnableXSRF
 	// @Description If it's true, Bhojpur Web will help to provide XSRF support
 	// But you should notice that, now Bhojpur Web only work for HTTPS protocol with XSRF
@@ -271,6 +310,29 @@ type WebConfig struct {
 	// And if you are in dev environment, you could set it to false
 	// @Default false
 	EnableXSRF bool
+	// EnableEarlyHints
+	// @Description If it's true, Bhojpur Web sends a 103 Early Hints response announcing the critical assets
+	// of rendered pages and static HTML files as preload links.
+	// The assets are listed in AssetManifest or found in the <link rel=preload> tags of the page.
+	// It needs Go 1.19 or later, older net/http versions cannot send informational responses
+	// @Default false
+	EnableEarlyHints bool
+	// EnableServerPush
+	// @Description If it's true, Bhojpur Web pushes the critical assets of rendered pages and static HTML files
+	// over HTTP/2. The assets pushed to a client are remembered in the PushCookieName cookie
+	// so that they are not pushed again
+	// @Default false
+	EnableServerPush bool
+	// AssetManifest
+	// @Description the JSON file mapping template names and URL paths to the critical assets they need,
+	// e.g. {"index.tpl": ["/static/css/app.css", "/static/js/app.js"]}
+	// @Default ""
+	AssetManifest string
+	// PushCookieName
+	// @Description the name of cookie remembering the assets pushed to the client
+	// see EnableServerPush
+	// @Default bhojpurpushed
+	PushCookieName string
 	// DirectoryIndex
 	// @Description When Bhojpur Web serves static resources request, it will look up the file.
 	// If the file is directory, Bhojpur Web will try to find the index.html as the response
@@ -520,11 +582,15 @@ func defaultRecoverPanic(ctx *context.Context, cfg *Config) {
 			stack = stack + fmt.Sprintln(fmt.Sprintf("%s:%d", file, line))
 		}
 
-		if ctx.Output.Status != 0 {
-			ctx.ResponseWriter.WriteHeader(ctx.Output.Status)
-		} else {
-			ctx.ResponseWriter.WriteHeader(500)
+		status := ctx.Output.Status
+		if status == 0 {
+			status = 500
+		}
+		if cfg.ProblemErrors {
+			ctx.Output.Problem(panicProblem(err, status, cfg.RunMode == DEV && cfg.EnableErrorsRender))
+			return
 		}
+		ctx.ResponseWriter.WriteHeader(status)
 
 		if cfg.RunMode == DEV && cfg.EnableErrorsRender {
 			showErr(err, ctx, stack)
@@ -537,6 +603,7 @@ func newBConfig() *Config {
 		AppName:             "bhojpur",
 		RunMode:             PROD,
 		RouterCaseSensitive: true,
+		ParamErrorStatus:    404,
 		ServerName:          "Bhojpur WebEngine:" + webapp.VERSION,
 		RecoverPanic:        true,
 
@@ -547,33 +614,40 @@ func newBConfig() *Config {
 		EnableErrorsShow:   true,
 		EnableErrorsRender: true,
 		Listen: Listen{
-			Graceful:      false,
-			ServerTimeOut: 0,
-			ListenTCP4:    false,
-			EnableHTTP:    true,
-			AutoTLS:       false,
-			Domains:       []string{},
-			TLSCacheDir:   ".",
-			HTTPAddr:      "",
-			HTTPPort:      8080,
-			EnableHTTPS:   false,
-			HTTPSAddr:     "",
-			HTTPSPort:     10443,
-			HTTPSCertFile: "",
-			HTTPSKeyFile:  "",
-			EnableAdmin:   false,
-			AdminAddr:     "",
-			AdminPort:     8088,
-			EnableFcgi:    false,
-			EnableStdIo:   false,
-			ClientAuth:    int(tls.RequireAndVerifyClientCert),
+			Graceful:       false,
+			PIDFile:        "",
+			ServerTimeOut:  0,
+			ListenTCP4:     false,
+			EnableHTTP:     true,
+			AutoTLS:        false,
+			Domains:        []string{},
+			TLSCacheDir:    ".",
+			DomainRegistry: "",
+			HTTPAddr:       "",
+			HTTPPort:       8080,
+			EnableHTTPS:    false,
+			HTTPSAddr:      "",
+			HTTPSPort:      10443,
+			HTTPSCertFile:  "",
+			HTTPSKeyFile:   "",
+			EnableAdmin:    false,
+			AdminAddr:      "",
+			AdminPort:      8088,
+			EnableFcgi:     false,
+			EnableStdIo:    false,
+			ClientAuth:     int(tls.RequireAndVerifyClientCert),
 		},
 		WebConfig: WebConfig{
 			AutoRender:             true,
 			EnableDocs:             false,
+			DocsPath:               "/openapi.json",
 			FlashName:              "BHOJPUR_FLASH",
 			FlashSeparator:         "BHOJPURFLASH",
 			DirectoryIndex:         false,
+			EnableEarlyHints:       false,
+			EnableServerPush:       false,
+			AssetManifest:          "",
+			PushCookieName:         "bhojpurpushed",
 			StaticDir:              map[string]string{"/static": "static"},
 			StaticExtensionsToGzip: []string{".css", ".js"},
 			StaticCacheFileSize:    1024 * 100,
@@ -288,6 +288,16 @@ func (c *Controller) Render() error {
 	if !c.EnableRender {
 		return nil
 	}
+
+	// the hints of the manifest are sent before the template runs, so the
+	// client fetches the assets meanwhile
+	var assets []criticalAsset
+	if hintsEnabled() {
+		assets = mergeAssets(manifest.assets(BConfig.WebConfig.AssetManifest, c.templateName()),
+			manifest.assets(BConfig.WebConfig.AssetManifest, c.Ctx.Request.URL.Path))
+		writeEarlyHints(c.Ctx, assets)
+	}
+
 	rb, err := c.RenderBytes()
 	if err != nil {
 		return err
@@ -297,6 +307,11 @@ func (c *Controller) Render() error {
 		c.Ctx.Output.Header("Content-Type", "text/html; charset=utf-8")
 	}
 
+	// the preloads of the page come too late for the 103, they are pushed
+	if hintsEnabled() {
+		pushAssets(c.Ctx, mergeAssets(assets, scanPreloads(rb)))
+	}
+
 	return c.Ctx.Output.Body(rb)
 }
 
@@ -337,14 +352,19 @@ func (c *Controller) RenderBytes() ([]byte, error) {
 	return buf.Bytes(), err
 }
 
+// templateName returns the name of the template rendered, the one of the
+// controller and the action by default
+func (c *Controller) templateName() string {
+	name := c.TplName
+	if name == "" {
+		name = strings.ToLower(c.controllerName) + "/" + strings.ToLower(c.actionName) + "." + c.TplExt
+	}
+	return c.TplPrefix + name
+}
+
 func (c *Controller) renderTemplate() (bytes.Buffer, error) {
 	var buf bytes.Buffer
-	if c.TplName == "" {
-		c.TplName = strings.ToLower(c.controllerName) + "/" + strings.ToLower(c.actionName) + "." + c.TplExt
-	}
-	if c.TplPrefix != "" {
-		c.TplName = c.TplPrefix + c.TplName
-	}
+	c.TplName = c.templateName()
 	if BConfig.RunMode == DEV {
 		buildFiles := []string{c.TplName}
 		if c.Layout != "" {
@@ -406,6 +426,10 @@ func (c *Controller) CustomAbort(status int, body string) {
 		panic(body)
 	}
 	// last panic user string
+	if BConfig.ProblemErrors {
+		c.Ctx.Output.Problem(ctxsvr.NewProblem(status, body))
+		panic(ErrAbort)
+	}
 	c.Ctx.ResponseWriter.WriteHeader(status)
 	c.Ctx.ResponseWriter.Write([]byte(body))
 	panic(ErrAbort)
@@ -475,7 +499,15 @@ func (c *Controller) ServeYAML() error {
 	return c.Ctx.Output.YAML(c.Data["yaml"])
 }
 
-// ServeFormatted serve YAML, XML OR JSON, depending on the value of the Accept header
+// SSE starts a stream of server-sent events as the response, see context.SSE.
+// The template is not rendered after the method returns.
+func (c *Controller) SSE() (*ctxsvr.SSE, error) {
+	c.EnableRender = false
+	return c.Ctx.SSE()
+}
+
+// ServeFormatted serves the data in the media type preferred by the Accept header,
+// among the codecs registered with context.RegisterCodec
 func (c *Controller) ServeFormatted(encoding ...bool) error {
 	hasIndent := BConfig.RunMode != PROD
 	hasEncoding := len(encoding) > 0 && encoding[0]
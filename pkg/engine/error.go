@@ -31,6 +31,7 @@ import (
 
 	webapp "github.com/bhojpur/web/pkg"
 	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/core/berror"
 	"github.com/bhojpur/web/pkg/core/utils"
 )
 
@@ -200,12 +201,27 @@ type errorInfo struct {
 	handler        http.HandlerFunc
 	method         string
 	errorType      int
+	// builtin is true for the default HTML handlers
+	builtin bool
 }
 
 // ErrorMaps holds map of http handlers for each error string.
 // there is 10 kinds default error(40x and 50x)
 var ErrorMaps = make(map[string]*errorInfo, 10)
 
+// show 400 bad request error.
+func badRequest(rw http.ResponseWriter, r *http.Request) {
+	responseError(rw, r,
+		400,
+		"<br>The page you have requested can't be served."+
+			"<br>Perhaps you are here because:"+
+			"<br><br><ul>"+
+			"<br>The request has invalid parameters"+
+			"<br>There are errors in the website address"+
+			"</ul>",
+	)
+}
+
 // show 401 unauthorized error.
 func unauthorized(rw http.ResponseWriter, r *http.Request) {
 	responseError(rw, r,
@@ -442,6 +458,10 @@ func exception(errCode string, ctx *context.Context) {
 		}
 	}
 	// if 50x error has been removed from errorMap
+	if BConfig.ProblemErrors {
+		ctx.Output.Problem(context.NewProblem(atoi(errCode), ""))
+		return
+	}
 	ctx.ResponseWriter.WriteHeader(atoi(errCode))
 	ctx.WriteString(errCode)
 }
@@ -450,6 +470,10 @@ func executeError(err *errorInfo, ctx *context.Context, code int) {
 	// make sure to log the error in the access log
 	LogAccess(ctx, nil, code)
 
+	if err.builtin && BConfig.ProblemErrors {
+		ctx.Output.Problem(context.NewProblem(code, ""))
+		return
+	}
 	if err.errorType == errorTypeHandler {
 		ctx.ResponseWriter.WriteHeader(code)
 		err.handler(ctx.ResponseWriter, ctx.Request)
@@ -485,3 +509,18 @@ func executeError(err *errorInfo, ctx *context.Context, code int) {
 		execController.Finish()
 	}
 }
+
+// panicProblem returns the problem of a recovered panic. Errors with a
+// berror code keep their message, the others only show it if detailed.
+func panicProblem(err interface{}, status int, detailed bool) *context.Problem {
+	if e, ok := err.(error); ok {
+		if _, ok := berror.FromError(e); ok {
+			return context.ProblemFromError(e)
+		}
+	}
+	p := context.NewProblem(status, "")
+	if detailed {
+		p.Detail = fmt.Sprint(err)
+	}
+	return p
+}
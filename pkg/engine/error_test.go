@@ -21,11 +21,16 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
+
+	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/core/berror"
 )
 
 type errorTestController struct {
@@ -92,3 +97,90 @@ func TestErrorCode_03(t *testing.T) {
 		t.Fail()
 	}
 }
+
+var errNoSuchTree = berror.DefineCode(4040001, "engine_test", "NoSuchTree", "the tree does not exist")
+
+func init() {
+	context.RegisterProblemType(errNoSuchTree, context.ProblemType{
+		Status: http.StatusNotFound,
+		Type:   "https://example.com/problems/no-such-tree",
+		Title:  "No such tree",
+	})
+}
+
+type problemTestController struct {
+	Controller
+}
+
+func (pc *problemTestController) Get() {
+	switch pc.GetString("case") {
+	case "abort":
+		pc.Abort("403")
+	case "custom":
+		pc.CustomAbort(http.StatusConflict, "the tree exists")
+	case "code":
+		panic(berror.Errorf(errNoSuchTree, "no tree %s", "oak"))
+	}
+	panic(errors.New("secret"))
+}
+
+func (pc problemTestController) Tree(id int) (string, error) {
+	if id == 0 {
+		return "", berror.Error(errNoSuchTree, "no tree 0")
+	}
+	return "oak", nil
+}
+
+func TestProblemErrors(t *testing.T) {
+	registerDefaultErrorHandler()
+	BConfig.ProblemErrors = true
+	defer func() {
+		BConfig.ProblemErrors = false
+	}()
+
+	handler := NewControllerRegister()
+	handler.Add("/problem", &problemTestController{})
+	handler.CtrlGet("/tree/:id:int", problemTestController.Tree)
+
+	tests := []struct {
+		url, accept string
+		status      int
+		contains    string
+	}{
+		{"/problem?case=abort", "", http.StatusForbidden, `"title":"Forbidden"`},
+		{"/problem?case=custom", "", http.StatusConflict, `"detail":"the tree exists"`},
+		{"/problem?case=code", "", http.StatusNotFound, `"type":"https://example.com/problems/no-such-tree"`},
+		{"/problem?case=panic", "", http.StatusInternalServerError, `"title":"Internal Server Error"`},
+		{"/tree/0", "", http.StatusNotFound, `"code":4040001`},
+		{"/nothing", "", http.StatusNotFound, `"instance":"/nothing"`},
+		{"/nothing", "application/xml, application/json", http.StatusNotFound, `<status>404</status>`},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s should return %d, got %d", test.url, test.status, w.Code)
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "application/problem+") {
+			t.Errorf("%s should return a problem, got %s", test.url, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), test.contains) {
+			t.Errorf("%s should contain %s, got %s", test.url, test.contains, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), "secret") {
+			t.Errorf("%s should not show the panic, got %s", test.url, w.Body.String())
+		}
+	}
+
+	r, _ := http.NewRequest(http.MethodGet, "/problem?case=code", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	p := &context.Problem{}
+	if err := json.Unmarshal(w.Body.Bytes(), p); err != nil || p.Detail != "no tree oak" || p.Title != "No such tree" {
+		t.Errorf("unexpected problem %+v: %v", p, err)
+	}
+}
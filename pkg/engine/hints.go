@@ -0,0 +1,279 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	logsvr "github.com/bhojpur/logger/pkg/engine"
+	"github.com/bhojpur/web/pkg/context"
+)
+
+// maxPushedAssets bounds the number of assets remembered in the push cookie
+const maxPushedAssets = 32
+
+// criticalAsset is an asset a page needs before it can be displayed
+type criticalAsset struct {
+	href string
+	as   string
+}
+
+// link formats the asset as a preload Link header value
+func (a criticalAsset) link() string {
+	l := fmt.Sprintf("<%s>; rel=preload", a.href)
+	if a.as != "" {
+		l += "; as=" + a.as
+	}
+	if a.as == "font" {
+		l += "; crossorigin"
+	}
+	return l
+}
+
+// assetManifest caches the manifest file named by WebConfig.AssetManifest,
+// reloading it when the file changes.
+type assetManifest struct {
+	sync.Mutex
+	file    string
+	modTime time.Time
+	pages   map[string][]string
+}
+
+var manifest assetManifest
+
+// assets returns the critical assets listed for page in the manifest. The
+// manifest is a JSON object mapping template names and URL paths to the
+// assets they need, e.g. {"index.tpl": ["/static/css/app.css"]}.
+func (m *assetManifest) assets(file, page string) []criticalAsset {
+	if file == "" {
+		return nil
+	}
+	m.Lock()
+	defer m.Unlock()
+	fi, err := os.Stat(file)
+	if err != nil {
+		logsvr.Warn("Can't open the asset manifest:", file, err)
+		return nil
+	}
+	if file != m.file || !fi.ModTime().Equal(m.modTime) {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			logsvr.Warn("Can't open the asset manifest:", file, err)
+			return nil
+		}
+		pages := make(map[string][]string)
+		if err := json.Unmarshal(data, &pages); err != nil {
+			logsvr.Warn("Can't parse the asset manifest:", file, err)
+			return nil
+		}
+		m.file, m.modTime, m.pages = file, fi.ModTime(), pages
+	}
+
+	hrefs := m.pages[page]
+	assets := make([]criticalAsset, 0, len(hrefs))
+	for _, href := range hrefs {
+		assets = append(assets, criticalAsset{href: href, as: assetType(href)})
+	}
+	return assets
+}
+
+// assetType guesses the preload destination of href from its extension
+func assetType(href string) string {
+	if i := strings.IndexAny(href, "?#"); i >= 0 {
+		href = href[:i]
+	}
+	switch strings.ToLower(path.Ext(href)) {
+	case ".css":
+		return "style"
+	case ".js", ".mjs":
+		return "script"
+	case ".woff", ".woff2", ".ttf", ".otf", ".eot":
+		return "font"
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".avif", ".ico":
+		return "image"
+	}
+	return ""
+}
+
+var (
+	linkTagRe  = regexp.MustCompile(`(?is)<link\s[^>]*>`)
+	linkAttrRe = regexp.MustCompile(`(?is)\b(rel|href|as)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// scanPreloads returns the assets of the <link rel=preload> tags of html
+func scanPreloads(html []byte) []criticalAsset {
+	var assets []criticalAsset
+	for _, tag := range linkTagRe.FindAll(html, -1) {
+		var rel, href, as string
+		for _, m := range linkAttrRe.FindAllSubmatch(tag, -1) {
+			value := string(m[2]) + string(m[3]) + string(m[4])
+			switch strings.ToLower(string(m[1])) {
+			case "rel":
+				rel = strings.ToLower(value)
+			case "href":
+				href = value
+			case "as":
+				as = strings.ToLower(value)
+			}
+		}
+		if href == "" || !hasToken(rel, "preload") {
+			continue
+		}
+		if as == "" {
+			as = assetType(href)
+		}
+		assets = append(assets, criticalAsset{href: href, as: as})
+	}
+	return assets
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// hintsEnabled reports whether critical assets should be computed at all
+func hintsEnabled() bool {
+	return BConfig.WebConfig.EnableEarlyHints || BConfig.WebConfig.EnableServerPush
+}
+
+// sendEarlyHints announces assets before the final response. With
+// EnableEarlyHints it sends them as preload links in a 103 Early Hints
+// response, and with EnableServerPush it pushes the local assets the client
+// has not been pushed yet, remembering them in the push cookie. It must be
+// called before the response is started.
+func sendEarlyHints(ctx *context.Context, assets []criticalAsset) {
+	pushAssets(ctx, assets)
+	writeEarlyHints(ctx, assets)
+}
+
+// pushAssets pushes the local assets the client has not been pushed yet
+// with EnableServerPush, remembering them in the push cookie
+func pushAssets(ctx *context.Context, assets []criticalAsset) {
+	cfg := BConfig.WebConfig
+	if len(assets) == 0 || ctx.ResponseWriter.Started || !cfg.EnableServerPush {
+		return
+	}
+	pusher := ctx.ResponseWriter.Pusher()
+	if pusher == nil {
+		return
+	}
+	pushed := strings.Split(ctx.GetCookie(cfg.PushCookieName), ".")
+	before := len(pushed)
+	for _, a := range assets {
+		if !strings.HasPrefix(a.href, "/") || strings.HasPrefix(a.href, "//") {
+			continue
+		}
+		key := assetKey(a.href)
+		if containsString(pushed, key) {
+			continue
+		}
+		if err := pusher.Push(a.href, nil); err != nil {
+			if err != http.ErrNotSupported {
+				logsvr.Debug("push", a.href, "failed:", err)
+			}
+			break
+		}
+		pushed = append(pushed, key)
+	}
+	if len(pushed) > before {
+		if len(pushed) > maxPushedAssets {
+			pushed = pushed[len(pushed)-maxPushedAssets:]
+		}
+		ctx.SetCookie(cfg.PushCookieName, strings.Trim(strings.Join(pushed, "."), "."), 0, "/", "", ctx.Input.IsSecure(), true)
+	}
+}
+
+// writeEarlyHints sends the assets as preload links in a 103 Early Hints
+// response with EnableEarlyHints. The 103 carries the links only, the
+// headers set so far, such as Set-Cookie, are kept for the final response,
+// which repeats the links. Nothing is sent when net/http cannot send
+// informational responses.
+func writeEarlyHints(ctx *context.Context, assets []criticalAsset) {
+	if !informationalResponses || len(assets) == 0 || ctx.ResponseWriter.Started ||
+		!BConfig.WebConfig.EnableEarlyHints || !ctx.Request.ProtoAtLeast(1, 1) {
+		return
+	}
+	header := ctx.ResponseWriter.Header()
+	final := header.Clone()
+	for k := range header {
+		delete(header, k)
+	}
+	for _, a := range assets {
+		link := a.link()
+		header.Add("Link", link)
+		final.Add("Link", link)
+	}
+	// the informational response must not mark the response as started
+	ctx.ResponseWriter.ResponseWriter.WriteHeader(http.StatusEarlyHints)
+	for k := range header {
+		delete(header, k)
+	}
+	for k, v := range final {
+		header[k] = v
+	}
+}
+
+// assetKey identifies href in the push cookie
+func assetKey(href string) string {
+	h := fnv.New32a()
+	h.Write([]byte(href))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeAssets appends the assets of more that are not in assets
+func mergeAssets(assets, more []criticalAsset) []criticalAsset {
+	for _, a := range more {
+		dup := false
+		for _, b := range assets {
+			if a.href == b.href {
+				dup = true
+				break
+			}
+		}
+		if !dup {
+			assets = append(assets, a)
+		}
+	}
+	return assets
+}
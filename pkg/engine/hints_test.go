@@ -0,0 +1,227 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/context"
+)
+
+func TestScanPreloads(t *testing.T) {
+	html := []byte(`<head>
+<link rel="stylesheet" href="/static/site.css">
+<link rel="preload" href="/static/app.css" as="style">
+<link href='/static/font.woff2' rel='preload'>
+<LINK REL=preload HREF=/static/app.js>
+</head>`)
+	assets := scanPreloads(html)
+	assert.Equal(t, []criticalAsset{
+		{href: "/static/app.css", as: "style"},
+		{href: "/static/font.woff2", as: "font"},
+		{href: "/static/app.js", as: "script"},
+	}, assets)
+	assert.Equal(t, "</static/font.woff2>; rel=preload; as=font; crossorigin", assets[1].link())
+}
+
+func TestAssetManifest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "assets.json")
+	assert.Nil(t, os.WriteFile(file, []byte(`{"index.tpl": ["/static/app.css", "/static/logo.svg"]}`), 0o644))
+
+	var m assetManifest
+	assert.Equal(t, []criticalAsset{
+		{href: "/static/app.css", as: "style"},
+		{href: "/static/logo.svg", as: "image"},
+	}, m.assets(file, "index.tpl"))
+	assert.Empty(t, m.assets(file, "other.tpl"))
+	assert.Empty(t, m.assets("", "index.tpl"))
+}
+
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed []string
+}
+
+func (p *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	p.pushed = append(p.pushed, target)
+	return nil
+}
+
+func TestServerPushCookie(t *testing.T) {
+	defer func(cfg WebConfig) { BConfig.WebConfig = cfg }(BConfig.WebConfig)
+	BConfig.WebConfig.EnableServerPush = true
+
+	assets := []criticalAsset{{href: "/static/app.css"}, {href: "https://cdn.example.com/lib.js"}, {href: "/static/app.js"}}
+
+	rw := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	ctx := context.NewContext()
+	ctx.Reset(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	sendEarlyHints(ctx, assets)
+	assert.Equal(t, []string{"/static/app.css", "/static/app.js"}, rw.pushed)
+	cookie := rw.Header().Get("Set-Cookie")
+	assert.True(t, strings.HasPrefix(cookie, "bhojpurpushed="), cookie)
+
+	// the assets remembered in the cookie are not pushed again
+	rw = &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Cookie", strings.Split(cookie, ";")[0])
+	ctx.Reset(rw, r)
+	sendEarlyHints(ctx, append(assets, criticalAsset{href: "/static/logo.png"}))
+	assert.Equal(t, []string{"/static/logo.png"}, rw.pushed)
+}
+
+func TestEarlyHints(t *testing.T) {
+	defer func(cfg WebConfig) { BConfig.WebConfig = cfg }(BConfig.WebConfig)
+	BConfig.WebConfig.EnableEarlyHints = true
+
+	handler := NewControllerRegister()
+	handler.Get("/", func(ctx *context.Context) {
+		sendEarlyHints(ctx, scanPreloads([]byte(`<link rel="preload" href="/static/app.css" as="style">`)))
+		ctx.Output.Body([]byte("page"))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var hints []string
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				hints = append(hints, header.Values("Link")...)
+			}
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	if informationalResponses {
+		assert.Equal(t, []string{"</static/app.css>; rel=preload; as=style"}, hints)
+	} else {
+		assert.Empty(t, hints)
+	}
+}
+
+// hintsRecorder records the informational responses and their headers
+type hintsRecorder struct {
+	*httptest.ResponseRecorder
+	hints []http.Header
+}
+
+func (r *hintsRecorder) WriteHeader(code int) {
+	if code == http.StatusEarlyHints {
+		r.hints = append(r.hints, r.Header().Clone())
+		return
+	}
+	r.ResponseRecorder.WriteHeader(code)
+}
+
+func TestRenderEarlyHints(t *testing.T) {
+	defer func(cfg WebConfig) { BConfig.WebConfig = cfg }(BConfig.WebConfig)
+	dir := t.TempDir()
+	manifestFile := filepath.Join(dir, "assets.json")
+	assert.Nil(t, os.WriteFile(manifestFile, []byte(`{"hints.tpl": ["/static/app.css"]}`), 0o644))
+	BConfig.WebConfig.EnableEarlyHints = true
+	BConfig.WebConfig.AssetManifest = manifestFile
+
+	rw := &hintsRecorder{ResponseRecorder: httptest.NewRecorder()}
+	// the template tells whether the hints were sent before it ran
+	AddFuncMap("hintsSent", func() bool { return len(rw.hints) > 0 })
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "hints.tpl"),
+		[]byte(`{{hintsSent}}<link rel="preload" href="/static/late.js" as="script">`), 0o644))
+	assert.Nil(t, AddViewPath(dir))
+
+	ctx := context.NewContext()
+	ctx.Reset(rw, httptest.NewRequest(http.MethodGet, "/", nil))
+	ctx.Output.Cookie("sid", "secret")
+	c := &Controller{}
+	c.Init(ctx, "HintsController", "Get", nil)
+	c.ViewPath = dir
+	c.TplName = "hints.tpl"
+	assert.Nil(t, c.Render())
+
+	assert.True(t, strings.HasPrefix(rw.Body.String(), "true"), rw.Body.String())
+	// the 103 carries the links only
+	assert.Equal(t, 1, len(rw.hints))
+	assert.Equal(t, http.Header{"Link": {"</static/app.css>; rel=preload; as=style"}}, rw.hints[0])
+	assert.NotEmpty(t, rw.Header().Get("Set-Cookie"))
+	assert.Equal(t, "</static/app.css>; rel=preload; as=style", rw.Header().Get("Link"))
+}
+
+type hintsController struct {
+	Controller
+}
+
+func (c *hintsController) Get() {
+	c.TplName = "status.tpl"
+}
+
+func TestRenderEarlyHintsStatus(t *testing.T) {
+	defer func(cfg WebConfig) { BConfig.WebConfig = cfg }(BConfig.WebConfig)
+	dir := t.TempDir()
+	manifestFile := filepath.Join(dir, "assets.json")
+	assert.Nil(t, os.WriteFile(manifestFile, []byte(`{"status.tpl": ["/static/app.css"]}`), 0o644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "status.tpl"), []byte(`page`), 0o644))
+	assert.Nil(t, AddViewPath(dir))
+	BConfig.WebConfig.EnableEarlyHints = true
+	BConfig.WebConfig.AssetManifest = manifestFile
+	BConfig.WebConfig.ViewsPath = dir
+
+	handler := NewControllerRegister()
+	handler.Add("/", &hintsController{})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	var informational []int
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			informational = append(informational, code)
+			return nil
+		},
+	}
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	// the 103 is informational, the page keeps its own status
+	if informationalResponses {
+		assert.Equal(t, []int{http.StatusEarlyHints}, informational)
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "page", string(body))
+	assert.Equal(t, "</static/app.css>; rel=preload; as=style", resp.Header.Get("Link"))
+}
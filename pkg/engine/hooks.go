@@ -29,6 +29,7 @@ import (
 	logsvr "github.com/bhojpur/logger/pkg/engine"
 	session "github.com/bhojpur/session/pkg/engine"
 	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/openapi"
 )
 
 // register MIME type with content type
@@ -42,6 +43,7 @@ func registerMime() error {
 // register default error http handlers, 404,401,403,500 and 503.
 func registerDefaultErrorHandler() error {
 	m := map[string]func(http.ResponseWriter, *http.Request){
+		"400": badRequest,
 		"401": unauthorized,
 		"402": paymentRequired,
 		"403": forbidden,
@@ -59,6 +61,7 @@ func registerDefaultErrorHandler() error {
 	for e, h := range m {
 		if _, ok := ErrorMaps[e]; !ok {
 			ErrorHandler(e, h)
+			ErrorMaps[e].builtin = true
 		}
 	}
 	return nil
@@ -117,3 +120,18 @@ func registerGzip() error {
 	}
 	return nil
 }
+
+func registerDocs() error {
+	if BConfig.WebConfig.EnableDocs {
+		BhojpurApp.Handlers.Get(BConfig.WebConfig.DocsPath, func(ctx *context.Context) {
+			doc := BhojpurApp.Handlers.OpenAPI(openapi.Info{
+				Title:   BConfig.AppName,
+				Version: AppConfig.DefaultString("version", "1.0.0"),
+			})
+			if err := ctx.Output.JSON(doc, BConfig.RunMode == DEV, false); err != nil {
+				logsvr.Error(err)
+			}
+		})
+	}
+	return nil
+}
@@ -36,6 +36,7 @@ type LinkNamespace func(*Namespace)
 type Namespace struct {
 	prefix   string
 	handlers *ControllerRegister
+	version  *apiVersion
 }
 
 // NewNamespace get new Namespace
@@ -126,6 +127,12 @@ func (n *Namespace) Get(rootpath string, f HandleFunc) *Namespace {
 	return n
 }
 
+// WebSocket same as websvr.WebSocket
+func (n *Namespace) WebSocket(rootpath string, h WebSocketHandler, opts ...WebSocketOption) *Namespace {
+	n.handlers.WebSocket(rootpath, h, opts...)
+	return n
+}
+
 // Post same as websvr.Post
 func (n *Namespace) Post(rootpath string, f HandleFunc) *Namespace {
 	n.handlers.Post(rootpath, f)
@@ -268,6 +275,8 @@ func (n *Namespace) Namespace(ns ...*Namespace) *Namespace {
 				}
 			}
 		}
+		n.handlers.mountVersions(ni)
+		n.handlers.hubs = append(n.handlers.hubs, ni.handlers.hubs...)
 	}
 	return n
 }
@@ -297,6 +306,8 @@ func AddNamespace(nl ...*Namespace) {
 				}
 			}
 		}
+		BhojpurApp.Handlers.mountVersions(n)
+		BhojpurApp.Handlers.hubs = append(BhojpurApp.Handlers.hubs, n.handlers.hubs...)
 	}
 }
 
@@ -358,6 +369,13 @@ func NSGet(rootpath string, f HandleFunc) LinkNamespace {
 	}
 }
 
+// NSWebSocket call Namespace WebSocket
+func NSWebSocket(rootpath string, h WebSocketHandler, opts ...WebSocketOption) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.WebSocket(rootpath, h, opts...)
+	}
+}
+
 // NSPost call Namespace Post
 func NSPost(rootpath string, f HandleFunc) LinkNamespace {
 	return func(ns *Namespace) {
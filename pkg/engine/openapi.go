@@ -0,0 +1,300 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/bhojpur/web/pkg/context/param"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// apiTypes are the Go types of the bodies of a router, registered with
+// DocumentTypes
+type apiTypes struct {
+	request  reflect.Type
+	response reflect.Type
+}
+
+// DocumentTypes registers the Go types of the request and response bodies
+// of the router of an HTTP method and a pattern for the OpenAPI document,
+// nil for no body. Controller methods are documented from their signatures,
+// the routers served by functions and http.Handler are documented with
+// their path parameters and a bare 200 response until their types are
+// registered.
+// usage:
+//    Post("/trees/:id:int", func(ctx *context.Context){
+//          ...
+//    })
+//    DocumentTypes(http.MethodPost, "/trees/:id:int", Tree{}, Tree{})
+func (p *ControllerRegister) DocumentTypes(method, pattern string, request, response interface{}) {
+	if p.apiTypes == nil {
+		p.apiTypes = make(map[string]apiTypes)
+	}
+	var types apiTypes
+	if request != nil {
+		types.request = reflect.TypeOf(request)
+	}
+	if response != nil {
+		types.response = reflect.TypeOf(response)
+	}
+	p.apiTypes[strings.ToUpper(method)+" "+pattern] = types
+}
+
+// OpenAPI returns the OpenAPI 3.1 document of the registered routers.
+// Parameters and bodies are described from the method parameters and the
+// signatures of controller methods, and from the types registered with
+// DocumentTypes.
+func (p *ControllerRegister) OpenAPI(info openapi.Info) *openapi.Document {
+	doc := openapi.New(info)
+	operationIDs := make(map[string]bool)
+	for _, method := range sortedMethods(p.routers) {
+		for _, r := range treeRouters(p.routers[method]) {
+			if p.cfg.WebConfig.EnableDocs && r.pattern == p.cfg.WebConfig.DocsPath {
+				continue
+			}
+			if op := p.operation(doc.Components, method, r); op != nil {
+				path, _ := openAPIPath(r.pattern)
+				if operationIDs[op.OperationID] {
+					op.OperationID += "_" + strings.ToLower(method)
+				}
+				operationIDs[op.OperationID] = true
+				doc.AddOperation(path, method, op)
+			}
+		}
+	}
+	return doc
+}
+
+func sortedMethods(routers map[string]*Tree) []string {
+	methods := make([]string, 0, len(routers))
+	for method := range routers {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// treeRouters returns the routers of the leaves of a tree
+func treeRouters(t *Tree) []*ControllerInfo {
+	var res []*ControllerInfo
+	for _, tr := range t.fixrouters {
+		res = append(res, treeRouters(tr)...)
+	}
+	if t.wildcard != nil {
+		res = append(res, treeRouters(t.wildcard)...)
+	}
+	for _, l := range t.leaves {
+		if r, ok := l.runObject.(*ControllerInfo); ok {
+			res = append(res, r)
+		}
+	}
+	return res
+}
+
+// operation returns the operation of a router for an HTTP method, nil if the
+// router does not serve the method
+func (p *ControllerRegister) operation(components *openapi.Components, method string, r *ControllerInfo) *openapi.Operation {
+	types, registered := p.apiTypes[method+" "+r.pattern]
+
+	_, path := openAPIPath(r.pattern)
+	op := &openapi.Operation{Parameters: path}
+	var fn *reflect.Method
+	switch r.routerType {
+	case routerTypeBhojpur:
+		name, mapped := r.methods[method]
+		if !mapped {
+			name, mapped = r.methods["*"]
+		}
+		if !mapped || HTTPMETHOD[name] {
+			// the controller serves the method with its method of the same
+			// name, unless it is the default one of Controller
+			name = method[:1] + strings.ToLower(method[1:])
+			if !mapped && !registered && !declaresMethod(r.controllerType, name) {
+				return nil
+			}
+		}
+		if m, ok := reflect.PtrTo(r.controllerType).MethodByName(name); ok {
+			fn = &m
+		}
+		op.OperationID = r.controllerType.Name() + "." + name
+		op.Tags = []string{strings.TrimSuffix(r.controllerType.Name(), "Controller")}
+	case routerTypeRESTFul:
+		if _, ok := r.methods[method]; !ok {
+			if _, ok = r.methods["*"]; !ok {
+				return nil
+			}
+		}
+		op.OperationID = operationID(method, r.pattern)
+	default:
+		// handlers serve every method, their bodies are described by the
+		// types registered with DocumentTypes
+		op.OperationID = operationID(method, r.pattern)
+	}
+
+	if fn != nil {
+		p.methodOperation(components, op, r, fn.Type)
+	}
+	if op.RequestBody == nil && types.request != nil {
+		op.RequestBody = components.JSONBody(types.request)
+	}
+	if op.Responses == nil {
+		if types.response != nil {
+			op.Responses = map[string]*openapi.Response{"200": components.JSONResponse("OK", types.response)}
+		} else {
+			op.Responses = map[string]*openapi.Response{"200": {Description: "OK"}}
+		}
+	}
+	return op
+}
+
+// methodOperation describes the arguments and results of a controller method
+func (p *ControllerRegister) methodOperation(components *openapi.Components, op *openapi.Operation, r *ControllerInfo, fn reflect.Type) {
+	// the first argument is the receiver
+	for i, mp := range r.methodParams {
+		if i+1 >= fn.NumIn() {
+			break
+		}
+		t := fn.In(i + 1)
+		switch mp.In() {
+		case "body":
+			op.RequestBody = components.JSONBody(t)
+			op.RequestBody.Required = mp.Required()
+		case "path":
+			for _, pp := range op.Parameters {
+				if pp.Name == mp.Name() && pp.Schema.Type.Has(openapi.TypeString) && pp.Schema.Format == "" && pp.Schema.Pattern == "" {
+					pp.Schema = components.SchemaOf(t)
+				}
+			}
+		default:
+			pp := &openapi.Parameter{Name: mp.Name(), In: mp.In(), Required: mp.Required(), Schema: components.SchemaOf(t)}
+			if v := mp.DefaultValue(); v != "" {
+				pp.Schema.Default = defaultValue(v)
+			}
+			op.Parameters = append(op.Parameters, pp)
+		}
+	}
+
+	for i := 0; i < fn.NumOut(); i++ {
+		if t := fn.Out(i); t != errorType {
+			op.Responses = map[string]*openapi.Response{"200": components.JSONResponse("OK", t)}
+			break
+		}
+	}
+}
+
+// defaultValue returns a default value as JSON, or as a string if it is not
+func defaultValue(v string) interface{} {
+	var res interface{}
+	if err := json.Unmarshal([]byte(v), &res); err != nil {
+		return v
+	}
+	return res
+}
+
+// declaresMethod reports whether a controller type declares a method itself
+// rather than promoting the one of an embedded Controller
+func declaresMethod(t reflect.Type, name string) bool {
+	for _, typ := range []reflect.Type{t, reflect.PtrTo(t)} {
+		if m, ok := typ.MethodByName(name); ok {
+			pc := m.Func.Pointer()
+			if file, _ := runtime.FuncForPC(pc).FileLine(pc); file != "<autogenerated>" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+var (
+	routerParamRegexp = regexp.MustCompile(`\??:([a-zA-Z0-9_]+)(?::([a-zA-Z0-9_]+))?(?:\(((?:[^()\\]|\\.|\([^()]*\))*)\))?`)
+	nonWordRegexp     = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+// openAPIPath turns a router pattern into an OpenAPI path, /user/:id:int
+// into /user/{id}, and returns its path parameters
+func openAPIPath(pattern string) (string, []*openapi.Parameter) {
+	var params []*openapi.Parameter
+	segments := strings.Split(pattern, "/")
+	for i, seg := range segments {
+		switch seg {
+		case "*":
+			segments[i] = "{splat}"
+			params = append(params, pathParameter("splat", nil))
+			continue
+		case "*.*":
+			segments[i] = "{path}.{ext}"
+			params = append(params, pathParameter("path", nil), pathParameter("ext", nil))
+			continue
+		}
+		seg = routerParamRegexp.ReplaceAllStringFunc(seg, func(s string) string {
+			m := routerParamRegexp.FindStringSubmatch(s)
+			schema := &openapi.Schema{Type: openapi.Types{openapi.TypeString}}
+			if m[3] != "" {
+				schema.Pattern = "^" + m[3] + "$"
+			} else if t, ok := param.LookupType(m[2]); ok {
+				schema = typeSchema(m[2], t)
+			}
+			params = append(params, pathParameter(m[1], schema))
+			return "{" + m[1] + "}"
+		})
+		segments[i] = strings.ReplaceAll(seg, `\`, "")
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func pathParameter(name string, schema *openapi.Schema) *openapi.Parameter {
+	if schema == nil {
+		schema = &openapi.Schema{Type: openapi.Types{openapi.TypeString}}
+	}
+	return &openapi.Parameter{Name: name, In: openapi.InPath, Required: true, Schema: schema}
+}
+
+// typeSchema returns the schema of a type of router parameters
+func typeSchema(name string, t param.Type) *openapi.Schema {
+	switch strings.ToLower(name) {
+	case "int":
+		return &openapi.Schema{Type: openapi.Types{openapi.TypeInteger}, Format: "int64", Minimum: new(float64)}
+	case "uuid":
+		return &openapi.Schema{Type: openapi.Types{openapi.TypeString}, Format: "uuid"}
+	case "date":
+		return &openapi.Schema{Type: openapi.Types{openapi.TypeString}, Format: "date"}
+	}
+	schema := &openapi.Schema{Type: openapi.Types{openapi.TypeString}}
+	if t.Pattern != `[^/]+` {
+		schema.Pattern = "^(?:" + t.Pattern + ")$"
+	}
+	return schema
+}
+
+// operationID returns the id of an operation without controller method,
+// e.g. get_user_id for GET /user/:id
+func operationID(method, pattern string) string {
+	path, _ := openAPIPath(pattern)
+	return strings.TrimSuffix(strings.ToLower(method)+"_"+strings.Trim(nonWordRegexp.ReplaceAllString(path, "_"), "_"), "_")
+}
@@ -0,0 +1,120 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/context/param"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+type docsTree struct {
+	Name string `json:"name"`
+}
+
+type DocsController struct {
+	Controller
+}
+
+func (c *DocsController) Get() {}
+
+func (c *DocsController) Search(q string, limit int) ([]docsTree, error) {
+	return nil, nil
+}
+
+func TestOpenAPI(t *testing.T) {
+	cfg := *BConfig
+	cfg.WebConfig.EnableDocs = true
+	cfg.CopyRequestBody = true
+
+	handler := NewControllerRegisterWithCfg(&cfg)
+	handler.Add("/docs", &DocsController{})
+	handler.Add("/example", &ExampleController{})
+	handler.addWithMethodParams("/docs/search", &DocsController{},
+		[]*param.MethodParam{param.New("q", param.IsRequired), param.New("limit", param.Default(10))},
+		WithRouterMethods(&DocsController{}, "get:Search"))
+	handler.CtrlGet("/post/:id:uuid/:day:date", ExampleController.Article)
+	handler.Post("/trees/:id:int", func(ctx *context.Context) {
+		var tree docsTree
+		ctx.BindJSON(&tree)
+		ctx.JSONResp(&tree)
+	})
+
+	handler.Handler("/files/:name", http.FileServer(http.Dir(".")))
+
+	doc := handler.OpenAPI(openapi.Info{Title: "Trees", Version: "1.0.0"})
+	// controllers are documented for the methods they declare
+	assert.Equal(t, "DocsController.Get", doc.Operation("/docs", http.MethodGet).OperationID)
+	assert.Nil(t, doc.Operation("/docs", http.MethodPost))
+	assert.NotContains(t, doc.Paths, "/example")
+
+	op := doc.Operation("/docs/search", http.MethodGet)
+	assert.Equal(t, []string{"Docs"}, op.Tags)
+	assert.Equal(t, 2, len(op.Parameters))
+	assert.Equal(t, openapi.InQuery, op.Parameters[0].In)
+	assert.True(t, op.Parameters[0].Required)
+	assert.Equal(t, openapi.Types{openapi.TypeInteger}, op.Parameters[1].Schema.Type)
+	assert.Equal(t, float64(10), op.Parameters[1].Schema.Default)
+	assert.Equal(t, "#/components/schemas/docsTree", op.Responses["200"].Content["application/json"].Schema.Items.Ref)
+
+	op = doc.Operation("/post/{id}/{day}", http.MethodGet)
+	assert.Equal(t, "uuid", op.Parameters[0].Schema.Format)
+	assert.Equal(t, "date", op.Parameters[1].Schema.Format)
+	assert.Equal(t, openapi.Types{openapi.TypeString}, op.Responses["200"].Content["application/json"].Schema.Type)
+
+	// the bodies of handlers are described by their registered types
+	op = doc.Operation("/trees/{id}", http.MethodPost)
+	assert.Equal(t, "post_trees_id", op.OperationID)
+	assert.Equal(t, openapi.Types{openapi.TypeInteger}, op.Parameters[0].Schema.Type)
+	assert.Nil(t, op.RequestBody)
+	assert.Nil(t, op.Responses["200"].Content)
+
+	// and so are those of http.Handler routers
+	op = doc.Operation("/files/{name}", http.MethodPut)
+	assert.Equal(t, "put_files_name", op.OperationID)
+	assert.Equal(t, "name", op.Parameters[0].Name)
+	assert.Nil(t, op.RequestBody)
+	assert.Equal(t, "OK", op.Responses["200"].Description)
+	assert.Nil(t, op.Responses["200"].Content)
+	assert.NotNil(t, doc.Operation("/files/{name}", http.MethodGet))
+
+	handler.DocumentTypes(http.MethodPost, "/trees/:id:int", docsTree{}, &docsTree{})
+	handler.DocumentTypes(http.MethodPut, "/files/:name", docsTree{}, nil)
+	doc = handler.OpenAPI(openapi.Info{Title: "Trees", Version: "1.0.0"})
+	op = doc.Operation("/trees/{id}", http.MethodPost)
+	assert.Equal(t, "#/components/schemas/docsTree", op.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "#/components/schemas/docsTree", op.Responses["200"].Content["application/json"].Schema.Ref)
+	op = doc.Operation("/files/{name}", http.MethodPut)
+	assert.Equal(t, "#/components/schemas/docsTree", op.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Nil(t, op.Responses["200"].Content)
+
+	// serving requests leaves the document as it is
+	r, _ := http.NewRequest(http.MethodPost, "/trees/1", bytes.NewBufferString(`{"name":"oak"}`))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, doc, handler.OpenAPI(openapi.Info{Title: "Trees", Version: "1.0.0"}))
+}
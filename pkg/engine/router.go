@@ -36,6 +36,7 @@ import (
 	ctxsvr "github.com/bhojpur/web/pkg/context"
 	"github.com/bhojpur/web/pkg/context/param"
 	"github.com/bhojpur/web/pkg/core/utils"
+	"github.com/bhojpur/web/pkg/websocket"
 )
 
 // default filter execution points
@@ -129,7 +130,10 @@ type ControllerInfo struct {
 	routerType     int
 	initialize     func() ControllerInterface
 	methodParams   []*param.MethodParam
+	paramTypes     map[string]param.Type
 	sessionOn      bool
+	// version is the name of the API version of the router, see Namespace.Version
+	version string
 }
 
 type ControllerOption func(*ControllerInfo)
@@ -171,6 +175,15 @@ type ControllerRegister struct {
 	// keep registered chain and build it when serve http
 	filterChains []filterChainConfig
 
+	// the API versions mounted by namespaces
+	versions []*versionSet
+
+	// the websocket hubs closed on shutdown
+	hubs []*websocket.Hub
+
+	// the types of the bodies of the routers, see DocumentTypes
+	apiTypes map[string]apiTypes
+
 	cfg *Config
 }
 
@@ -320,6 +333,14 @@ func (p *ControllerRegister) addToRouter(method, pattern string, r *ControllerIn
 	if !p.cfg.RouterCaseSensitive {
 		pattern = strings.ToLower(pattern)
 	}
+	for _, pp := range pathParams(pattern) {
+		if t, ok := param.LookupType(pp.typ); ok {
+			if r.paramTypes == nil {
+				r.paramTypes = make(map[string]param.Type)
+			}
+			r.paramTypes[":"+pp.name] = t
+		}
+	}
 	if t, ok := p.routers[method]; ok {
 		t.AddRouter(pattern, r)
 	} else {
@@ -488,6 +509,13 @@ func (p *ControllerRegister) CtrlAny(pattern string, f interface{}) {
 //    }
 //
 //    AddRouterMethod("get","/api/:id", MyController.Ping)
+// The arguments of a method are the parameters of the pattern, in order and
+// converted by their types, and its results are rendered:
+//    func (m MyController) Order(id uuid.UUID, day time.Time) (*Order, error) {
+//	     ...
+//    }
+//
+//    AddRouterMethod("get","/api/:id:uuid/:day:date", MyController.Order)
 func (p *ControllerRegister) AddRouterMethod(httpMethod, pattern string, f interface{}) {
 	httpMethod = p.getUpperMethodString(httpMethod)
 	ct, methodName := getReflectTypeAndMethod(f)
@@ -500,10 +528,30 @@ func (p *ControllerRegister) addBhojpurTypeRouter(ct reflect.Type, ctMethod, htt
 	route := p.createBhojpurRouter(ct, pattern)
 	methods := p.getHttpMethodMapMethod(httpMethod, ctMethod)
 	route.methods = methods
+	if m, ok := reflect.PtrTo(ct).MethodByName(ctMethod); ok && m.Type.NumIn() > 1 {
+		route.methodParams = p.pathMethodParams(pattern, m.Type.NumIn()-1)
+	}
 
 	p.addRouterForMethod(route)
 }
 
+// pathMethodParams returns the method parameters of a method taking the
+// parameters of pattern as arguments
+func (p *ControllerRegister) pathMethodParams(pattern string, numIn int) []*param.MethodParam {
+	if !p.cfg.RouterCaseSensitive {
+		pattern = strings.ToLower(pattern)
+	}
+	pps := pathParams(pattern)
+	if len(pps) != numIn {
+		panic(fmt.Sprintf("router %s has %d parameters but the method takes %d arguments", pattern, len(pps), numIn))
+	}
+	methodParams := make([]*param.MethodParam, 0, numIn)
+	for _, pp := range pps {
+		methodParams = append(methodParams, param.New(pp.name, param.InPath, param.IsRequired, param.OfType(pp.typ)))
+	}
+	return methodParams
+}
+
 // createBhojpurRouter create Bhojpur Web router base on reflect type and pattern
 func (p *ControllerRegister) createBhojpurRouter(ct reflect.Type, pattern string) *ControllerInfo {
 	route := &ControllerInfo{}
@@ -595,8 +643,9 @@ func getReflectTypeAndMethod(f interface{}) (controllerType reflect.Type, method
 		panic(fmt.Sprintf("%s is not a public method", method))
 	}
 
-	// check only one param which is the method receiver
-	if numIn := funcType.NumIn(); numIn != 1 {
+	// check the first param is the method receiver, the others are the
+	// parameters of the router pattern
+	if numIn := funcType.NumIn(); numIn < 1 {
 		panic("invalid number of param in")
 	}
 
@@ -975,6 +1024,9 @@ func (p *ControllerRegister) ServeHTTP(rw http.ResponseWriter, r *http.Request)
 	ctx.Reset(rw, r)
 	defer p.GiveBackContext(ctx)
 
+	if len(p.versions) > 0 && !p.resolveVersion(ctx) {
+		return
+	}
 	var preFilterParams map[string]string
 	p.chainRoot.filter(ctx, p.getUrlPath(ctx), preFilterParams)
 }
@@ -1099,6 +1151,10 @@ func (p *ControllerRegister) serveHttp(ctx *ctxsvr.Context) {
 			ctx.Input.SetParam(strconv.Itoa(k), v)
 		}
 	}
+	if routerInfo != nil && !p.checkParams(ctx, routerInfo) {
+		exception(strconv.Itoa(p.cfg.ParamErrorStatus), ctx)
+		goto Admin
+	}
 
 	if routerInfo != nil {
 		// store router pattern into context
@@ -1291,12 +1347,31 @@ func (p *ControllerRegister) getUrlPath(ctx *ctxsvr.Context) string {
 	return urlPath
 }
 
+// checkParams checks the typed parameters of the router against the pattern
+// and the validation of their type, such as :day:date
+func (p *ControllerRegister) checkParams(context *ctxsvr.Context, routerInfo *ControllerInfo) bool {
+	for name, t := range routerInfo.paramTypes {
+		if err := t.Check(context.Input.Param(name)); err != nil {
+			logsvr.Debug("invalid parameter %s of router %s: %v", name, routerInfo.pattern, err)
+			return false
+		}
+	}
+	return true
+}
+
 func (p *ControllerRegister) handleParamResponse(context *ctxsvr.Context, execController ControllerInterface, results []reflect.Value) {
 	// looping in reverse order for the case when both error and value are returned and error sets the response status code
 	for i := len(results) - 1; i >= 0; i-- {
 		result := results[i]
 		if result.Kind() != reflect.Interface || !result.IsNil() {
 			resultValue := result.Interface()
+			if err, ok := resultValue.(error); ok && p.cfg.ProblemErrors {
+				if _, ok := resultValue.(ctxsvr.Renderer); !ok {
+					// the other results are not rendered after the problem
+					context.Output.Problem(ctxsvr.ProblemFromError(err))
+					return
+				}
+			}
 			context.RenderMethodResult(resultValue)
 		}
 	}
@@ -27,9 +27,11 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	logsvr "github.com/bhojpur/logger/pkg/engine"
 	"github.com/bhojpur/web/pkg/context"
+	"github.com/google/uuid"
 )
 
 type PrefixTestController struct {
@@ -1103,3 +1105,42 @@ func TestRouterAddRouterPointerMethodPanicNotImplementInterface(t *testing.T) {
 	handler := NewControllerRegister()
 	handler.AddRouterMethod(method, "/user", (*TestControllerWithInterface).PingPointer)
 }
+
+func (m ExampleController) Article(id uuid.UUID, day time.Time) string {
+	return id.String() + " " + day.Format("Jan 2 2006")
+}
+
+func TestRouterTypedParams(t *testing.T) {
+	handler := NewControllerRegister()
+	handler.CtrlGet("/post/:id:uuid/:day:date", ExampleController.Article)
+
+	r, _ := http.NewRequest(http.MethodGet, "/post/1b4e28ba-2fa1-11d2-883f-0016d3cca427/2021-02-03", nil)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "1b4e28ba-2fa1-11d2-883f-0016d3cca427 Feb 3 2021") {
+		t.Errorf("TestRouterTypedParams can't run, got %d %s", w.Code, w.Body.String())
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusBadRequest} {
+		handler.cfg.ParamErrorStatus = status
+		for _, url := range []string{"/post/123/2021-02-03", "/post/not-a-uuid/2021-02-03",
+			"/post/1b4e28ba-2fa1-11d2-883f-0016d3cca427/2021-02-30", "/post/1b4e28ba-2fa1-11d2-883f-0016d3cca427/yesterday"} {
+			r, _ = http.NewRequest(http.MethodGet, url, nil)
+			w = httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != status {
+				t.Errorf("%s should return %d, got %d", url, status, w.Code)
+			}
+		}
+	}
+}
+
+func TestRouterTypedParamsPanic(t *testing.T) {
+	defer func() {
+		if err := recover(); err == nil {
+			t.Error("a method taking more arguments than the router has parameters should panic")
+		}
+	}()
+	handler := NewControllerRegister()
+	handler.CtrlGet("/post/:id:uuid", ExampleController.Article)
+}
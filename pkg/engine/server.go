@@ -21,6 +21,7 @@ package engine
 // THE SOFTWARE.
 
 import (
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -30,6 +31,7 @@ import (
 	"net/http/fcgi"
 	"os"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"text/template"
@@ -40,6 +42,7 @@ import (
 	logsvr "github.com/bhojpur/logger/pkg/engine"
 	ctxsvr "github.com/bhojpur/web/pkg/context"
 	"github.com/bhojpur/web/pkg/core/utils"
+	"github.com/bhojpur/web/pkg/domain"
 	"github.com/bhojpur/web/pkg/grace"
 )
 
@@ -140,9 +143,11 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 	app.Server.ReadTimeout = time.Duration(app.Cfg.Listen.ServerTimeOut) * time.Second
 	app.Server.WriteTimeout = time.Duration(app.Cfg.Listen.ServerTimeOut) * time.Second
 	app.Server.ErrorLog = logsvr.GetLogger("HTTP")
+	app.Server.RegisterOnShutdown(app.Handlers.shutdownHubs)
 
 	// run graceful mode
 	if app.Cfg.Listen.Graceful {
+		grace.PIDFile = app.Cfg.Listen.PIDFile
 		httpsAddr := app.Cfg.Listen.HTTPSAddr
 		app.Server.Addr = httpsAddr
 		if app.Cfg.Listen.EnableHTTPS || app.Cfg.Listen.EnableMutualHTTPS {
@@ -155,6 +160,7 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 				server := grace.NewServer(httpsAddr, app.Server.Handler)
 				server.Server.ReadTimeout = app.Server.ReadTimeout
 				server.Server.WriteTimeout = app.Server.WriteTimeout
+				server.Server.RegisterOnShutdown(app.Handlers.shutdownHubs)
 				if app.Cfg.Listen.EnableMutualHTTPS {
 					if err := server.ListenAndServeMutualTLS(app.Cfg.Listen.HTTPSCertFile,
 						app.Cfg.Listen.HTTPSKeyFile,
@@ -164,12 +170,16 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 					}
 				} else {
 					if app.Cfg.Listen.AutoTLS {
-						m := autocert.Manager{
-							Prompt:     autocert.AcceptTOS,
-							HostPolicy: autocert.HostWhitelist(app.Cfg.Listen.Domains...),
-							Cache:      autocert.DirCache(app.Cfg.Listen.TLSCacheDir),
+						ctx, cancel := context.WithCancel(context.Background())
+						defer cancel()
+						server.Server.RegisterOnShutdown(cancel)
+						tlsConfig, err := app.autoTLSConfig(ctx)
+						if err != nil {
+							logsvr.Critical("AutoTLS: ", err, fmt.Sprintf("%d", os.Getpid()))
+							endRunning <- true
+							return
 						}
-						app.Server.TLSConfig = &tls.Config{GetCertificate: m.GetCertificate}
+						server.Server.TLSConfig = tlsConfig
 						app.Cfg.Listen.HTTPSCertFile, app.Cfg.Listen.HTTPSKeyFile = "", ""
 					}
 					if err := server.ListenAndServeTLS(app.Cfg.Listen.HTTPSCertFile, app.Cfg.Listen.HTTPSKeyFile); err != nil {
@@ -185,6 +195,7 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 				server := grace.NewServer(addr, app.Server.Handler)
 				server.Server.ReadTimeout = app.Server.ReadTimeout
 				server.Server.WriteTimeout = app.Server.WriteTimeout
+				server.Server.RegisterOnShutdown(app.Handlers.shutdownHubs)
 				if app.Cfg.Listen.ListenTCP4 {
 					server.Network = "tcp4"
 				}
@@ -211,12 +222,16 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 			}
 			logsvr.Info("Bhojpur WebEngine - HTTPS server running on https://%s", app.Server.Addr)
 			if app.Cfg.Listen.AutoTLS {
-				m := autocert.Manager{
-					Prompt:     autocert.AcceptTOS,
-					HostPolicy: autocert.HostWhitelist(app.Cfg.Listen.Domains...),
-					Cache:      autocert.DirCache(app.Cfg.Listen.TLSCacheDir),
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+				app.Server.RegisterOnShutdown(cancel)
+				tlsConfig, err := app.autoTLSConfig(ctx)
+				if err != nil {
+					logsvr.Critical("AutoTLS: ", err)
+					endRunning <- true
+					return
 				}
-				app.Server.TLSConfig = &tls.Config{GetCertificate: m.GetCertificate}
+				app.Server.TLSConfig = tlsConfig
 				app.Cfg.Listen.HTTPSCertFile, app.Cfg.Listen.HTTPSKeyFile = "", ""
 			} else if app.Cfg.Listen.EnableMutualHTTPS {
 				pool := x509.NewCertPool()
@@ -268,6 +283,30 @@ func (app *HttpServer) Run(addr string, mws ...MiddleWare) {
 	<-endRunning
 }
 
+// autoTLSConfig returns the TLS configuration of AutoTLS: the certificates
+// of the domain registry, watched for changes, or the ACME certificates of
+// the configured domains. The registry is watched until ctx is done.
+func (app *HttpServer) autoTLSConfig(ctx context.Context) (*tls.Config, error) {
+	if app.Cfg.Listen.DomainRegistry == "" {
+		m := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(app.Cfg.Listen.Domains...),
+			Cache:      autocert.DirCache(app.Cfg.Listen.TLSCacheDir),
+		}
+		return m.TLSConfig(), nil
+	}
+	registry, err := domain.OpenRegistry(app.Cfg.Listen.DomainRegistry)
+	if err != nil {
+		return nil, err
+	}
+	m, err := domain.NewManager(registry, domain.WithDomains(app.Cfg.Listen.Domains...))
+	if err != nil {
+		return nil, err
+	}
+	go m.Watch(ctx, domain.DefaultWatchInterval)
+	return m.TLSConfig(), nil
+}
+
 // Router see HttpServer.Router
 func Router(rootpath string, c ControllerInterface, mappingMethods ...string) *HttpServer {
 	return RouterWithOpts(rootpath, c, WithRouterMethods(c, mappingMethods...))
@@ -639,6 +678,37 @@ func (app *HttpServer) Get(rootpath string, f HandleFunc) *HttpServer {
 	return app
 }
 
+// DocumentTypes see HttpServer.DocumentTypes
+func DocumentTypes(method, rootpath string, request, response interface{}) *HttpServer {
+	return BhojpurApp.DocumentTypes(method, rootpath, request, response)
+}
+
+// DocumentTypes registers the types of the request and response bodies of
+// a router for the OpenAPI document served when EnableDocs is on
+// usage:
+//    websvr.Post("/trees", createTree)
+//    websvr.DocumentTypes(http.MethodPost, "/trees", Tree{}, Tree{})
+func (app *HttpServer) DocumentTypes(method, rootpath string, request, response interface{}) *HttpServer {
+	app.Handlers.DocumentTypes(method, rootpath, request, response)
+	return app
+}
+
+// WebSocket see HttpServer.WebSocket
+func WebSocket(rootpath string, h WebSocketHandler, opts ...WebSocketOption) *HttpServer {
+	return BhojpurApp.WebSocket(rootpath, h, opts...)
+}
+
+// WebSocket used to register router upgrading Get requests to websocket connections
+// usage:
+//    websvr.WebSocket("/echo", func(ctx *context.Context, conn *websocket.Conn){
+//          mt, data, _ := conn.ReadMessage()
+//          conn.WriteMessage(mt, data)
+//    })
+func (app *HttpServer) WebSocket(rootpath string, h WebSocketHandler, opts ...WebSocketOption) *HttpServer {
+	app.Handlers.WebSocket(rootpath, h, opts...)
+	return app
+}
+
 // Post see HttpServer.Post
 func Post(rootpath string, f HandleFunc) *HttpServer {
 	return BhojpurApp.Post(rootpath, f)
@@ -834,21 +904,40 @@ func (app *HttpServer) LogAccess(ctx *ctxsvr.Context, startTime *time.Time, stat
 	logsvr.AccessLog(record, app.Cfg.Log.AccessLogsFormat)
 }
 
-// PrintTree prints all registered routers.
+// PrintTree prints all registered routers, grouped by API version and
+// method. The routers of a version are in the groups such as
+// "GET (version 2)".
 func (app *HttpServer) PrintTree() M {
+	type group struct {
+		version, method string
+		resultList      *[][]string
+	}
 	var (
 		content     = M{}
 		methods     = []string{}
 		methodsData = make(M)
+		groups      []group
 	)
 	for method, t := range app.Handlers.routers {
-
-		resultList := new([][]string)
-
-		printTree(resultList, t)
-
-		methods = append(methods, template.HTMLEscapeString(method))
-		methodsData[template.HTMLEscapeString(method)] = resultList
+		versions := make(map[string]*[][]string)
+		printTree(versions, t)
+		for version, resultList := range versions {
+			groups = append(groups, group{version: version, method: method, resultList: resultList})
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].version != groups[j].version {
+			return compareVersions(groups[i].version, groups[j].version) < 0
+		}
+		return groups[i].method < groups[j].method
+	})
+	for _, g := range groups {
+		name := g.method
+		if g.version != "" {
+			name = fmt.Sprintf("%s (version %s)", g.method, g.version)
+		}
+		methods = append(methods, template.HTMLEscapeString(name))
+		methodsData[template.HTMLEscapeString(name)] = g.resultList
 	}
 
 	content["Data"] = methodsData
@@ -856,15 +945,20 @@ func (app *HttpServer) PrintTree() M {
 	return content
 }
 
-func printTree(resultList *[][]string, t *Tree) {
+func printTree(versions map[string]*[][]string, t *Tree) {
 	for _, tr := range t.fixrouters {
-		printTree(resultList, tr)
+		printTree(versions, tr)
 	}
 	if t.wildcard != nil {
-		printTree(resultList, t.wildcard)
+		printTree(versions, t.wildcard)
 	}
 	for _, l := range t.leaves {
 		if v, ok := l.runObject.(*ControllerInfo); ok {
+			resultList, ok := versions[v.version]
+			if !ok {
+				resultList = new([][]string)
+				versions[v.version] = resultList
+			}
 			if v.routerType == routerTypeBhojpur {
 				result := []string{
 					template.HTMLEscapeString(v.pattern),
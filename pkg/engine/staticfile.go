@@ -75,13 +75,32 @@ func serverStaticRouter(ctx *context.Context) {
 			http.ServeFile(ctx.ResponseWriter, ctx.Request, filePath)
 		}
 		return
-	} else if fileInfo.Size() > int64(BConfig.WebConfig.StaticCacheFileSize) {
+	}
+
+	enableCompress := BConfig.EnableGzip && isStaticCompress(filePath)
+	if enableCompress {
+		ctx.Output.Header("Vary", "Accept-Encoding")
+		if sidecar, encoding := lookupPrecompressed(ctx.Request, filePath, fileInfo); sidecar != "" {
+			if f, err := os.Open(sidecar); err == nil {
+				defer f.Close()
+				ctx.Output.Header("Content-Encoding", encoding)
+				// the content type follows the file, not its sidecar
+				http.ServeContent(ctx.ResponseWriter, ctx.Request, filePath, fileInfo.ModTime(), f)
+				return
+			}
+			// the sidecar is gone since it was cached
+			lruLock.Lock()
+			staticFileLruCache.Remove(precompressedKey(filePath))
+			lruLock.Unlock()
+		}
+	}
+
+	if fileInfo.Size() > int64(BConfig.WebConfig.StaticCacheFileSize) {
 		// over size file serve with http module
 		http.ServeFile(ctx.ResponseWriter, ctx.Request, filePath)
 		return
 	}
 
-	enableCompress := BConfig.EnableGzip && isStaticCompress(filePath)
 	var acceptEncoding string
 	if enableCompress {
 		acceptEncoding = context.ParseEncoding(ctx.Request)
@@ -101,6 +120,14 @@ func serverStaticRouter(ctx *context.Context) {
 		ctx.Output.Header("Content-Length", strconv.FormatInt(sch.size, 10))
 	}
 
+	if hintsEnabled() && isHTMLFile(filePath) {
+		assets := manifest.assets(BConfig.WebConfig.AssetManifest, ctx.Request.URL.Path)
+		if !b {
+			assets = mergeAssets(assets, scanPreloads(sch.data))
+		}
+		sendEarlyHints(ctx, assets)
+	}
+
 	http.ServeContent(ctx.ResponseWriter, ctx.Request, filePath, sch.modTime, reader)
 }
 
@@ -121,7 +148,7 @@ var (
 	lruLock            sync.RWMutex
 )
 
-func openFile(filePath string, fi os.FileInfo, acceptEncoding string) (bool, string, *serveContentHolder, *serveContentReader, error) {
+func initStaticFileCache() {
 	if staticFileLruCache == nil {
 		// avoid lru cache error
 		if BConfig.WebConfig.StaticCacheFileNum >= 1 {
@@ -130,6 +157,10 @@ func openFile(filePath string, fi os.FileInfo, acceptEncoding string) (bool, str
 			staticFileLruCache, _ = lru.New(1)
 		}
 	}
+}
+
+func openFile(filePath string, fi os.FileInfo, acceptEncoding string) (bool, string, *serveContentHolder, *serveContentReader, error) {
+	initStaticFileCache()
 	mapKey := acceptEncoding + ":" + filePath
 	lruLock.RLock()
 	var mapFile *serveContentHolder
@@ -176,6 +207,84 @@ func isOk(s *serveContentHolder, fi os.FileInfo) bool {
 	return s.modTime == fi.ModTime() && s.originSize == fi.Size()
 }
 
+// precompressedExts maps the content codings to the extensions of the
+// precompressed sidecar files of static resources, e.g. app.js.br
+var precompressedExts = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+// precompressedHolder caches which sidecar files of a static resource exist,
+// by encoding, for the modification time and size of the resource
+type precompressedHolder struct {
+	modTime    time.Time
+	originSize int64
+	sidecars   map[string]bool
+}
+
+// lookupPrecompressed returns the sidecar file of filePath in the encoding
+// the request accepts best, among the sidecars at least as recent as the file.
+// Only the sidecars of accepted encodings are looked for, and what is found
+// is cached in the static file cache until the file changes.
+func lookupPrecompressed(r *http.Request, filePath string, fi os.FileInfo) (string, string) {
+	offers := make([]string, 0, len(precompressedExts))
+	for encoding := range precompressedExts {
+		offers = append(offers, encoding)
+	}
+	encodings := context.AcceptedEncodings(r, offers...)
+	if len(encodings) == 0 {
+		return "", ""
+	}
+	initStaticFileCache()
+	mapKey := precompressedKey(filePath)
+	lruLock.RLock()
+	var holder *precompressedHolder
+	if cacheItem, ok := staticFileLruCache.Get(mapKey); ok {
+		holder = cacheItem.(*precompressedHolder)
+	}
+	lruLock.RUnlock()
+	sidecars := map[string]bool{}
+	if holder != nil && holder.modTime == fi.ModTime() && holder.originSize == fi.Size() {
+		for k, v := range holder.sidecars {
+			sidecars[k] = v
+		}
+	}
+
+	found, changed := "", false
+	for _, encoding := range encodings {
+		exists, ok := sidecars[encoding]
+		if !ok {
+			sfi, err := os.Stat(filePath + precompressedExts[encoding])
+			exists = err == nil && !sfi.IsDir() && !sfi.ModTime().Before(fi.ModTime())
+			sidecars[encoding], changed = exists, true
+		}
+		if exists {
+			found = encoding
+			break
+		}
+	}
+	if changed {
+		// the cached holder may be in use, so it is replaced rather than updated
+		lruLock.Lock()
+		staticFileLruCache.Add(mapKey, &precompressedHolder{modTime: fi.ModTime(), originSize: fi.Size(), sidecars: sidecars})
+		lruLock.Unlock()
+	}
+	if found == "" {
+		return "", ""
+	}
+	return filePath + precompressedExts[found], found
+}
+
+func precompressedKey(filePath string) string {
+	return "precompressed:" + filePath
+}
+
+func isHTMLFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".html" || ext == ".htm"
+}
+
 // isStaticCompress detect static files
 func isStaticCompress(filePath string) bool {
 	for _, statExtension := range BConfig.WebConfig.StaticExtensionsToGzip {
@@ -27,9 +27,17 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/andybalholm/brotli"
+
+	"github.com/bhojpur/web/pkg/context"
 )
 
 var (
@@ -121,3 +129,74 @@ func assetOpenFileAndContent(sch *serveContentHolder, reader *serveContentReader
 		t.Fail()
 	}
 }
+
+func TestOpenStaticFileBrotli_1(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.css")
+	content := bytes.Repeat([]byte("body { color: #333; }\n"), 64)
+	if err := ioutil.WriteFile(file, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fi, _ := os.Stat(file)
+	b, n, _, reader, err := openFile(file, fi, "br")
+	if err != nil || !b || n != "br" {
+		t.Fatalf("openFile returned %v %q %v, want a brotli variant", b, n, err)
+	}
+	decoded, err := ioutil.ReadAll(brotli.NewReader(reader))
+	if err != nil || !bytes.Equal(decoded, content) {
+		t.Fatalf("brotli variant does not decode to the file: %v", err)
+	}
+}
+
+func TestStaticPrecompressed(t *testing.T) {
+	defer func(gzip bool, dirs map[string]string) {
+		BConfig.EnableGzip, BConfig.WebConfig.StaticDir = gzip, dirs
+	}(BConfig.EnableGzip, BConfig.WebConfig.StaticDir)
+	BConfig.EnableGzip = true
+
+	dir := t.TempDir()
+	BConfig.WebConfig.StaticDir = map[string]string{"/static": dir}
+	// the file is written first, sidecars older than their file are ignored
+	for _, f := range [][2]string{{"app.js", "plain"}, {"app.js.br", "brotli"}, {"app.js.gz", "gzip"}} {
+		if err := ioutil.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		accept   string
+		encoding string
+		body     string
+	}{
+		{"gzip, deflate, br", "br", "brotli"},
+		{"gzip, br;q=0.5", "gzip", "gzip"},
+		{"zstd", "", "plain"},
+		{"", "", "plain"},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/static/app.js", nil)
+		r.Header.Set("Accept-Encoding", tt.accept)
+		rw := httptest.NewRecorder()
+		ctx := context.NewContext()
+		ctx.Reset(rw, r)
+		serverStaticRouter(ctx)
+
+		if got := rw.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("Accept-Encoding %q: got encoding %q, want %q", tt.accept, got, tt.encoding)
+		}
+		if rw.Body.String() != tt.body {
+			t.Errorf("Accept-Encoding %q: got body %q, want %q", tt.accept, rw.Body.String(), tt.body)
+		}
+		if ct := rw.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+			t.Errorf("Accept-Encoding %q: got content type %q", tt.accept, ct)
+		}
+	}
+
+	// only the sidecars of accepted encodings were looked for, and cached
+	item, ok := staticFileLruCache.Get(precompressedKey(filepath.Join(dir, "app.js")))
+	if !ok {
+		t.Fatal("the sidecars are not cached")
+	}
+	sidecars := item.(*precompressedHolder).sidecars
+	if want := map[string]bool{"br": true, "gzip": true, "zstd": false}; !reflect.DeepEqual(sidecars, want) {
+		t.Errorf("got cached sidecars %v, want %v", sidecars, want)
+	}
+}
@@ -26,6 +26,7 @@ import (
 	"strings"
 
 	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/context/param"
 	"github.com/bhojpur/web/pkg/core/utils"
 )
 
@@ -475,8 +476,8 @@ func splitPath(key string) []string {
 // "admin" -> false, nil, ""
 // ":id" -> true, [:id], ""
 // "?:id" -> true, [: :id], ""        : meaning can empty
-// ":id:int" -> true, [:id], ([0-9]+)
-// ":name:string" -> true, [:name], ([\w]+)
+// ":id:int" -> true, [:id], ""        the type is checked by the router
+// ":id:int_:name" -> true, [:id :name], ([0-9]+)_(.+)
 // ":id([0-9]+)" -> true, [:id], ([0-9]+)
 // ":id([0-9]+)_:name" -> true, [:id :name], ([0-9]+)_(.+)
 // "cms_:id_:page.html" -> true, [:id_ :page], cms_(.+)(.+).html
@@ -506,31 +507,22 @@ func splitSegment(key string) (bool, []string, string) {
 				continue
 			}
 			if start {
-				// :id:int and :name:string
+				// :id:int, :name:string and the other types registered
+				// with param.RegisterType, e.g. :id:uuid. A parameter
+				// filling the segment matches any value, its type is
+				// checked once the router is found.
 				if v == ':' {
-					if len(key) >= i+4 {
-						if key[i+1:i+4] == "int" {
-							out = append(out, []rune("([0-9]+)")...)
-							params = append(params, ":"+string(param))
-							start = false
-							startexp = false
-							skipnum = 3
-							param = make([]rune, 0)
-							paramsNum++
-							continue
-						}
-					}
-					if len(key) >= i+7 {
-						if key[i+1:i+7] == "string" {
-							out = append(out, []rune(`([\w]+)`)...)
-							params = append(params, ":"+string(param))
-							paramsNum++
-							start = false
-							startexp = false
-							skipnum = 6
-							param = make([]rune, 0)
-							continue
+					if pattern, n := typePattern(key[i+1:]); n > 0 {
+						if len(out) > 0 || i+1+n < len(key) {
+							out = append(out, []rune("("+pattern+")")...)
 						}
+						params = append(params, ":"+string(param))
+						paramsNum++
+						start = false
+						startexp = false
+						skipnum = n
+						param = make([]rune, 0)
+						continue
 					}
 				}
 				// params only support a-zA-Z0-9
@@ -590,3 +582,41 @@ func splitSegment(key string) (bool, []string, string) {
 	}
 	return false, nil, ""
 }
+
+// typePattern returns the pattern of the parameter type named at the start
+// of s and the length of its name, which is 0 if there is no such type. The
+// longest name registered wins, so :id:int_:name is an int followed by _.
+func typePattern(s string) (string, int) {
+	n := 0
+	for n < len(s) && (s[n] == '_' || 'a' <= s[n] && s[n] <= 'z' || 'A' <= s[n] && s[n] <= 'Z' || '0' <= s[n] && s[n] <= '9') {
+		n++
+	}
+	for ; n > 0; n-- {
+		if t, ok := param.LookupType(s[:n]); ok {
+			return t.Pattern, n
+		}
+	}
+	return "", 0
+}
+
+// pathParam is a named parameter of a router pattern, with its type if the
+// type is registered
+type pathParam struct {
+	name string
+	typ  string
+}
+
+var pathParamRegexp = regexp.MustCompile(`:([a-zA-Z0-9_]+)(?::([a-zA-Z0-9_]+))?`)
+
+// pathParams returns the named parameters of a router pattern in order
+func pathParams(pattern string) []pathParam {
+	var res []pathParam
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(pattern, -1) {
+		p := pathParam{name: m[1]}
+		if _, n := typePattern(m[2]); n > 0 && n == len(m[2]) {
+			p.typ = m[2]
+		}
+		res = append(res, p)
+	}
+	return res
+}
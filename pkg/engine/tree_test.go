@@ -93,6 +93,12 @@ func init() {
 		matchTestInfo("/v1/shop/:id/:name", "/v1/shop/123/nike", map[string]string{":id": "123", ":name": "nike"}),
 		matchTestInfo("/v1/shop/:id/account", "/v1/shop/123/account", map[string]string{":id": "123"}),
 		matchTestInfo("/v1/shop/:name:string", "/v1/shop/nike", map[string]string{":name": "nike"}),
+		matchTestInfo("/v1/user/:id:uuid", "/v1/user/1b4e28ba-2fa1-11d2-883f-0016d3cca427", map[string]string{":id": "1b4e28ba-2fa1-11d2-883f-0016d3cca427"}),
+		// the types of the parameters filling a segment are checked by the router
+		matchTestInfo("/v1/user/:id:uuid", "/v1/user/123", map[string]string{":id": "123"}),
+		matchTestInfo("/v1/blog/:title:slug", "/v1/blog/Hello_World", map[string]string{":title": "Hello_World"}),
+		matchTestInfo("/v1/blog/:day:date/:title:slug", "/v1/blog/2021-02-03/hello-world", map[string]string{":day": "2021-02-03", ":title": "hello-world"}),
+		matchTestInfo("/v1/release/:version:semver", "/v1/release/1.2.3-rc.1", map[string]string{":version": "1.2.3-rc.1"}),
 		matchTestInfo("/v1/shop/:id([0-9]+)", "/v1/shop//123", map[string]string{":id": "123"}),
 		matchTestInfo("/v1/shop/:id([0-9]+)_:name", "/v1/shop/123_nike", map[string]string{":id": "123", ":name": "nike"}),
 		matchTestInfo("/v1/shop/:id(.+)_cms.html", "/v1/shop/123_cms.html", map[string]string{":id": "123"}),
@@ -116,6 +122,8 @@ func init() {
 
 		// not match example
 		notMatchTestInfo("/read_:id:int\\.htm", "/read_222htm"),
+		notMatchTestInfo("/v1/user/u:id:uuid", "/v1/user/u123"),
+		notMatchTestInfo("/v1/release/:version:semver.json", "/v1/release/1.2.json"),
 		notMatchTestInfo("/read_:id:int\\.htm", "/read_222_htm"),
 		notMatchTestInfo("/read_:id:int\\.htm", " /read_262shtm"),
 
@@ -349,8 +357,11 @@ func TestSplitSegment(t *testing.T) {
 		"*.*":                        {true, []string{".", ":path", ":ext"}, ""},
 		":id":                        {true, []string{":id"}, ""},
 		"?:id":                       {true, []string{":", ":id"}, ""},
-		":id:int":                    {true, []string{":id"}, "([0-9]+)"},
-		":name:string":               {true, []string{":name"}, `([\w]+)`},
+		":id:int":                    {true, []string{":id"}, ""},
+		"?:id:int":                   {true, []string{":", ":id"}, ""},
+		":day:date":                  {true, []string{":day"}, ""},
+		":day:date.json":             {true, []string{":day"}, `([0-9]{4}-[0-9]{2}-[0-9]{2}).json`},
+		":id:int_:name":              {true, []string{":id", ":name"}, `([0-9]+)_(.+)`},
 		":id([0-9]+)":                {true, []string{":id"}, `([0-9]+)`},
 		":id([0-9]+)_:name":          {true, []string{":id", ":name"}, `([0-9]+)_(.+)`},
 		":id(.+)_cms.html":           {true, []string{":id"}, `(.+)_cms.html`},
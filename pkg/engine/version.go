@@ -0,0 +1,334 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+)
+
+const (
+	// AcceptVersionHeader is the request header selecting an API version
+	AcceptVersionHeader = "Accept-Version"
+	// APIVersionHeader is the response header naming the API version served
+	APIVersionHeader = "Api-Version"
+	// APIVersionKey is the key of the API version served in the data of
+	// the input, see APIVersion
+	APIVersionKey = "APIVersion"
+)
+
+// VersionOption configures an API version
+type VersionOption func(v *apiVersion)
+
+// WithDeprecation marks the version as deprecated since a date, responses
+// get a Deprecation header
+func WithDeprecation(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.deprecation = at
+	}
+}
+
+// WithSunset announces the date the version stops being served, responses
+// get a Sunset header
+func WithSunset(at time.Time) VersionOption {
+	return func(v *apiVersion) {
+		v.sunset = at
+	}
+}
+
+// WithDeprecationLink links the responses of a deprecated version to a page
+// documenting the deprecation and the migration
+func WithDeprecationLink(url string) VersionOption {
+	return func(v *apiVersion) {
+		v.link = url
+	}
+}
+
+// apiVersion is a version of an API, served by a namespace
+type apiVersion struct {
+	name string
+	// segment is the prefix of the namespace, e.g. /v2
+	segment     string
+	deprecation time.Time
+	sunset      time.Time
+	link        string
+}
+
+// versionSet holds the versions of the API mounted at a base path
+type versionSet struct {
+	base     string
+	versions []*apiVersion
+}
+
+// Version makes the namespace serve a version of the API of the namespace
+// it is added to. Requests to the prefix of the namespace are served by the
+// version, other requests to the API are routed to a version by the
+// Accept-Version header or the version parameter of the Accept media type,
+// e.g. application/json; version=2, falling back to the latest compatible
+// version serving the route: the latest one with the same major version,
+// not older than the version requested.
+// usage:
+//
+//	api := websvr.NewNamespace("/api",
+//		websvr.NSNamespace("/v1",
+//			websvr.NSVersion("1", websvr.WithDeprecation(deprecated), websvr.WithSunset(sunset)),
+//			websvr.NSRouter("/trees", &v1.TreeController{}),
+//		),
+//		websvr.NSNamespace("/v2",
+//			websvr.NSVersion("2"),
+//			websvr.NSRouter("/trees", &v2.TreeController{}),
+//		),
+//	)
+//	websvr.AddNamespace(api)
+//
+// Then /api/v1/trees is served by version 1, and /api/trees by version 2
+// unless the request asks for version 1.
+func (n *Namespace) Version(name string, opts ...VersionOption) *Namespace {
+	n.version = &apiVersion{name: name}
+	for _, opt := range opts {
+		opt(n.version)
+	}
+	return n
+}
+
+// NSVersion makes the Namespace serve a version of the API
+func NSVersion(name string, opts ...VersionOption) LinkNamespace {
+	return func(ns *Namespace) {
+		ns.Version(name, opts...)
+	}
+}
+
+// APIVersion returns the name of the API version serving a request, empty
+// for the routers outside versions
+func APIVersion(ctx *ctxsvr.Context) string {
+	name, _ := ctx.Input.GetData(APIVersionKey).(string)
+	return name
+}
+
+// mountVersions registers the versions of a namespace added to the register
+func (p *ControllerRegister) mountVersions(ns *Namespace) {
+	if ns.version != nil {
+		v := *ns.version
+		v.segment = ns.prefix
+		for _, t := range ns.handlers.routers {
+			markVersion(t, v.name)
+		}
+		p.addVersion("", &v)
+	}
+	for _, set := range ns.handlers.versions {
+		for _, v := range set.versions {
+			p.addVersion(ns.prefix+set.base, v)
+		}
+	}
+}
+
+func (p *ControllerRegister) addVersion(base string, v *apiVersion) {
+	base = strings.TrimSuffix(base, "/")
+	var set *versionSet
+	for _, s := range p.versions {
+		if s.base == base {
+			set = s
+			break
+		}
+	}
+	if set == nil {
+		set = &versionSet{base: base}
+		p.versions = append(p.versions, set)
+		// the most specific base paths first
+		sort.SliceStable(p.versions, func(i, j int) bool {
+			return len(p.versions[i].base) > len(p.versions[j].base)
+		})
+	}
+	set.versions = append(set.versions, v)
+	// the latest versions first
+	sort.SliceStable(set.versions, func(i, j int) bool {
+		return compareVersions(set.versions[i].name, set.versions[j].name) > 0
+	})
+}
+
+// markVersion sets the version of the routers of a namespace
+func markVersion(t *Tree, name string) {
+	for _, v := range t.fixrouters {
+		markVersion(v, name)
+	}
+	if t.wildcard != nil {
+		markVersion(t.wildcard, name)
+	}
+	for _, l := range t.leaves {
+		if c, ok := l.runObject.(*ControllerInfo); ok && c.version == "" {
+			c.version = name
+		}
+	}
+}
+
+// resolveVersion routes a request to an API version, rewriting the path of
+// requests without version prefix. It returns false if the request asks for
+// a version which is not served.
+func (p *ControllerRegister) resolveVersion(ctx *ctxsvr.Context) bool {
+	urlPath := p.getUrlPath(ctx)
+	for _, set := range p.versions {
+		rest, ok := trimPathPrefix(urlPath, p.normalizePath(set.base))
+		if !ok {
+			continue
+		}
+		for _, v := range set.versions {
+			if _, ok := trimPathPrefix(rest, p.normalizePath(v.segment)); ok {
+				setVersionHeaders(ctx, v)
+				return true
+			}
+		}
+		// routers outside versions keep serving all of them
+		if p.matches(ctx.Request.Method, urlPath) {
+			return true
+		}
+
+		requested := requestedVersion(ctx.Request)
+		served := false
+		for _, v := range set.versions {
+			versioned := set.base + v.segment + ctx.Request.URL.Path[len(set.base):]
+			if !p.matches(ctx.Request.Method, p.normalizePath(versioned)) {
+				continue
+			}
+			served = true
+			if requested == "" || compatibleVersion(v.name, requested) {
+				ctx.Request.URL.Path = versioned
+				ctx.Request.URL.RawPath = ""
+				ctx.ResponseWriter.Header().Add("Vary", AcceptVersionHeader+", Accept")
+				setVersionHeaders(ctx, v)
+				return true
+			}
+		}
+		// the router exists, but not in a version compatible with the request
+		if served {
+			exception("400", ctx)
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+func (p *ControllerRegister) normalizePath(path string) string {
+	if !p.cfg.RouterCaseSensitive {
+		return strings.ToLower(path)
+	}
+	return path
+}
+
+// matches reports whether a router serves a path, without changing the
+// parameters of the request
+func (p *ControllerRegister) matches(method string, urlPath string) bool {
+	t, ok := p.routers[method]
+	if !ok {
+		return false
+	}
+	return t.Match(urlPath, ctxsvr.NewContext()) != nil
+}
+
+// trimPathPrefix removes a prefix of whole segments from a path
+func trimPathPrefix(path, prefix string) (string, bool) {
+	if !strings.HasPrefix(path, prefix) {
+		return "", false
+	}
+	rest := path[len(prefix):]
+	if rest != "" && rest[0] != '/' {
+		return "", false
+	}
+	return rest, true
+}
+
+func setVersionHeaders(ctx *ctxsvr.Context, v *apiVersion) {
+	ctx.Input.SetData(APIVersionKey, v.name)
+	ctx.Output.Header(APIVersionHeader, v.name)
+	if !v.deprecation.IsZero() {
+		ctx.Output.Header("Deprecation", "@"+strconv.FormatInt(v.deprecation.Unix(), 10))
+	}
+	if !v.sunset.IsZero() {
+		ctx.Output.Header("Sunset", v.sunset.UTC().Format(http.TimeFormat))
+	}
+	if v.link != "" {
+		ctx.ResponseWriter.Header().Add("Link", "<"+v.link+`>; rel="deprecation"`)
+	}
+}
+
+// requestedVersion returns the version asked by the Accept-Version header or
+// the version parameter of the Accept header
+func requestedVersion(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get(AcceptVersionHeader)); v != "" {
+		return v
+	}
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if _, params, err := mime.ParseMediaType(accept); err == nil && params["version"] != "" {
+			return params["version"]
+		}
+	}
+	return ""
+}
+
+// versionParts splits a version such as v2.1 into its components
+func versionParts(name string) []string {
+	return strings.Split(strings.TrimPrefix(strings.ToLower(name), "v"), ".")
+}
+
+// compareVersions compares versions component by component, numerically if
+// both components are numbers
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var ca, cb string
+		if i < len(pa) {
+			ca = pa[i]
+		}
+		if i < len(pb) {
+			cb = pb[i]
+		}
+		na, errA := strconv.Atoi(ca)
+		nb, errB := strconv.Atoi(cb)
+		if ca == "" {
+			na, errA = 0, nil
+		}
+		if cb == "" {
+			nb, errB = 0, nil
+		}
+		switch {
+		case errA == nil && errB == nil && na != nb:
+			if na < nb {
+				return -1
+			}
+			return 1
+		case (errA != nil || errB != nil) && ca != cb:
+			return strings.Compare(ca, cb)
+		}
+	}
+	return 0
+}
+
+// compatibleVersion reports whether a version can serve the requests for
+// another: it has the same major version and is not older
+func compatibleVersion(name, requested string) bool {
+	return versionParts(name)[0] == versionParts(requested)[0] && compareVersions(name, requested) >= 0
+}
@@ -0,0 +1,148 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/web/pkg/context"
+)
+
+func versionedAPI(prefix string) *Namespace {
+	deprecated := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	serve := func(body string) HandleFunc {
+		return func(ctx *context.Context) {
+			ctx.Output.Body([]byte(body + " " + APIVersion(ctx) + " " + ctx.Input.Param(":id")))
+		}
+	}
+	return NewNamespace(prefix,
+		NSNamespace("/v1",
+			NSVersion("1", WithDeprecation(deprecated), WithSunset(sunset), WithDeprecationLink("https://example.com/v1")),
+			NSGet("/trees/:id", serve("trees")),
+			NSGet("/forests", serve("forests")),
+		),
+		NSNamespace("/v2",
+			NSVersion("2"),
+			NSGet("/trees/:id", serve("trees")),
+		),
+		NSNamespace("/v2.1",
+			NSVersion("2.1"),
+			NSGet("/trees/:id", serve("trees")),
+		),
+		NSGet("/health", serve("health")),
+	)
+}
+
+func TestVersionRouting(t *testing.T) {
+	// the namespaces added to a root namespace are served by its handlers
+	handler := NewNamespace("").Namespace(versionedAPI("/api")).handlers
+
+	tests := []struct {
+		url, acceptVersion, accept string
+		status                     int
+		body, version              string
+	}{
+		{"/api/v1/trees/1", "", "", 200, "trees 1 1", "1"},
+		{"/api/v2/trees/1", "", "", 200, "trees 2 1", "2"},
+		{"/api/trees/1", "", "", 200, "trees 2.1 1", "2.1"},
+		{"/api/trees/1", "1", "", 200, "trees 1 1", "1"},
+		{"/api/trees/1", "2.0", "", 200, "trees 2.1 1", "2.1"},
+		{"/api/trees/1", "", "application/json; version=1", 200, "trees 1 1", "1"},
+		{"/api/trees/1", "3", "", 400, "", ""},
+		{"/api/forests", "", "", 200, "forests 1 ", "1"},
+		{"/api/forests", "2", "", 400, "", ""},
+		{"/api/health", "1", "", 200, "health  ", ""},
+		{"/api/nothing", "1", "", 404, "", ""},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(http.MethodGet, test.url, nil)
+		if test.acceptVersion != "" {
+			r.Header.Set(AcceptVersionHeader, test.acceptVersion)
+		}
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("%s %s should return %d, got %d", test.url, test.acceptVersion, test.status, w.Code)
+			continue
+		}
+		if test.status != http.StatusOK {
+			continue
+		}
+		if w.Body.String() != test.body {
+			t.Errorf("%s %s should return %q, got %q", test.url, test.acceptVersion, test.body, w.Body.String())
+		}
+		if got := w.Header().Get(APIVersionHeader); got != test.version {
+			t.Errorf("%s %s should be served by version %q, got %q", test.url, test.acceptVersion, test.version, got)
+		}
+		deprecated := test.version == "1"
+		if (w.Header().Get("Deprecation") == "@1609459200") != deprecated ||
+			(w.Header().Get("Sunset") == "Sat, 01 Jan 2022 00:00:00 GMT") != deprecated ||
+			(w.Header().Get("Link") == `<https://example.com/v1>; rel="deprecation"`) != deprecated {
+			t.Errorf("%s %s has unexpected deprecation headers %v", test.url, test.acceptVersion, w.Header())
+		}
+	}
+}
+
+func TestVersionPrintTree(t *testing.T) {
+	AddNamespace(versionedAPI("/versioned"))
+	content := BhojpurApp.PrintTree()
+	methods := strings.Join(content["Methods"].([]string), ",")
+	for _, group := range []string{"GET (version 1)", "GET (version 2)", "GET (version 2.1)"} {
+		if !strings.Contains(methods, group) {
+			t.Errorf("PrintTree should group the routers of %s, got %s", group, methods)
+		}
+	}
+	if strings.Index(methods, "GET (version 2)") > strings.Index(methods, "GET (version 2.1)") {
+		t.Errorf("PrintTree should sort the versions, got %s", methods)
+	}
+	list := content["Data"].(M)["GET (version 1)"].(*[][]string)
+	if len(*list) != 2 {
+		t.Errorf("version 1 should have 2 routers, got %v", *list)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1", "2", -1},
+		{"v2", "2.0", 0},
+		{"2.10", "2.9", 1},
+		{"2021-03-01", "2021-02-01", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.want {
+			t.Errorf("compareVersions(%s, %s) should be %d, got %d", test.a, test.b, test.want, got)
+		}
+	}
+	if !compatibleVersion("2.1", "2") || compatibleVersion("2.1", "2.2") || compatibleVersion("3", "2") {
+		t.Error("unexpected compatible versions")
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/http"
+
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/grace"
+	"github.com/bhojpur/web/pkg/websocket"
+)
+
+// WebSocketHandler serves a connection upgraded by a WebSocket router. The
+// connection is closed by the caller of the handler once it returns.
+type WebSocketHandler func(ctx *ctxsvr.Context, conn *websocket.Conn)
+
+// WebSocketOption configures a WebSocket router.
+type WebSocketOption func(*webSocketRouter)
+
+// WithUpgrader sets the upgrader used for the router, e.g. to check the
+// origin or negotiate subprotocols.
+func WithUpgrader(u *websocket.Upgrader) WebSocketOption {
+	return func(r *webSocketRouter) {
+		r.upgrader = u
+	}
+}
+
+// WithHub registers hub with the router's server so that its connections
+// are closed with CloseGoingAway when the server shuts down.
+func WithHub(hub *websocket.Hub) WebSocketOption {
+	return func(r *webSocketRouter) {
+		r.hub = hub
+	}
+}
+
+type webSocketRouter struct {
+	upgrader *websocket.Upgrader
+	hub      *websocket.Hub
+	handler  WebSocketHandler
+}
+
+// serve upgrades the request once the filters and policies of the route
+// have let it through.
+func (r *webSocketRouter) serve(ctx *ctxsvr.Context) {
+	conn, err := r.upgrader.Upgrade(ctx.ResponseWriter, ctx.Request, nil)
+	if err != nil {
+		// the upgrader has already replied with an error status
+		return
+	}
+	defer conn.Close()
+	ctx.ResponseWriter.Started = true
+	ctx.ResponseWriter.Status = http.StatusSwitchingProtocols
+	r.handler(ctx, conn)
+}
+
+// WebSocket adds a router upgrading GET requests on pattern to websocket
+// connections. Filters and policies matching pattern run before the upgrade,
+// so they can reject the handshake.
+// usage:
+//    hub := websocket.NewHub()
+//    WebSocket("/chat/:room", func(ctx *context.Context, conn *websocket.Conn) {
+//          hub.Serve(conn, func(c *websocket.HubConn, mt int, data []byte) {
+//                hub.Broadcast(ctx.Input.Param(":room"), mt, data)
+//          }, ctx.Input.Param(":room"))
+//    }, WithHub(hub))
+func (p *ControllerRegister) WebSocket(pattern string, h WebSocketHandler, opts ...WebSocketOption) {
+	r := &webSocketRouter{
+		upgrader: &websocket.Upgrader{},
+		handler:  h,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.hub != nil {
+		p.hubs = append(p.hubs, r.hub)
+	}
+	p.Get(pattern, r.serve)
+}
+
+// shutdownHubs closes the connections of the hubs registered with the
+// routers. It is run when the server shuts down.
+func (p *ControllerRegister) shutdownHubs() {
+	ctx := context.Background()
+	if grace.DefaultTimeout >= 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grace.DefaultTimeout)
+		defer cancel()
+	}
+	for _, hub := range p.hubs {
+		hub.Shutdown(ctx)
+	}
+}
@@ -0,0 +1,103 @@
+package engine
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	gocontext "context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/websocket"
+)
+
+func TestWebSocketRouter(t *testing.T) {
+	hub := websocket.NewHub()
+	handler := NewControllerRegister()
+	handler.InsertFilter("/ws/*", BeforeRouter, func(ctx *context.Context) {
+		if ctx.Input.Query("token") != "secret" {
+			ctx.Output.SetStatus(http.StatusUnauthorized)
+			ctx.Output.Body([]byte("unauthorized"))
+		}
+	})
+	handler.WebSocket("/ws/:room", func(ctx *context.Context, conn *websocket.Conn) {
+		room := ctx.Input.Param(":room")
+		hub.Serve(conn, func(c *websocket.HubConn, mt int, data []byte) {
+			hub.Broadcast(room, mt, append([]byte(room+": "), data...))
+		}, room)
+	}, WithHub(hub))
+	handler.Init()
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws/lobby"
+
+	// the filter rejects the handshake before the upgrade
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without token: %v, want 401", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, p, err := conn.ReadMessage(); err != nil || string(p) != "lobby: hi" {
+		t.Fatalf("got %q, %v; want %q", p, err, "lobby: hi")
+	}
+
+	// a plain GET is refused by the upgrader
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/ws/lobby?token=secret", nil))
+	if rw.Code != http.StatusBadRequest {
+		t.Fatalf("plain GET returned %d, want 400", rw.Code)
+	}
+
+	// the registered hubs close their connections on shutdown
+	if len(handler.hubs) != 1 {
+		t.Fatalf("registered %d hubs, want 1", len(handler.hubs))
+	}
+	go handler.shutdownHubs()
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseGoingAway) {
+		t.Fatalf("read after shutdown: %v, want close going away", err)
+	}
+}
+
+func TestNamespaceWebSocketHubs(t *testing.T) {
+	hub := websocket.NewHub()
+	ns := NewNamespace("/api",
+		NSNamespace("/v1",
+			NSWebSocket("/events", func(ctx *context.Context, conn *websocket.Conn) {}, WithHub(hub)),
+		),
+	)
+	if len(ns.handlers.hubs) != 1 {
+		t.Fatalf("namespace has %d hubs, want 1", len(ns.handlers.hubs))
+	}
+	hub.Shutdown(gocontext.Background())
+}
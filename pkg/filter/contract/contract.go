@@ -0,0 +1,236 @@
+package contract
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It provides a filter validating requests against an OpenAPI 3 contract
+// before the controllers run: path, query, header and cookie parameters,
+// content types and JSON or form bodies. Requests which do not match the
+// contract are answered with an RFC 7807 problem detail, see context.Problem.
+// In dev RunMode, responses are validated too, so that handlers drifting
+// from the contract fail loudly.
+// Usage:
+//	import(
+//		websvr "github.com/bhojpur/web/pkg/engine"
+//		"github.com/bhojpur/web/pkg/filter/contract"
+//		"github.com/bhojpur/web/pkg/openapi"
+//	)
+//
+//	func main(){
+//		doc, err := openapi.LoadFile("conf/openapi.yaml")
+//		if err != nil {
+//			panic(err)
+//		}
+//		websvr.InsertFilterChain("/*", contract.NewFilterChain(doc))
+//		websvr.Run()
+//	}
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+// Option configures the filter
+type Option func(v *validator)
+
+// WithResponseValidation turns the validation of responses on or off, it
+// is on in dev RunMode by default. Responses are buffered to be validated.
+func WithResponseValidation(on bool) Option {
+	return func(v *validator) {
+		v.responses = on
+	}
+}
+
+// WithBasePath sets the path the paths of the document are relative to. It
+// defaults to the path of the URL of the first server of the document.
+func WithBasePath(path string) Option {
+	return func(v *validator) {
+		v.basePath = strings.TrimSuffix(path, "/")
+	}
+}
+
+// WithMaxBodySize limits the size of the request bodies read for
+// validation, it defaults to MaxMemory
+func WithMaxBodySize(size int64) Option {
+	return func(v *validator) {
+		v.maxBodySize = size
+	}
+}
+
+type validator struct {
+	doc         *openapi.Document
+	routes      []*route
+	responses   bool
+	basePath    string
+	maxBodySize int64
+}
+
+// route is a path of the document
+type route struct {
+	re    *regexp.Regexp
+	names []string
+	item  *openapi.PathItem
+	// literal is the length of the path without its parameters, the most
+	// specific routes are matched first
+	literal int
+}
+
+// NewFilterChain returns a filter chain validating requests, and responses
+// if configured, against the operations of an OpenAPI document. Requests to
+// paths not in the document pass through.
+func NewFilterChain(doc *openapi.Document, opts ...Option) websvr.FilterChain {
+	v := &validator{
+		doc:         doc,
+		responses:   websvr.BConfig.RunMode == websvr.DEV,
+		basePath:    basePath(doc),
+		maxBodySize: websvr.BConfig.MaxMemory,
+	}
+	for _, opt := range opts {
+		opt(v)
+	}
+	if v.doc.Components == nil {
+		v.doc.Components = openapi.NewComponents()
+	}
+	v.compile()
+
+	return func(next websvr.FilterFunc) websvr.FilterFunc {
+		return func(ctx *ctxsvr.Context) {
+			r, params := v.match(ctx.Request.URL.EscapedPath())
+			if r == nil {
+				next(ctx)
+				return
+			}
+			method := ctx.Request.Method
+			op := r.item.Operation(method)
+			if op == nil && method == http.MethodHead {
+				op = r.item.Get
+			}
+			if op == nil {
+				if method == http.MethodOptions {
+					next(ctx)
+					return
+				}
+				ctx.Output.Header("Allow", strings.Join(allowed(r.item), ", "))
+				ctx.Output.Problem(problem(http.StatusMethodNotAllowed, "", nil))
+				return
+			}
+
+			if status, errs := v.validateRequest(ctx, r.item, op, params); status != 0 {
+				ctx.Output.Problem(problem(status, "the request does not match the API contract", errs))
+				return
+			}
+			if !v.responses || bufferless(ctx.Request) {
+				next(ctx)
+				return
+			}
+			v.validateResponse(ctx, op, next)
+		}
+	}
+}
+
+// basePath returns the path of the URL of the first server of a document
+func basePath(doc *openapi.Document) string {
+	if len(doc.Servers) == 0 || strings.Contains(doc.Servers[0].URL, "{") {
+		return ""
+	}
+	u, err := url.Parse(doc.Servers[0].URL)
+	if err != nil {
+		logs.Warn("contract: invalid server URL %s: %v", doc.Servers[0].URL, err)
+		return ""
+	}
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+var templateRegexp = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// compile turns the paths of the document into regular expressions
+func (v *validator) compile() {
+	for path, item := range v.doc.Paths {
+		r := &route{item: item}
+		var expr strings.Builder
+		expr.WriteString("^" + regexp.QuoteMeta(v.basePath))
+		last := 0
+		for _, m := range templateRegexp.FindAllStringSubmatchIndex(path, -1) {
+			expr.WriteString(regexp.QuoteMeta(path[last:m[0]]))
+			expr.WriteString("([^/]+)")
+			r.names = append(r.names, path[m[2]:m[3]])
+			r.literal += m[0] - last
+			last = m[1]
+		}
+		expr.WriteString(regexp.QuoteMeta(path[last:]) + "$")
+		r.literal += len(path) - last
+		r.re = regexp.MustCompile(expr.String())
+		v.routes = append(v.routes, r)
+	}
+	sort.Slice(v.routes, func(i, j int) bool {
+		if len(v.routes[i].names) != len(v.routes[j].names) {
+			return len(v.routes[i].names) < len(v.routes[j].names)
+		}
+		if v.routes[i].literal != v.routes[j].literal {
+			return v.routes[i].literal > v.routes[j].literal
+		}
+		return v.routes[i].re.String() < v.routes[j].re.String()
+	})
+}
+
+// match returns the route of a path with the values of its parameters
+func (v *validator) match(path string) (*route, map[string]string) {
+	for _, r := range v.routes {
+		m := r.re.FindStringSubmatch(path)
+		if m == nil {
+			continue
+		}
+		params := make(map[string]string, len(r.names))
+		for i, name := range r.names {
+			value, err := url.PathUnescape(m[i+1])
+			if err != nil {
+				value = m[i+1]
+			}
+			params[name] = value
+		}
+		return r, params
+	}
+	return nil, nil
+}
+
+func allowed(item *openapi.PathItem) []string {
+	var methods []string
+	for _, m := range []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions, http.MethodTrace} {
+		if item.Operation(m) != nil || (m == http.MethodHead && item.Get != nil) {
+			methods = append(methods, m)
+		}
+	}
+	return methods
+}
+
+// bufferless reports whether the response of a request is streamed, so it
+// can not be buffered for validation
+func bufferless(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" || strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
@@ -0,0 +1,220 @@
+package contract
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+const spec = `
+openapi: 3.0.3
+info:
+  title: Trees
+  version: 1.0.0
+servers:
+  - url: https://example.com/v1
+paths:
+  /trees:
+    get:
+      parameters:
+        - name: limit
+          in: query
+          schema:
+            type: integer
+            maximum: 100
+      responses:
+        '200':
+          description: the trees
+    post:
+      requestBody:
+        required: true
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Tree'
+      responses:
+        '201':
+          description: the tree
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Tree'
+  /trees/{id}:
+    parameters:
+      - name: id
+        in: path
+        required: true
+        schema:
+          type: integer
+    get:
+      responses:
+        '200':
+          description: the tree
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Tree'
+components:
+  schemas:
+    Tree:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+          minLength: 1
+        height:
+          type: number
+          nullable: true
+`
+
+func newHandler(t *testing.T, opts ...Option) *websvr.ControllerRegister {
+	doc, err := openapi.Load([]byte(spec))
+	require.Nil(t, err)
+
+	handler := websvr.NewControllerRegister()
+	handler.InsertFilterChain("/*", NewFilterChain(doc, opts...))
+	handler.Get("/v1/trees", func(ctx *context.Context) {
+		ctx.Output.Body([]byte("[]"))
+	})
+	handler.Post("/v1/trees", func(ctx *context.Context) {
+		ctx.Output.SetStatus(http.StatusCreated)
+		ctx.Output.Header("Content-Type", "application/json")
+		body, _ := ioutil.ReadAll(ctx.Request.Body)
+		ctx.Output.Body(body)
+	})
+	handler.Get("/v1/trees/:id", func(ctx *context.Context) {
+		ctx.Output.Header("Content-Type", "application/json")
+		if ctx.Input.Param(":id") == "13" {
+			ctx.Output.Body([]byte(`{"height":3}`))
+			return
+		}
+		ctx.Output.Body([]byte(`{"name":"oak","height":null}`))
+	})
+	handler.Get("/v1/other", func(ctx *context.Context) {
+		ctx.Output.Body([]byte("other"))
+	})
+	handler.Init()
+	return handler
+}
+
+func serve(handler http.Handler, method, url, contentType, body string) *httptest.ResponseRecorder {
+	r, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+type validationProblem struct {
+	Status   int                      `json:"status"`
+	Instance string                   `json:"instance"`
+	Errors   openapi.ValidationErrors `json:"errors"`
+}
+
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) *validationProblem {
+	assert.Equal(t, "application/problem+json; charset=utf-8", w.Header().Get("Content-Type"))
+	p := &validationProblem{}
+	require.Nil(t, json.Unmarshal(w.Body.Bytes(), p))
+	return p
+}
+
+func TestValidRequests(t *testing.T) {
+	handler := newHandler(t)
+
+	w := serve(handler, "GET", "/v1/trees?limit=10", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]", w.Body.String())
+
+	w = serve(handler, "POST", "/v1/trees", "application/json", `{"name":"oak"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `{"name":"oak"}`, w.Body.String())
+
+	w = serve(handler, "GET", "/v1/trees/1", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve(handler, "GET", "/v1/other", "", "")
+	assert.Equal(t, "other", w.Body.String())
+}
+
+func TestInvalidRequests(t *testing.T) {
+	handler := newHandler(t)
+
+	w := serve(handler, "GET", "/v1/trees?limit=1000", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	p := decodeProblem(t, w)
+	assert.Equal(t, http.StatusBadRequest, p.Status)
+	assert.Equal(t, "/v1/trees", p.Instance)
+	require.Len(t, p.Errors, 1)
+	assert.Equal(t, "query/limit", p.Errors[0].Field)
+
+	w = serve(handler, "GET", "/v1/trees/oak", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "path/id", decodeProblem(t, w).Errors[0].Field)
+
+	w = serve(handler, "POST", "/v1/trees", "application/json", `{"name":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "body/name", decodeProblem(t, w).Errors[0].Field)
+
+	w = serve(handler, "POST", "/v1/trees", "application/json", `{"name":`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve(handler, "POST", "/v1/trees", "", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "body", decodeProblem(t, w).Errors[0].Field)
+
+	w = serve(handler, "POST", "/v1/trees", "text/plain", "oak")
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+
+	w = serve(handler, "DELETE", "/v1/trees", "", "")
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, POST", w.Header().Get("Allow"))
+}
+
+func TestResponseValidation(t *testing.T) {
+	handler := newHandler(t, WithResponseValidation(true))
+
+	w := serve(handler, "GET", "/v1/trees/1", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"name":"oak","height":null}`, w.Body.String())
+
+	w = serve(handler, "GET", "/v1/trees/13", "", "")
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, "response/name", decodeProblem(t, w).Errors[0].Field)
+
+	handler = newHandler(t, WithResponseValidation(false))
+	w = serve(handler, "GET", "/v1/trees/13", "", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
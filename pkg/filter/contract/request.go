@@ -0,0 +1,258 @@
+package contract
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+// validateRequest returns the status of the problem of a request which does
+// not match its operation, 0 if it matches
+func (v *validator) validateRequest(ctx *ctxsvr.Context, item *openapi.PathItem, op *openapi.Operation, pathParams map[string]string) (int, openapi.ValidationErrors) {
+	var errs openapi.ValidationErrors
+	for _, p := range parameters(item, op) {
+		field := p.In + "/" + p.Name
+		raws := v.parameterValues(ctx.Request, p, pathParams)
+		if len(raws) == 0 {
+			if p.Required {
+				errs = append(errs, &openapi.ValidationError{Field: field, Message: "is required"})
+			}
+			continue
+		}
+		value := coerce(v.doc.Components, p.Schema, raws)
+		errs = appendErrors(errs, v.doc.Components.ValidateField(p.Schema, value, field))
+	}
+
+	if op.RequestBody != nil && len(op.RequestBody.Content) > 0 {
+		body, err := v.readBody(ctx.Request)
+		if err != nil {
+			return http.StatusRequestEntityTooLarge, openapi.ValidationErrors{{Field: "body", Message: err.Error()}}
+		}
+		if len(body) == 0 {
+			if op.RequestBody.Required {
+				errs = append(errs, &openapi.ValidationError{Field: "body", Message: "is required"})
+			}
+		} else {
+			mediaType, media := mediaType(op.RequestBody.Content, ctx.Request.Header.Get("Content-Type"))
+			if media == nil {
+				return http.StatusUnsupportedMediaType, openapi.ValidationErrors{{
+					Field:   "header/Content-Type",
+					Message: "must be one of " + strings.Join(mediaTypes(op.RequestBody.Content), ", "),
+				}}
+			}
+			errs = appendErrors(errs, v.validateBody(mediaType, media, body, "body"))
+		}
+	}
+	if len(errs) > 0 {
+		return http.StatusBadRequest, errs
+	}
+	return 0, nil
+}
+
+// parameters returns the parameters of an operation, which override the
+// ones of its path
+func parameters(item *openapi.PathItem, op *openapi.Operation) []*openapi.Parameter {
+	params := append([]*openapi.Parameter{}, op.Parameters...)
+	for _, p := range item.Parameters {
+		overridden := false
+		for _, o := range op.Parameters {
+			if o.Name == p.Name && o.In == p.In {
+				overridden = true
+				break
+			}
+		}
+		if !overridden {
+			params = append(params, p)
+		}
+	}
+	return params
+}
+
+// parameterValues returns the raw values of a parameter in a request
+func (v *validator) parameterValues(r *http.Request, p *openapi.Parameter, pathParams map[string]string) []string {
+	switch p.In {
+	case openapi.InPath:
+		if value, ok := pathParams[p.Name]; ok {
+			return []string{value}
+		}
+	case openapi.InQuery:
+		return r.URL.Query()[p.Name]
+	case openapi.InHeader:
+		return r.Header.Values(p.Name)
+	case openapi.InCookie:
+		if c, err := r.Cookie(p.Name); err == nil {
+			return []string{c.Value}
+		}
+	}
+	return nil
+}
+
+// coerce turns the raw values of a parameter into a value of the type of
+// its schema. Values which can not be converted are left as strings, for
+// the validation to report them.
+func coerce(c *openapi.Components, s *openapi.Schema, raws []string) interface{} {
+	s = c.Resolve(s)
+	if s != nil && s.Type.Has(openapi.TypeArray) {
+		if len(raws) == 1 {
+			raws = strings.Split(raws[0], ",")
+		}
+		values := make([]interface{}, len(raws))
+		for i, raw := range raws {
+			values[i] = coerce(c, s.Items, []string{raw})
+		}
+		return values
+	}
+	raw := raws[0]
+	if s == nil {
+		return raw
+	}
+	switch {
+	case s.Type.Has(openapi.TypeInteger) || s.Type.Has(openapi.TypeNumber):
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case s.Type.Has(openapi.TypeBoolean):
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	case s.Type.Has(openapi.TypeObject):
+		var obj interface{}
+		if err := json.Unmarshal([]byte(raw), &obj); err == nil {
+			return obj
+		}
+	}
+	return raw
+}
+
+// readBody reads the body of a request and puts it back for the handlers
+func (v *validator) readBody(r *http.Request) ([]byte, error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, nil
+	}
+	reader := io.Reader(r.Body)
+	if v.maxBodySize > 0 {
+		reader = io.LimitReader(r.Body, v.maxBodySize+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	r.Body.Close()
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if v.maxBodySize > 0 && int64(len(body)) > v.maxBodySize {
+		return nil, fmt.Errorf("must be at most %d bytes long", v.maxBodySize)
+	}
+	return body, nil
+}
+
+// validateBody validates a JSON or form body, other media types are not
+// checked beyond their type
+func (v *validator) validateBody(mediaType string, media *openapi.MediaType, body []byte, field string) openapi.ValidationErrors {
+	if media.Schema == nil {
+		return nil
+	}
+	var value interface{}
+	switch {
+	case isJSON(mediaType):
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil {
+			return openapi.ValidationErrors{{Field: field, Message: "must be valid JSON: " + err.Error()}}
+		}
+	case mediaType == ctxsvr.ApplicationForm:
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return openapi.ValidationErrors{{Field: field, Message: "must be a valid form: " + err.Error()}}
+		}
+		s := v.doc.Components.Resolve(media.Schema)
+		obj := make(map[string]interface{}, len(form))
+		for name, raws := range form {
+			var prop *openapi.Schema
+			if s != nil {
+				prop = s.Properties[name]
+			}
+			obj[name] = coerce(v.doc.Components, prop, raws)
+		}
+		value = obj
+	default:
+		return nil
+	}
+	return appendErrors(nil, v.doc.Components.ValidateField(media.Schema, value, field))
+}
+
+func appendErrors(errs openapi.ValidationErrors, err error) openapi.ValidationErrors {
+	if more, ok := err.(openapi.ValidationErrors); ok {
+		return append(errs, more...)
+	}
+	if err != nil {
+		return append(errs, &openapi.ValidationError{Message: err.Error()})
+	}
+	return errs
+}
+
+// mediaType returns the media type of a content type among the content of
+// an operation, matching ranges such as application/* as well
+func mediaType(content map[string]*openapi.MediaType, contentType string) (string, *openapi.MediaType) {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = ctxsvr.ApplicationJSON
+		if contentType != "" {
+			return "", nil
+		}
+	}
+	if media, ok := content[mt]; ok {
+		return mt, media
+	}
+	for _, r := range []string{mt[:strings.Index(mt+"/", "/")] + "/*", "*/*"} {
+		if media, ok := content[r]; ok {
+			return mt, media
+		}
+	}
+	return "", nil
+}
+
+func mediaTypes(content map[string]*openapi.MediaType) []string {
+	var types []string
+	for mt := range content {
+		types = append(types, mt)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// isJSON reports whether a media type is JSON, such as application/json or
+// application/vnd.bhojpur+json
+func isJSON(mediaType string) bool {
+	return mediaType == ctxsvr.ApplicationJSON || strings.HasSuffix(mediaType, "+json")
+}
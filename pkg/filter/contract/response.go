@@ -0,0 +1,124 @@
+package contract
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+	"github.com/bhojpur/web/pkg/openapi"
+)
+
+// bufferedWriter holds a response back until it is validated
+type bufferedWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// validateResponse runs the handlers with a buffered response and replaces
+// the response by a problem if it does not match the operation
+func (v *validator) validateResponse(ctx *ctxsvr.Context, op *openapi.Operation, next websvr.FilterFunc) {
+	rw := ctx.ResponseWriter.ResponseWriter
+	buf := &bufferedWriter{ResponseWriter: rw}
+	ctx.ResponseWriter.ResponseWriter = buf
+	defer func() {
+		ctx.ResponseWriter.ResponseWriter = rw
+	}()
+	next(ctx)
+
+	status := buf.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if errs := v.checkResponse(op, status, rw.Header(), buf.body.Bytes()); len(errs) > 0 {
+		logs.Warn("contract: the response of %s %s does not match the API contract: %v",
+			ctx.Request.Method, ctx.Request.URL.Path, errs)
+		rw.Header().Del("Content-Encoding")
+		ctx.ResponseWriter.ResponseWriter = rw
+		ctx.ResponseWriter.Started = false
+		ctx.ResponseWriter.Status = 0
+		ctx.Output.Problem(problem(http.StatusInternalServerError, "the response does not match the API contract", errs))
+		return
+	}
+	rw.WriteHeader(status)
+	rw.Write(buf.body.Bytes())
+}
+
+// checkResponse validates the status and body of a response
+func (v *validator) checkResponse(op *openapi.Operation, status int, header http.Header, body []byte) openapi.ValidationErrors {
+	resp := response(op, status)
+	if resp == nil {
+		return openapi.ValidationErrors{{Field: "status", Message: fmt.Sprintf("%d is not a documented response", status)}}
+	}
+	if len(resp.Content) == 0 || len(body) == 0 || header.Get("Content-Encoding") != "" {
+		return nil
+	}
+	mediaType, media := mediaType(resp.Content, header.Get("Content-Type"))
+	if media == nil {
+		return openapi.ValidationErrors{{
+			Field:   "header/Content-Type",
+			Message: "must be one of " + strings.Join(mediaTypes(resp.Content), ", "),
+		}}
+	}
+	return v.validateBody(mediaType, media, body, "response")
+}
+
+// response returns the response of an operation for a status, following
+// the ranges such as 2XX and the default response
+func response(op *openapi.Operation, status int) *openapi.Response {
+	if resp, ok := op.Responses[strconv.Itoa(status)]; ok {
+		return resp
+	}
+	if resp, ok := op.Responses[strconv.Itoa(status/100)+"XX"]; ok {
+		return resp
+	}
+	return op.Responses["default"]
+}
+
+// problem returns the problem of a request or response not matching the
+// contract, with the errors of the validation as extension
+func problem(status int, detail string, errs openapi.ValidationErrors) *ctxsvr.Problem {
+	p := ctxsvr.NewProblem(status, detail)
+	if len(errs) > 0 {
+		p.Extensions = map[string]interface{}{"errors": errs}
+	}
+	return p
+}
@@ -0,0 +1,433 @@
+package httpcache
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It provides a filter caching full responses in a cache.Cache adapter,
+// so read-heavy routers are served without running the controllers. The
+// responses are keyed by method, host, URL and the request headers they
+// vary on, carry a strong ETag and answer If-None-Match and
+// If-Modified-Since with 304 Not Modified. Stale responses may be served
+// while they are revalidated in the background, and cached responses can be
+// purged by the tags set in the Cache-Tag header, see Purge. The responses
+// to requests carrying credentials, an Authorization or a Cookie header, are
+// neither cached nor served from the cache, unless they are public, set
+// s-maxage or must-revalidate, or their route is shared, see
+// WithSharedRoute.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/client/cache"
+//		websvr "github.com/bhojpur/web/pkg/engine"
+//		"github.com/bhojpur/web/pkg/filter/httpcache"
+//	)
+//
+//	func main(){
+//		store, err := cache.NewCache("memory", `{"interval":60}`)
+//		if err != nil {
+//			panic(err)
+//		}
+//		websvr.InsertFilterChain("/api/*", httpcache.NewFilterChain(store,
+//			httpcache.WithTTL(time.Minute),
+//			httpcache.WithRouteTTL("/api/reports/*", time.Hour),
+//			httpcache.WithStaleWhileRevalidate(30*time.Second)))
+//		websvr.Run()
+//	}
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/web/pkg/client/cache"
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+)
+
+const (
+	// TagHeader is the response header listing the tags of a response,
+	// separated by spaces or commas. It is not sent to the client.
+	TagHeader = "Cache-Tag"
+	// StatusHeader tells whether a response was a HIT, a STALE hit or a
+	// MISS of the cache.
+	StatusHeader = "X-Cache"
+)
+
+// Option configures the response cache
+type Option func(c *ResponseCache)
+
+// WithTTL sets how long responses stay fresh when neither their
+// Cache-Control header nor a route TTL says otherwise, it defaults to one
+// minute.
+func WithTTL(ttl time.Duration) Option {
+	return func(c *ResponseCache) {
+		c.ttl = ttl
+	}
+}
+
+// WithRouteTTL sets how long the responses of the paths matching pattern
+// stay fresh. The pattern follows path.Match, with a trailing /* matching
+// every path below it. A TTL of 0 disables caching of the paths. The first
+// matching pattern wins.
+func WithRouteTTL(pattern string, ttl time.Duration) Option {
+	return func(c *ResponseCache) {
+		c.routes = append(c.routes, routeTTL{pattern: pattern, ttl: ttl})
+	}
+}
+
+// WithSharedRoute lets the responses of the paths matching pattern be cached
+// and served regardless of the credentials of the requests, such as the
+// cookies of pages which are the same for every user. The pattern follows
+// WithRouteTTL.
+func WithSharedRoute(pattern string) Option {
+	return func(c *ResponseCache) {
+		c.sharedRoutes = append(c.sharedRoutes, pattern)
+	}
+}
+
+// WithStaleWhileRevalidate sets how long responses may be served after
+// they went stale while a fresh one is fetched in the background, unless
+// their Cache-Control header sets stale-while-revalidate.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(c *ResponseCache) {
+		c.stale = d
+	}
+}
+
+// WithVary adds request headers every response varies on, in addition to
+// those listed in the Vary header of the responses.
+func WithVary(headers ...string) Option {
+	return func(c *ResponseCache) {
+		for _, h := range headers {
+			c.vary = append(c.vary, http.CanonicalHeaderKey(h))
+		}
+	}
+}
+
+// WithKeyPrefix sets the prefix of the keys in the store, it defaults to
+// "httpcache:".
+func WithKeyPrefix(prefix string) Option {
+	return func(c *ResponseCache) {
+		c.prefix = prefix
+	}
+}
+
+// WithMaxBodySize sets the size of the largest response cached, it
+// defaults to 1MB. Larger responses are streamed to the client as usual.
+func WithMaxBodySize(size int64) Option {
+	return func(c *ResponseCache) {
+		c.maxBodySize = size
+	}
+}
+
+type routeTTL struct {
+	pattern string
+	ttl     time.Duration
+}
+
+// ResponseCache caches the responses of the routers it filters
+type ResponseCache struct {
+	store        cache.Cache
+	ttl          time.Duration
+	stale        time.Duration
+	routes       []routeTTL
+	sharedRoutes []string
+	vary         []string
+	prefix       string
+	maxBodySize  int64
+
+	// mu guards the tag index updates and the revalidations in flight
+	mu           sync.Mutex
+	revalidating map[string]struct{}
+}
+
+// New returns a response cache storing the responses in store. It is
+// purged by the admin command "cache purge" along with the other response
+// caches.
+func New(store cache.Cache, opts ...Option) *ResponseCache {
+	c := &ResponseCache{
+		store:        store,
+		ttl:          time.Minute,
+		prefix:       "httpcache:",
+		maxBodySize:  1 << 20,
+		revalidating: make(map[string]struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	register(c)
+	return c
+}
+
+// NewFilterChain returns a filter chain caching responses in store
+func NewFilterChain(store cache.Cache, opts ...Option) websvr.FilterChain {
+	return New(store, opts...).FilterChain
+}
+
+// FilterChain serves the cached response of a request when there is one and
+// caches the response of the next filter otherwise
+func (c *ResponseCache) FilterChain(next websvr.FilterFunc) websvr.FilterFunc {
+	return func(ctx *ctxsvr.Context) {
+		r := ctx.Request
+		if (r.Method != http.MethodGet && r.Method != http.MethodHead) || bufferless(r) {
+			next(ctx)
+			return
+		}
+		ttl, ok := c.routeTTL(r.URL.Path)
+		if !ok {
+			next(ctx)
+			return
+		}
+		directives := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, ok := directives["no-store"]; ok {
+			next(ctx)
+			return
+		}
+
+		base := c.baseKey(r)
+		if _, ok := directives["no-cache"]; !ok {
+			if e := c.lookup(r, base); e != nil && (!credentials(r) || e.shared() || c.sharedRoute(r.URL.Path)) {
+				age := time.Since(e.Stored)
+				if age < e.TTL {
+					e.serve(ctx, "HIT")
+					return
+				}
+				if age < e.TTL+e.Stale {
+					e.serve(ctx, "STALE")
+					c.revalidate(r, next, base, ttl)
+					return
+				}
+			}
+		}
+		c.fill(ctx, next, base, ttl)
+	}
+}
+
+// routeTTL returns the TTL of the responses of a path and whether they are
+// cached at all
+func (c *ResponseCache) routeTTL(p string) (time.Duration, bool) {
+	for _, route := range c.routes {
+		if matchRoute(route.pattern, p) {
+			return route.ttl, route.ttl > 0
+		}
+	}
+	return c.ttl, c.ttl > 0
+}
+
+// sharedRoute reports whether the responses of a path are shared between
+// the requests carrying credentials
+func (c *ResponseCache) sharedRoute(p string) bool {
+	for _, pattern := range c.sharedRoutes {
+		if matchRoute(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchRoute(pattern, p string) bool {
+	if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(p, strings.TrimSuffix(pattern, "*")) {
+		return true
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// fill runs the next filter with a buffered response, caches the response
+// when it may be and sends it
+func (c *ResponseCache) fill(ctx *ctxsvr.Context, next websvr.FilterFunc, base string, ttl time.Duration) {
+	rw := ctx.ResponseWriter.ResponseWriter
+	buf := &bufferedWriter{ResponseWriter: rw, limit: c.maxBodySize}
+	ctx.ResponseWriter.ResponseWriter = buf
+	defer func() {
+		ctx.ResponseWriter.ResponseWriter = rw
+	}()
+	next(ctx)
+	if buf.passthrough {
+		return
+	}
+
+	status := buf.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if e := c.save(ctx.Request, base, rw.Header(), status, buf.body.Bytes(), ttl); e != nil {
+		rw.Header().Set(StatusHeader, "MISS")
+		if status == http.StatusOK && notModified(ctx.Request, e) {
+			writeNotModified(rw)
+			return
+		}
+	}
+	rw.WriteHeader(status)
+	rw.Write(buf.body.Bytes())
+}
+
+// revalidate fetches a fresh response for a stale entry in the background,
+// once per key at a time
+func (c *ResponseCache) revalidate(r *http.Request, next websvr.FilterFunc, base string, ttl time.Duration) {
+	c.mu.Lock()
+	if _, ok := c.revalidating[base]; ok {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[base] = struct{}{}
+	c.mu.Unlock()
+
+	req := r.Clone(context.Background())
+	req.Header.Del("If-None-Match")
+	req.Header.Del("If-Modified-Since")
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, base)
+			c.mu.Unlock()
+		}()
+		rec := &recorder{header: make(http.Header)}
+		ctx := ctxsvr.NewContext()
+		ctx.Reset(rec, req)
+		next(ctx)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		c.save(req, base, rec.header, rec.status, rec.body.Bytes(), ttl)
+	}()
+}
+
+// baseKey identifies the responses of a request before the headers they
+// vary on are known
+func (c *ResponseCache) baseKey(r *http.Request) string {
+	return c.prefix + r.Method + " " + r.Host + r.URL.RequestURI()
+}
+
+// variantKey identifies the response of a request among those varying on
+// the headers
+func variantKey(base string, vary []string, r *http.Request) string {
+	if len(vary) == 0 {
+		return base
+	}
+	var b strings.Builder
+	b.WriteString(base)
+	for _, h := range vary {
+		b.WriteString("|")
+		b.WriteString(h)
+		b.WriteString("=")
+		b.WriteString(strings.Join(r.Header.Values(h), ","))
+	}
+	return b.String()
+}
+
+// bufferless reports whether the response of a request is streamed, so it
+// must not be held back
+func bufferless(r *http.Request) bool {
+	return r.Header.Get("Upgrade") != "" ||
+		strings.Contains(r.Header.Get("Accept"), ctxsvr.TextEventStream)
+}
+
+// bufferedWriter holds a response back until it is cached, and lets it
+// through once it grows past the limit
+type bufferedWriter struct {
+	http.ResponseWriter
+	status      int
+	body        bytes.Buffer
+	limit       int64
+	passthrough bool
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *bufferedWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(p)
+	}
+	if int64(w.body.Len()+len(p)) <= w.limit {
+		return w.body.Write(p)
+	}
+	w.passthrough = true
+	w.ResponseWriter.WriteHeader(w.status)
+	if _, err := w.ResponseWriter.Write(w.body.Bytes()); err != nil {
+		return 0, err
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// recorder captures the response of a background revalidation
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recorder) Header() http.Header {
+	return w.header
+}
+
+func (w *recorder) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+func (w *recorder) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.body.Write(p)
+}
+
+// parseCacheControl returns the directives of a Cache-Control header
+func parseCacheControl(header string) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.Index(part, "="); i >= 0 {
+			name, value = part[:i], strings.Trim(part[i+1:], `"`)
+		}
+		directives[strings.ToLower(name)] = value
+	}
+	return directives
+}
+
+// seconds returns the duration of a delta-seconds directive
+func seconds(directives map[string]string, name string) (time.Duration, bool) {
+	v, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
@@ -0,0 +1,232 @@
+package httpcache
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/client/cache"
+	"github.com/bhojpur/web/pkg/context"
+	"github.com/bhojpur/web/pkg/core/admin"
+	websvr "github.com/bhojpur/web/pkg/engine"
+)
+
+// newHandler returns routers counting the requests they serve behind a
+// response cache
+func newHandler(calls *int32, opts ...Option) *websvr.ControllerRegister {
+	handler := websvr.NewControllerRegister()
+	handler.Get("/trees", func(ctx *context.Context) {
+		n := atomic.AddInt32(calls, 1)
+		ctx.Output.Header(TagHeader, "trees")
+		ctx.Output.Body([]byte("trees " + strconv.Itoa(int(n))))
+	})
+	handler.Get("/greeting", func(ctx *context.Context) {
+		atomic.AddInt32(calls, 1)
+		ctx.Output.Header("Vary", "Accept-Language")
+		ctx.Output.Body([]byte("hello " + ctx.Request.Header.Get("Accept-Language")))
+	})
+	handler.Get("/private", func(ctx *context.Context) {
+		atomic.AddInt32(calls, 1)
+		ctx.Output.Header("Cache-Control", "private")
+		ctx.Output.Body([]byte("mine"))
+	})
+	handler.Get("/account", func(ctx *context.Context) {
+		atomic.AddInt32(calls, 1)
+		ctx.Output.Body([]byte("account of " + ctx.Request.Header.Get("Authorization")))
+	})
+	handler.Get("/session", func(ctx *context.Context) {
+		atomic.AddInt32(calls, 1)
+		sid, _ := ctx.Request.Cookie("sid")
+		ctx.Output.Body([]byte("session " + sid.Value))
+	})
+	handler.Get("/news", func(ctx *context.Context) {
+		n := atomic.AddInt32(calls, 1)
+		ctx.Output.Header("Cache-Control", "public, max-age=60")
+		ctx.Output.Body([]byte("news " + strconv.Itoa(int(n))))
+	})
+	handler.Get("/live/clock", func(ctx *context.Context) {
+		atomic.AddInt32(calls, 1)
+		ctx.Output.Body([]byte("tick"))
+	})
+	handler.InsertFilterChain("/*", NewFilterChain(cache.NewMemoryCache(), opts...))
+	handler.Init()
+	return handler
+}
+
+func serve(handler http.Handler, path string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	rw := httptest.NewRecorder()
+	handler.ServeHTTP(rw, r)
+	return rw
+}
+
+func TestCacheHit(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls)
+
+	miss := serve(handler, "/trees")
+	assert.Equal(t, http.StatusOK, miss.Code)
+	assert.Equal(t, "MISS", miss.Header().Get(StatusHeader))
+	assert.Empty(t, miss.Header().Get(TagHeader))
+	etag := miss.Header().Get("ETag")
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, etag)
+
+	hit := serve(handler, "/trees")
+	assert.Equal(t, "HIT", hit.Header().Get(StatusHeader))
+	assert.Equal(t, "trees 1", hit.Body.String())
+	assert.Equal(t, etag, hit.Header().Get("ETag"))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+
+	// a request refusing cached responses refreshes the cache
+	assert.Equal(t, "trees 2", serve(handler, "/trees", "Cache-Control", "no-cache").Body.String())
+	assert.Equal(t, "trees 2", serve(handler, "/trees").Body.String())
+}
+
+func TestConditionalRequests(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls)
+
+	first := serve(handler, "/trees")
+	etag := first.Header().Get("ETag")
+
+	rw := serve(handler, "/trees", "If-None-Match", `"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+	assert.Empty(t, rw.Body.String())
+	assert.Equal(t, etag, rw.Header().Get("ETag"))
+
+	rw = serve(handler, "/trees", "If-Modified-Since", first.Header().Get("Last-Modified"))
+	assert.Equal(t, http.StatusNotModified, rw.Code)
+
+	rw = serve(handler, "/trees", "If-Modified-Since", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.Equal(t, http.StatusOK, rw.Code)
+	assert.Equal(t, "trees 1", rw.Body.String())
+}
+
+func TestCacheVaryAndDirectives(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls, WithRouteTTL("/live/*", 0))
+
+	assert.Equal(t, "hello en", serve(handler, "/greeting", "Accept-Language", "en").Body.String())
+	assert.Equal(t, "hello fr", serve(handler, "/greeting", "Accept-Language", "fr").Body.String())
+	assert.Equal(t, "HIT", serve(handler, "/greeting", "Accept-Language", "en").Header().Get(StatusHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	serve(handler, "/private")
+	assert.Empty(t, serve(handler, "/private").Header().Get(StatusHeader))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	serve(handler, "/live/clock")
+	serve(handler, "/live/clock")
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+func TestAuthorizedRequests(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls)
+
+	alice := serve(handler, "/account", "Authorization", "Basic YWxpY2U6YQ==")
+	bob := serve(handler, "/account", "Authorization", "Basic Ym9iOmI=")
+	assert.Equal(t, "account of Basic YWxpY2U6YQ==", alice.Body.String())
+	assert.Equal(t, "account of Basic Ym9iOmI=", bob.Body.String())
+	assert.Empty(t, bob.Header().Get(StatusHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// nor is a response cached for anonymous requests served to them
+	serve(handler, "/trees")
+	rw := serve(handler, "/trees", "Authorization", "Basic Ym9iOmI=")
+	assert.Empty(t, rw.Header().Get(StatusHeader))
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	// unless the response is explicitly public
+	assert.Equal(t, "news 5", serve(handler, "/news", "Authorization", "Basic YWxpY2U6YQ==").Body.String())
+	rw = serve(handler, "/news", "Authorization", "Basic Ym9iOmI=")
+	assert.Equal(t, "HIT", rw.Header().Get(StatusHeader))
+	assert.Equal(t, "news 5", rw.Body.String())
+}
+
+func TestCookieRequests(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls, WithSharedRoute("/trees"))
+
+	alice := serve(handler, "/session", "Cookie", "sid=alice")
+	bob := serve(handler, "/session", "Cookie", "sid=bob")
+	assert.Equal(t, "session alice", alice.Body.String())
+	assert.Equal(t, "session bob", bob.Body.String())
+	assert.Empty(t, bob.Header().Get(StatusHeader))
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+	// the routes opting in are shared between sessions
+	serve(handler, "/trees", "Cookie", "sid=alice")
+	rw := serve(handler, "/trees", "Cookie", "sid=bob")
+	assert.Equal(t, "HIT", rw.Header().Get(StatusHeader))
+	assert.Equal(t, "trees 3", rw.Body.String())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls, WithTTL(20*time.Millisecond), WithStaleWhileRevalidate(time.Minute))
+
+	serve(handler, "/trees")
+	time.Sleep(30 * time.Millisecond)
+
+	rw := serve(handler, "/trees")
+	assert.Equal(t, "STALE", rw.Header().Get(StatusHeader))
+	assert.Equal(t, "trees 1", rw.Body.String())
+
+	// the revalidation runs in the background
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&calls) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+	rw = serve(handler, "/trees")
+	assert.Equal(t, "HIT", rw.Header().Get(StatusHeader))
+	assert.Equal(t, "trees 2", rw.Body.String())
+}
+
+func TestPurgeCommand(t *testing.T) {
+	var calls int32
+	handler := newHandler(&calls)
+
+	serve(handler, "/trees")
+	serve(handler, "/greeting")
+
+	res := admin.GetCommand("cache", "purge").Execute("trees")
+	assert.True(t, res.IsSuccess())
+	// the caches of the other tests are purged too
+	assert.GreaterOrEqual(t, res.Content, 1)
+
+	assert.Equal(t, "MISS", serve(handler, "/trees").Header().Get(StatusHeader))
+	assert.Equal(t, "HIT", serve(handler, "/greeting").Header().Get(StatusHeader))
+
+	assert.Equal(t, 400, admin.GetCommand("cache", "purge").Execute().Status)
+}
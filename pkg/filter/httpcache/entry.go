@@ -0,0 +1,300 @@
+package httpcache
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+)
+
+// cacheableStatus lists the statuses cached by default, see RFC 9110
+// section 15.1
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// sharedDirectives let the responses to requests carrying credentials be
+// stored and served to other requests, see RFC 9111 section 3.5
+var sharedDirectives = []string{"public", "s-maxage", "must-revalidate"}
+
+// uncachedHeaders are not stored with the responses
+var uncachedHeaders = []string{"Connection", "Keep-Alive", "Age", StatusHeader, TagHeader}
+
+// entry is a cached response
+type entry struct {
+	Status int           `json:"status"`
+	Header http.Header   `json:"header"`
+	Body   []byte        `json:"body"`
+	Stored time.Time     `json:"stored"`
+	TTL    time.Duration `json:"ttl"`
+	Stale  time.Duration `json:"stale"`
+	Tags   []string      `json:"tags,omitempty"`
+}
+
+// lookup returns the cached response of a request, fresh or not
+func (c *ResponseCache) lookup(r *http.Request, base string) *entry {
+	var vary []string
+	if !c.get(base+"|vary", &vary) {
+		return nil
+	}
+	var e entry
+	if !c.get(variantKey(base, vary, r), &e) {
+		return nil
+	}
+	return &e
+}
+
+// get decodes the value of key and reports whether there was one
+func (c *ResponseCache) get(key string, v interface{}) bool {
+	val, err := c.store.Get(context.Background(), key)
+	if err != nil || val == nil {
+		return false
+	}
+	var data []byte
+	switch val := val.(type) {
+	case []byte:
+		data = val
+	case string:
+		data = []byte(val)
+	default:
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// put encodes v as the value of key
+func (c *ResponseCache) put(key string, v interface{}, timeout time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.store.Put(context.Background(), key, data, timeout)
+}
+
+// save caches a response when its status and headers allow it, completing
+// its ETag and Last-Modified headers, and returns its entry
+func (c *ResponseCache) save(r *http.Request, base string, header http.Header, status int, body []byte, ttl time.Duration) *entry {
+	tags := splitTags(header.Get(TagHeader))
+	header.Del(TagHeader)
+
+	if !cacheableStatus[status] || header.Get("Set-Cookie") != "" {
+		return nil
+	}
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return nil
+		}
+	}
+	if credentials(r) && !shared(directives) && !c.sharedRoute(r.URL.Path) {
+		return nil
+	}
+	if d, ok := seconds(directives, "s-maxage"); ok {
+		ttl = d
+	} else if d, ok := seconds(directives, "max-age"); ok {
+		ttl = d
+	}
+	stale := c.stale
+	if d, ok := seconds(directives, "stale-while-revalidate"); ok {
+		stale = d
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	vary, ok := c.varyHeaders(header)
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if header.Get("ETag") == "" {
+		header.Set("ETag", strongETag(body))
+	}
+	if header.Get("Last-Modified") == "" {
+		header.Set("Last-Modified", now.UTC().Format(http.TimeFormat))
+	}
+	e := &entry{
+		Status: status,
+		Header: header.Clone(),
+		Body:   body,
+		Stored: now,
+		TTL:    ttl,
+		Stale:  stale,
+		Tags:   tags,
+	}
+	for _, h := range uncachedHeaders {
+		e.Header.Del(h)
+	}
+
+	key := variantKey(base, vary, r)
+	timeout := ttl + stale
+	if err := c.put(key, e, timeout); err != nil {
+		logs.Warn("httpcache: can't cache the response of %s %s: %v", r.Method, r.URL.Path, err)
+		return nil
+	}
+	if err := c.put(base+"|vary", vary, timeout); err != nil {
+		logs.Warn("httpcache: can't cache the response of %s %s: %v", r.Method, r.URL.Path, err)
+		return nil
+	}
+	c.tag(key, tags)
+	return e
+}
+
+// varyHeaders returns the request headers a response varies on, and false
+// when it varies on everything
+func (c *ResponseCache) varyHeaders(header http.Header) ([]string, bool) {
+	vary := append([]string(nil), c.vary...)
+	for _, v := range header.Values("Vary") {
+		for _, h := range strings.Split(v, ",") {
+			h = strings.TrimSpace(h)
+			if h == "*" {
+				return nil, false
+			}
+			if h != "" {
+				vary = append(vary, http.CanonicalHeaderKey(h))
+			}
+		}
+	}
+	// a compressed body only suits the clients accepting its encoding
+	if header.Get("Content-Encoding") != "" {
+		vary = append(vary, "Accept-Encoding")
+	}
+	sort.Strings(vary)
+	unique := vary[:0]
+	for i, h := range vary {
+		if i == 0 || h != vary[i-1] {
+			unique = append(unique, h)
+		}
+	}
+	return unique, true
+}
+
+// credentials reports whether a request identifies its user, so that its
+// response is private unless told otherwise
+func credentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("Cookie") != ""
+}
+
+// shared reports whether the response may be served to requests carrying
+// credentials
+func (e *entry) shared() bool {
+	return shared(parseCacheControl(e.Header.Get("Cache-Control")))
+}
+
+func shared(directives map[string]string) bool {
+	for _, d := range sharedDirectives {
+		if _, ok := directives[d]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// serve sends a cached response, or 304 Not Modified when the client holds
+// it already
+func (e *entry) serve(ctx *ctxsvr.Context, state string) {
+	header := ctx.ResponseWriter.Header()
+	for k, v := range e.Header {
+		header[k] = append([]string(nil), v...)
+	}
+	header.Set("Age", strconv.Itoa(int(time.Since(e.Stored)/time.Second)))
+	header.Set(StatusHeader, state)
+	if e.Status == http.StatusOK && notModified(ctx.Request, e) {
+		writeNotModified(ctx.ResponseWriter)
+		return
+	}
+	ctx.ResponseWriter.WriteHeader(e.Status)
+	if ctx.Request.Method != http.MethodHead {
+		ctx.ResponseWriter.Write(e.Body)
+	}
+}
+
+// notModified evaluates the conditional headers of a request against a
+// cached response, see RFC 9110 section 13.2.2
+func notModified(r *http.Request, e *entry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		return etagMatch(inm, e.Header.Get("ETag"))
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		modified, err := http.ParseTime(e.Header.Get("Last-Modified"))
+		if err != nil {
+			return false
+		}
+		return !modified.After(since)
+	}
+	return false
+}
+
+// etagMatch compares the entity tags of If-None-Match with etag, weakly
+func etagMatch(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range strings.Split(list, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	header := w.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// strongETag returns an entity tag derived from the body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+func splitTags(header string) []string {
+	return strings.FieldsFunc(header, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+}
@@ -0,0 +1,149 @@
+package httpcache
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bhojpur/web/pkg/core/admin"
+)
+
+// tagIndexTTL is how long the keys of a tag are remembered after the last
+// response tagged with it was cached
+const tagIndexTTL = 24 * time.Hour
+
+// tag adds key to the index of each tag
+func (c *ResponseCache) tag(key string, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, t := range tags {
+		var keys []string
+		c.get(c.tagKey(t), &keys)
+		if !containsString(keys, key) {
+			keys = append(keys, key)
+		}
+		c.put(c.tagKey(t), keys, tagIndexTTL)
+	}
+}
+
+func (c *ResponseCache) tagKey(tag string) string {
+	return c.prefix + "tag|" + tag
+}
+
+// Purge removes the cached responses tagged with any of tags and returns
+// how many were removed
+func (c *ResponseCache) Purge(ctx context.Context, tags ...string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	purged := 0
+	for _, t := range tags {
+		var keys []string
+		if !c.get(c.tagKey(t), &keys) {
+			continue
+		}
+		for _, key := range keys {
+			if ok, _ := c.store.IsExist(ctx, key); !ok {
+				continue
+			}
+			if err := c.store.Delete(ctx, key); err != nil {
+				return purged, err
+			}
+			purged++
+		}
+		if err := c.store.Delete(ctx, c.tagKey(t)); err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cachesLock sync.Mutex
+	caches     []*ResponseCache
+)
+
+func register(c *ResponseCache) {
+	cachesLock.Lock()
+	defer cachesLock.Unlock()
+	caches = append(caches, c)
+}
+
+// purgeCommand purges the responses tagged with the tags passed as
+// parameters from every response cache
+type purgeCommand struct {
+}
+
+func (p *purgeCommand) Execute(params ...interface{}) *admin.Result {
+	tags := make([]string, 0, len(params))
+	for _, param := range params {
+		tag, ok := param.(string)
+		if !ok || tag == "" {
+			return &admin.Result{
+				Status: 400,
+				Error:  errors.New("parameter is invalid"),
+			}
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		return &admin.Result{
+			Status: 400,
+			Error:  errors.New("tag not passed"),
+		}
+	}
+
+	cachesLock.Lock()
+	defer cachesLock.Unlock()
+	purged := 0
+	for _, c := range caches {
+		n, err := c.Purge(context.Background(), tags...)
+		purged += n
+		if err != nil {
+			return &admin.Result{
+				Status: 500,
+				Error:  err,
+			}
+		}
+	}
+	return &admin.Result{
+		Status:  200,
+		Content: purged,
+	}
+}
+
+func init() {
+	admin.RegisterCommand("cache", "purge", &purgeCommand{})
+}
@@ -25,6 +25,12 @@ package grace
 
 // Grace is used to hot reload
 //
+// On SIGHUP, a server starts a new process of the program, which inherits
+// its listeners and terminates the old process. On SIGUSR2, the old process
+// hands off instead: it stops accepting connections and waits for SIGTERM
+// once the new process is ready, or for SIGUSR1 to terminate the new process
+// and accept connections again.
+//
 // Usage:
 //
 // import(
@@ -76,6 +82,9 @@ const (
 	StateTerminate
 )
 
+// handoffEnv marks a process started by a handoff
+const handoffEnv = "BHOJPUR_GRACE_HANDOFF"
+
 var (
 	regLock              *sync.Mutex
 	runningServers       map[string]*Server
@@ -92,8 +101,17 @@ var (
 	// DefaultTimeout is the shutdown server's timeout. default is 60s
 	DefaultTimeout = 60 * time.Second
 
+	// PIDFile is the file the process ID is written to when a server
+	// starts listening, and by the process which takes over on restarts
+	PIDFile string
+
 	isChild     bool
 	socketOrder string
+	// isHandoff is set in a process started by a handoff, which must not
+	// terminate its parent
+	isHandoff      bool
+	handoffProcess *os.Process
+	handoffAborted bool
 
 	hookableSignals []os.Signal
 )
@@ -102,6 +120,9 @@ func init() {
 	flag.BoolVar(&isChild, "graceful", false, "listen on open fd (after forking)")
 	flag.StringVar(&socketOrder, "socketorder", "", "previous initialization order - used when more than one listener was started")
 
+	isHandoff = os.Getenv(handoffEnv) != ""
+	os.Unsetenv(handoffEnv)
+
 	regLock = &sync.Mutex{}
 	runningServers = make(map[string]*Server)
 	runningServersOrder = []string{}
@@ -111,6 +132,8 @@ func init() {
 		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
+		abortHandoffSignal,
+		handoffSignal,
 	}
 }
 
@@ -135,14 +158,18 @@ func NewServer(addr string, handler http.Handler) (srv *Server) {
 		isChild: isChild,
 		SignalHooks: map[int]map[os.Signal][]func(){
 			PreSignal: {
-				syscall.SIGHUP:  {},
-				syscall.SIGINT:  {},
-				syscall.SIGTERM: {},
+				syscall.SIGHUP:     {},
+				syscall.SIGINT:     {},
+				syscall.SIGTERM:    {},
+				abortHandoffSignal: {},
+				handoffSignal:      {},
 			},
 			PostSignal: {
-				syscall.SIGHUP:  {},
-				syscall.SIGINT:  {},
-				syscall.SIGTERM: {},
+				syscall.SIGHUP:     {},
+				syscall.SIGINT:     {},
+				syscall.SIGTERM:    {},
+				abortHandoffSignal: {},
+				handoffSignal:      {},
 			},
 		},
 		state:        StateInit,
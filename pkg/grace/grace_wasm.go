@@ -25,6 +25,14 @@ package grace
 
 import (
 	"net/http"
+	"time"
+)
+
+var (
+	// PIDFile is the file the process ID is written to
+	PIDFile string
+	// DefaultTimeout is the shutdown server's timeout. default is 60s
+	DefaultTimeout = 60 * time.Second
 )
 
 func NewServer(addr string, handler http.Handler) (srv *Server) {
@@ -0,0 +1,102 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package grace
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+var errListenerClosed = errors.New("grace: listener closed")
+
+// pausableListener is a TCP listener which stops accepting connections while
+// paused, leaving them to another process listening on the same socket
+type pausableListener struct {
+	*net.TCPListener
+	mu        sync.Mutex
+	resume    chan struct{} // non-nil while paused
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPausableListener(ln *net.TCPListener) *pausableListener {
+	return &pausableListener{TCPListener: ln, closed: make(chan struct{})}
+}
+
+// Accept accepts TCP connections with keep-alive enabled
+func (ln *pausableListener) Accept() (net.Conn, error) {
+	for {
+		ln.mu.Lock()
+		resume := ln.resume
+		ln.mu.Unlock()
+		if resume != nil {
+			select {
+			case <-resume:
+				continue
+			case <-ln.closed:
+				return nil, errListenerClosed
+			}
+		}
+		tc, err := ln.TCPListener.AcceptTCP()
+		if err != nil {
+			// Pause interrupts a pending accept with a deadline
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				continue
+			}
+			return nil, err
+		}
+		tc.SetKeepAlive(true)
+		tc.SetKeepAlivePeriod(3 * time.Minute)
+		return tc, nil
+	}
+}
+
+// Pause stops accepting connections until Resume is called
+func (ln *pausableListener) Pause() {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	if ln.resume == nil {
+		ln.resume = make(chan struct{})
+		ln.TCPListener.SetDeadline(time.Now())
+	}
+}
+
+// Resume accepts connections again
+func (ln *pausableListener) Resume() {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+	if ln.resume != nil {
+		ln.TCPListener.SetDeadline(time.Time{})
+		close(ln.resume)
+		ln.resume = nil
+	}
+}
+
+// Close closes the listener, even while paused
+func (ln *pausableListener) Close() error {
+	ln.closeOnce.Do(func() { close(ln.closed) })
+	return ln.TCPListener.Close()
+}
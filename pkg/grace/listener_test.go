@@ -0,0 +1,103 @@
+//go:build !js && !wasm
+// +build !js,!wasm
+
+package grace
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPausableListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ln := newPausableListener(l.(*net.TCPListener))
+	defer ln.Close()
+	// another process listening on the same socket
+	f, err := ln.File()
+	assert.Nil(t, err)
+	other, err := net.FileListener(f)
+	assert.Nil(t, err)
+	defer other.Close()
+
+	accepted := make(chan net.Conn, 10)
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- c
+		}
+	}()
+	dial := func() net.Conn {
+		c, err := net.Dial("tcp", l.Addr().String())
+		assert.Nil(t, err)
+		return c
+	}
+
+	c := dial()
+	defer c.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted")
+	}
+
+	// a pending Accept is interrupted, the other listener gets the connections
+	ln.Pause()
+	for i := 0; i < 3; i++ {
+		c := dial()
+		defer c.Close()
+		other.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second))
+		conn, err := other.Accept()
+		assert.Nil(t, err)
+		conn.Close()
+	}
+	assert.Equal(t, 0, len(accepted))
+
+	ln.Resume()
+	c = dial()
+	defer c.Close()
+	select {
+	case conn := <-accepted:
+		conn.Close()
+	case <-time.After(time.Second):
+		t.Fatal("connection not accepted after Resume")
+	}
+
+	// Close stops a paused listener
+	ln.Pause()
+	ln.Close()
+	select {
+	case _, ok := <-accepted:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("Accept not stopped by Close")
+	}
+}
@@ -44,6 +44,7 @@ import (
 type Server struct {
 	*http.Server
 	ln           net.Listener
+	tcp          *pausableListener
 	SignalHooks  map[int]map[os.Signal][]func()
 	sigChan      chan os.Signal
 	isChild      bool
@@ -86,22 +87,15 @@ func (srv *Server) ListenAndServe() (err error) {
 
 	go srv.handleSignals()
 
-	srv.ln, err = srv.getListener(addr)
+	ln, err := srv.getListener(addr)
 	if err != nil {
 		log.Println(err)
 		return err
 	}
+	srv.ln = ln
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		err = process.Signal(syscall.SIGTERM)
-		if err != nil {
-			return err
-		}
+	if err = srv.started(); err != nil {
+		return err
 	}
 
 	log.Println(os.Getpid(), srv.Addr)
@@ -130,10 +124,13 @@ func (srv *Server) ListenAndServeTLS(certFile, keyFile string) (err error) {
 		srv.TLSConfig.NextProtos = []string{"http/1.1"}
 	}
 
-	srv.TLSConfig.Certificates = make([]tls.Certificate, 1)
-	srv.TLSConfig.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
-	if err != nil {
-		return
+	// the certificates may come from TLSConfig.GetCertificate instead
+	if certFile != "" || keyFile != "" || srv.TLSConfig.GetCertificate == nil {
+		srv.TLSConfig.Certificates = make([]tls.Certificate, 1)
+		srv.TLSConfig.Certificates[0], err = tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return
+		}
 	}
 
 	go srv.handleSignals()
@@ -143,18 +140,10 @@ func (srv *Server) ListenAndServeTLS(certFile, keyFile string) (err error) {
 		log.Println(err)
 		return err
 	}
-	srv.ln = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, srv.TLSConfig)
+	srv.ln = tls.NewListener(ln, srv.TLSConfig)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		err = process.Signal(syscall.SIGTERM)
-		if err != nil {
-			return err
-		}
+	if err = srv.started(); err != nil {
+		return err
 	}
 
 	log.Println(os.Getpid(), srv.Addr)
@@ -198,18 +187,10 @@ func (srv *Server) ListenAndServeMutualTLS(certFile, keyFile, trustFile string)
 		log.Println(err)
 		return err
 	}
-	srv.ln = tls.NewListener(tcpKeepAliveListener{ln.(*net.TCPListener)}, srv.TLSConfig)
+	srv.ln = tls.NewListener(ln, srv.TLSConfig)
 
-	if srv.isChild {
-		process, err := os.FindProcess(os.Getppid())
-		if err != nil {
-			log.Println(err)
-			return err
-		}
-		err = process.Signal(syscall.SIGTERM)
-		if err != nil {
-			return err
-		}
+	if err = srv.started(); err != nil {
+		return err
 	}
 
 	log.Println(os.Getpid(), srv.Addr)
@@ -218,7 +199,11 @@ func (srv *Server) ListenAndServeMutualTLS(certFile, keyFile, trustFile string)
 
 // getListener either opens a new socket to listen on, or takes the acceptor socket
 // it got passed when restarted.
-func (srv *Server) getListener(laddr string) (l net.Listener, err error) {
+func (srv *Server) getListener(laddr string) (*pausableListener, error) {
+	var (
+		l   net.Listener
+		err error
+	)
 	if srv.isChild {
 		var ptrOffset uint
 		if len(socketPtrOffsetMap) > 0 {
@@ -229,31 +214,46 @@ func (srv *Server) getListener(laddr string) (l net.Listener, err error) {
 		f := os.NewFile(uintptr(3+ptrOffset), "")
 		l, err = net.FileListener(f)
 		if err != nil {
-			err = fmt.Errorf("net.FileListener error: %v", err)
-			return
+			return nil, fmt.Errorf("net.FileListener error: %v", err)
 		}
 	} else {
 		l, err = net.Listen(srv.Network, laddr)
 		if err != nil {
-			err = fmt.Errorf("net.Listen error: %v", err)
-			return
+			return nil, fmt.Errorf("net.Listen error: %v", err)
 		}
 	}
-	return
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, fmt.Errorf("%s is not a TCP listener", laddr)
+	}
+	srv.tcp = newPausableListener(tl)
+	return srv.tcp, nil
 }
 
-type tcpKeepAliveListener struct {
-	*net.TCPListener
+// started is called once the server listens. It records the process in
+// PIDFile and terminates the parent of a restarted process, unless the
+// parent hands off to this process and waits to be terminated.
+func (srv *Server) started() error {
+	writePIDFile()
+	if !srv.isChild || isHandoff {
+		return nil
+	}
+	process, err := os.FindProcess(os.Getppid())
+	if err != nil {
+		log.Println(err)
+		return err
+	}
+	return process.Signal(syscall.SIGTERM)
 }
 
-func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
-	tc, err := ln.AcceptTCP()
-	if err != nil {
+func writePIDFile() {
+	if PIDFile == "" {
 		return
 	}
-	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
-	return tc, nil
+	if err := ioutil.WriteFile(PIDFile, []byte(fmt.Sprintf("%d\n", os.Getpid())), 0644); err != nil {
+		log.Println("PID file error:", err)
+	}
 }
 
 // handleSignals listens for os Signals and calls any hooked in function that the
@@ -277,6 +277,15 @@ func (srv *Server) handleSignals() {
 			if err != nil {
 				log.Println("Fork err:", err)
 			}
+		case handoffSignal:
+			log.Println(pid, "Received SIGUSR2. handing off to a new process.")
+			err := srv.handoff()
+			if err != nil {
+				log.Println("Handoff err:", err)
+			}
+		case abortHandoffSignal:
+			log.Println(pid, "Received SIGUSR1. aborting the handoff.")
+			abortHandoff()
 		case syscall.SIGINT:
 			log.Println(pid, "Received SIGINT.")
 			srv.shutdown()
@@ -326,10 +335,92 @@ func (srv *Server) fork() (err error) {
 	}
 	runningServersForked = true
 
+	if _, err = srv.startProcess(false); err != nil {
+		log.Fatalf("Restart: Failed to launch, error: %v", err)
+	}
+	return
+}
+
+// handoff starts a new process like fork, but this process stops accepting
+// connections instead of being terminated by the new process. It is meant
+// to be terminated once the new process is ready; if the new process exits
+// first, this process resumes accepting connections.
+func (srv *Server) handoff() error {
+	regLock.Lock()
+	defer regLock.Unlock()
+	if runningServersForked {
+		return nil
+	}
+
+	pauseServers(true)
+	cmd, err := srv.startProcess(true)
+	if err != nil {
+		pauseServers(false)
+		return err
+	}
+	runningServersForked = true
+	handoffProcess = cmd.Process
+	handoffAborted = false
+
+	go func() {
+		err := cmd.Wait()
+		regLock.Lock()
+		defer regLock.Unlock()
+		runningServersForked = false
+		handoffProcess = nil
+		if pauseServers(false) {
+			log.Println(os.Getpid(), "New process exited:", err, "resuming.")
+			writePIDFile()
+		}
+	}()
+	return nil
+}
+
+// abortHandoff terminates the process of a handoff, which lets this process
+// resume accepting connections
+func abortHandoff() {
+	regLock.Lock()
+	defer regLock.Unlock()
+	if handoffProcess == nil || handoffAborted {
+		return
+	}
+	handoffAborted = true
+	p := handoffProcess
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		log.Println("Abort err:", err)
+	}
+	if DefaultTimeout >= 0 {
+		time.AfterFunc(DefaultTimeout, func() { p.Kill() })
+	}
+}
+
+// pauseServers pauses or resumes the running servers, and reports whether
+// any of them is running
+func pauseServers(pause bool) bool {
+	var running bool
+	for _, srv := range runningServers {
+		if srv.tcp == nil || srv.state != StateRunning {
+			continue
+		}
+		running = true
+		if pause {
+			srv.tcp.Pause()
+		} else {
+			srv.tcp.Resume()
+		}
+	}
+	return running
+}
+
+// startProcess starts a new process of the program inheriting the listeners
+func (srv *Server) startProcess(handoff bool) (*exec.Cmd, error) {
 	var files = make([]*os.File, len(runningServers))
 	var orderArgs = make([]string, len(runningServers))
 	for _, srvPtr := range runningServers {
-		f, _ := srvPtr.ln.(*net.TCPListener).File()
+		if srvPtr.tcp == nil {
+			return nil, fmt.Errorf("%s is not listening", srvPtr.Server.Addr)
+		}
+		f, _ := srvPtr.tcp.File()
 		files[socketPtrOffsetMap[srvPtr.Server.Addr]] = f
 		orderArgs[socketPtrOffsetMap[srvPtr.Server.Addr]] = srvPtr.Server.Addr
 	}
@@ -354,12 +445,10 @@ func (srv *Server) fork() (err error) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.ExtraFiles = files
-	err = cmd.Start()
-	if err != nil {
-		log.Fatalf("Restart: Failed to launch, error: %v", err)
+	if handoff {
+		cmd.Env = append(os.Environ(), handoffEnv+"=1")
 	}
-
-	return
+	return cmd, cmd.Start()
 }
 
 // RegisterSignalHook registers a function to be run PreSignal or PostSignal for a given signal.
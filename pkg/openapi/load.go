@@ -0,0 +1,209 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadFile reads an OpenAPI document from a JSON or YAML file
+func LoadFile(filename string) (*Document, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("openapi: %s: %v", filename, err)
+	}
+	return doc, nil
+}
+
+// Load reads an OpenAPI 3.0 or 3.1 document in JSON or YAML. Documents of
+// version 3.0 are upgraded to 3.1: nullable becomes a null type and boolean
+// exclusive bounds become numbers. The parameters, request bodies and
+// responses of operations referring to the components are resolved.
+func Load(data []byte) (*Document, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("neither JSON nor YAML: %v", err)
+		}
+		raw = stringKeys(raw)
+	}
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not a document")
+	}
+	version, _ := m["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("unsupported version %q, OpenAPI 3 is required", version)
+	}
+	if strings.HasPrefix(version, "3.0") {
+		upgrade(m)
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	doc := &Document{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return nil, err
+	}
+	if doc.Components == nil {
+		doc.Components = NewComponents()
+	}
+	if err := doc.resolve(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// stringKeys turns the maps decoded from YAML, whose keys may be numbers
+// such as response codes, into maps with string keys
+func stringKeys(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			v[k] = stringKeys(e)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = stringKeys(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = stringKeys(e)
+		}
+	}
+	return v
+}
+
+// upgrade rewrites the schema keywords of OpenAPI 3.0 which changed in 3.1
+func upgrade(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if nullable, ok := v["nullable"].(bool); ok {
+			delete(v, "nullable")
+			if t, ok := v["type"].(string); ok && nullable {
+				v["type"] = []interface{}{t, TypeNull}
+			}
+		}
+		for keyword, bound := range map[string]string{"exclusiveMinimum": "minimum", "exclusiveMaximum": "maximum"} {
+			if exclusive, ok := v[keyword].(bool); ok {
+				delete(v, keyword)
+				if exclusive {
+					if n, ok := v[bound]; ok {
+						v[keyword] = n
+						delete(v, bound)
+					}
+				}
+			}
+		}
+		for _, e := range v {
+			upgrade(e)
+		}
+	case []interface{}:
+		for _, e := range v {
+			upgrade(e)
+		}
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler, accepting the boolean schemas
+// true, which accepts every value, and false, which accepts none
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	switch strings.TrimSpace(string(data)) {
+	case "true":
+		*s = Schema{}
+		return nil
+	case "false":
+		*s = Schema{Not: &Schema{}}
+		return nil
+	}
+	type schema Schema
+	return json.Unmarshal(data, (*schema)(s))
+}
+
+const componentsPrefix = "#/components/"
+
+// resolve replaces the parameters, request bodies and responses referring
+// to the components by the components
+func (doc *Document) resolve() error {
+	c := doc.Components
+	param := func(p *Parameter) (*Parameter, error) {
+		if p.Ref == "" {
+			return p, nil
+		}
+		if r, ok := c.Parameters[strings.TrimPrefix(p.Ref, componentsPrefix+"parameters/")]; ok && r.Ref == "" {
+			return r, nil
+		}
+		return nil, fmt.Errorf("unresolved reference %s", p.Ref)
+	}
+	for path, item := range doc.Paths {
+		for i, p := range item.Parameters {
+			r, err := param(p)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			item.Parameters[i] = r
+		}
+		for _, op := range []*Operation{item.Get, item.Put, item.Post, item.Delete, item.Options, item.Head, item.Patch, item.Trace} {
+			if op == nil {
+				continue
+			}
+			for i, p := range op.Parameters {
+				r, err := param(p)
+				if err != nil {
+					return fmt.Errorf("%s: %v", path, err)
+				}
+				op.Parameters[i] = r
+			}
+			if body := op.RequestBody; body != nil && body.Ref != "" {
+				r, ok := c.RequestBodies[strings.TrimPrefix(body.Ref, componentsPrefix+"requestBodies/")]
+				if !ok || r.Ref != "" {
+					return fmt.Errorf("%s: unresolved reference %s", path, body.Ref)
+				}
+				op.RequestBody = r
+			}
+			for code, resp := range op.Responses {
+				if resp.Ref == "" {
+					continue
+				}
+				r, ok := c.Responses[strings.TrimPrefix(resp.Ref, componentsPrefix+"responses/")]
+				if !ok || r.Ref != "" {
+					return fmt.Errorf("%s: unresolved reference %s", path, resp.Ref)
+				}
+				op.Responses[code] = r
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const document = `
+openapi: 3.0.3
+info:
+  title: Trees
+  version: 1.0.0
+paths:
+  /trees/{id}:
+    parameters:
+      - $ref: '#/components/parameters/id'
+    get:
+      responses:
+        '200':
+          $ref: '#/components/responses/tree'
+components:
+  parameters:
+    id:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: integer
+        minimum: 1
+        exclusiveMinimum: true
+  responses:
+    tree:
+      description: the tree
+      content:
+        application/json:
+          schema:
+            $ref: '#/components/schemas/Tree'
+  schemas:
+    Tree:
+      type: object
+      required: [name]
+      additionalProperties: false
+      properties:
+        name:
+          type: string
+          pattern: '^[a-z]+$'
+        height:
+          type: number
+          nullable: true
+        planted:
+          type: string
+          format: date
+        tags:
+          type: array
+          uniqueItems: true
+          items:
+            type: string
+`
+
+func TestLoad(t *testing.T) {
+	doc, err := Load([]byte(document))
+	require.Nil(t, err)
+	assert.Equal(t, "Trees", doc.Info.Title)
+
+	item := doc.Paths["/trees/{id}"]
+	require.NotNil(t, item)
+	require.Len(t, item.Parameters, 1)
+	assert.Equal(t, "id", item.Parameters[0].Name)
+	assert.Equal(t, InPath, item.Parameters[0].In)
+	require.NotNil(t, item.Parameters[0].Schema.ExclusiveMinimum)
+	assert.Equal(t, 1.0, *item.Parameters[0].Schema.ExclusiveMinimum)
+	assert.Equal(t, "the tree", item.Get.Responses["200"].Description)
+
+	height := doc.Components.Schemas["Tree"].Properties["height"]
+	assert.True(t, height.Type.Has(TypeNumber))
+	assert.True(t, height.Type.Has(TypeNull))
+
+	data, err := json.Marshal(doc)
+	require.Nil(t, err)
+	_, err = Load(data)
+	assert.Nil(t, err)
+
+	_, err = Load([]byte(`{"swagger":"2.0"}`))
+	assert.NotNil(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	doc, err := Load([]byte(document))
+	require.Nil(t, err)
+	c := doc.Components
+	tree := Ref("Tree")
+
+	decode := func(s string) interface{} {
+		var v interface{}
+		dec := json.NewDecoder(strings.NewReader(s))
+		dec.UseNumber()
+		require.Nil(t, dec.Decode(&v))
+		return v
+	}
+
+	assert.Nil(t, c.Validate(tree, decode(`{"name":"oak","height":null,"planted":"2021-03-01","tags":["a","b"]}`)))
+	assert.Nil(t, c.Validate(tree, decode(`{"name":"oak","height":3.5}`)))
+
+	tests := map[string]string{
+		`{}`:                                    "/name",
+		`{"name":"Oak"}`:                        "/name",
+		`{"name":"oak","height":"high"}`:        "/height",
+		`{"name":"oak","planted":"03/01/2021"}`: "/planted",
+		`{"name":"oak","tags":["a","a"]}`:       "/tags",
+		`{"name":"oak","age":3}`:                "/age",
+		`[]`:                                    "",
+	}
+	for value, field := range tests {
+		err := c.Validate(tree, decode(value))
+		require.NotNil(t, err, value)
+		errs, ok := err.(ValidationErrors)
+		require.True(t, ok, value)
+		assert.Equal(t, field, errs[0].Field, value)
+	}
+
+	id := doc.Paths["/trees/{id}"].Parameters[0].Schema
+	assert.Nil(t, c.ValidateField(id, json.Number("2"), "path/id"))
+	err = c.ValidateField(id, json.Number("1"), "path/id")
+	require.NotNil(t, err)
+	assert.Equal(t, "path/id", err.(ValidationErrors)[0].Field)
+}
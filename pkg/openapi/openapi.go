@@ -0,0 +1,326 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements the OpenAPI 3.1 document model, with a generator of JSON
+// schemas for Go types. The web engine uses it to describe its routers at
+// runtime, but documents may be built by hand as well.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/openapi"
+//	)
+//
+//	doc := openapi.New(openapi.Info{Title: "Orders", Version: "1.0.0"})
+//	doc.AddOperation("/orders/{id}", http.MethodGet, &openapi.Operation{
+//		Responses: map[string]*openapi.Response{
+//			"200": doc.Components.JSONResponse("OK", reflect.TypeOf(Order{})),
+//		},
+//	})
+//	json.NewEncoder(w).Encode(doc)
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// Version is the version of the OpenAPI specification of documents
+const Version = "3.1.0"
+
+// Document is the root object of an OpenAPI document
+type Document struct {
+	OpenAPI      string                `json:"openapi" yaml:"openapi"`
+	Info         Info                  `json:"info" yaml:"info"`
+	Servers      []*Server             `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Paths        map[string]*PathItem  `json:"paths,omitempty" yaml:"paths,omitempty"`
+	Webhooks     map[string]*PathItem  `json:"webhooks,omitempty" yaml:"webhooks,omitempty"`
+	Components   *Components           `json:"components,omitempty" yaml:"components,omitempty"`
+	Security     []SecurityRequirement `json:"security,omitempty" yaml:"security,omitempty"`
+	Tags         []*Tag                `json:"tags,omitempty" yaml:"tags,omitempty"`
+	ExternalDocs *ExternalDocs         `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
+}
+
+// Info provides metadata about the API
+type Info struct {
+	Title          string   `json:"title" yaml:"title"`
+	Summary        string   `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description    string   `json:"description,omitempty" yaml:"description,omitempty"`
+	TermsOfService string   `json:"termsOfService,omitempty" yaml:"termsOfService,omitempty"`
+	Contact        *Contact `json:"contact,omitempty" yaml:"contact,omitempty"`
+	License        *License `json:"license,omitempty" yaml:"license,omitempty"`
+	Version        string   `json:"version" yaml:"version"`
+}
+
+// Contact information for the exposed API
+type Contact struct {
+	Name  string `json:"name,omitempty" yaml:"name,omitempty"`
+	URL   string `json:"url,omitempty" yaml:"url,omitempty"`
+	Email string `json:"email,omitempty" yaml:"email,omitempty"`
+}
+
+// License information for the exposed API, Identifier is an SPDX license
+// expression
+type License struct {
+	Name       string `json:"name" yaml:"name"`
+	Identifier string `json:"identifier,omitempty" yaml:"identifier,omitempty"`
+	URL        string `json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+// Server is a server of the API, its URL may contain {variables}
+type Server struct {
+	URL         string                     `json:"url" yaml:"url"`
+	Description string                     `json:"description,omitempty" yaml:"description,omitempty"`
+	Variables   map[string]*ServerVariable `json:"variables,omitempty" yaml:"variables,omitempty"`
+}
+
+// ServerVariable is a variable of a server URL
+type ServerVariable struct {
+	Enum        []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Default     string   `json:"default" yaml:"default"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// PathItem describes the operations available on a single path
+type PathItem struct {
+	Ref         string       `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Summary     string       `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string       `json:"description,omitempty" yaml:"description,omitempty"`
+	Get         *Operation   `json:"get,omitempty" yaml:"get,omitempty"`
+	Put         *Operation   `json:"put,omitempty" yaml:"put,omitempty"`
+	Post        *Operation   `json:"post,omitempty" yaml:"post,omitempty"`
+	Delete      *Operation   `json:"delete,omitempty" yaml:"delete,omitempty"`
+	Options     *Operation   `json:"options,omitempty" yaml:"options,omitempty"`
+	Head        *Operation   `json:"head,omitempty" yaml:"head,omitempty"`
+	Patch       *Operation   `json:"patch,omitempty" yaml:"patch,omitempty"`
+	Trace       *Operation   `json:"trace,omitempty" yaml:"trace,omitempty"`
+	Servers     []*Server    `json:"servers,omitempty" yaml:"servers,omitempty"`
+	Parameters  []*Parameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+}
+
+// Operation returns the operation of an HTTP method, nil if there is none
+// or the method is not supported by OpenAPI
+func (p *PathItem) Operation(method string) *Operation {
+	if op := p.operation(method); op != nil {
+		return *op
+	}
+	return nil
+}
+
+// SetOperation sets the operation of an HTTP method. It returns false if the
+// method is not supported by OpenAPI, such as CONNECT.
+func (p *PathItem) SetOperation(method string, op *Operation) bool {
+	if ref := p.operation(method); ref != nil {
+		*ref = op
+		return true
+	}
+	return false
+}
+
+func (p *PathItem) operation(method string) **Operation {
+	switch strings.ToUpper(method) {
+	case http.MethodGet:
+		return &p.Get
+	case http.MethodPut:
+		return &p.Put
+	case http.MethodPost:
+		return &p.Post
+	case http.MethodDelete:
+		return &p.Delete
+	case http.MethodOptions:
+		return &p.Options
+	case http.MethodHead:
+		return &p.Head
+	case http.MethodPatch:
+		return &p.Patch
+	case http.MethodTrace:
+		return &p.Trace
+	}
+	return nil
+}
+
+// Operation describes a single API operation on a path
+type Operation struct {
+	Tags         []string              `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Summary      string                `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description  string                `json:"description,omitempty" yaml:"description,omitempty"`
+	ExternalDocs *ExternalDocs         `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
+	OperationID  string                `json:"operationId,omitempty" yaml:"operationId,omitempty"`
+	Parameters   []*Parameter          `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody  *RequestBody          `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses    map[string]*Response  `json:"responses,omitempty" yaml:"responses,omitempty"`
+	Deprecated   bool                  `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Security     []SecurityRequirement `json:"security,omitempty" yaml:"security,omitempty"`
+	Servers      []*Server             `json:"servers,omitempty" yaml:"servers,omitempty"`
+}
+
+// Parameter locations
+const (
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+	InCookie = "cookie"
+)
+
+// Parameter describes a single operation parameter
+type Parameter struct {
+	Ref             string      `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Name            string      `json:"name,omitempty" yaml:"name,omitempty"`
+	In              string      `json:"in,omitempty" yaml:"in,omitempty"`
+	Description     string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Required        bool        `json:"required,omitempty" yaml:"required,omitempty"`
+	Deprecated      bool        `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	AllowEmptyValue bool        `json:"allowEmptyValue,omitempty" yaml:"allowEmptyValue,omitempty"`
+	Style           string      `json:"style,omitempty" yaml:"style,omitempty"`
+	Explode         *bool       `json:"explode,omitempty" yaml:"explode,omitempty"`
+	Schema          *Schema     `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Example         interface{} `json:"example,omitempty" yaml:"example,omitempty"`
+}
+
+// RequestBody describes a request body by media type
+type RequestBody struct {
+	Ref         string                `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Description string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+	Required    bool                  `json:"required,omitempty" yaml:"required,omitempty"`
+}
+
+// MediaType describes the content of a media type
+type MediaType struct {
+	Schema  *Schema     `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Example interface{} `json:"example,omitempty" yaml:"example,omitempty"`
+}
+
+// Response describes a single response of an operation
+type Response struct {
+	Ref         string                `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Description string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Headers     map[string]*Header    `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// Header describes a response header
+type Header struct {
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Deprecated  bool    `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	Schema      *Schema `json:"schema,omitempty" yaml:"schema,omitempty"`
+}
+
+// Components holds the reusable objects of a document
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty" yaml:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty" yaml:"responses,omitempty"`
+	Parameters      map[string]*Parameter      `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBodies   map[string]*RequestBody    `json:"requestBodies,omitempty" yaml:"requestBodies,omitempty"`
+	Headers         map[string]*Header         `json:"headers,omitempty" yaml:"headers,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty" yaml:"securitySchemes,omitempty"`
+
+	// names are the names of the Go types in Schemas
+	names map[reflect.Type]string
+}
+
+// SecurityScheme defines a security scheme used by operations
+type SecurityScheme struct {
+	// Type is one of apiKey, http, mutualTLS, oauth2 and openIdConnect
+	Type             string      `json:"type" yaml:"type"`
+	Description      string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Name             string      `json:"name,omitempty" yaml:"name,omitempty"`
+	In               string      `json:"in,omitempty" yaml:"in,omitempty"`
+	Scheme           string      `json:"scheme,omitempty" yaml:"scheme,omitempty"`
+	BearerFormat     string      `json:"bearerFormat,omitempty" yaml:"bearerFormat,omitempty"`
+	Flows            *OAuthFlows `json:"flows,omitempty" yaml:"flows,omitempty"`
+	OpenIDConnectURL string      `json:"openIdConnectUrl,omitempty" yaml:"openIdConnectUrl,omitempty"`
+}
+
+// OAuthFlows configures the supported OAuth flows
+type OAuthFlows struct {
+	Implicit          *OAuthFlow `json:"implicit,omitempty" yaml:"implicit,omitempty"`
+	Password          *OAuthFlow `json:"password,omitempty" yaml:"password,omitempty"`
+	ClientCredentials *OAuthFlow `json:"clientCredentials,omitempty" yaml:"clientCredentials,omitempty"`
+	AuthorizationCode *OAuthFlow `json:"authorizationCode,omitempty" yaml:"authorizationCode,omitempty"`
+}
+
+// OAuthFlow configures an OAuth flow
+type OAuthFlow struct {
+	AuthorizationURL string            `json:"authorizationUrl,omitempty" yaml:"authorizationUrl,omitempty"`
+	TokenURL         string            `json:"tokenUrl,omitempty" yaml:"tokenUrl,omitempty"`
+	RefreshURL       string            `json:"refreshUrl,omitempty" yaml:"refreshUrl,omitempty"`
+	Scopes           map[string]string `json:"scopes" yaml:"scopes"`
+}
+
+// SecurityRequirement maps the names of security schemes to the scopes
+// required by an operation
+type SecurityRequirement map[string][]string
+
+// Tag adds metadata to a tag used by operations
+type Tag struct {
+	Name         string        `json:"name" yaml:"name"`
+	Description  string        `json:"description,omitempty" yaml:"description,omitempty"`
+	ExternalDocs *ExternalDocs `json:"externalDocs,omitempty" yaml:"externalDocs,omitempty"`
+}
+
+// ExternalDocs refers to external documentation
+type ExternalDocs struct {
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	URL         string `json:"url" yaml:"url"`
+}
+
+// New returns an empty document
+func New(info Info) *Document {
+	return &Document{
+		OpenAPI:    Version,
+		Info:       info,
+		Paths:      make(map[string]*PathItem),
+		Components: NewComponents(),
+	}
+}
+
+// NewComponents returns empty components
+func NewComponents() *Components {
+	return &Components{Schemas: make(map[string]*Schema)}
+}
+
+// AddOperation adds the operation of an HTTP method to a path, replacing an
+// operation of the same method. It returns false if the method is not
+// supported by OpenAPI.
+func (doc *Document) AddOperation(path, method string, op *Operation) bool {
+	if doc.Paths == nil {
+		doc.Paths = make(map[string]*PathItem)
+	}
+	item, ok := doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+	}
+	if !item.SetOperation(method, op) {
+		return false
+	}
+	doc.Paths[path] = item
+	return true
+}
+
+// Operation returns the operation of an HTTP method on a path, nil if there
+// is none
+func (doc *Document) Operation(path, method string) *Operation {
+	if item, ok := doc.Paths[path]; ok {
+		return item.Operation(method)
+	}
+	return nil
+}
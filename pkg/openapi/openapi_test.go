@@ -0,0 +1,98 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+type base struct {
+	ID      uuid.UUID `json:"id"`
+	Created time.Time `json:"created"`
+}
+
+type Tree struct {
+	base
+	Name     string            `json:"name" description:"the name of the tree"`
+	Age      *int              `json:"age"`
+	Height   float64           `json:"height,omitempty"`
+	Count    int64             `json:"count,string"`
+	Children []*Tree           `json:"children,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Data     []byte            `json:"data,omitempty"`
+	Ignored  string            `json:"-"`
+	private  string
+}
+
+func TestSchemaOf(t *testing.T) {
+	c := NewComponents()
+	s := c.SchemaOf(reflect.TypeOf([]Tree{}))
+	assert.Equal(t, Types{TypeArray}, s.Type)
+	assert.Equal(t, "#/components/schemas/Tree", s.Items.Ref)
+
+	tree := c.Schemas["Tree"]
+	assert.Equal(t, []string{"id", "created", "name", "age", "count"}, tree.Required)
+	assert.Equal(t, "uuid", tree.Properties["id"].Format)
+	assert.Equal(t, "date-time", tree.Properties["created"].Format)
+	assert.Equal(t, "the name of the tree", tree.Properties["name"].Description)
+	assert.Equal(t, Types{TypeInteger, TypeNull}, tree.Properties["age"].Type)
+	assert.Equal(t, Types{TypeString}, tree.Properties["count"].Type)
+	assert.Equal(t, "#/components/schemas/Tree", tree.Properties["children"].Items.Ref)
+	assert.Equal(t, Types{TypeString}, tree.Properties["labels"].AdditionalProperties.Type)
+	assert.Equal(t, "base64", tree.Properties["data"].ContentEncoding)
+	assert.NotContains(t, tree.Properties, "Ignored")
+	assert.NotContains(t, tree.Properties, "private")
+
+	data, err := json.Marshal(tree.Properties["age"])
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":["integer","null"],"format":"int64"}`, string(data))
+	data, err = json.Marshal(tree.Properties["name"])
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type":"string","description":"the name of the tree"}`, string(data))
+}
+
+func TestDocument(t *testing.T) {
+	doc := New(Info{Title: "Trees", Version: "1.0.0"})
+	assert.True(t, doc.AddOperation("/trees/{id}", http.MethodGet, &Operation{
+		OperationID: "getTree",
+		Parameters:  []*Parameter{{Name: "id", In: InPath, Required: true, Schema: &Schema{Type: Types{TypeString}}}},
+		Responses:   map[string]*Response{"200": doc.Components.JSONResponse("OK", reflect.TypeOf(&Tree{}))},
+	}))
+	assert.False(t, doc.AddOperation("/trees", http.MethodConnect, &Operation{}))
+	assert.Equal(t, "getTree", doc.Operation("/trees/{id}", "get").OperationID)
+	assert.Nil(t, doc.Operation("/trees/{id}", http.MethodPost))
+
+	data, err := json.Marshal(doc)
+	assert.Nil(t, err)
+	var decoded Document
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, "3.1.0", decoded.OpenAPI)
+	assert.Equal(t, Types{TypeObject}, decoded.Components.Schemas["Tree"].Type)
+	assert.Equal(t, "#/components/schemas/Tree",
+		decoded.Operation("/trees/{id}", http.MethodGet).Responses["200"].Content["application/json"].Schema.Ref)
+}
@@ -0,0 +1,350 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema 2020-12 object, as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 Types              `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Title                string             `json:"title,omitempty" yaml:"title,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Default              interface{}        `json:"default,omitempty" yaml:"default,omitempty"`
+	Const                interface{}        `json:"const,omitempty" yaml:"const,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Examples             []interface{}      `json:"examples,omitempty" yaml:"examples,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	UniqueItems          bool               `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MultipleOf           *float64           `json:"multipleOf,omitempty" yaml:"multipleOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty" yaml:"allOf,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
+	Not                  *Schema            `json:"not,omitempty" yaml:"not,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty" yaml:"readOnly,omitempty"`
+	WriteOnly            bool               `json:"writeOnly,omitempty" yaml:"writeOnly,omitempty"`
+	Deprecated           bool               `json:"deprecated,omitempty" yaml:"deprecated,omitempty"`
+	ContentEncoding      string             `json:"contentEncoding,omitempty" yaml:"contentEncoding,omitempty"`
+	ContentMediaType     string             `json:"contentMediaType,omitempty" yaml:"contentMediaType,omitempty"`
+}
+
+// Types are the types of a schema, written as a single string when there
+// is only one
+type Types []string
+
+// MarshalJSON implements json.Marshaler
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = Types{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (t Types) MarshalYAML() (interface{}, error) {
+	if len(t) == 1 {
+		return t[0], nil
+	}
+	return []string(t), nil
+}
+
+// Has reports whether typ is one of the types
+func (t Types) Has(typ string) bool {
+	for _, s := range t {
+		if s == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// JSON types
+const (
+	TypeNull    = "null"
+	TypeBoolean = "boolean"
+	TypeObject  = "object"
+	TypeArray   = "array"
+	TypeNumber  = "number"
+	TypeString  = "string"
+	TypeInteger = "integer"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	rawMessageType    = reflect.TypeOf(json.RawMessage{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// SchemaOf returns the schema of the JSON encoding of a Go type. Named
+// struct types are added to the schemas of the components and referred to.
+func (c *Components) SchemaOf(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: Types{TypeString}, Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: Types{TypeInteger}, Format: "int64"}
+	case t == rawMessageType:
+		return &Schema{}
+	case t.PkgPath() == "github.com/google/uuid" && t.Name() == "UUID":
+		return &Schema{Type: Types{TypeString}, Format: "uuid"}
+	case implements(t, jsonMarshalerType):
+		// the encoding is up to the type
+		return &Schema{}
+	case implements(t, textMarshalerType):
+		return &Schema{Type: Types{TypeString}}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: Types{TypeBoolean}}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: Types{TypeInteger}, Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: Types{TypeInteger}, Format: "int64"}
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: Types{TypeInteger}, Format: "int32", Minimum: float(0)}
+	case reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: Types{TypeInteger}, Format: "int64", Minimum: float(0)}
+	case reflect.Float32:
+		return &Schema{Type: Types{TypeNumber}, Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: Types{TypeNumber}, Format: "double"}
+	case reflect.String:
+		return &Schema{Type: Types{TypeString}}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: Types{TypeString}, ContentEncoding: "base64"}
+		}
+		return &Schema{Type: Types{TypeArray}, Items: c.SchemaOf(t.Elem())}
+	case reflect.Array:
+		n := t.Len()
+		return &Schema{Type: Types{TypeArray}, Items: c.SchemaOf(t.Elem()), MinItems: &n, MaxItems: &n}
+	case reflect.Map:
+		switch t.Key().Kind() {
+		case reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		default:
+			if !implements(t.Key(), textMarshalerType) {
+				return &Schema{}
+			}
+		}
+		return &Schema{Type: Types{TypeObject}, AdditionalProperties: c.SchemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return c.structSchema(t)
+		}
+		return c.ref(t)
+	}
+	// interfaces may hold anything, channels and functions can not be encoded
+	return &Schema{}
+}
+
+// Ref returns a reference to the schema named name
+func Ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// ref adds the schema of a named struct type to the components and refers
+// to it
+func (c *Components) ref(t reflect.Type) *Schema {
+	if name, ok := c.names[t]; ok {
+		return Ref(name)
+	}
+	if c.Schemas == nil {
+		c.Schemas = make(map[string]*Schema)
+	}
+	if c.names == nil {
+		c.names = make(map[reflect.Type]string)
+	}
+	name := schemaName(t.Name())
+	if _, taken := c.Schemas[name]; taken {
+		name = schemaName(path.Base(t.PkgPath()) + "." + t.Name())
+		for i := 2; ; i++ {
+			if _, taken := c.Schemas[name]; !taken {
+				break
+			}
+			name = schemaName(fmt.Sprintf("%s.%s%d", path.Base(t.PkgPath()), t.Name(), i))
+		}
+	}
+	// registered before the properties, which may refer to it
+	c.names[t] = name
+	c.Schemas[name] = &Schema{}
+	*c.Schemas[name] = *c.structSchema(t)
+	return Ref(name)
+}
+
+var invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// schemaName turns a type name, e.g. of a generic type Page[main.User], into
+// a valid component name
+func schemaName(name string) string {
+	return strings.Trim(invalidNameChars.ReplaceAllString(name, "_"), "_")
+}
+
+func (c *Components) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: Types{TypeObject}, Properties: make(map[string]*Schema)}
+	c.addFields(s, t)
+	return s
+}
+
+// addFields adds the fields of a struct type to s the way encoding/json
+// encodes them: embedded structs are inlined and json tags are followed
+func (c *Components) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts := tag, ""
+		if i := strings.Index(tag, ","); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			c.addFields(s, ft)
+			continue
+		}
+		if f.PkgPath != "" {
+			// unexported
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		var prop *Schema
+		if strings.Contains(opts, ",string") && isScalar(ft) {
+			prop = &Schema{Type: Types{TypeString}}
+		} else {
+			prop = c.SchemaOf(f.Type)
+		}
+		omitempty := strings.Contains(opts, ",omitempty")
+		if f.Type.Kind() == reflect.Ptr && !omitempty {
+			prop = nullable(prop)
+		}
+		if desc := f.Tag.Get("description"); desc != "" {
+			if prop.Ref != "" {
+				// siblings of $ref are allowed since OpenAPI 3.1
+				prop = &Schema{Ref: prop.Ref}
+			}
+			prop.Description = desc
+		}
+		s.Properties[name] = prop
+		if !omitempty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// nullable allows null in place of the values of s
+func nullable(s *Schema) *Schema {
+	if len(s.Type) > 0 {
+		if !s.Type.Has(TypeNull) {
+			s.Type = append(s.Type, TypeNull)
+		}
+		return s
+	}
+	if s.Ref != "" {
+		return &Schema{AnyOf: []*Schema{s, {Type: Types{TypeNull}}}}
+	}
+	// an empty schema accepts null already
+	return s
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return true
+	}
+	return false
+}
+
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+func float(f float64) *float64 {
+	return &f
+}
+
+// JSONContent returns the JSON content of a Go type, for requests and
+// responses
+func (c *Components) JSONContent(t reflect.Type) map[string]*MediaType {
+	return map[string]*MediaType{"application/json": {Schema: c.SchemaOf(t)}}
+}
+
+// JSONResponse returns a response with the JSON encoding of a Go type
+func (c *Components) JSONResponse(description string, t reflect.Type) *Response {
+	return &Response{Description: description, Content: c.JSONContent(t)}
+}
+
+// JSONBody returns a required request body with the JSON encoding of a Go
+// type
+func (c *Components) JSONBody(t reflect.Type) *RequestBody {
+	return &RequestBody{Content: c.JSONContent(t), Required: true}
+}
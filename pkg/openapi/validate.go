@@ -0,0 +1,383 @@
+package openapi
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// maxDepth bounds the nesting of schemas referring to themselves
+const maxDepth = 64
+
+// ValidationError is a value not matching a schema
+type ValidationError struct {
+	// Field is the location of the value, e.g. the JSON pointer /items/0 in
+	// a body or the name of a parameter
+	Field   string `json:"field,omitempty" xml:"field,omitempty"`
+	Message string `json:"message" xml:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	if e.Field == "" {
+		return e.Message
+	}
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors are the errors of a validation
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Resolve follows the reference of a schema to the components, it returns
+// nil if the reference is unknown
+func (c *Components) Resolve(s *Schema) *Schema {
+	for i := 0; s != nil && s.Ref != "" && i < maxDepth; i++ {
+		s = c.Schemas[strings.TrimPrefix(s.Ref, componentsPrefix+"schemas/")]
+	}
+	return s
+}
+
+// Validate validates a value decoded from JSON against a schema, numbers
+// may be float64 or json.Number. The error is a ValidationErrors.
+func (c *Components) Validate(s *Schema, value interface{}) error {
+	return c.ValidateField(s, value, "")
+}
+
+// ValidateField validates a value like Validate, reporting errors at the
+// given field
+func (c *Components) ValidateField(s *Schema, value interface{}, field string) error {
+	var errs ValidationErrors
+	c.validate(s, value, field, &errs, 0)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (c *Components) validate(s *Schema, v interface{}, field string, errs *ValidationErrors, depth int) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...interface{}) {
+		*errs = append(*errs, &ValidationError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	if depth > maxDepth {
+		fail("schema nested too deeply")
+		return
+	}
+	if s.Ref != "" {
+		r := c.Resolve(s)
+		if r == nil {
+			fail("unresolved reference %s", s.Ref)
+			return
+		}
+		c.validate(r, v, field, errs, depth+1)
+	}
+	if len(s.Type) > 0 && !hasType(s.Type, v) {
+		fail("must be %s", strings.Join(s.Type, " or "))
+		return
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equal(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", values(s.Enum))
+		}
+	}
+	if s.Const != nil && !equal(s.Const, v) {
+		fail("must be %s", values([]interface{}{s.Const}))
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			if re, err := compilePattern(s.Pattern); err == nil && !re.MatchString(v) {
+				fail("must match %s", s.Pattern)
+			}
+		}
+		if !checkFormat(s.Format, v) {
+			fail("must be a valid %s", s.Format)
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.UniqueItems {
+		unique:
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if equal(v[i], v[j]) {
+						fail("must have unique items")
+						break unique
+					}
+				}
+			}
+		}
+		if s.Items != nil {
+			for i, e := range v {
+				c.validate(s.Items, e, fmt.Sprintf("%s/%d", field, i), errs, depth+1)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, &ValidationError{Field: field + "/" + pointerEscape(name), Message: "is required"})
+			}
+		}
+		for name, e := range v {
+			if p, ok := s.Properties[name]; ok {
+				c.validate(p, e, field+"/"+pointerEscape(name), errs, depth+1)
+			} else if s.AdditionalProperties != nil {
+				c.validate(s.AdditionalProperties, e, field+"/"+pointerEscape(name), errs, depth+1)
+			}
+		}
+	default:
+		if f, ok := number(v); ok {
+			c.validateNumber(s, f, fail)
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		c.validate(sub, v, field, errs, depth+1)
+	}
+	if len(s.AnyOf) > 0 && c.matches(s.AnyOf, v, depth) == 0 {
+		fail("must match any of the schemas")
+	}
+	if len(s.OneOf) > 0 && c.matches(s.OneOf, v, depth) != 1 {
+		fail("must match exactly one of the schemas")
+	}
+	if s.Not != nil && c.matches([]*Schema{s.Not}, v, depth) == 1 {
+		fail("must not match the schema")
+	}
+}
+
+func (c *Components) validateNumber(s *Schema, f float64, fail func(string, ...interface{})) {
+	if s.Minimum != nil && f < *s.Minimum {
+		fail("must be at least %v", *s.Minimum)
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		fail("must be at most %v", *s.Maximum)
+	}
+	if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+		fail("must be greater than %v", *s.ExclusiveMinimum)
+	}
+	if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+		fail("must be less than %v", *s.ExclusiveMaximum)
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		if q := f / *s.MultipleOf; math.Abs(q-math.Round(q)) > 1e-9 {
+			fail("must be a multiple of %v", *s.MultipleOf)
+		}
+	}
+}
+
+// matches returns how many of the schemas accept a value
+func (c *Components) matches(schemas []*Schema, v interface{}, depth int) int {
+	n := 0
+	for _, s := range schemas {
+		var errs ValidationErrors
+		c.validate(s, v, "", &errs, depth+1)
+		if len(errs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func hasType(types Types, v interface{}) bool {
+	for _, t := range types {
+		switch t {
+		case TypeNull:
+			if v == nil {
+				return true
+			}
+		case TypeBoolean:
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case TypeString:
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case TypeArray:
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case TypeObject:
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case TypeNumber:
+			if _, ok := number(v); ok {
+				return true
+			}
+		case TypeInteger:
+			if f, ok := number(v); ok && f == math.Trunc(f) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func number(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+// equal compares values decoded from JSON, numbers by value
+func equal(a, b interface{}) bool {
+	if fa, ok := number(a); ok {
+		fb, ok := number(b)
+		return ok && fa == fb
+	}
+	switch a := a.(type) {
+	case []interface{}:
+		b, ok := b.([]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]interface{}:
+		b, ok := b.(map[string]interface{})
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, e := range a {
+			if !equal(e, b[k]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func values(vs []interface{}) string {
+	s := make([]string, len(vs))
+	for i, v := range vs {
+		data, _ := json.Marshal(v)
+		s[i] = string(data)
+	}
+	return strings.Join(s, ", ")
+}
+
+func pointerEscape(name string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(name, "~", "~0"), "/", "~1")
+}
+
+var patterns sync.Map
+
+// compilePattern compiles the pattern of a schema once. JSON Schema patterns
+// are ECMA 262 regular expressions, which mostly are valid Go ones.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	if re, ok := patterns.Load(pattern); ok {
+		return re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	patterns.Store(pattern, re)
+	return re, nil
+}
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// checkFormat checks the common formats, others are accepted as is
+func checkFormat(format, v string) bool {
+	var err error
+	switch format {
+	case "date-time":
+		_, err = time.Parse(time.RFC3339, v)
+	case "date":
+		_, err = time.Parse("2006-01-02", v)
+	case "time":
+		_, err = time.Parse("15:04:05Z07:00", v)
+	case "email":
+		var addr *mail.Address
+		if addr, err = mail.ParseAddress(v); err == nil && addr.Address != v {
+			return false
+		}
+	case "uuid":
+		return uuidRegexp.MatchString(v)
+	case "uri":
+		var u *url.URL
+		if u, err = url.Parse(v); err == nil && u.Scheme == "" {
+			return false
+		}
+	case "ipv4":
+		ip := net.ParseIP(v)
+		return ip != nil && ip.To4() != nil && !strings.Contains(v, ":")
+	case "ipv6":
+		ip := net.ParseIP(v)
+		return ip != nil && strings.Contains(v, ":")
+	}
+	return err == nil
+}
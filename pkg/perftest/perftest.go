@@ -0,0 +1,358 @@
+package perftest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements an HTTP load generator. In concurrency mode (closed model) a
+// number of workers send requests back to back; in rate mode (open model)
+// requests are started at a fixed rate whether or not earlier ones returned,
+// and their latency is measured from the time they were due, so a stalling
+// server cannot hide its queueing delay. Both modes ramp linearly through
+// stages, record latencies in a histogram and break results down by status.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/perftest"
+//	)
+//
+//	tpl, err := perftest.NewTemplate("GET", "http://localhost:8080/posts/{{rand 1 100}}", nil, "", nil, true)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	res, err := perftest.Run(context.Background(), &perftest.Config{
+//		Mode:     perftest.ModeRate,
+//		Start:    10,
+//		Stages:   []perftest.Stage{{Duration: time.Minute, Target: 200}},
+//		Template: tpl,
+//	})
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	res.WriteText(os.Stdout)
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// ModeConcurrency runs a number of workers sending requests back to back
+	ModeConcurrency = "concurrency"
+	// ModeRate starts requests at a number per second
+	ModeRate = "rate"
+)
+
+// idleWait is how often idle workers check the target again
+const idleWait = 10 * time.Millisecond
+
+// Stage ramps the target linearly to Target over Duration. Targets are
+// workers in concurrency mode and requests per second in rate mode.
+type Stage struct {
+	Duration time.Duration
+	Target   float64
+}
+
+// ParseStage parses a stage written as duration:target, e.g. 30s:100
+func ParseStage(s string) (Stage, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return Stage{}, fmt.Errorf("perftest: stage %q is not duration:target", s)
+	}
+	d, err := time.ParseDuration(parts[0])
+	if err != nil {
+		return Stage{}, fmt.Errorf("perftest: stage %q: %v", s, err)
+	}
+	target, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || target < 0 {
+		return Stage{}, fmt.Errorf("perftest: stage %q: bad target", s)
+	}
+	return Stage{Duration: d, Target: target}, nil
+}
+
+// Config describes a test. The test ends after Duration, or after the
+// stages if Duration is 0, or after MaxRequests, whatever comes first.
+type Config struct {
+	// Mode is ModeConcurrency or ModeRate
+	Mode string
+	// Start is the target before the first stage, and the target of the
+	// whole test if there are no stages
+	Start  float64
+	Stages []Stage
+
+	Duration    time.Duration
+	MaxRequests int64
+	// MaxInFlight caps outstanding requests in rate mode, requests over
+	// the cap are dropped. 0 means 10000.
+	MaxInFlight int
+
+	Template *Template
+	// Client defaults to http.DefaultClient
+	Client *http.Client
+	// Label names the run in exported results
+	Label string
+}
+
+func (c *Config) validate() error {
+	if c.Template == nil {
+		return errors.New("perftest: no request template")
+	}
+	if c.Mode != ModeConcurrency && c.Mode != ModeRate {
+		return fmt.Errorf("perftest: unknown mode %q", c.Mode)
+	}
+	if c.Duration == 0 && c.MaxRequests == 0 && len(c.Stages) == 0 {
+		return errors.New("perftest: test needs a duration, stages or a maximum number of requests")
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	if c.MaxInFlight <= 0 {
+		c.MaxInFlight = 10000
+	}
+	if c.Duration == 0 {
+		for _, s := range c.Stages {
+			c.Duration += s.Duration
+		}
+	}
+	return nil
+}
+
+// target returns the number of workers or the rate after elapsed
+func (c *Config) target(elapsed time.Duration) float64 {
+	from := c.Start
+	for _, s := range c.Stages {
+		if elapsed < s.Duration {
+			return from + (s.Target-from)*float64(elapsed)/float64(s.Duration)
+		}
+		elapsed -= s.Duration
+		from = s.Target
+	}
+	return from
+}
+
+// requests returns how many requests are due in rate mode after elapsed,
+// the integral of the rate
+func (c *Config) requests(elapsed time.Duration) float64 {
+	from, acc := c.Start, 0.0
+	for _, s := range c.Stages {
+		d := s.Duration.Seconds()
+		if elapsed < s.Duration {
+			t := elapsed.Seconds()
+			return acc + from*t + (s.Target-from)*t*t/(2*d)
+		}
+		acc += (from + s.Target) / 2 * d
+		elapsed -= s.Duration
+		from = s.Target
+	}
+	return acc + from*elapsed.Seconds()
+}
+
+// dueTime returns when the n-th request is due in rate mode, searching from
+// the due time of the previous one. It returns false if the rate drops to 0
+// for good before.
+func (c *Config) dueTime(n float64, prev time.Duration) (time.Duration, bool) {
+	var stages time.Duration
+	for _, s := range c.Stages {
+		stages += s.Duration
+	}
+	lo, hi := prev, prev+time.Second
+	for c.requests(hi) < n {
+		if hi > stages && c.target(hi) <= 0 {
+			return 0, false
+		}
+		lo, hi = hi, hi+2*(hi-lo)
+	}
+	for hi-lo > time.Microsecond {
+		mid := lo + (hi-lo)/2
+		if c.requests(mid) < n {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi, true
+}
+
+// peak returns the highest target of the test
+func (c *Config) peak() float64 {
+	peak := c.Start
+	for _, s := range c.Stages {
+		peak = math.Max(peak, s.Target)
+	}
+	return peak
+}
+
+type runner struct {
+	cfg    *Config
+	begin  time.Time
+	seq    int64
+	result *Result
+	lock   sync.Mutex
+}
+
+// Run runs the test and returns its result. Cancelling ctx ends the test
+// early and aborts outstanding requests.
+func Run(ctx context.Context, cfg *Config) (*Result, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	// the schedule ends at the deadline, requests in flight may complete
+	schedCtx := ctx
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		schedCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	r := &runner{cfg: cfg, begin: time.Now(), result: newResult(cfg.Label)}
+	r.result.Started = r.begin
+	if cfg.Mode == ModeRate {
+		r.runRate(ctx, schedCtx)
+	} else {
+		r.runConcurrency(ctx, schedCtx)
+	}
+	r.result.finish(time.Since(r.begin))
+	return r.result, nil
+}
+
+// next returns the next sequence number, or false if the test is over
+func (r *runner) next(schedCtx context.Context) (int64, bool) {
+	if schedCtx.Err() != nil {
+		return 0, false
+	}
+	seq := atomic.AddInt64(&r.seq, 1)
+	if r.cfg.MaxRequests > 0 && seq > r.cfg.MaxRequests {
+		return 0, false
+	}
+	return seq, true
+}
+
+func (r *runner) runConcurrency(ctx, schedCtx context.Context) {
+	workers := int(math.Ceil(r.cfg.peak()))
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for schedCtx.Err() == nil {
+				// workers above the current target sit idle
+				if float64(i) >= r.cfg.target(time.Since(r.begin)) {
+					sleep(schedCtx, idleWait)
+					continue
+				}
+				seq, ok := r.next(schedCtx)
+				if !ok {
+					return
+				}
+				r.do(ctx, seq, time.Now())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func (r *runner) runRate(ctx, schedCtx context.Context) {
+	var wg sync.WaitGroup
+	inFlight := make(chan struct{}, r.cfg.MaxInFlight)
+	var due time.Duration
+	for n := 1; ; n++ {
+		var ok bool
+		if due, ok = r.cfg.dueTime(float64(n), due); !ok {
+			break
+		}
+		if r.cfg.Duration > 0 && due >= r.cfg.Duration {
+			break
+		}
+		// when behind schedule, requests are started right away to catch up
+		if !sleep(schedCtx, time.Until(r.begin.Add(due))) {
+			break
+		}
+		seq, ok := r.next(schedCtx)
+		if !ok {
+			break
+		}
+		select {
+		case inFlight <- struct{}{}:
+		default:
+			r.lock.Lock()
+			r.result.Dropped++
+			r.lock.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(seq int64, due time.Time) {
+			defer wg.Done()
+			r.do(ctx, seq, due)
+			<-inFlight
+		}(seq, r.begin.Add(due))
+	}
+	wg.Wait()
+}
+
+// do sends a request and records its latency since start
+func (r *runner) do(ctx context.Context, seq int64, start time.Time) {
+	req, err := r.cfg.Template.Request(seq)
+	if err != nil {
+		r.record(start, 0, 0, err)
+		return
+	}
+	resp, err := r.cfg.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		if ctx.Err() != nil {
+			// aborted by the caller, not a failure of the server
+			return
+		}
+		r.record(start, 0, 0, err)
+		return
+	}
+	n, err := io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	r.record(start, resp.StatusCode, n, err)
+}
+
+func (r *runner) record(start time.Time, status int, n int64, err error) {
+	latency := time.Since(start)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.result.add(latency, status, n, err)
+}
+
+// sleep waits for d and reports whether ctx is still alive
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
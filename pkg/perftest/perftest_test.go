@@ -0,0 +1,159 @@
+package perftest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram()
+	for i := 1; i <= 10000; i++ {
+		h.Record(time.Duration(i) * time.Microsecond)
+	}
+	assert.Equal(t, uint64(10000), h.Count())
+	assert.Equal(t, time.Microsecond, h.Min())
+	assert.Equal(t, 10*time.Millisecond, h.Max())
+	assert.Equal(t, 1000*time.Microsecond, h.Percentile(10))
+	// above 2048µs buckets are approximate, within 0.1%
+	assert.InDelta(t, 9900, h.Percentile(99).Microseconds(), 10)
+	assert.InDelta(t, 5000, h.Mean().Microseconds(), 1)
+
+	other := NewHistogram()
+	other.Record(time.Second)
+	h.Merge(other)
+	assert.Equal(t, time.Second, h.Percentile(100))
+
+	for _, v := range []int64{0, 1, 2047, 2048, 2049, 4095, 4096, 1 << 30} {
+		idx := bucketIndex(v)
+		assert.True(t, bucketValue(idx) >= v, "value %d", v)
+		if idx > 0 {
+			assert.True(t, bucketValue(idx-1) < v, "value %d", v)
+		}
+	}
+}
+
+func TestStages(t *testing.T) {
+	s, err := ParseStage("30s:100")
+	assert.Nil(t, err)
+	assert.Equal(t, Stage{Duration: 30 * time.Second, Target: 100}, s)
+	_, err = ParseStage("30s")
+	assert.NotNil(t, err)
+
+	cfg := &Config{Start: 10, Stages: []Stage{{10 * time.Second, 20}, {10 * time.Second, 0}}}
+	assert.Equal(t, 10.0, cfg.target(0))
+	assert.Equal(t, 15.0, cfg.target(5*time.Second))
+	assert.Equal(t, 10.0, cfg.target(15*time.Second))
+	assert.Equal(t, 0.0, cfg.target(time.Minute))
+	assert.Equal(t, 20.0, cfg.peak())
+}
+
+func TestTemplate(t *testing.T) {
+	tpl, err := NewTemplate("post", "http://localhost/users/{{.Seq}}?q={{.Vars.term}}",
+		[]string{"X-Request: {{rand 5 5}}", "Host: bhojpur.net"}, `{"id": "{{uuid}}"}`, map[string]string{"term": "go"}, true)
+	assert.Nil(t, err)
+	req, err := tpl.Request(7)
+	assert.Nil(t, err)
+	assert.Equal(t, http.MethodPost, req.Method)
+	assert.Equal(t, "http://localhost/users/7?q=go", req.URL.String())
+	assert.Equal(t, "5", req.Header.Get("X-Request"))
+	assert.Equal(t, "bhojpur.net", req.Host)
+	assert.Equal(t, "gzip", req.Header.Get("Accept-Encoding"))
+	body, _ := ioutil.ReadAll(req.Body)
+	assert.Equal(t, 46, len(body))
+
+	tpl, err = NewTemplate("GET", "http://localhost/{{.Vars.missing}}", nil, "", nil, false)
+	assert.Nil(t, err)
+	_, err = tpl.Request(1)
+	assert.NotNil(t, err)
+	_, err = NewTemplate("GET", "http://localhost", []string{"broken"}, "", nil, false)
+	assert.NotNil(t, err)
+}
+
+func newServer() (*httptest.Server, func() []int64) {
+	var lock sync.Mutex
+	var seqs []int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		seqs = append(seqs, int64(len(seqs)))
+		lock.Unlock()
+		if strings.HasSuffix(r.URL.Path, "/3") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+		w.Write([]byte("hello"))
+	}))
+	return srv, func() []int64 {
+		lock.Lock()
+		defer lock.Unlock()
+		return seqs
+	}
+}
+
+func TestRunConcurrency(t *testing.T) {
+	srv, _ := newServer()
+	defer srv.Close()
+	tpl, _ := NewTemplate("GET", srv.URL+"/{{.Seq}}", nil, "", nil, false)
+
+	res, err := Run(context.Background(), &Config{Mode: ModeConcurrency, Start: 4, MaxRequests: 100, Template: tpl, Label: "v1"})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(100), res.Requests)
+	assert.Equal(t, int64(99), res.Successes)
+	assert.Equal(t, int64(1), res.StatusCodes[http.StatusNotFound])
+	assert.Equal(t, int64(500), res.Bytes)
+	assert.True(t, res.Latency.P99 >= res.Latency.P50)
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, res.WriteCSV(buf, true))
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, 2, len(lines))
+	assert.True(t, strings.HasPrefix(lines[1], "v1,"))
+	assert.True(t, strings.HasSuffix(lines[1], ",200=99 404=1"))
+
+	_, err = Run(context.Background(), &Config{Mode: ModeConcurrency, Start: 1, Template: tpl})
+	assert.NotNil(t, err)
+}
+
+func TestRunRate(t *testing.T) {
+	srv, requests := newServer()
+	defer srv.Close()
+	tpl, _ := NewTemplate("GET", srv.URL+"/{{.Seq}}", nil, "", nil, false)
+
+	// ramps from 0 to 200/s over 500ms: about 50 requests
+	res, err := Run(context.Background(), &Config{
+		Mode:     ModeRate,
+		Stages:   []Stage{{Duration: 500 * time.Millisecond, Target: 200}},
+		Template: tpl,
+	})
+	assert.Nil(t, err)
+	assert.InDelta(t, 50, res.Requests, 10)
+	assert.Equal(t, res.Requests, int64(len(requests())))
+	assert.Equal(t, int64(0), res.Errors)
+}
@@ -0,0 +1,206 @@
+package perftest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxErrorKinds bounds the distinct error messages kept in a result
+const maxErrorKinds = 20
+
+// Latency summarizes the latency histogram in milliseconds
+type Latency struct {
+	Min  float64 `json:"min"`
+	Mean float64 `json:"mean"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	P999 float64 `json:"p99_9"`
+	Max  float64 `json:"max"`
+}
+
+// Result is the outcome of a test. Successes answered below 400, failures
+// with 400 or above, errors did not get an answer.
+type Result struct {
+	Label             string           `json:"label,omitempty"`
+	Started           time.Time        `json:"started"`
+	Duration          time.Duration    `json:"duration"`
+	Requests          int64            `json:"requests"`
+	Successes         int64            `json:"successes"`
+	Failures          int64            `json:"failures"`
+	Errors            int64            `json:"errors"`
+	Dropped           int64            `json:"dropped"`
+	Bytes             int64            `json:"bytes"`
+	RequestsPerSecond float64          `json:"requests_per_second"`
+	StatusCodes       map[int]int64    `json:"status_codes"`
+	ErrorMessages     map[string]int64 `json:"error_messages,omitempty"`
+	Latency           Latency          `json:"latency_ms"`
+
+	histogram *Histogram
+}
+
+func newResult(label string) *Result {
+	return &Result{
+		Label:         label,
+		StatusCodes:   make(map[int]int64),
+		ErrorMessages: make(map[string]int64),
+		histogram:     NewHistogram(),
+	}
+}
+
+func (r *Result) add(latency time.Duration, status int, n int64, err error) {
+	r.Requests++
+	r.Bytes += n
+	if status == 0 {
+		r.Errors++
+		msg := err.Error()
+		if _, ok := r.ErrorMessages[msg]; ok || len(r.ErrorMessages) < maxErrorKinds {
+			r.ErrorMessages[msg]++
+		}
+		return
+	}
+	r.StatusCodes[status]++
+	if status >= 400 {
+		r.Failures++
+	} else {
+		r.Successes++
+	}
+	r.histogram.Record(latency)
+}
+
+func (r *Result) finish(d time.Duration) {
+	r.Duration = d
+	if d > 0 {
+		r.RequestsPerSecond = float64(r.Requests) / d.Seconds()
+	}
+	h := r.histogram
+	r.Latency = Latency{
+		Min:  ms(h.Min()),
+		Mean: ms(h.Mean()),
+		P50:  ms(h.Percentile(50)),
+		P90:  ms(h.Percentile(90)),
+		P99:  ms(h.Percentile(99)),
+		P999: ms(h.Percentile(99.9)),
+		Max:  ms(h.Max()),
+	}
+}
+
+// Histogram returns the latencies of all answered requests
+func (r *Result) Histogram() *Histogram {
+	return r.histogram
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func (r *Result) statuses() []int {
+	codes := make([]int, 0, len(r.StatusCodes))
+	for c := range r.StatusCodes {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	return codes
+}
+
+// WriteText writes a human readable summary
+func (r *Result) WriteText(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Requests: %d\n", r.Requests)
+	fmt.Fprintf(&b, "# Successes: %d\n", r.Successes)
+	fmt.Fprintf(&b, "# Failures: %d\n", r.Failures)
+	fmt.Fprintf(&b, "# Unavailable: %d\n", r.Errors)
+	if r.Dropped > 0 {
+		fmt.Fprintf(&b, "# Dropped: %d\n", r.Dropped)
+	}
+	fmt.Fprintf(&b, "Duration: %v\n", r.Duration.Round(time.Millisecond))
+	fmt.Fprintf(&b, "Requests Per Second: %.2f\n", r.RequestsPerSecond)
+	fmt.Fprintf(&b, "Bytes Received (excluding headers): %d\n", r.Bytes)
+	fmt.Fprintf(&b, "Latency (ms): min %.3f  mean %.3f  p50 %.3f  p90 %.3f  p99 %.3f  p99.9 %.3f  max %.3f\n",
+		r.Latency.Min, r.Latency.Mean, r.Latency.P50, r.Latency.P90, r.Latency.P99, r.Latency.P999, r.Latency.Max)
+	if len(r.StatusCodes) > 0 {
+		b.WriteString("Status Codes:\n")
+		for _, c := range r.statuses() {
+			fmt.Fprintf(&b, "  %d: %d\n", c, r.StatusCodes[c])
+		}
+	}
+	if len(r.ErrorMessages) > 0 {
+		b.WriteString("Errors:\n")
+		for msg, n := range r.ErrorMessages {
+			fmt.Fprintf(&b, "  %d x %s\n", n, msg)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteJSON writes the result as indented JSON
+func (r *Result) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+var csvHeader = []string{
+	"label", "started", "duration_s", "requests", "successes", "failures", "errors", "dropped",
+	"rps", "bytes", "min_ms", "mean_ms", "p50_ms", "p90_ms", "p99_ms", "p99_9_ms", "max_ms", "status_codes",
+}
+
+// WriteCSV writes the result as a CSV row, preceded by the header row if
+// header is set, so that runs can be appended to one file and compared
+func (r *Result) WriteCSV(w io.Writer, header bool) error {
+	cw := csv.NewWriter(w)
+	if header {
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	var codes []string
+	for _, c := range r.statuses() {
+		codes = append(codes, fmt.Sprintf("%d=%d", c, r.StatusCodes[c]))
+	}
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', 3, 64)
+	}
+	i := func(v int64) string {
+		return strconv.FormatInt(v, 10)
+	}
+	if err := cw.Write([]string{
+		r.Label, r.Started.Format(time.RFC3339), f(r.Duration.Seconds()),
+		i(r.Requests), i(r.Successes), i(r.Failures), i(r.Errors), i(r.Dropped),
+		f(r.RequestsPerSecond), i(r.Bytes),
+		f(r.Latency.Min), f(r.Latency.Mean), f(r.Latency.P50), f(r.Latency.P90),
+		f(r.Latency.P99), f(r.Latency.P999), f(r.Latency.Max),
+		strings.Join(codes, " "),
+	}); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,161 @@
+package perftest
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Template builds the requests of a test. URL, header values and body are
+// text/template templates evaluated for every request with
+//
+//	{{.Seq}}           sequence number of the request, starting at 1
+//	{{.Vars.name}}     variables given to NewTemplate
+//	{{rand 1 100}}     random integer in [1, 100]
+//	{{pick "a" "b"}}   random choice
+//	{{uuid}}           random UUID
+//	{{now}}            current Unix time in seconds
+//	{{env "NAME"}}     environment variable
+type Template struct {
+	method  string
+	url     *template.Template
+	headers []header
+	body    *template.Template
+	vars    map[string]string
+	gzip    bool
+}
+
+type header struct {
+	name  string
+	value *template.Template
+}
+
+type templateData struct {
+	Seq  int64
+	Vars map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"rand": func(min, max int) int {
+		if max <= min {
+			return min
+		}
+		return min + rand.Intn(max-min+1)
+	},
+	"pick": func(choices ...string) string {
+		if len(choices) == 0 {
+			return ""
+		}
+		return choices[rand.Intn(len(choices))]
+	},
+	"uuid": func() string {
+		return uuid.New().String()
+	},
+	"now": func() int64 {
+		return time.Now().Unix()
+	},
+	"env": os.Getenv,
+}
+
+// NewTemplate parses a request template. Headers are "Name: value" lines.
+// If gzip is set, the requests accept gzip encoded responses.
+func NewTemplate(method, url string, headers []string, body string, vars map[string]string, gzip bool) (*Template, error) {
+	t := &Template{method: strings.ToUpper(method), vars: vars, gzip: gzip}
+	if t.method == "" {
+		t.method = http.MethodGet
+	}
+	var err error
+	if t.url, err = parseTemplate("url", url); err != nil {
+		return nil, err
+	}
+	for _, h := range headers {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("perftest: invalid header %q", h)
+		}
+		value, err := parseTemplate(parts[0], strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, err
+		}
+		t.headers = append(t.headers, header{name: strings.TrimSpace(parts[0]), value: value})
+	}
+	if body != "" {
+		if t.body, err = parseTemplate("body", body); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func parseTemplate(name, text string) (*template.Template, error) {
+	tpl, err := template.New(name).Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("perftest: %v", err)
+	}
+	return tpl, nil
+}
+
+// Request builds the request with the given sequence number
+func (t *Template) Request(seq int64) (*http.Request, error) {
+	data := &templateData{Seq: seq, Vars: t.vars}
+	buf := &bytes.Buffer{}
+	if err := t.url.Execute(buf, data); err != nil {
+		return nil, err
+	}
+	url := buf.String()
+
+	var body []byte
+	if t.body != nil {
+		buf = &bytes.Buffer{}
+		if err := t.body.Execute(buf, data); err != nil {
+			return nil, err
+		}
+		body = buf.Bytes()
+	}
+	req, err := http.NewRequest(t.method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if t.gzip {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	for _, h := range t.headers {
+		buf = &bytes.Buffer{}
+		if err := h.value.Execute(buf, data); err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(h.name, "Host") {
+			req.Host = buf.String()
+			continue
+		}
+		req.Header.Add(h.name, buf.String())
+	}
+	return req, nil
+}
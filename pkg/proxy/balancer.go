@@ -0,0 +1,113 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"fmt"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+)
+
+// Upstream is a single backend server of a route.
+type Upstream struct {
+	URL    *url.URL
+	proxy  *httputil.ReverseProxy
+	active int64
+	down   int32
+}
+
+func newUpstream(raw string) (*Upstream, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("proxy: upstream %s must be an http or https URL", raw)
+	}
+	return &Upstream{URL: u, proxy: httputil.NewSingleHostReverseProxy(u)}, nil
+}
+
+// Alive reports whether the upstream passed its last health checks.
+func (u *Upstream) Alive() bool {
+	return atomic.LoadInt32(&u.down) == 0
+}
+
+// Active returns the number of in-flight requests sent to the upstream.
+func (u *Upstream) Active() int64 {
+	return atomic.LoadInt64(&u.active)
+}
+
+func (u *Upstream) setAlive(alive bool) {
+	if alive {
+		atomic.StoreInt32(&u.down, 0)
+	} else {
+		atomic.StoreInt32(&u.down, 1)
+	}
+}
+
+// Balancer picks the upstream which serves the next request.
+// Next returns nil when no upstream is alive.
+type Balancer interface {
+	Next(upstreams []*Upstream) *Upstream
+}
+
+// NewBalancer returns the Balancer registered for name
+func NewBalancer(name string) (Balancer, error) {
+	switch name {
+	case "", BalanceRoundRobin:
+		return &roundRobin{}, nil
+	case BalanceLeastConn:
+		return leastConn{}, nil
+	}
+	return nil, fmt.Errorf("proxy: unknown balance %q", name)
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (b *roundRobin) Next(upstreams []*Upstream) *Upstream {
+	n := uint64(len(upstreams))
+	start := atomic.AddUint64(&b.next, 1) - 1
+	for i := uint64(0); i < n; i++ {
+		u := upstreams[(start+i)%n]
+		if u.Alive() {
+			return u
+		}
+	}
+	return nil
+}
+
+type leastConn struct{}
+
+func (leastConn) Next(upstreams []*Upstream) *Upstream {
+	var best *Upstream
+	for _, u := range upstreams {
+		if !u.Alive() {
+			continue
+		}
+		if best == nil || u.Active() < best.Active() {
+			best = u
+		}
+	}
+	return best
+}
@@ -0,0 +1,208 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bhojpur/web/pkg/core/config"
+)
+
+// ConfigSection is the top level key the gateway configuration is read from.
+const ConfigSection = "proxy"
+
+const (
+	// BalanceRoundRobin hands requests to healthy upstreams in turn.
+	BalanceRoundRobin = "round_robin"
+	// BalanceLeastConn hands requests to the healthy upstream with the
+	// fewest in-flight requests.
+	BalanceLeastConn = "least_conn"
+)
+
+// Config is the route table of a reverse proxy gateway.
+//
+// A JSON configuration looks like:
+//
+//	{
+//	  "proxy": {
+//	    "listen": ":80",
+//	    "tls_listen": ":443",
+//	    "routes": [{
+//	      "name": "api",
+//	      "host": "api.bhojpur.net",
+//	      "path_prefix": "/v1",
+//	      "upstreams": ["http://10.0.0.1:8080", "http://10.0.0.2:8080"],
+//	      "balance": "least_conn",
+//	      "health_check": {"path": "/healthcheck", "interval": "10s"},
+//	      "rate_limit": {"rate": "10ms", "capacity": 100, "per_ip": true}
+//	    }]
+//	  }
+//	}
+type Config struct {
+	// Listen is the address of the plain HTTP listener, e.g. ":80"
+	Listen string `mapstructure:"listen" yaml:"listen"`
+	// TLSListen is the address of the TLS listener, e.g. ":443"
+	TLSListen string `mapstructure:"tls_listen" yaml:"tls_listen"`
+	// MuxTimeout bounds the time a new connection has to present its Host/SNI
+	MuxTimeout string         `mapstructure:"mux_timeout" yaml:"mux_timeout"`
+	Routes     []*RouteConfig `mapstructure:"routes" yaml:"routes"`
+}
+
+// RouteConfig maps a host and path prefix to an upstream pool.
+type RouteConfig struct {
+	Name string `mapstructure:"name" yaml:"name"`
+	// Host is matched against the Host header (HTTP) or SNI (TLS). Leading
+	// wildcards like "*.bhojpur.net" are supported. Empty matches any host.
+	Host string `mapstructure:"host" yaml:"host"`
+	// PathPrefix defaults to "/"
+	PathPrefix  string   `mapstructure:"path_prefix" yaml:"path_prefix"`
+	StripPrefix bool     `mapstructure:"strip_prefix" yaml:"strip_prefix"`
+	Upstreams   []string `mapstructure:"upstreams" yaml:"upstreams"`
+	// Balance is round_robin (default) or least_conn
+	Balance     string             `mapstructure:"balance" yaml:"balance"`
+	TLS         *TLSConfig         `mapstructure:"tls" yaml:"tls"`
+	HealthCheck *HealthCheckConfig `mapstructure:"health_check" yaml:"health_check"`
+	RateLimit   *RateLimitConfig   `mapstructure:"rate_limit" yaml:"rate_limit"`
+	CORS        *CORSConfig        `mapstructure:"cors" yaml:"cors"`
+	BasicAuth   *BasicAuthConfig   `mapstructure:"basic_auth" yaml:"basic_auth"`
+}
+
+// TLSConfig holds the certificate served for a route's host.
+type TLSConfig struct {
+	CertFile string `mapstructure:"cert_file" yaml:"cert_file"`
+	KeyFile  string `mapstructure:"key_file" yaml:"key_file"`
+}
+
+// HealthCheckConfig configures active health checking of a route's upstreams.
+type HealthCheckConfig struct {
+	Path     string `mapstructure:"path" yaml:"path"`
+	Interval string `mapstructure:"interval" yaml:"interval"`
+	Timeout  string `mapstructure:"timeout" yaml:"timeout"`
+	// HealthyThreshold is the number of consecutive successes to mark an upstream up
+	HealthyThreshold int `mapstructure:"healthy_threshold" yaml:"healthy_threshold"`
+	// UnhealthyThreshold is the number of consecutive failures to mark an upstream down
+	UnhealthyThreshold int `mapstructure:"unhealthy_threshold" yaml:"unhealthy_threshold"`
+}
+
+// RateLimitConfig configures pkg/filter/ratelimit for a route.
+type RateLimitConfig struct {
+	// Rate is how long it takes to generate a token, e.g. "10ms"
+	Rate     string `mapstructure:"rate" yaml:"rate"`
+	Capacity uint   `mapstructure:"capacity" yaml:"capacity"`
+	// PerIP limits every client address separately instead of the route as a whole
+	PerIP bool `mapstructure:"per_ip" yaml:"per_ip"`
+}
+
+// CORSConfig configures pkg/filter/cors for a route.
+type CORSConfig struct {
+	AllowAllOrigins  bool     `mapstructure:"allow_all_origins" yaml:"allow_all_origins"`
+	AllowOrigins     []string `mapstructure:"allow_origins" yaml:"allow_origins"`
+	AllowCredentials bool     `mapstructure:"allow_credentials" yaml:"allow_credentials"`
+	AllowMethods     []string `mapstructure:"allow_methods" yaml:"allow_methods"`
+	AllowHeaders     []string `mapstructure:"allow_headers" yaml:"allow_headers"`
+	ExposeHeaders    []string `mapstructure:"expose_headers" yaml:"expose_headers"`
+	MaxAge           string   `mapstructure:"max_age" yaml:"max_age"`
+}
+
+// BasicAuthConfig configures pkg/filter/auth for a route.
+type BasicAuthConfig struct {
+	Username string `mapstructure:"username" yaml:"username"`
+	Password string `mapstructure:"password" yaml:"password"`
+	Realm    string `mapstructure:"realm" yaml:"realm"`
+}
+
+// LoadConfig reads the gateway configuration from filename. The config
+// adapter is picked from the file extension, so the matching adapter package
+// (e.g. github.com/bhojpur/web/pkg/core/config/json) must be imported.
+func LoadConfig(filename string) (*Config, error) {
+	adapter := strings.TrimPrefix(filepath.Ext(filename), ".")
+	if adapter == "yml" {
+		adapter = "yaml"
+	}
+	cnf, err := config.NewConfig(adapter, filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(cnf)
+}
+
+// ParseConfig decodes the "proxy" section of cnf and validates it.
+func ParseConfig(cnf config.Configure) (*Config, error) {
+	c := &Config{}
+	if err := cnf.Unmarshaler(ConfigSection, c); err != nil {
+		return nil, err
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Config) validate() error {
+	if c.Listen == "" && c.TLSListen == "" {
+		return errors.New("proxy: one of listen or tls_listen is required")
+	}
+	if len(c.Routes) == 0 {
+		return errors.New("proxy: no routes configured")
+	}
+	if _, err := parseDuration(c.MuxTimeout, 0); err != nil {
+		return fmt.Errorf("proxy: invalid mux_timeout: %v", err)
+	}
+	for i, r := range c.Routes {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("route-%d", i)
+		}
+		if r.PathPrefix == "" {
+			r.PathPrefix = "/"
+		}
+		if !strings.HasPrefix(r.PathPrefix, "/") {
+			return fmt.Errorf("proxy: route %s: path_prefix must start with /", r.Name)
+		}
+		if len(r.Upstreams) == 0 {
+			return fmt.Errorf("proxy: route %s: no upstreams", r.Name)
+		}
+		switch r.Balance {
+		case "":
+			r.Balance = BalanceRoundRobin
+		case BalanceRoundRobin, BalanceLeastConn:
+		default:
+			return fmt.Errorf("proxy: route %s: unknown balance %q", r.Name, r.Balance)
+		}
+		if r.TLS != nil && c.TLSListen == "" {
+			return fmt.Errorf("proxy: route %s: tls configured without tls_listen", r.Name)
+		}
+		if r.TLS != nil && r.Host == "" {
+			return fmt.Errorf("proxy: route %s: tls requires a host for SNI", r.Name)
+		}
+	}
+	return nil
+}
+
+func parseDuration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,343 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements a reverse proxy gateway in front of Bhojpur web applications.
+// Connections are routed by Host header or TLS SNI with the pkg/virtual
+// muxers, requests by host and path prefix to a pool of upstreams, and every
+// route can run engine filters (CORS, rate limiting, basic auth) before the
+// request is forwarded.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/proxy"
+//		_ "github.com/bhojpur/web/pkg/core/config/json"
+//	)
+//
+//	cfg, err := proxy.LoadConfig("conf/proxy.json")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	gw, err := proxy.NewGateway(cfg)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	log.Fatal(gw.ListenAndServe())
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+	"github.com/bhojpur/web/pkg/virtual"
+)
+
+const (
+	defaultMuxTimeout = 5 * time.Second
+	// catchAllHost is the muxer name of routes without a host
+	catchAllHost = "*"
+)
+
+// Gateway is a reverse proxy serving a route table.
+type Gateway struct {
+	cfg        *Config
+	muxTimeout time.Duration
+	routes     []*route
+	pool       sync.Pool
+
+	lock    sync.Mutex
+	stop    chan struct{}
+	servers []*http.Server
+}
+
+// NewGateway compiles the route table in cfg
+func NewGateway(cfg *Config) (*Gateway, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	muxTimeout, _ := parseDuration(cfg.MuxTimeout, defaultMuxTimeout)
+	g := &Gateway{
+		cfg:        cfg,
+		muxTimeout: muxTimeout,
+		pool: sync.Pool{
+			New: func() interface{} {
+				return ctxsvr.NewContext()
+			},
+		},
+		stop: make(chan struct{}),
+	}
+	for _, rc := range cfg.Routes {
+		r, err := newRoute(rc)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: route %s: %v", rc.Name, err)
+		}
+		g.routes = append(g.routes, r)
+	}
+	// most specific first: exact hosts, then wildcard hosts, then any host;
+	// longer prefixes before shorter ones within the same host
+	sort.SliceStable(g.routes, func(i, j int) bool {
+		ri, rj := hostRank(g.routes[i].host), hostRank(g.routes[j].host)
+		if ri != rj {
+			return ri < rj
+		}
+		return len(g.routes[i].prefix) > len(g.routes[j].prefix)
+	})
+	return g, nil
+}
+
+func hostRank(host string) int {
+	switch {
+	case host == "":
+		return 2
+	case host[0] == '*':
+		return 1
+	}
+	return 0
+}
+
+// InsertFilter appends an engine filter to the named route. Filters run in
+// insertion order after the ones built from the route configuration.
+func (g *Gateway) InsertFilter(routeName string, filter websvr.FilterFunc) error {
+	for _, r := range g.routes {
+		if r.name == routeName {
+			r.filters = append(r.filters, filter)
+			return nil
+		}
+	}
+	return fmt.Errorf("proxy: no route named %s", routeName)
+}
+
+// Upstreams returns the upstreams of the named route, mostly for reporting
+func (g *Gateway) Upstreams(routeName string) []*Upstream {
+	for _, r := range g.routes {
+		if r.name == routeName {
+			return r.upstreams
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) match(host, path string) *route {
+	host = normalizeHost(host)
+	for _, r := range g.routes {
+		if r.matchHost(host) && r.matchPath(path) {
+			return r
+		}
+	}
+	return nil
+}
+
+// ServeHTTP implements http.Handler
+func (g *Gateway) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	r := g.match(req.Host, req.URL.Path)
+	if r == nil {
+		http.NotFound(rw, req)
+		return
+	}
+	ctx := g.pool.Get().(*ctxsvr.Context)
+	ctx.Reset(rw, req)
+	defer g.pool.Put(ctx)
+	r.serve(ctx)
+}
+
+// ListenAndServe starts the health checkers and the HTTP and TLS listeners
+// and blocks until one of them fails or the gateway is shut down.
+func (g *Gateway) ListenAndServe() error {
+	for _, r := range g.routes {
+		if r.health != nil {
+			go r.health.run(g.stop)
+		}
+	}
+
+	var listeners []net.Listener
+	closeAll := func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}
+	if g.cfg.Listen != "" {
+		ls, err := g.listenHTTP()
+		listeners = append(listeners, ls...)
+		if err != nil {
+			closeAll()
+			return err
+		}
+	}
+	if g.cfg.TLSListen != "" {
+		ls, err := g.listenTLS()
+		listeners = append(listeners, ls...)
+		if err != nil {
+			closeAll()
+			return err
+		}
+	}
+
+	// every server reports its error once, so none of them blocks after
+	// the first one is received
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		g.serve(l, errs)
+	}
+	if g.cfg.Listen != "" {
+		logs.Info("Bhojpur WebEngine - reverse proxy running on http://%s", g.cfg.Listen)
+	}
+	if g.cfg.TLSListen != "" {
+		logs.Info("Bhojpur WebEngine - reverse proxy running on https://%s", g.cfg.TLSListen)
+	}
+	err := <-errs
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+// listenHTTP returns a listener per host name of the routes, sharing the
+// HTTP listen address
+func (g *Gateway) listenHTTP() ([]net.Listener, error) {
+	l, err := net.Listen("tcp", g.cfg.Listen)
+	if err != nil {
+		return nil, err
+	}
+	mux, err := virtual.NewHTTPMuxer(l, g.muxTimeout)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	go mux.HandleErrors()
+
+	var listeners []net.Listener
+	_, port, _ := net.SplitHostPort(g.cfg.Listen)
+	for _, name := range g.hostNames(false) {
+		names := []string{name}
+		// the Host header carries the port unless it is the default one
+		if port != "" && port != "80" && name != catchAllHost {
+			names = append(names, net.JoinHostPort(name, port))
+		}
+		for _, n := range names {
+			ml, err := mux.Listen(n)
+			if err != nil {
+				mux.Close()
+				return listeners, err
+			}
+			listeners = append(listeners, ml)
+		}
+	}
+	return listeners, nil
+}
+
+// listenTLS returns a TLS listener per host name of the routes with a
+// certificate, sharing the TLS listen address
+func (g *Gateway) listenTLS() ([]net.Listener, error) {
+	l, err := net.Listen("tcp", g.cfg.TLSListen)
+	if err != nil {
+		return nil, err
+	}
+	mux, err := virtual.NewTLSMuxer(l, g.muxTimeout)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	go mux.HandleErrors()
+
+	var listeners []net.Listener
+	for _, name := range g.hostNames(true) {
+		cert, err := g.certificate(name)
+		if err != nil {
+			mux.Close()
+			return listeners, err
+		}
+		ml, err := mux.Listen(name)
+		if err != nil {
+			mux.Close()
+			return listeners, err
+		}
+		listeners = append(listeners, tls.NewListener(ml, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		}))
+	}
+	return listeners, nil
+}
+
+func (g *Gateway) serve(l net.Listener, errs chan<- error) {
+	srv := &http.Server{Handler: g, ErrorLog: logs.GetLogger("PROXY")}
+	g.lock.Lock()
+	g.servers = append(g.servers, srv)
+	g.lock.Unlock()
+	go func() {
+		errs <- srv.Serve(l)
+	}()
+}
+
+// hostNames returns the distinct muxer names of all routes, or only of the
+// routes with a certificate when withTLS is set
+func (g *Gateway) hostNames(withTLS bool) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, rc := range g.cfg.Routes {
+		if withTLS && rc.TLS == nil {
+			continue
+		}
+		name := normalizeHost(rc.Host)
+		if name == "" {
+			name = catchAllHost
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func (g *Gateway) certificate(host string) (tls.Certificate, error) {
+	for _, rc := range g.cfg.Routes {
+		if rc.TLS != nil && normalizeHost(rc.Host) == host {
+			return tls.LoadX509KeyPair(rc.TLS.CertFile, rc.TLS.KeyFile)
+		}
+	}
+	return tls.Certificate{}, fmt.Errorf("proxy: no certificate for %s", host)
+}
+
+// Shutdown stops the health checkers and gracefully shuts down all listeners
+func (g *Gateway) Shutdown(ctx context.Context) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	select {
+	case <-g.stop:
+	default:
+		close(g.stop)
+	}
+	var err error
+	for _, srv := range g.servers {
+		if e := srv.Shutdown(ctx); e != nil {
+			err = e
+		}
+	}
+	return err
+}
@@ -0,0 +1,215 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bhojpur/web/pkg/core/config"
+	_ "github.com/bhojpur/web/pkg/core/config/json"
+)
+
+func newBackend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthcheck" && name == "sick" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(name + " " + r.URL.Path))
+	}))
+}
+
+func doRequest(g *Gateway, host, path string) (int, string) {
+	r := httptest.NewRequest("GET", path, nil)
+	r.Host = host
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	body, _ := ioutil.ReadAll(w.Body)
+	return w.Code, string(body)
+}
+
+func TestParseConfig(t *testing.T) {
+	cnf, err := config.NewConfigData("json", []byte(`{
+  "proxy": {
+    "listen": ":8080",
+    "routes": [{
+      "name": "api",
+      "host": "api.bhojpur.net",
+      "path_prefix": "/v1",
+      "upstreams": ["http://127.0.0.1:9001"],
+      "balance": "least_conn",
+      "rate_limit": {"rate": "1s", "capacity": 10}
+    }]
+  }
+}`))
+	assert.Nil(t, err)
+	cfg, err := ParseConfig(cnf)
+	assert.Nil(t, err)
+	assert.Equal(t, ":8080", cfg.Listen)
+	assert.Equal(t, 1, len(cfg.Routes))
+	assert.Equal(t, "api.bhojpur.net", cfg.Routes[0].Host)
+	assert.Equal(t, BalanceLeastConn, cfg.Routes[0].Balance)
+	assert.Equal(t, uint(10), cfg.Routes[0].RateLimit.Capacity)
+
+	_, err = NewGateway(&Config{Listen: ":80", Routes: []*RouteConfig{{Upstreams: []string{"http://a"}, Balance: "random"}}})
+	assert.NotNil(t, err)
+}
+
+func TestGatewayRouting(t *testing.T) {
+	api, web := newBackend("api"), newBackend("web")
+	defer api.Close()
+	defer web.Close()
+
+	g, err := NewGateway(&Config{Listen: ":80", Routes: []*RouteConfig{
+		{Name: "web", Upstreams: []string{web.URL}},
+		{Name: "api", Host: "*.bhojpur.net", PathPrefix: "/api", StripPrefix: true, Upstreams: []string{api.URL}},
+	}})
+	assert.Nil(t, err)
+
+	code, body := doRequest(g, "svc.bhojpur.net", "/api/users")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "api /users", body)
+
+	_, body = doRequest(g, "svc.bhojpur.net", "/apiary")
+	assert.Equal(t, "web /apiary", body)
+
+	_, body = doRequest(g, "localhost:8080", "/api/users")
+	assert.Equal(t, "web /api/users", body)
+}
+
+func TestGatewayBalancing(t *testing.T) {
+	a, b := newBackend("a"), newBackend("b")
+	defer a.Close()
+	defer b.Close()
+
+	g, err := NewGateway(&Config{Listen: ":80", Routes: []*RouteConfig{
+		{Name: "rr", Upstreams: []string{a.URL, b.URL}},
+	}})
+	assert.Nil(t, err)
+	_, first := doRequest(g, "", "/")
+	_, second := doRequest(g, "", "/")
+	assert.NotEqual(t, first, second)
+
+	ups := g.Upstreams("rr")
+	ups[0].setAlive(false)
+	for i := 0; i < 3; i++ {
+		_, body := doRequest(g, "", "/")
+		assert.Equal(t, "b /", body)
+	}
+	ups[1].setAlive(false)
+	code, _ := doRequest(g, "", "/")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+
+	lc, _ := NewBalancer(BalanceLeastConn)
+	ups[0].setAlive(true)
+	ups[1].setAlive(true)
+	ups[0].active = 3
+	assert.Equal(t, ups[1], lc.Next(ups))
+}
+
+func TestGatewayFilters(t *testing.T) {
+	backend := newBackend("app")
+	defer backend.Close()
+
+	g, err := NewGateway(&Config{Listen: ":80", Routes: []*RouteConfig{{
+		Name:      "private",
+		Upstreams: []string{backend.URL},
+		BasicAuth: &BasicAuthConfig{Username: "bhojpur", Password: "secret"},
+		RateLimit: &RateLimitConfig{Rate: "1h", Capacity: 1},
+	}}})
+	assert.Nil(t, err)
+
+	code, _ := doRequest(g, "", "/")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.SetBasicAuth("bhojpur", "secret")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestHealthCheck(t *testing.T) {
+	good, sick := newBackend("good"), newBackend("sick")
+	defer good.Close()
+	defer sick.Close()
+
+	g, err := NewGateway(&Config{Listen: ":80", Routes: []*RouteConfig{{
+		Name:        "checked",
+		Upstreams:   []string{good.URL, sick.URL},
+		HealthCheck: &HealthCheckConfig{Path: "/healthcheck", UnhealthyThreshold: 1},
+	}}})
+	assert.Nil(t, err)
+
+	g.routes[0].health.checkAll()
+	ups := g.Upstreams("checked")
+	assert.True(t, ups[0].Alive())
+	assert.False(t, ups[1].Alive())
+}
+
+func TestGatewayShutdown(t *testing.T) {
+	backend := newBackend("web")
+	defer backend.Close()
+
+	var routes []*RouteConfig
+	for _, host := range []string{"a.bhojpur.net", "b.bhojpur.net", "c.bhojpur.net", ""} {
+		routes = append(routes, &RouteConfig{Host: host, Upstreams: []string{backend.URL}})
+	}
+	g, err := NewGateway(&Config{Listen: "127.0.0.1:0", Routes: routes})
+	assert.Nil(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- g.ListenAndServe()
+	}()
+	for i := 0; i < 100 && g.serverCount() < 7; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, 7, g.serverCount())
+
+	assert.Nil(t, g.Shutdown(context.Background()))
+	assert.Nil(t, <-done)
+
+	// none of the servers is left blocked on reporting its error
+	serving := func() bool {
+		buf := make([]byte, 1<<20)
+		return strings.Contains(string(buf[:runtime.Stack(buf, true)]), "proxy.(*Gateway).serve.func")
+	}
+	for i := 0; i < 100 && serving(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, serving())
+}
+
+func (g *Gateway) serverCount() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return len(g.servers)
+}
@@ -0,0 +1,132 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	logs "github.com/bhojpur/logger/pkg/engine"
+)
+
+const (
+	defaultHealthInterval  = 10 * time.Second
+	defaultHealthTimeout   = 2 * time.Second
+	defaultHealthThreshold = 2
+)
+
+// healthChecker probes every upstream of a route on a fixed interval and
+// flips its alive state after enough consecutive successes or failures.
+type healthChecker struct {
+	route              string
+	path               string
+	interval           time.Duration
+	healthyThreshold   int
+	unhealthyThreshold int
+	client             *http.Client
+	upstreams          []*Upstream
+	successes          []int
+	failures           []int
+}
+
+func newHealthChecker(route string, cfg *HealthCheckConfig, upstreams []*Upstream) (*healthChecker, error) {
+	interval, err := parseDuration(cfg.Interval, defaultHealthInterval)
+	if err != nil {
+		return nil, err
+	}
+	timeout, err := parseDuration(cfg.Timeout, defaultHealthTimeout)
+	if err != nil {
+		return nil, err
+	}
+	hc := &healthChecker{
+		route:              route,
+		path:               cfg.Path,
+		interval:           interval,
+		healthyThreshold:   cfg.HealthyThreshold,
+		unhealthyThreshold: cfg.UnhealthyThreshold,
+		client:             &http.Client{Timeout: timeout},
+		upstreams:          upstreams,
+		successes:          make([]int, len(upstreams)),
+		failures:           make([]int, len(upstreams)),
+	}
+	if hc.path == "" {
+		hc.path = "/"
+	} else if !strings.HasPrefix(hc.path, "/") {
+		hc.path = "/" + hc.path
+	}
+	if hc.healthyThreshold <= 0 {
+		hc.healthyThreshold = defaultHealthThreshold
+	}
+	if hc.unhealthyThreshold <= 0 {
+		hc.unhealthyThreshold = defaultHealthThreshold
+	}
+	return hc, nil
+}
+
+// run checks all upstreams until stop is closed
+func (hc *healthChecker) run(stop <-chan struct{}) {
+	ticker := time.NewTicker(hc.interval)
+	defer ticker.Stop()
+	hc.checkAll()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			hc.checkAll()
+		}
+	}
+}
+
+func (hc *healthChecker) checkAll() {
+	for i, u := range hc.upstreams {
+		if hc.probe(u) {
+			hc.failures[i] = 0
+			hc.successes[i]++
+			if !u.Alive() && hc.successes[i] >= hc.healthyThreshold {
+				logs.Info("proxy: route %s upstream %s is healthy", hc.route, u.URL)
+				u.setAlive(true)
+			}
+		} else {
+			hc.successes[i] = 0
+			hc.failures[i]++
+			if u.Alive() && hc.failures[i] >= hc.unhealthyThreshold {
+				logs.Warn("proxy: route %s upstream %s is unhealthy", hc.route, u.URL)
+				u.setAlive(false)
+			}
+		}
+	}
+}
+
+func (hc *healthChecker) probe(u *Upstream) bool {
+	target := *u.URL
+	target.Path = strings.TrimSuffix(target.Path, "/") + hc.path
+	resp, err := hc.client.Get(target.String())
+	if err != nil {
+		return false
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 400
+}
@@ -0,0 +1,197 @@
+package proxy
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	ctxsvr "github.com/bhojpur/web/pkg/context"
+	websvr "github.com/bhojpur/web/pkg/engine"
+	"github.com/bhojpur/web/pkg/filter/auth"
+	"github.com/bhojpur/web/pkg/filter/cors"
+	"github.com/bhojpur/web/pkg/filter/ratelimit"
+)
+
+// same defaults as ratelimit.NewLimiter
+const (
+	defaultLimitRate     = 10 * time.Millisecond
+	defaultLimitCapacity = 100
+)
+
+// route is the compiled form of a RouteConfig
+type route struct {
+	name        string
+	host        string
+	prefix      string
+	stripPrefix bool
+	upstreams   []*Upstream
+	balancer    Balancer
+	filters     []websvr.FilterFunc
+	health      *healthChecker
+}
+
+func newRoute(cfg *RouteConfig) (*route, error) {
+	r := &route{
+		name:        cfg.Name,
+		host:        normalizeHost(cfg.Host),
+		prefix:      cfg.PathPrefix,
+		stripPrefix: cfg.StripPrefix,
+	}
+	if r.prefix != "/" {
+		r.prefix = strings.TrimSuffix(r.prefix, "/")
+	}
+	for _, raw := range cfg.Upstreams {
+		u, err := newUpstream(raw)
+		if err != nil {
+			return nil, err
+		}
+		r.upstreams = append(r.upstreams, u)
+	}
+	var err error
+	if r.balancer, err = NewBalancer(cfg.Balance); err != nil {
+		return nil, err
+	}
+	if cfg.HealthCheck != nil {
+		if r.health, err = newHealthChecker(r.name, cfg.HealthCheck, r.upstreams); err != nil {
+			return nil, err
+		}
+	}
+	if r.filters, err = buildFilters(cfg); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// buildFilters turns the filter sections of a route into engine filters.
+// CORS goes first so that preflight requests are answered without
+// credentials, then rate limiting, then authentication.
+func buildFilters(cfg *RouteConfig) ([]websvr.FilterFunc, error) {
+	var filters []websvr.FilterFunc
+	if c := cfg.CORS; c != nil {
+		maxAge, err := parseDuration(c.MaxAge, 0)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, cors.Allow(&cors.Options{
+			AllowAllOrigins:  c.AllowAllOrigins,
+			AllowOrigins:     c.AllowOrigins,
+			AllowCredentials: c.AllowCredentials,
+			AllowMethods:     c.AllowMethods,
+			AllowHeaders:     c.AllowHeaders,
+			ExposeHeaders:    c.ExposeHeaders,
+			MaxAge:           maxAge,
+		}))
+	}
+	if rl := cfg.RateLimit; rl != nil {
+		rate, err := parseDuration(rl.Rate, defaultLimitRate)
+		if err != nil {
+			return nil, err
+		}
+		capacity := rl.Capacity
+		if capacity == 0 {
+			capacity = defaultLimitCapacity
+		}
+		name := cfg.Name
+		sessionKey := func(*ctxsvr.Context) string { return name }
+		if rl.PerIP {
+			sessionKey = ratelimit.RemoteIPSessionKey
+		}
+		filters = append(filters, ratelimit.NewLimiter(
+			ratelimit.WithRate(rate),
+			ratelimit.WithCapacity(capacity),
+			ratelimit.WithSessionKey(sessionKey)))
+	}
+	if ba := cfg.BasicAuth; ba != nil {
+		if ba.Realm == "" {
+			filters = append(filters, auth.Basic(ba.Username, ba.Password))
+		} else {
+			filters = append(filters, auth.NewBasicAuthenticator(func(user, pass string) bool {
+				return user == ba.Username && pass == ba.Password
+			}, ba.Realm))
+		}
+	}
+	return filters, nil
+}
+
+// matchHost reports whether the request host is served by this route
+func (r *route) matchHost(host string) bool {
+	if r.host == "" || r.host == host {
+		return true
+	}
+	if strings.HasPrefix(r.host, "*.") {
+		return strings.HasSuffix(host, r.host[1:])
+	}
+	return false
+}
+
+// matchPath reports whether the request path is below the route prefix
+func (r *route) matchPath(path string) bool {
+	if r.prefix == "/" || path == r.prefix {
+		return true
+	}
+	return strings.HasPrefix(path, r.prefix+"/")
+}
+
+func (r *route) serve(ctx *ctxsvr.Context) {
+	for _, filter := range r.filters {
+		filter(ctx)
+		if ctx.ResponseWriter.Started {
+			return
+		}
+	}
+
+	u := r.balancer.Next(r.upstreams)
+	if u == nil {
+		http.Error(ctx.ResponseWriter, "no healthy upstream", http.StatusServiceUnavailable)
+		return
+	}
+
+	req := ctx.Request
+	if r.stripPrefix && r.prefix != "/" {
+		req.URL.Path = strings.TrimPrefix(req.URL.Path, r.prefix)
+		if !strings.HasPrefix(req.URL.Path, "/") {
+			req.URL.Path = "/" + req.URL.Path
+		}
+		req.URL.RawPath = ""
+	}
+	req.Header.Set("X-Forwarded-Host", req.Host)
+	if req.TLS != nil {
+		req.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		req.Header.Set("X-Forwarded-Proto", "http")
+	}
+
+	atomic.AddInt64(&u.active, 1)
+	defer atomic.AddInt64(&u.active, -1)
+	u.proxy.ServeHTTP(ctx.ResponseWriter, req)
+}
+
+// normalizeHost lower-cases host and drops any port
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,258 @@
+package search
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// skipped elements do not contain readable text
+var skipped = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true,
+	atom.Template: true, atom.Svg: true, atom.Head: true,
+}
+
+// blocks are elements whose text is separated from the text around them
+var blocks = map[atom.Atom]bool{
+	atom.Address: true, atom.Article: true, atom.Aside: true, atom.Blockquote: true,
+	atom.Br: true, atom.Dd: true, atom.Div: true, atom.Dl: true, atom.Dt: true,
+	atom.Figcaption: true, atom.Footer: true, atom.Form: true, atom.H1: true,
+	atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Header: true, atom.Hr: true, atom.Li: true, atom.Main: true, atom.Nav: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true, atom.Section: true, atom.Table: true,
+	atom.Td: true, atom.Th: true, atom.Tr: true, atom.Ul: true,
+}
+
+var headings = map[atom.Atom]bool{
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// AddHTML indexes an HTML page. Pages asking robots not to index them with
+// a meta tag are skipped, AddHTML then returns false.
+func (idx *Index) AddHTML(url string, body []byte) bool {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return false
+	}
+
+	var (
+		title, h1 string
+		heads     []string
+		text      strings.Builder
+		noindex   bool
+	)
+	var walk func(n *html.Node, inHead bool)
+	walk = func(n *html.Node, inHead bool) {
+		if n.Type == html.TextNode {
+			text.WriteString(n.Data)
+			return
+		}
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Title:
+				if title == "" {
+					title = normalizeSpace(textOf(n))
+				}
+			case atom.Meta:
+				if strings.EqualFold(attr(n, "name"), "robots") &&
+					strings.Contains(strings.ToLower(attr(n, "content")), "noindex") {
+					noindex = true
+				}
+			}
+			if headings[n.DataAtom] {
+				h := normalizeSpace(textOf(n))
+				heads = append(heads, h)
+				if n.DataAtom == atom.H1 && h1 == "" {
+					h1 = h
+				}
+			}
+			if skipped[n.DataAtom] {
+				// the head is walked for its title and meta tags only
+				if n.DataAtom == atom.Head {
+					for c := n.FirstChild; c != nil; c = c.NextSibling {
+						if c.Type == html.ElementNode {
+							walk(c, true)
+						}
+					}
+				}
+				return
+			}
+			if inHead {
+				return
+			}
+			if blocks[n.DataAtom] {
+				text.WriteByte(' ')
+				defer text.WriteByte(' ')
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inHead)
+		}
+	}
+	walk(doc, false)
+
+	if noindex {
+		return false
+	}
+	if title == "" {
+		title = h1
+	}
+	idx.Add(url, title, heads, normalizeSpace(text.String()))
+	return true
+}
+
+func textOf(n *html.Node) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+var (
+	mdHeading = regexp.MustCompile(`^\s{0,3}(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdLink    = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	mdTag     = regexp.MustCompile(`<[^>]+>`)
+	mdInline  = regexp.MustCompile("[*`~]+")
+	mdMarkup  = regexp.MustCompile("[|>]+|^\\s*([-+]|\\d+\\.)\\s+")
+	mdFence   = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// AddMarkdown indexes a Markdown document. The title is the title of a YAML
+// front matter or the first level 1 heading.
+func (idx *Index) AddMarkdown(url string, body []byte) {
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	var title string
+	if len(lines) > 0 && strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			line := strings.TrimSpace(lines[i])
+			if line == "---" {
+				lines = lines[i+1:]
+				break
+			}
+			if strings.HasPrefix(line, "title:") {
+				title = strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "title:")), `"'`)
+			}
+		}
+	}
+
+	var heads []string
+	var text strings.Builder
+	for _, line := range lines {
+		if mdFence.MatchString(line) {
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(line); m != nil {
+			h := clean(m[2])
+			heads = append(heads, h)
+			if title == "" && m[1] == "#" {
+				title = h
+			}
+			line = h
+		} else {
+			line = clean(line)
+		}
+		text.WriteString(line)
+		text.WriteByte(' ')
+	}
+	idx.Add(url, title, heads, normalizeSpace(text.String()))
+}
+
+// clean removes inline Markdown and HTML markup
+func clean(s string) string {
+	s = mdLink.ReplaceAllString(s, "$1")
+	s = mdTag.ReplaceAllString(s, " ")
+	s = mdInline.ReplaceAllString(s, "")
+	s = mdMarkup.ReplaceAllString(s, " ")
+	return html.UnescapeString(normalizeSpace(s))
+}
+
+// AddDir indexes the HTML and Markdown files under dir, such as the output
+// of app.GenerateStaticWebsite or a directory of documents. Their URLs are
+// their paths relative to dir appended to baseURL; index.html files stand
+// for their directory. It returns the number of documents indexed.
+func (idx *Index) AddDir(dir, baseURL string) (int, error) {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	var n int
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if file != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext != ".html" && ext != ".htm" && ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		url := "/" + filepath.ToSlash(rel)
+		if path.Base(url) == "index.html" {
+			url = path.Dir(url)
+			if url != "/" {
+				url += "/"
+			}
+		}
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		if ext == ".md" || ext == ".markdown" {
+			idx.AddMarkdown(baseURL+url, body)
+			n++
+		} else if idx.AddHTML(baseURL+url, body) {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
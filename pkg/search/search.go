@@ -0,0 +1,225 @@
+package search
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements a full-text search index for web sites. HTML pages and
+// Markdown documents are reduced to text, tokenized into an inverted index
+// and queried with BM25 ranking; every hit comes with a snippet around the
+// first match. The index has no dependency on the network or the file system
+// layout, so the same package serves a command line tool and a WebAssembly
+// frontend loading a static JSON index.
+// Usage:
+//	import(
+//		"github.com/bhojpur/web/pkg/search"
+//	)
+//
+//	idx := search.NewIndex()
+//	idx.AddHTML("https://bhojpur.net/docs", body)
+//	for _, hit := range idx.Search("reverse proxy", 10) {
+//		fmt.Println(hit.Title, hit.URL, hit.Snippet)
+//	}
+
+import (
+	"math"
+	"sort"
+)
+
+// BM25 parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+)
+
+// Field weights: a term in the title counts as titleWeight occurrences in
+// the text, a term in a heading as headingWeight more
+const (
+	titleWeight   = 3
+	headingWeight = 1
+)
+
+// Document is an indexed page
+type Document struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	// Text is the plain text of the page, kept for snippets
+	Text string `json:"text"`
+	// Length is the number of terms of the text
+	Length int `json:"length"`
+}
+
+// Posting records how often a term occurs in a document, weighted by field
+type Posting struct {
+	Doc  int `json:"d"`
+	Freq int `json:"f"`
+}
+
+// Index is an inverted index of documents. It is not safe for concurrent
+// modification; searching concurrently is safe.
+type Index struct {
+	// Docs holds the documents; removed documents are nil
+	Docs     []*Document          `json:"docs"`
+	Postings map[string][]Posting `json:"postings"`
+
+	byURL map[string]int
+}
+
+// Hit is a search result
+type Hit struct {
+	URL     string  `json:"url"`
+	Title   string  `json:"title"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+	// Highlights are the byte ranges of the matched terms in Snippet
+	Highlights [][2]int `json:"highlights,omitempty"`
+}
+
+// NewIndex returns an empty index
+func NewIndex() *Index {
+	return &Index{Postings: make(map[string][]Posting), byURL: make(map[string]int)}
+}
+
+// Len returns the number of documents in the index
+func (idx *Index) Len() int {
+	return len(idx.byURL)
+}
+
+// Add indexes a document with its headings, replacing a document with the
+// same URL
+func (idx *Index) Add(url, title string, headings []string, text string) {
+	idx.Remove(url)
+
+	freqs := make(map[string]int)
+	terms := Tokenize(text)
+	for _, t := range terms {
+		freqs[t]++
+	}
+	for _, t := range Tokenize(title) {
+		freqs[t] += titleWeight
+	}
+	for _, h := range headings {
+		for _, t := range Tokenize(h) {
+			freqs[t] += headingWeight
+		}
+	}
+
+	id := len(idx.Docs)
+	idx.Docs = append(idx.Docs, &Document{URL: url, Title: title, Text: text, Length: len(terms)})
+	idx.byURL[url] = id
+	for t, f := range freqs {
+		idx.Postings[t] = append(idx.Postings[t], Posting{Doc: id, Freq: f})
+	}
+}
+
+// Remove removes the document with the given URL, if any
+func (idx *Index) Remove(url string) {
+	id, ok := idx.byURL[url]
+	if !ok {
+		return
+	}
+	delete(idx.byURL, url)
+	idx.Docs[id] = nil
+	for t, postings := range idx.Postings {
+		for i, p := range postings {
+			if p.Doc == id {
+				postings = append(postings[:i], postings[i+1:]...)
+				break
+			}
+		}
+		if len(postings) == 0 {
+			delete(idx.Postings, t)
+		} else {
+			idx.Postings[t] = postings
+		}
+	}
+}
+
+// Search returns the documents containing all terms of the query, best
+// first, at most limit of them if limit is positive
+func (idx *Index) Search(query string, limit int) []*Hit {
+	terms := unique(Tokenize(query))
+	if len(terms) == 0 || idx.Len() == 0 {
+		return nil
+	}
+
+	n := float64(idx.Len())
+	var total int
+	for _, d := range idx.Docs {
+		if d != nil {
+			total += d.Length
+		}
+	}
+	avgLen := math.Max(float64(total)/n, 1)
+
+	scores := make(map[int]float64)
+	matched := make(map[int]int)
+	for _, t := range terms {
+		postings := idx.Postings[t]
+		if len(postings) == 0 {
+			// every term must match
+			return nil
+		}
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for _, p := range postings {
+			tf := float64(p.Freq)
+			norm := k1 * (1 - b + b*float64(idx.Docs[p.Doc].Length)/avgLen)
+			scores[p.Doc] += idf * tf * (k1 + 1) / (tf + norm)
+			matched[p.Doc]++
+		}
+	}
+
+	var hits []*Hit
+	ids := make(map[*Hit]int)
+	for id, score := range scores {
+		if matched[id] < len(terms) {
+			continue
+		}
+		d := idx.Docs[id]
+		hit := &Hit{URL: d.URL, Title: d.Title, Score: score}
+		ids[hit] = id
+		hits = append(hits, hit)
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].URL < hits[j].URL
+	})
+	if limit > 0 && len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for _, hit := range hits {
+		hit.Snippet, hit.Highlights = snippet(idx.Docs[ids[hit]].Text, terms)
+	}
+	return hits
+}
+
+func unique(terms []string) []string {
+	seen := make(map[string]bool)
+	var res []string
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	return res
+}
@@ -0,0 +1,145 @@
+package search
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const proxyPage = `<html><head><title>Reverse Proxy</title><script>var proxy = 1;</script></head>
+<body><nav>Home Docs</nav><h1>Proxy</h1><p>The gateway forwards requests to upstream
+servers and balances the load between them.</p><h2>Health checks</h2><p>Unhealthy
+upstreams are taken out of rotation.</p></body></html>`
+
+const routerPage = `<html><head><title>Router</title></head><body><p>Routes map paths to
+controllers. A proxy in front of the router is optional.</p></body></html>`
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"bhojpur", "web", "v1", "2", "serves", "café"},
+		Tokenize("The Bhojpur-Web v1.2 serves a café!"))
+}
+
+func TestSearch(t *testing.T) {
+	idx := NewIndex()
+	assert.True(t, idx.AddHTML("/proxy", []byte(proxyPage)))
+	assert.True(t, idx.AddHTML("/router", []byte(routerPage)))
+	assert.False(t, idx.AddHTML("/secret", []byte(`<meta name="robots" content="noindex"><p>proxy</p>`)))
+	assert.Equal(t, 2, idx.Len())
+
+	hits := idx.Search("Proxy", 10)
+	assert.Equal(t, 2, len(hits))
+	// the title weighs more than a mention in the text
+	assert.Equal(t, "/proxy", hits[0].URL)
+	assert.Equal(t, "Reverse Proxy", hits[0].Title)
+	assert.True(t, hits[0].Score > hits[1].Score)
+
+	// all terms must match
+	hits = idx.Search("proxy router", 10)
+	assert.Equal(t, 1, len(hits))
+	assert.Equal(t, "/router", hits[0].URL)
+	assert.Empty(t, idx.Search("proxy kubernetes", 10))
+	assert.Empty(t, idx.Search("the", 10))
+
+	// scripts are not text
+	hits = idx.Search("var", 10)
+	assert.Empty(t, hits)
+
+	idx.Add("/router", "Router", nil, "replaced")
+	assert.Equal(t, 2, idx.Len())
+	assert.Equal(t, 1, len(idx.Search("proxy", 10)))
+	idx.Remove("/proxy")
+	assert.Equal(t, 1, idx.Len())
+	assert.Empty(t, idx.Search("proxy", 10))
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "the gateway balances load " + strings.Repeat("dolor sit ", 30)
+	s, hl := snippet(text, []string{"load", "gateway"})
+	assert.True(t, strings.HasPrefix(s, "… "))
+	assert.True(t, strings.HasSuffix(s, " …"))
+	assert.True(t, len(s) <= snippetLength+len("… ")+len(" …"))
+	assert.Equal(t, 2, len(hl))
+	assert.Equal(t, "gateway", s[hl[0][0]:hl[0][1]])
+	assert.Equal(t, "load", s[hl[1][0]:hl[1][1]])
+
+	s, hl = snippet("short text", []string{"text"})
+	assert.Equal(t, "short text", s)
+	assert.Equal(t, [][2]int{{6, 10}}, hl)
+}
+
+func TestMarkdown(t *testing.T) {
+	idx := NewIndex()
+	idx.AddMarkdown("/docs/actions", []byte("---\ntitle: \"Actions\"\n---\n# Handling actions\n\n"+
+		"Call `ctx.NewAction` to [dispatch](https://bhojpur.net/dispatch) an **action**.\n\n```go\nctx.Handle(\"x\", fn)\n```\n"))
+	d := idx.Docs[0]
+	assert.Equal(t, "Actions", d.Title)
+	assert.Equal(t, "Handling actions Call ctx.NewAction to dispatch an action. ctx.Handle(\"x\", fn)", d.Text)
+	assert.Equal(t, 1, len(idx.Search("dispatch", 0)))
+}
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	site := filepath.Join(dir, "site")
+	assert.Nil(t, os.MkdirAll(filepath.Join(site, "docs"), 0755))
+	assert.Nil(t, os.MkdirAll(filepath.Join(site, ".git"), 0755))
+	ioutil.WriteFile(filepath.Join(site, "index.html"), []byte(routerPage), 0644)
+	ioutil.WriteFile(filepath.Join(site, "docs", "index.html"), []byte(proxyPage), 0644)
+	ioutil.WriteFile(filepath.Join(site, "docs", "home.md"), []byte("# Home\nWelcome to the proxy docs"), 0644)
+	ioutil.WriteFile(filepath.Join(site, "app.js"), []byte("proxy"), 0644)
+	ioutil.WriteFile(filepath.Join(site, ".git", "x.md"), []byte("proxy"), 0644)
+
+	idx := NewIndex()
+	n, err := idx.AddDir(site, "https://bhojpur.net/")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, n)
+	var urls []string
+	for _, hit := range idx.Search("proxy", 0) {
+		urls = append(urls, hit.URL)
+	}
+	assert.ElementsMatch(t, []string{"https://bhojpur.net/", "https://bhojpur.net/docs/", "https://bhojpur.net/docs/home.md"}, urls)
+
+	idx.Remove("https://bhojpur.net/")
+	file := filepath.Join(dir, "index.gob")
+	assert.Nil(t, idx.Save(file))
+	loaded, err := Load(file)
+	assert.Nil(t, err)
+	assert.Equal(t, idx.Search("proxy", 0), loaded.Search("proxy", 0))
+
+	buf := &bytes.Buffer{}
+	assert.Nil(t, idx.WriteJSON(buf))
+	loaded, err = ReadJSON(buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, loaded.Len())
+	assert.Equal(t, idx.Search("upstream servers", 0), loaded.Search("upstream servers", 0))
+
+	_, err = Load(filepath.Join(site, "index.html"))
+	assert.NotNil(t, err)
+}
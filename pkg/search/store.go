@@ -0,0 +1,120 @@
+package search
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Save writes the index to a file, as gzipped gob
+func (idx *Index) Save(filename string) error {
+	idx.compact()
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	if err := gob.NewEncoder(zw).Encode(idx); err != nil {
+		f.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Load reads an index written by Save
+func Load(filename string) (*Index, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("search: %s is not an index: %v", filename, err)
+	}
+	idx := &Index{}
+	if err := gob.NewDecoder(zr).Decode(idx); err != nil {
+		return nil, fmt.Errorf("search: %s is not an index: %v", filename, err)
+	}
+	idx.init()
+	return idx, nil
+}
+
+// WriteJSON writes the index as a static JSON file, to be loaded with
+// ReadJSON by a frontend searching on the client side
+func (idx *Index) WriteJSON(w io.Writer) error {
+	idx.compact()
+	return json.NewEncoder(w).Encode(idx)
+}
+
+// ReadJSON reads an index written by WriteJSON
+func ReadJSON(r io.Reader) (*Index, error) {
+	idx := &Index{}
+	if err := json.NewDecoder(r).Decode(idx); err != nil {
+		return nil, fmt.Errorf("search: invalid index: %v", err)
+	}
+	idx.init()
+	return idx, nil
+}
+
+func (idx *Index) init() {
+	if idx.Postings == nil {
+		idx.Postings = make(map[string][]Posting)
+	}
+	idx.byURL = make(map[string]int)
+	for id, d := range idx.Docs {
+		if d != nil {
+			idx.byURL[d.URL] = id
+		}
+	}
+}
+
+// compact drops removed documents and renumbers the others
+func (idx *Index) compact() {
+	if len(idx.byURL) == len(idx.Docs) {
+		return
+	}
+	ids := make(map[int]int)
+	var docs []*Document
+	for id, d := range idx.Docs {
+		if d != nil {
+			ids[id] = len(docs)
+			docs = append(docs, d)
+		}
+	}
+	for t, postings := range idx.Postings {
+		for i := range postings {
+			postings[i].Doc = ids[postings[i].Doc]
+		}
+		idx.Postings[t] = postings
+	}
+	idx.Docs = docs
+	idx.init()
+}
@@ -0,0 +1,155 @@
+package search
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// snippetContext is how much text is shown before the first match, and
+// snippetLength the length of a snippet, in bytes
+const (
+	snippetContext = 60
+	snippetLength  = 200
+)
+
+var stopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true,
+	"be": true, "but": true, "by": true, "for": true, "if": true, "in": true,
+	"into": true, "is": true, "it": true, "no": true, "not": true, "of": true,
+	"on": true, "or": true, "such": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "was": true, "will": true, "with": true,
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokens splits text into lower case words and numbers, skipping stop words
+func tokens(text string) []token {
+	var res []token
+	start := -1
+	flush := func(end int) {
+		if start < 0 {
+			return
+		}
+		term := strings.ToLower(text[start:end])
+		if !stopWords[term] {
+			res = append(res, token{term: term, start: start, end: end})
+		}
+		start = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		flush(i)
+	}
+	flush(len(text))
+	return res
+}
+
+// Tokenize returns the terms of text as they are indexed and searched
+func Tokenize(text string) []string {
+	toks := tokens(text)
+	terms := make([]string, len(toks))
+	for i, t := range toks {
+		terms[i] = t.term
+	}
+	return terms
+}
+
+// normalizeSpace collapses runs of white space into single spaces
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// snippet returns a part of text around the first occurrence of one of the
+// terms, and the byte ranges of the terms within it
+func snippet(text string, terms []string) (string, [][2]int) {
+	want := make(map[string]bool)
+	for _, t := range terms {
+		want[t] = true
+	}
+	toks := tokens(text)
+	first := 0
+	for _, t := range toks {
+		if want[t.term] {
+			first = t.start
+			break
+		}
+	}
+
+	start := 0
+	if first > snippetContext {
+		if start = wordStart(text, first-snippetContext); start > first {
+			start = first
+		}
+	}
+	end := len(text)
+	if end-start > snippetLength {
+		end = wordEnd(text, start+snippetLength)
+	}
+
+	var prefix, suffix string
+	if start > 0 {
+		prefix = "… "
+	}
+	if end < len(text) {
+		suffix = " …"
+	}
+	var highlights [][2]int
+	for _, t := range toks {
+		if t.start >= start && t.end <= end && want[t.term] {
+			highlights = append(highlights, [2]int{t.start - start + len(prefix), t.end - start + len(prefix)})
+		}
+	}
+	return prefix + text[start:end] + suffix, highlights
+}
+
+// wordStart moves i forward to the start of the next word
+func wordStart(text string, i int) int {
+	if j := strings.IndexByte(text[i:], ' '); j >= 0 {
+		return i + j + 1
+	}
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// wordEnd moves i back to the end of the previous word
+func wordEnd(text string, i int) int {
+	if j := strings.LastIndexByte(text[:i], ' '); j > 0 {
+		return j
+	}
+	for i > 0 && !utf8.RuneStart(text[i]) {
+		i--
+	}
+	return i
+}
@@ -0,0 +1,354 @@
+package supervisor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	v1 "github.com/bhojpur/web/pkg/api/v1"
+	websvr "github.com/bhojpur/web/pkg/engine"
+)
+
+// maxLogLines is the number of log lines kept for late listeners
+const maxLogLines = 1000
+
+// stopTimeout is how long an engine gets to terminate, for a child process
+// between SIGTERM and SIGKILL
+var stopTimeout = 10 * time.Second
+
+// event is either a status update or a log line of an engine
+type event struct {
+	status *v1.EngineStatus
+	slice  *v1.LogSliceEvent
+}
+
+type engine struct {
+	spec     *EngineSpec
+	specYAML []byte
+
+	mu        sync.Mutex
+	status    *v1.EngineStatus
+	logs      []string
+	listeners map[chan event]struct{}
+	done      chan struct{}
+	stop      func() error
+	stopping  bool
+	// stopTimeout is the stopTimeout when the engine was created
+	stopTimeout time.Duration
+
+	onUpdate func(*v1.EngineStatus)
+}
+
+func newEngine(name string, md *v1.EngineMetadata, spec *EngineSpec, specYAML []byte, onUpdate func(*v1.EngineStatus)) *engine {
+	if md == nil {
+		md = &v1.EngineMetadata{}
+	}
+	md.Created = timestamppb.Now()
+	if md.EngineSpecName == "" {
+		md.EngineSpecName = spec.Name
+	}
+	return &engine{
+		spec:     spec,
+		specYAML: specYAML,
+		status: &v1.EngineStatus{
+			Name:       name,
+			Metadata:   md,
+			Phase:      v1.EnginePhase_PHASE_PREPARING,
+			Conditions: &v1.EngineConditions{CanReplay: true},
+		},
+		listeners: make(map[chan event]struct{}),
+		done:      make(chan struct{}),
+		onUpdate:  onUpdate,
+
+		stopTimeout: stopTimeout,
+	}
+}
+
+// Status returns a copy of the current engine status
+func (e *engine) Status() *v1.EngineStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return proto.Clone(e.status).(*v1.EngineStatus)
+}
+
+func (e *engine) update(fn func(s *v1.EngineStatus)) {
+	e.mu.Lock()
+	fn(e.status)
+	s := proto.Clone(e.status).(*v1.EngineStatus)
+	e.broadcast(event{status: s})
+	e.mu.Unlock()
+	if e.onUpdate != nil {
+		e.onUpdate(s)
+	}
+}
+
+func (e *engine) setPhase(phase v1.EnginePhase, details string) {
+	e.update(func(s *v1.EngineStatus) {
+		s.Phase = phase
+		s.Details = details
+	})
+	e.log(v1.LogSliceType_SLICE_PHASE, phase.String())
+}
+
+func (e *engine) log(tpe v1.LogSliceType, line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tpe == v1.LogSliceType_SLICE_CONTENT {
+		e.logs = append(e.logs, line)
+		if len(e.logs) > maxLogLines {
+			e.logs = e.logs[len(e.logs)-maxLogLines:]
+		}
+	}
+	e.broadcast(event{slice: &v1.LogSliceEvent{Name: e.status.Name, Type: tpe, Payload: line}})
+}
+
+// broadcast must be called with e.mu held. Slow listeners lose events
+// rather than blocking the engine.
+func (e *engine) broadcast(evt event) {
+	for l := range e.listeners {
+		select {
+		case l <- evt:
+		default:
+		}
+	}
+}
+
+// listen registers a listener and returns the log backlog along with it
+func (e *engine) listen() (chan event, []string, func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	l := make(chan event, 256)
+	e.listeners[l] = struct{}{}
+	backlog := append([]string(nil), e.logs...)
+	return l, backlog, func() {
+		e.mu.Lock()
+		delete(e.listeners, l)
+		e.mu.Unlock()
+	}
+}
+
+func (e *engine) finished() bool {
+	select {
+	case <-e.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// run starts the engine once waitUntil has passed
+func (e *engine) run(waitUntil time.Time) {
+	if d := time.Until(waitUntil); d > 0 {
+		e.update(func(s *v1.EngineStatus) {
+			s.Conditions.WaitUntil = timestamppb.New(waitUntil)
+		})
+		e.setPhase(v1.EnginePhase_PHASE_WAITING, "waiting until "+waitUntil.Format(time.RFC3339))
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		stopped := make(chan struct{})
+		if !e.setStop(func() error {
+			close(stopped)
+			return nil
+		}) {
+			e.finish(nil, "stopped before start")
+			return
+		}
+		select {
+		case <-timer.C:
+		case <-stopped:
+		}
+		// a Stop until the engine runs is noticed when it sets its stop
+		if !e.setStop(nil) {
+			e.finish(nil, "stopped before start")
+			return
+		}
+	}
+
+	e.setPhase(v1.EnginePhase_PHASE_STARTING, "")
+	var err error
+	if e.spec.Command != "" {
+		err = e.runProcess()
+	} else {
+		err = e.runApp()
+	}
+	e.finish(err, "")
+}
+
+func (e *engine) finish(err error, details string) {
+	e.update(func(s *v1.EngineStatus) {
+		s.Phase = v1.EnginePhase_PHASE_DONE
+		s.Metadata.Finished = timestamppb.Now()
+		s.Conditions.Success = err == nil
+		if err != nil {
+			s.Conditions.FailureCount++
+			details = err.Error()
+		}
+		s.Details = details
+	})
+	if err != nil {
+		e.log(v1.LogSliceType_SLICE_FAIL, err.Error())
+	} else {
+		e.log(v1.LogSliceType_SLICE_DONE, details)
+	}
+	close(e.done)
+}
+
+func (e *engine) runProcess() error {
+	cmd := exec.Command(e.spec.Command, e.spec.Args...)
+	cmd.Dir = e.spec.Dir
+	cmd.Env = append(os.Environ(), e.spec.Env...)
+	startProcessGroup(cmd)
+	pr, pw := io.Pipe()
+	cmd.Stdout = pw
+	cmd.Stderr = pw
+	if e.isStopping() {
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan struct{})
+	stop := func() error {
+		return terminateProcess(cmd, exited, e.stopTimeout)
+	}
+	if !e.setStop(stop) {
+		// stopped while starting
+		go stop()
+	}
+
+	e.update(func(s *v1.EngineStatus) {
+		s.Phase = v1.EnginePhase_PHASE_RUNNING
+		s.Details = fmt.Sprintf("pid %d", cmd.Process.Pid)
+		s.Conditions.DidExecute = true
+	})
+	e.log(v1.LogSliceType_SLICE_START, e.spec.Command)
+
+	scanned := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(pr)
+		for scanner.Scan() {
+			e.log(v1.LogSliceType_SLICE_CONTENT, scanner.Text())
+		}
+		// keep the child from blocking on a line the scanner gave up on
+		io.Copy(ioutil.Discard, pr)
+		close(scanned)
+	}()
+
+	err := cmd.Wait()
+	close(exited)
+	pw.Close()
+	<-scanned
+	if e.isStopping() {
+		// terminated on request
+		return nil
+	}
+	return err
+}
+
+// setStop sets how the engine is stopped, nil while it cannot be. It
+// reports false when the engine is being stopped already.
+func (e *engine) setStop(stop func() error) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.stopping {
+		return false
+	}
+	e.stop = stop
+	return true
+}
+
+func (e *engine) isStopping() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.stopping
+}
+
+func (e *engine) runApp() error {
+	factory, ok := lookupApp(e.spec.App)
+	if !ok {
+		return fmt.Errorf("supervisor: unknown app %q", e.spec.App)
+	}
+	app := factory(e.spec.Config.apply(websvr.BConfig))
+
+	stopped := make(chan struct{})
+	if !e.setStop(func() error {
+		close(stopped)
+		ctx, cancel := context.WithTimeout(context.Background(), e.stopTimeout)
+		defer cancel()
+		return app.Server.Shutdown(ctx)
+	}) {
+		// stopped while starting
+		return nil
+	}
+
+	e.update(func(s *v1.EngineStatus) {
+		s.Phase = v1.EnginePhase_PHASE_RUNNING
+		s.Details = fmt.Sprintf("%s:%d", app.Cfg.Listen.HTTPAddr, app.Cfg.Listen.HTTPPort)
+		s.Conditions.DidExecute = true
+	})
+	e.log(v1.LogSliceType_SLICE_START, e.spec.App)
+
+	// HttpServer.Run only returns once its listeners are gone
+	app.Run("")
+	select {
+	case <-stopped:
+		return nil
+	default:
+		return fmt.Errorf("supervisor: app %s exited", e.spec.App)
+	}
+}
+
+// Stop asks an engine to terminate and waits until it is done or ctx is.
+// An engine stopped while it starts terminates once it runs.
+func (e *engine) Stop(ctx context.Context) error {
+	e.mu.Lock()
+	stop, stopping := e.stop, e.stopping
+	e.stopping = true
+	e.mu.Unlock()
+	if !stopping && !e.finished() {
+		e.update(func(s *v1.EngineStatus) {
+			s.Phase = v1.EnginePhase_PHASE_CLEANUP
+		})
+		if stop != nil {
+			if err := stop(); err != nil {
+				return err
+			}
+		}
+	}
+	select {
+	case <-e.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
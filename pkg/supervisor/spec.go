@@ -0,0 +1,157 @@
+package supervisor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"gopkg.in/yaml.v2"
+
+	websvr "github.com/bhojpur/web/pkg/engine"
+)
+
+// EngineSpec describes an engine managed by the supervisor. It is the
+// engine_yaml of a StartEngineRequest. Exactly one of App or Command is set.
+//
+//	name: blog
+//	app: blog            # in-process, see RegisterApp
+//	config:
+//	  appname: blog
+//	  runmode: prod
+//	  httpaddr: 127.0.0.1
+//	  httpport: 8081
+//
+//	name: shop
+//	command: ./bin/shop  # child process
+//	args: ["-port", "8082"]
+//	env: ["BHOJPUR_RUNMODE=prod"]
+//	dir: /srv/shop
+type EngineSpec struct {
+	Name    string       `yaml:"name"`
+	App     string       `yaml:"app"`
+	Config  EngineConfig `yaml:"config"`
+	Command string       `yaml:"command"`
+	Args    []string     `yaml:"args"`
+	Env     []string     `yaml:"env"`
+	Dir     string       `yaml:"dir"`
+}
+
+// EngineConfig overrides the websvr.Config of an in-process engine.
+// Zero values keep the defaults of websvr.BConfig.
+type EngineConfig struct {
+	AppName    string `yaml:"appname"`
+	RunMode    string `yaml:"runmode"`
+	ServerName string `yaml:"servername"`
+	HTTPAddr   string `yaml:"httpaddr"`
+	HTTPPort   int    `yaml:"httpport"`
+	EnableGzip bool   `yaml:"enablegzip"`
+}
+
+// ParseEngineSpec parses and validates an engine YAML
+func ParseEngineSpec(data []byte) (*EngineSpec, error) {
+	spec := &EngineSpec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, err
+	}
+	if spec.App == "" && spec.Command == "" {
+		return nil, errors.New("supervisor: engine spec needs either app or command")
+	}
+	if spec.App != "" && spec.Command != "" {
+		return nil, errors.New("supervisor: engine spec cannot have both app and command")
+	}
+	if spec.App != "" {
+		if _, ok := lookupApp(spec.App); !ok {
+			return nil, fmt.Errorf("supervisor: unknown app %q (forgotten RegisterApp?)", spec.App)
+		}
+	}
+	return spec, nil
+}
+
+// apply returns a copy of base with the overrides of c
+func (c EngineConfig) apply(base *websvr.Config) *websvr.Config {
+	cfg := *base
+	if c.AppName != "" {
+		cfg.AppName = c.AppName
+	}
+	if c.RunMode != "" {
+		cfg.RunMode = c.RunMode
+	}
+	if c.ServerName != "" {
+		cfg.ServerName = c.ServerName
+	}
+	if c.HTTPAddr != "" {
+		cfg.Listen.HTTPAddr = c.HTTPAddr
+	}
+	if c.HTTPPort != 0 {
+		cfg.Listen.HTTPPort = c.HTTPPort
+	}
+	if c.EnableGzip {
+		cfg.EnableGzip = true
+	}
+	return &cfg
+}
+
+// AppFactory builds the HttpServer of an in-process engine from its Config.
+// Routes, filters and controllers are registered on the returned server.
+type AppFactory func(cfg *websvr.Config) *websvr.HttpServer
+
+var (
+	appsLock sync.RWMutex
+	apps     = make(map[string]AppFactory)
+)
+
+// RegisterApp makes an application available to in-process engines by the
+// name used in EngineSpec.App.
+// If RegisterApp is called twice with the same name or if factory is nil,
+// it panics.
+func RegisterApp(name string, factory AppFactory) {
+	appsLock.Lock()
+	defer appsLock.Unlock()
+	if factory == nil {
+		panic("supervisor: RegisterApp factory is nil")
+	}
+	if _, ok := apps[name]; ok {
+		panic("supervisor: RegisterApp called twice for app " + name)
+	}
+	apps[name] = factory
+}
+
+// Apps returns the sorted names of the registered applications
+func Apps() []string {
+	appsLock.RLock()
+	defer appsLock.RUnlock()
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupApp(name string) (AppFactory, bool) {
+	appsLock.RLock()
+	defer appsLock.RUnlock()
+	f, ok := apps[name]
+	return f, ok
+}
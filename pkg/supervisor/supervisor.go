@@ -0,0 +1,430 @@
+package supervisor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// It implements the WebService gRPC API as an in-process engine supervisor.
+// Engines are either registered applications running as goroutines with
+// their own websvr.Config, or child processes whose output is captured.
+// Usage:
+//	import(
+//		v1 "github.com/bhojpur/web/pkg/api/v1"
+//		websvr "github.com/bhojpur/web/pkg/engine"
+//		"github.com/bhojpur/web/pkg/supervisor"
+//	)
+//
+//	supervisor.RegisterApp("blog", func(cfg *websvr.Config) *websvr.HttpServer {
+//		app := websvr.NewHttpServerWithCfg(cfg)
+//		app.Router("/", &controllers.MainController{})
+//		return app
+//	})
+//
+//	srv := grpc.NewServer()
+//	v1.RegisterWebServiceServer(srv, supervisor.NewSupervisor())
+//	srv.Serve(lis)
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	v1 "github.com/bhojpur/web/pkg/api/v1"
+)
+
+// Supervisor manages the lifecycle of engines and implements v1.WebServiceServer.
+// StartLocalEngine is not supported.
+type Supervisor struct {
+	v1.UnimplementedWebServiceServer
+
+	mu          sync.RWMutex
+	engines     map[string]*engine
+	subscribers map[chan *v1.EngineStatus]struct{}
+	counter     uint64
+}
+
+// NewSupervisor returns a Supervisor without engines
+func NewSupervisor() *Supervisor {
+	return &Supervisor{
+		engines:     make(map[string]*engine),
+		subscribers: make(map[chan *v1.EngineStatus]struct{}),
+	}
+}
+
+// StartEngine starts a new engine from engine_yaml, or from the spec file
+// at engine_path on the supervisor host.
+func (s *Supervisor) StartEngine(ctx context.Context, req *v1.StartEngineRequest) (*v1.StartEngineResponse, error) {
+	specYAML := req.EngineYaml
+	if len(specYAML) == 0 {
+		if req.EnginePath == "" {
+			return nil, status.Error(codes.InvalidArgument, "either engine_yaml or engine_path is required")
+		}
+		var err error
+		if specYAML, err = ioutil.ReadFile(req.EnginePath); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	spec, err := ParseEngineSpec(specYAML)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	e, err := s.start(req.Metadata, spec, specYAML, req.NameSuffix, req.WaitUntil.AsTime())
+	if err != nil {
+		return nil, err
+	}
+	return &v1.StartEngineResponse{Status: e.Status()}, nil
+}
+
+// StartFromPreviousEngine starts a new engine with the spec of a previous one
+func (s *Supervisor) StartFromPreviousEngine(ctx context.Context, req *v1.StartFromPreviousEngineRequest) (*v1.StartEngineResponse, error) {
+	prev, err := s.get(req.PreviousEngine)
+	if err != nil {
+		return nil, err
+	}
+	st := prev.Status()
+	if !st.Conditions.CanReplay {
+		return nil, status.Errorf(codes.FailedPrecondition, "engine %s cannot be replayed", req.PreviousEngine)
+	}
+	md := st.Metadata
+	md.Created, md.Finished = nil, nil
+	e, err := s.start(md, prev.spec, prev.specYAML, "", req.WaitUntil.AsTime())
+	if err != nil {
+		return nil, err
+	}
+	return &v1.StartEngineResponse{Status: e.Status()}, nil
+}
+
+func (s *Supervisor) start(md *v1.EngineMetadata, spec *EngineSpec, specYAML []byte, suffix string, waitUntil time.Time) (*engine, error) {
+	name := spec.Name
+	if name == "" {
+		name = "engine"
+	}
+	if suffix != "" {
+		name += "." + suffix
+	} else {
+		name = fmt.Sprintf("%s.%d", name, atomic.AddUint64(&s.counter, 1))
+	}
+
+	s.mu.Lock()
+	if _, exists := s.engines[name]; exists {
+		s.mu.Unlock()
+		return nil, status.Errorf(codes.AlreadyExists, "engine %s already exists", name)
+	}
+	e := newEngine(name, md, spec, specYAML, s.publish)
+	s.engines[name] = e
+	s.mu.Unlock()
+
+	go e.run(waitUntil)
+	return e, nil
+}
+
+// ListEngines returns the engines matching the filter, ordered and paginated
+func (s *Supervisor) ListEngines(ctx context.Context, req *v1.ListEnginesRequest) (*v1.ListEnginesResponse, error) {
+	s.mu.RLock()
+	result := make([]*v1.EngineStatus, 0, len(s.engines))
+	for _, e := range s.engines {
+		st := e.Status()
+		if MatchesFilter(st, req.Filter) {
+			result = append(result, st)
+		}
+	}
+	s.mu.RUnlock()
+
+	sortStatus(result, req.Order)
+	total := len(result)
+	start := int(req.Start)
+	if start > total {
+		start = total
+	}
+	result = result[start:]
+	if req.Limit > 0 && int(req.Limit) < len(result) {
+		result = result[:req.Limit]
+	}
+	return &v1.ListEnginesResponse{Total: int32(total), Result: result}, nil
+}
+
+// GetEngine returns the status of a single engine
+func (s *Supervisor) GetEngine(ctx context.Context, req *v1.GetEngineRequest) (*v1.GetEngineResponse, error) {
+	e, err := s.get(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &v1.GetEngineResponse{Result: e.Status()}, nil
+}
+
+// StopEngine stops a waiting or running engine and waits until it is done
+func (s *Supervisor) StopEngine(ctx context.Context, req *v1.StopEngineRequest) (*v1.StopEngineResponse, error) {
+	e, err := s.get(req.Name)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.Stop(ctx); err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &v1.StopEngineResponse{}, nil
+}
+
+// Subscribe streams status updates of all engines matching the filter
+func (s *Supervisor) Subscribe(req *v1.SubscribeRequest, srv v1.WebService_SubscribeServer) error {
+	updates := make(chan *v1.EngineStatus, 256)
+	s.mu.Lock()
+	s.subscribers[updates] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, updates)
+		s.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case st := <-updates:
+			if !MatchesFilter(st, req.Filter) {
+				continue
+			}
+			if err := srv.Send(&v1.SubscribeResponse{Result: st}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Listen streams the status updates and/or log output of a single engine
+// until the engine is done or the client goes away.
+func (s *Supervisor) Listen(req *v1.ListenRequest, srv v1.WebService_ListenServer) error {
+	e, err := s.get(req.Name)
+	if err != nil {
+		return err
+	}
+	events, backlog, unlisten := e.listen()
+	defer unlisten()
+
+	if req.Updates {
+		if err := srv.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Update{Update: e.Status()}}); err != nil {
+			return err
+		}
+	}
+	if req.Logs != v1.ListenRequestLogs_LOGS_DISABLED {
+		for _, line := range backlog {
+			slice := &v1.LogSliceEvent{Name: req.Name, Type: v1.LogSliceType_SLICE_CONTENT, Payload: line}
+			if err := sendSlice(srv, req.Logs, slice); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-srv.Context().Done():
+			return nil
+		case <-e.done:
+			// flush what the engine said on its way out
+			for {
+				select {
+				case evt := <-events:
+					if err := sendEvent(srv, req, evt); err != nil {
+						return err
+					}
+				default:
+					return nil
+				}
+			}
+		case evt := <-events:
+			if err := sendEvent(srv, req, evt); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func sendEvent(srv v1.WebService_ListenServer, req *v1.ListenRequest, evt event) error {
+	if evt.status != nil && req.Updates {
+		return srv.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Update{Update: evt.status}})
+	}
+	if evt.slice != nil && req.Logs != v1.ListenRequestLogs_LOGS_DISABLED {
+		return sendSlice(srv, req.Logs, evt.slice)
+	}
+	return nil
+}
+
+func sendSlice(srv v1.WebService_ListenServer, mode v1.ListenRequestLogs, slice *v1.LogSliceEvent) error {
+	switch mode {
+	case v1.ListenRequestLogs_LOGS_RAW:
+		// raw mode only carries the program output
+		if slice.Type != v1.LogSliceType_SLICE_CONTENT {
+			return nil
+		}
+	case v1.ListenRequestLogs_LOGS_HTML:
+		slice = &v1.LogSliceEvent{Name: slice.Name, Type: slice.Type, Payload: html.EscapeString(slice.Payload)}
+	}
+	return srv.Send(&v1.ListenResponse{Content: &v1.ListenResponse_Slice{Slice: slice}})
+}
+
+// Shutdown stops all engines
+func (s *Supervisor) Shutdown() {
+	s.mu.RLock()
+	engines := make([]*engine, 0, len(s.engines))
+	for _, e := range s.engines {
+		engines = append(engines, e)
+	}
+	s.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, e := range engines {
+		wg.Add(1)
+		go func(e *engine) {
+			defer wg.Done()
+			e.Stop(context.Background())
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (s *Supervisor) get(name string) (*engine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	e, ok := s.engines[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "engine %s not found", name)
+	}
+	return e, nil
+}
+
+// publish fans a status update out to all subscribers
+func (s *Supervisor) publish(st *v1.EngineStatus) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for sub := range s.subscribers {
+		select {
+		case sub <- st:
+		default:
+		}
+	}
+}
+
+// MatchesFilter reports whether st satisfies all filter expressions. An
+// expression is satisfied if any of its terms is.
+// Supported fields are name, phase, owner, trigger, spec, success and
+// annotation.<key>.
+func MatchesFilter(st *v1.EngineStatus, filter []*v1.FilterExpression) bool {
+	for _, expr := range filter {
+		var ok bool
+		for _, term := range expr.Terms {
+			if matchesTerm(st, term) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func matchesTerm(st *v1.EngineStatus, term *v1.FilterTerm) bool {
+	val, exists := statusField(st, term.Field)
+	var res bool
+	switch term.Operation {
+	case v1.FilterOp_OP_EQUALS:
+		res = exists && val == term.Value
+	case v1.FilterOp_OP_STARTS_WITH:
+		res = exists && strings.HasPrefix(val, term.Value)
+	case v1.FilterOp_OP_ENDS_WITH:
+		res = exists && strings.HasSuffix(val, term.Value)
+	case v1.FilterOp_OP_CONTAINS:
+		res = exists && strings.Contains(val, term.Value)
+	case v1.FilterOp_OP_EXISTS:
+		res = exists
+	}
+	if term.Negate {
+		return !res
+	}
+	return res
+}
+
+func statusField(st *v1.EngineStatus, field string) (string, bool) {
+	md := st.Metadata
+	if md == nil {
+		md = &v1.EngineMetadata{}
+	}
+	switch field {
+	case "name":
+		return st.Name, true
+	case "phase":
+		return strings.ToLower(strings.TrimPrefix(st.Phase.String(), "PHASE_")), true
+	case "owner":
+		return md.Owner, md.Owner != ""
+	case "trigger":
+		return strings.ToLower(strings.TrimPrefix(md.Trigger.String(), "TRIGGER_")), true
+	case "spec":
+		return md.EngineSpecName, md.EngineSpecName != ""
+	case "success":
+		return fmt.Sprint(st.Conditions != nil && st.Conditions.Success), true
+	}
+	if key := strings.TrimPrefix(field, "annotation."); key != field {
+		for _, a := range md.Annotations {
+			if a.Key == key {
+				return a.Value, true
+			}
+		}
+	}
+	return "", false
+}
+
+// sortStatus orders by the given fields, or by creation time when none is given
+func sortStatus(result []*v1.EngineStatus, order []*v1.OrderExpression) {
+	if len(order) == 0 {
+		order = []*v1.OrderExpression{{Field: "created", Ascending: true}}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		for _, o := range order {
+			var a, b string
+			if o.Field == "created" {
+				a = result[i].Metadata.GetCreated().AsTime().Format(time.RFC3339Nano)
+				b = result[j].Metadata.GetCreated().AsTime().Format(time.RFC3339Nano)
+			} else {
+				a, _ = statusField(result[i], o.Field)
+				b, _ = statusField(result[j], o.Field)
+			}
+			if a == b {
+				continue
+			}
+			if o.Ascending {
+				return a < b
+			}
+			return a > b
+		}
+		return false
+	})
+}
@@ -0,0 +1,194 @@
+package supervisor
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	v1 "github.com/bhojpur/web/pkg/api/v1"
+	websvr "github.com/bhojpur/web/pkg/engine"
+)
+
+const sleeperSpec = `
+name: sleeper
+command: sh
+args: ["-c", "echo hello; sleep 10"]
+`
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met in time")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestParseEngineSpec(t *testing.T) {
+	spec, err := ParseEngineSpec([]byte(sleeperSpec))
+	assert.Nil(t, err)
+	assert.Equal(t, "sleeper", spec.Name)
+	assert.Equal(t, []string{"-c", "echo hello; sleep 10"}, spec.Args)
+
+	_, err = ParseEngineSpec([]byte("name: empty"))
+	assert.NotNil(t, err)
+	_, err = ParseEngineSpec([]byte("app: unknown"))
+	assert.NotNil(t, err)
+}
+
+func TestRegisterApp(t *testing.T) {
+	if _, ok := lookupApp("registered"); !ok {
+		RegisterApp("registered", func(cfg *websvr.Config) *websvr.HttpServer {
+			return websvr.NewHttpServerWithCfg(cfg)
+		})
+	}
+	assert.Contains(t, Apps(), "registered")
+	spec, err := ParseEngineSpec([]byte("app: registered"))
+	assert.Nil(t, err)
+	assert.Equal(t, "registered", spec.App)
+	assert.Panics(t, func() { RegisterApp("registered", nil) })
+}
+
+func TestEngineLifecycle(t *testing.T) {
+	s := NewSupervisor()
+	ctx := context.Background()
+
+	resp, err := s.StartEngine(ctx, &v1.StartEngineRequest{
+		Metadata:   &v1.EngineMetadata{Owner: "bhojpur"},
+		EngineYaml: []byte(sleeperSpec),
+		NameSuffix: "test",
+	})
+	assert.Nil(t, err)
+	name := resp.Status.Name
+	assert.Equal(t, "sleeper.test", name)
+
+	_, err = s.StartEngine(ctx, &v1.StartEngineRequest{EngineYaml: []byte(sleeperSpec), NameSuffix: "test"})
+	assert.NotNil(t, err)
+
+	e, err := s.get(name)
+	assert.Nil(t, err)
+	waitFor(t, func() bool {
+		_, backlog, cancel := e.listen()
+		cancel()
+		return len(backlog) == 1 && backlog[0] == "hello"
+	})
+
+	list, err := s.ListEngines(ctx, &v1.ListEnginesRequest{Filter: []*v1.FilterExpression{{
+		Terms: []*v1.FilterTerm{{Field: "phase", Value: "running", Operation: v1.FilterOp_OP_EQUALS}},
+	}}})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), list.Total)
+
+	_, err = s.StopEngine(ctx, &v1.StopEngineRequest{Name: name})
+	assert.Nil(t, err)
+	got, err := s.GetEngine(ctx, &v1.GetEngineRequest{Name: name})
+	assert.Nil(t, err)
+	assert.Equal(t, v1.EnginePhase_PHASE_DONE, got.Result.Phase)
+	assert.True(t, got.Result.Conditions.Success)
+
+	_, err = s.GetEngine(ctx, &v1.GetEngineRequest{Name: "missing"})
+	assert.NotNil(t, err)
+}
+
+func TestStopStartingEngine(t *testing.T) {
+	s := NewSupervisor()
+	ctx := context.Background()
+
+	// stops racing the end of the wait still terminate the engines
+	for i := 0; i < 20; i++ {
+		resp, err := s.StartEngine(ctx, &v1.StartEngineRequest{
+			EngineYaml: []byte(sleeperSpec),
+			NameSuffix: "wait" + strconv.Itoa(i),
+			WaitUntil:  timestamppb.New(time.Now().Add(time.Duration(i%4) * time.Millisecond)),
+		})
+		assert.Nil(t, err)
+		time.Sleep(time.Duration(i%3) * time.Millisecond)
+		stopCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		_, err = s.StopEngine(stopCtx, &v1.StopEngineRequest{Name: resp.Status.Name})
+		cancel()
+		assert.Nil(t, err)
+		got, err := s.GetEngine(ctx, &v1.GetEngineRequest{Name: resp.Status.Name})
+		assert.Nil(t, err)
+		assert.Equal(t, v1.EnginePhase_PHASE_DONE, got.Result.Phase)
+	}
+}
+
+func TestStopEngineContext(t *testing.T) {
+	defer func(d time.Duration) { stopTimeout = d }(stopTimeout)
+	stopTimeout = 200 * time.Millisecond
+
+	s := NewSupervisor()
+	ctx := context.Background()
+	resp, err := s.StartEngine(ctx, &v1.StartEngineRequest{EngineYaml: []byte(`
+name: stubborn
+command: sh
+args: ["-c", "trap '' TERM; echo ready; sleep 10"]
+`)})
+	assert.Nil(t, err)
+	e, err := s.get(resp.Status.Name)
+	assert.Nil(t, err)
+	waitFor(t, func() bool {
+		_, backlog, cancel := e.listen()
+		cancel()
+		return len(backlog) == 1
+	})
+
+	// the engine ignores SIGTERM, so the stop outlives the request
+	stopCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = s.StopEngine(stopCtx, &v1.StopEngineRequest{Name: resp.Status.Name})
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+	waitFor(t, e.finished)
+}
+
+func TestMatchesFilter(t *testing.T) {
+	st := &v1.EngineStatus{
+		Name:  "blog.1",
+		Phase: v1.EnginePhase_PHASE_RUNNING,
+		Metadata: &v1.EngineMetadata{
+			Owner:       "bhojpur",
+			Annotations: []*v1.Annotation{{Key: "env", Value: "prod"}},
+		},
+		Conditions: &v1.EngineConditions{},
+	}
+	term := func(field, value string, op v1.FilterOp, negate bool) *v1.FilterExpression {
+		return &v1.FilterExpression{Terms: []*v1.FilterTerm{{Field: field, Value: value, Operation: op, Negate: negate}}}
+	}
+
+	assert.True(t, MatchesFilter(st, nil))
+	assert.True(t, MatchesFilter(st, []*v1.FilterExpression{term("name", "blog", v1.FilterOp_OP_STARTS_WITH, false)}))
+	assert.True(t, MatchesFilter(st, []*v1.FilterExpression{term("annotation.env", "prod", v1.FilterOp_OP_EQUALS, false)}))
+	assert.False(t, MatchesFilter(st, []*v1.FilterExpression{term("annotation.team", "", v1.FilterOp_OP_EXISTS, false)}))
+	assert.True(t, MatchesFilter(st, []*v1.FilterExpression{term("success", "true", v1.FilterOp_OP_EQUALS, true)}))
+	assert.False(t, MatchesFilter(st, []*v1.FilterExpression{
+		term("owner", "bhojpur", v1.FilterOp_OP_EQUALS, false),
+		term("phase", "done", v1.FilterOp_OP_EQUALS, false),
+	}))
+}
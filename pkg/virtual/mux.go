@@ -195,6 +195,10 @@ func (m *VirtualHostMuxer) get(name string) (l *Listener, ok bool) {
 			}
 		}
 	}
+	if !ok {
+		// fall back to the catch-all listener, if any
+		l, ok = m.registry["*"]
+	}
 	return
 }
 
@@ -180,6 +180,8 @@ func TestMuxingPatterns(t *testing.T) {
 		{"sub.bhojpur.net", "sub.bhojpur.net"},
 		{"*.bhojpur.net", "sub.bhojpur.net"},
 		{"*.bhojpur.net", "nested.sub.bhojpur.net"},
+		{"*", "bhojpur.net"},
+		{"*", "localhost"},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,509 @@
+package websocket
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHubClosed is returned when a connection is registered with, or a message
+// is sent through, a hub that has been shut down.
+var ErrHubClosed = errors.New("websocket: hub closed")
+
+// ErrConnClosed is returned when a message is queued on a hub connection that
+// has been closed.
+var ErrConnClosed = errors.New("websocket: connection closed")
+
+// DropPolicy decides what a hub does when a connection's send queue is full.
+type DropPolicy int
+
+const (
+	// DropNewest discards the message being queued.
+	DropNewest DropPolicy = iota
+	// DropOldest discards the oldest queued message to make room.
+	DropOldest
+	// CloseSlow closes the connection with CloseTryAgainLater.
+	CloseSlow
+)
+
+// HubOption configures a Hub.
+type HubOption func(*Hub)
+
+// WithSendQueue sets the number of messages queued per connection. The
+// default is 64.
+func WithSendQueue(size int) HubOption {
+	return func(h *Hub) {
+		if size > 0 {
+			h.queueSize = size
+		}
+	}
+}
+
+// WithDropPolicy sets what happens when a connection's send queue is full.
+// The default is DropNewest.
+func WithDropPolicy(p DropPolicy) HubOption {
+	return func(h *Hub) {
+		h.policy = p
+	}
+}
+
+// WithPingInterval sets how often connections are pinged. A connection that
+// has not answered within twice the interval is closed. The default is 30
+// seconds; zero disables pings and read deadlines.
+func WithPingInterval(d time.Duration) HubOption {
+	return func(h *Hub) {
+		h.pingInterval = d
+	}
+}
+
+// WithWriteTimeout sets the deadline for writing a single message. The
+// default is 10 seconds.
+func WithWriteTimeout(d time.Duration) HubOption {
+	return func(h *Hub) {
+		if d > 0 {
+			h.writeTimeout = d
+		}
+	}
+}
+
+// WithReadLimit sets the maximum size of a message read from a connection.
+func WithReadLimit(limit int64) HubOption {
+	return func(h *Hub) {
+		h.readLimit = limit
+	}
+}
+
+// Hub is a registry of websocket connections grouped into rooms. Messages
+// broadcast through a hub are prepared once and written to every member by
+// the connection's own writer, so a slow peer never blocks the others.
+type Hub struct {
+	queueSize    int
+	policy       DropPolicy
+	pingInterval time.Duration
+	writeTimeout time.Duration
+	readLimit    int64
+
+	mu     sync.RWMutex
+	conns  map[*HubConn]struct{}
+	rooms  map[string]map[*HubConn]struct{}
+	closed bool
+	empty  chan struct{}
+}
+
+// NewHub returns an empty hub.
+func NewHub(opts ...HubOption) *Hub {
+	h := &Hub{
+		queueSize:    64,
+		policy:       DropNewest,
+		pingInterval: 30 * time.Second,
+		writeTimeout: 10 * time.Second,
+		conns:        make(map[*HubConn]struct{}),
+		rooms:        make(map[string]map[*HubConn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// HubConn is a connection registered with a Hub. Messages must be written
+// through Send so that they go through the connection's send queue; the
+// embedded Conn's read methods must not be used while Run is reading.
+type HubConn struct {
+	*Conn
+	hub *Hub
+
+	mu      sync.Mutex
+	send    chan *PreparedMessage
+	rooms   map[string]struct{}
+	closed  bool
+	code    int
+	text    string
+	dropped uint64
+	done    chan struct{}
+}
+
+// Register adds conn to the hub and starts its writer.
+func (h *Hub) Register(conn *Conn) (*HubConn, error) {
+	c := &HubConn{
+		Conn:  conn,
+		hub:   h,
+		send:  make(chan *PreparedMessage, h.queueSize),
+		rooms: make(map[string]struct{}),
+		code:  CloseNormalClosure,
+		done:  make(chan struct{}),
+	}
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil, ErrHubClosed
+	}
+	h.conns[c] = struct{}{}
+	h.mu.Unlock()
+
+	go c.writer()
+	return c, nil
+}
+
+// Serve registers conn, joins it to rooms and reads from it until it is
+// closed, passing every data message to onMessage. It closes conn before it
+// returns.
+func (h *Hub) Serve(conn *Conn, onMessage func(c *HubConn, messageType int, data []byte), rooms ...string) error {
+	c, err := h.Register(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	for _, room := range rooms {
+		c.Join(room)
+	}
+	return c.Run(onMessage)
+}
+
+// Broadcast sends a message to every member of room, or to every connection
+// of the hub when room is empty.
+func (h *Hub) Broadcast(room string, messageType int, data []byte) error {
+	pm, err := NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	return h.BroadcastPrepared(room, pm)
+}
+
+// BroadcastPrepared sends pm to every member of room, or to every connection
+// of the hub when room is empty.
+func (h *Hub) BroadcastPrepared(room string, pm *PreparedMessage) error {
+	h.mu.RLock()
+	if h.closed {
+		h.mu.RUnlock()
+		return ErrHubClosed
+	}
+	members := h.conns
+	if room != "" {
+		members = h.rooms[room]
+	}
+	targets := make([]*HubConn, 0, len(members))
+	for c := range members {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		c.enqueue(pm)
+	}
+	return nil
+}
+
+// Rooms returns the names of the rooms with at least one member.
+func (h *Hub) Rooms() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]string, 0, len(h.rooms))
+	for room := range h.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Len returns the number of members of room, or the number of connections of
+// the hub when room is empty.
+func (h *Hub) Len(room string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if room == "" {
+		return len(h.conns)
+	}
+	return len(h.rooms[room])
+}
+
+// Shutdown closes every connection with CloseGoingAway after its queued
+// messages have been written and waits for the peers to acknowledge. When
+// ctx is done first the remaining connections are closed without waiting.
+// The hub refuses new connections afterwards.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	h.mu.Lock()
+	h.closed = true
+	conns := make([]*HubConn, 0, len(h.conns))
+	for c := range h.conns {
+		conns = append(conns, c)
+	}
+	if len(conns) == 0 {
+		h.mu.Unlock()
+		return nil
+	}
+	if h.empty == nil {
+		h.empty = make(chan struct{})
+	}
+	empty := h.empty
+	h.mu.Unlock()
+
+	for _, c := range conns {
+		c.CloseWith(CloseGoingAway, "server shutdown")
+	}
+
+	select {
+	case <-empty:
+		return nil
+	case <-ctx.Done():
+		for _, c := range conns {
+			c.Conn.Close()
+		}
+		return ctx.Err()
+	}
+}
+
+func (h *Hub) remove(c *HubConn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.conns, c)
+	for room := range c.rooms {
+		h.leave(c, room)
+	}
+	if h.closed && len(h.conns) == 0 && h.empty != nil {
+		close(h.empty)
+		h.empty = nil
+	}
+}
+
+// leave removes c from room; the caller holds h.mu.
+func (h *Hub) leave(c *HubConn, room string) {
+	members := h.rooms[room]
+	delete(members, c)
+	if len(members) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// Join adds the connection to room.
+func (c *HubConn) Join(room string) {
+	h := c.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.conns[c]; !ok {
+		return
+	}
+	members, ok := h.rooms[room]
+	if !ok {
+		members = make(map[*HubConn]struct{})
+		h.rooms[room] = members
+	}
+	members[c] = struct{}{}
+	c.rooms[room] = struct{}{}
+}
+
+// Leave removes the connection from room.
+func (c *HubConn) Leave(room string) {
+	h := c.hub
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := c.rooms[room]; !ok {
+		return
+	}
+	delete(c.rooms, room)
+	h.leave(c, room)
+}
+
+// Rooms returns the rooms the connection has joined.
+func (c *HubConn) Rooms() []string {
+	h := c.hub
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	rooms := make([]string, 0, len(c.rooms))
+	for room := range c.rooms {
+		rooms = append(rooms, room)
+	}
+	return rooms
+}
+
+// Send queues a message for the connection.
+func (c *HubConn) Send(messageType int, data []byte) error {
+	pm, err := NewPreparedMessage(messageType, data)
+	if err != nil {
+		return err
+	}
+	return c.SendPrepared(pm)
+}
+
+// SendPrepared queues pm for the connection.
+func (c *HubConn) SendPrepared(pm *PreparedMessage) error {
+	if !c.enqueue(pm) {
+		return ErrConnClosed
+	}
+	return nil
+}
+
+// Dropped returns the number of messages discarded because the send queue
+// was full.
+func (c *HubConn) Dropped() uint64 {
+	return atomic.LoadUint64(&c.dropped)
+}
+
+// Close closes the connection with CloseNormalClosure once the queued
+// messages have been written.
+func (c *HubConn) Close() error {
+	c.CloseWith(CloseNormalClosure, "")
+	return nil
+}
+
+// CloseWith closes the connection with the given close code and text once
+// the queued messages have been written.
+func (c *HubConn) CloseWith(code int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeLocked(code, text)
+}
+
+func (c *HubConn) closeLocked(code int, text string) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.code, c.text = code, text
+	close(c.send)
+}
+
+// enqueue reports whether pm was accepted for the connection.
+func (c *HubConn) enqueue(pm *PreparedMessage) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return false
+	}
+	select {
+	case c.send <- pm:
+		return true
+	default:
+	}
+
+	switch c.hub.policy {
+	case DropOldest:
+		select {
+		case <-c.send:
+			atomic.AddUint64(&c.dropped, 1)
+		default:
+		}
+		c.send <- pm
+		return true
+	case CloseSlow:
+		c.closeLocked(CloseTryAgainLater, "send queue full")
+		return false
+	default:
+		atomic.AddUint64(&c.dropped, 1)
+		return true
+	}
+}
+
+// Run reads from the connection until it is closed, passing every data
+// message to onMessage, then removes the connection from the hub and closes
+// it. A normal close by either side is not reported as an error.
+func (c *HubConn) Run(onMessage func(c *HubConn, messageType int, data []byte)) error {
+	h := c.hub
+	if h.readLimit > 0 {
+		c.Conn.SetReadLimit(h.readLimit)
+	}
+	if h.pingInterval > 0 {
+		wait := 2 * h.pingInterval
+		c.Conn.SetReadDeadline(time.Now().Add(wait))
+		c.Conn.SetPongHandler(func(string) error {
+			return c.Conn.SetReadDeadline(time.Now().Add(wait))
+		})
+	}
+
+	var err error
+	for {
+		var (
+			messageType int
+			data        []byte
+		)
+		messageType, data, err = c.Conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		if onMessage != nil {
+			onMessage(c, messageType, data)
+		}
+	}
+
+	h.remove(c)
+	c.CloseWith(CloseNormalClosure, "")
+	<-c.done
+	c.Conn.Close()
+
+	if IsCloseError(err, CloseNormalClosure, CloseGoingAway, CloseNoStatusReceived) {
+		return nil
+	}
+	return err
+}
+
+// writer is the only goroutine writing data messages to the connection.
+func (c *HubConn) writer() {
+	defer close(c.done)
+
+	var tick <-chan time.Time
+	if c.hub.pingInterval > 0 {
+		ticker := time.NewTicker(c.hub.pingInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case pm, ok := <-c.send:
+			if !ok {
+				c.mu.Lock()
+				code, text := c.code, c.text
+				c.mu.Unlock()
+				deadline := time.Now().Add(c.hub.writeTimeout)
+				c.Conn.WriteControl(CloseMessage, FormatCloseMessage(code, text), deadline)
+				// Give the peer until the deadline to acknowledge the close.
+				c.Conn.SetReadDeadline(deadline)
+				return
+			}
+			c.Conn.SetWriteDeadline(time.Now().Add(c.hub.writeTimeout))
+			if err := c.Conn.WritePreparedMessage(pm); err != nil {
+				c.Conn.Close()
+				c.drain()
+				return
+			}
+		case <-tick:
+			if err := c.Conn.WriteControl(PingMessage, nil, time.Now().Add(c.hub.writeTimeout)); err != nil {
+				c.Conn.Close()
+				c.drain()
+				return
+			}
+		}
+	}
+}
+
+// drain marks the connection closed after a write failure so that senders
+// stop queueing messages for it.
+func (c *HubConn) drain() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
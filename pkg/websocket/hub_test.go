@@ -0,0 +1,142 @@
+package websocket
+
+// Copyright (c) 2018 Bhojpur Consulting Private Limited, India. All rights reserved.
+
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newHubServer(t *testing.T, h *Hub) (*httptest.Server, string) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := cstUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		h.Serve(conn, func(c *HubConn, messageType int, data []byte) {
+			h.Broadcast(r.URL.Query().Get("room"), messageType, data)
+		}, r.URL.Query().Get("room"))
+	}))
+	return s, "ws" + strings.TrimPrefix(s.URL, "http")
+}
+
+func dialHub(t *testing.T, h *Hub, url string, want int) *Conn {
+	conn, _, err := cstDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for h.Len("") < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	return conn
+}
+
+func TestHubBroadcastRooms(t *testing.T) {
+	h := NewHub()
+	s, url := newHubServer(t, h)
+	defer s.Close()
+
+	a := dialHub(t, h, url+"?room=a", 1)
+	defer a.Close()
+	b := dialHub(t, h, url+"?room=a", 2)
+	defer b.Close()
+	other := dialHub(t, h, url+"?room=b", 3)
+	defer other.Close()
+
+	if n := h.Len("a"); n != 2 {
+		t.Fatalf("room a has %d members, want 2", n)
+	}
+	if err := a.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, conn := range []*Conn{a, b} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, p, err := conn.ReadMessage()
+		if err != nil || string(p) != "hello" {
+			t.Fatalf("got %q, %v; want hello", p, err)
+		}
+	}
+
+	other.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, p, err := other.ReadMessage(); err == nil {
+		t.Fatalf("member of room b received %q", p)
+	}
+}
+
+func TestHubShutdown(t *testing.T) {
+	h := NewHub()
+	s, url := newHubServer(t, h)
+	defer s.Close()
+
+	conn := dialHub(t, h, url, 1)
+	defer conn.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		done <- h.Shutdown(ctx)
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err := conn.ReadMessage()
+	if !IsCloseError(err, CloseGoingAway) {
+		t.Fatalf("read error %v, want close going away", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Shutdown returned %v", err)
+	}
+	if n := h.Len(""); n != 0 {
+		t.Fatalf("hub has %d connections after shutdown", n)
+	}
+	if _, err := h.Register(conn); err != ErrHubClosed {
+		t.Fatalf("Register after shutdown returned %v, want ErrHubClosed", err)
+	}
+}
+
+func TestHubDropPolicy(t *testing.T) {
+	pm, _ := NewPreparedMessage(TextMessage, []byte("x"))
+	for _, tt := range []struct {
+		policy   DropPolicy
+		accepted bool
+		closed   bool
+		dropped  uint64
+	}{
+		{DropNewest, true, false, 1},
+		{DropOldest, true, false, 1},
+		{CloseSlow, false, true, 0},
+	} {
+		h := NewHub(WithSendQueue(1), WithDropPolicy(tt.policy))
+		c := &HubConn{hub: h, send: make(chan *PreparedMessage, 1)}
+		c.enqueue(pm)
+		if got := c.enqueue(pm); got != tt.accepted {
+			t.Errorf("policy %d: accepted %v, want %v", tt.policy, got, tt.accepted)
+		}
+		if c.closed != tt.closed || c.Dropped() != tt.dropped {
+			t.Errorf("policy %d: closed %v dropped %d, want %v %d", tt.policy, c.closed, c.Dropped(), tt.closed, tt.dropped)
+		}
+	}
+}
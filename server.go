@@ -26,7 +26,9 @@ package main
 import (
 	cmd "github.com/bhojpur/web/cmd/server"
 
+	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )
 